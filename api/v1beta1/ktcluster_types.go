@@ -17,9 +17,17 @@ limitations under the License.
 package v1beta1
 
 import (
+	"net"
+	"slices"
+	"strconv"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// ControlPlaneInitMachineAnnotation is set on a KTCluster to the name of the control plane
+// KTMachine that runs kubeadm init. All other machines of the cluster join it.
+const ControlPlaneInitMachineAnnotation = "infrastructure.dcnlab.ssu.ac.kr/control-plane-init-machine"
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
@@ -31,13 +39,143 @@ type KTClusterSpec struct {
 	APIServerLoadBalancer             APIServerLoadBalancer `json:"apiServerLoadBalancer,omitempty"`
 	ControlPlaneExternalNetworkEnable bool                  `json:"controlPlaneExternalNetworkEnable,omitempty"`
 	IdentityRef                       IdentityRef           `json:"identityRef,omitempty"`
-	ManagedSecurityGroups             ManagedSecurityGroups `json:"managedSecurityGroups,omitempty"`
-	ManagedSubnets                    []ManagedSubnet       `json:"managedSubnets,omitempty"`
+	// ManagedSecurityGroups creates a control plane and a worker security group for the cluster that
+	// machines are attached to when they are created. Without it, machines get the default security group.
+	// +optional
+	ManagedSecurityGroups *ManagedSecurityGroups `json:"managedSecurityGroups,omitempty"`
+	ManagedSubnets        []ManagedSubnet        `json:"managedSubnets,omitempty"`
+
+	// ExternalFirewall configures the firewall rules that open the public IPs of the control planes
+	// when ControlPlaneExternalNetworkEnable is set.
+	// +optional
+	ExternalFirewall ExternalFirewall `json:"externalFirewall,omitempty"`
+
+	// ControlPlaneEndpoint is where clients outside KT Cloud reach the API server, for example an API
+	// server load balancer. When empty the public IP of the first control plane machine is used.
+	// +optional
+	ControlPlaneEndpoint APIEndpoint `json:"controlPlaneEndpoint,omitempty"`
+
+	// PublicIPPool restricts the public IPs the operator claims for the cluster. When empty new public
+	// IPs are allocated for the control planes.
+	// +optional
+	PublicIPPool PublicIPPool `json:"publicIPPool,omitempty"`
+
+	// PortForwarding shares one public IP between the control planes with port forwarding instead of
+	// binding a public IP to each of them with static NAT.
+	// +optional
+	PortForwarding PortForwarding `json:"portForwarding,omitempty"`
+}
+
+// PortForwarding configures the public IP shared by the control planes of a cluster. It is claimed by
+// the KTPublicNetwork <cluster>-control-plane-public-ip, owned by the KTCluster.
+type PortForwarding struct {
+	Enabled bool `json:"enabled"`
+
+	// APIServerBasePort is the public port forwarded to the API server of the first control plane. The
+	// next control planes get the following free ports. Defaults to 6443.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	APIServerBasePort int32 `json:"apiServerBasePort,omitempty"`
+}
+
+// PublicIPPool is the set of existing public IPs a cluster may use. Public IPs in the pool are adopted,
+// never allocated or released, and a public IP outside of it is never touched.
+type PublicIPPool struct {
+	// IDs of public IPs in the pool.
+	// +optional
+	IDs []string `json:"ids,omitempty"`
+
+	// CIDRs whose public IPs are in the pool.
+	// +optional
+	CIDRs []string `json:"cidrs,omitempty"`
+
+	// ControlPlaneEndpointIP is the public IP the first control plane is bound to, for example the one
+	// DNS records point to. It is kept for this machine and does not have to be in IDs or CIDRs.
+	// +optional
+	ControlPlaneEndpointIP string `json:"controlPlaneEndpointIP,omitempty"`
+}
+
+// IsZero returns true when the pool is not set.
+func (p PublicIPPool) IsZero() bool {
+	return len(p.IDs) == 0 && len(p.CIDRs) == 0 && p.ControlPlaneEndpointIP == ""
+}
+
+// Contains returns true when the public IP with the given ID and address is in the pool.
+// Invalid CIDRs match nothing.
+func (p PublicIPPool) Contains(id, ip string) bool {
+	if slices.Contains(p.IDs, id) {
+		return true
+	}
+	address := net.ParseIP(ip)
+	for _, cidr := range p.CIDRs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && address != nil && network.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExternalFirewall configures the firewall rules created for the public IPs of control planes. A rule
+// for the API server port is always created, as a KTNetworkFirewall owned by the KTMachine.
+type ExternalFirewall struct {
+	// ExternalNetworkID is the ID of the external network of the VPC the rules allow traffic from.
+	// No rules are created without it.
+	// +optional
+	ExternalNetworkID string `json:"externalNetworkID,omitempty"`
+
+	// ExtraPorts are opened in addition to the API server port, for example the NodePort range.
+	// +optional
+	ExtraPorts []FirewallPort `json:"extraPorts,omitempty"`
+}
+
+// FirewallPort is a port range opened on the public IPs of control planes.
+type FirewallPort struct {
+	// Name is appended to the name of the KTNetworkFirewall created for the port range.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	StartPort int32 `json:"startPort"`
+
+	// EndPort defaults to StartPort.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	EndPort int32 `json:"endPort,omitempty"`
+
+	// Protocol is the IP protocol number, defaults to 6 (TCP).
+	// +optional
+	Protocol int `json:"protocol,omitempty"`
 }
 
-// APIServerLoadBalancer represents the API server load balancer settings
+// APIEndpoint is the address of an API server.
+type APIEndpoint struct {
+	Host string `json:"host"`
+	Port int32  `json:"port"`
+}
+
+// IsZero returns true when the endpoint is not set.
+func (e APIEndpoint) IsZero() bool {
+	return e.Host == "" && e.Port == 0
+}
+
+// String returns the endpoint as host:port.
+func (e APIEndpoint) String() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(int(e.Port)))
+}
+
+// APIServerLoadBalancer represents the API server load balancer settings.
+// When enabled a load balancer <cluster>-apiserver with a health-checked listener on the API server
+// port balances to the control plane machines, and its IP is the control plane endpoint.
 type APIServerLoadBalancer struct {
 	Enabled bool `json:"enabled"`
+
+	// NetworkID is the tier network the load balancer listens on. Defaults to the first network tier
+	// of the control plane machine template.
+	// +optional
+	NetworkID string `json:"networkID,omitempty"`
 }
 
 // ExternalNetwork represents the external network configuration
@@ -45,30 +183,47 @@ type APIServerLoadBalancer struct {
 // 	ID string `json:"id"`
 // }
 
-// IdentityRef holds the identity reference for OpenStack
+// IdentityRef holds the identity reference for KT Cloud.
+// Name is a Secret in the KTCluster namespace holding the keys username, password
+// and optionally domain, project and zone. CloudName is only informational.
 type IdentityRef struct {
 	CloudName string `json:"cloudName,omitempty"`
 	Name      string `json:"name,omitempty"`
 }
 
-// ManagedSecurityGroups contains security group rules for nodes
+// ManagedSecurityGroups contains security group rules for nodes. The rules Kubernetes requires
+// between the nodes are always added.
 type ManagedSecurityGroups struct {
+	// AllNodesSecurityGroupRules are added to both the control plane and the worker security group.
 	AllNodesSecurityGroupRules []SecurityGroupRule `json:"allNodesSecurityGroupRules,omitempty"`
 }
 
 // SecurityGroupRule represents individual security group rules
 type SecurityGroupRule struct {
-	Description         string   `json:"description,omitempty"`
-	Direction           string   `json:"direction,omitempty"`
-	EtherType           string   `json:"etherType,omitempty"`
-	Name                string   `json:"name,omitempty"`
-	PortRangeMin        int      `json:"portRangeMin,omitempty"`
-	PortRangeMax        int      `json:"portRangeMax,omitempty"`
-	Protocol            string   `json:"protocol,omitempty"`
+	Description string `json:"description,omitempty"`
+	// +kubebuilder:validation:Enum=ingress;egress
+	Direction string `json:"direction,omitempty"`
+	// +kubebuilder:validation:Enum=IPv4;IPv6
+	EtherType    string `json:"etherType,omitempty"`
+	Name         string `json:"name,omitempty"`
+	PortRangeMin int    `json:"portRangeMin,omitempty"`
+	PortRangeMax int    `json:"portRangeMax,omitempty"`
+	Protocol     string `json:"protocol,omitempty"`
+	// RemoteManagedGroups limits the rule to traffic from the managed security groups with these
+	// names, controlplane or worker. Without them the rule matches traffic from anywhere.
 	RemoteManagedGroups []string `json:"remoteManagedGroups,omitempty"`
 }
 
-// ManagedSubnet defines a subnet with CIDR and DNS settings
+const (
+	// ControlPlaneSecurityGroup is the name of the managed security group of the control planes.
+	ControlPlaneSecurityGroup = "controlplane"
+
+	// WorkerSecurityGroup is the name of the managed security group of the workers.
+	WorkerSecurityGroup = "worker"
+)
+
+// ManagedSubnet defines a subnet with CIDR and DNS settings. A tier network is created for it,
+// or an existing tier network with the same CIDR is adopted.
 type ManagedSubnet struct {
 	CIDR           string   `json:"cidr,omitempty"`
 	DNSNameServers []string `json:"dnsNameservers,omitempty"`
@@ -78,10 +233,155 @@ type ManagedSubnet struct {
 type KTClusterStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// Ready is true once the subject token of the cluster is valid and every resource the cluster
+	// manages on KT Cloud is provisioned.
+	// +optional
+	Ready bool `json:"ready"`
+
+	// ControlPlaneEndpoint is where the API server of the cluster is reached: the configured endpoint,
+	// the IP of the API server load balancer when it is enabled, otherwise the control plane endpoint IP
+	// of the public IP pool or the public IP of the first control plane.
+	// +optional
+	ControlPlaneEndpoint APIEndpoint `json:"controlPlaneEndpoint,omitempty"`
+
+	// FailureDomains are the availability zones of the zone of the cluster machines can be created in.
+	// +optional
+	FailureDomains FailureDomains `json:"failureDomains,omitempty"`
+
+	// FailureReason is set when the cluster cannot be reconciled without changing its spec.
+	// +optional
+	FailureReason *string `json:"failureReason,omitempty"`
+
+	// FailureMessage explains FailureReason.
+	// +optional
+	FailureMessage *string `json:"failureMessage,omitempty"`
+
+	// LoadBalancer is the API server load balancer on KT Cloud.
+	// +optional
+	LoadBalancer *LoadBalancerStatus `json:"loadBalancer,omitempty"`
+
+	// ControlPlaneSecurityGroup is the managed security group of the control planes.
+	// +optional
+	ControlPlaneSecurityGroup *SecurityGroupStatus `json:"controlPlaneSecurityGroup,omitempty"`
+
+	// WorkerSecurityGroup is the managed security group of the workers.
+	// +optional
+	WorkerSecurityGroup *SecurityGroupStatus `json:"workerSecurityGroup,omitempty"`
+
+	// Networks are the tier networks of the managed subnets, in the order of the managed subnets.
+	// KTMachines without a network tier are attached to them.
+	// +optional
+	Networks []NetworkStatus `json:"networks,omitempty"`
+
+	// Conditions of the cluster.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// LoadBalancerStatus is a load balancer created on KT Cloud.
+type LoadBalancerStatus struct {
+	// ID of the load balancer.
+	ID string `json:"id"`
+
+	// IP the load balancer listens on.
+	IP string `json:"ip,omitempty"`
+}
+
+// FailureDomains are the failure domains of a cluster by name.
+type FailureDomains map[string]FailureDomainSpec
+
+// FailureDomainSpec is a failure domain of a cluster.
+type FailureDomainSpec struct {
+	// ControlPlane is set when control plane machines may be placed in the failure domain.
+	// +optional
+	ControlPlane bool `json:"controlPlane,omitempty"`
+
+	// Attributes of the failure domain.
+	// +optional
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// SecurityGroupStatus is a managed security group on KT Cloud.
+type SecurityGroupStatus struct {
+	// ID of the security group.
+	ID string `json:"id"`
+
+	// Name of the security group, servers are attached to it by name.
+	Name string `json:"name"`
+}
+
+// NetworkStatus is a tier network of a managed subnet on KT Cloud.
+type NetworkStatus struct {
+	// ID of the network.
+	ID string `json:"id"`
+
+	// Name of the network.
+	Name string `json:"name,omitempty"`
+
+	// CIDR of the network.
+	CIDR string `json:"cidr"`
+
+	// Created is set when the network was created for the cluster rather than adopted,
+	// only created networks are deleted with the cluster.
+	// +optional
+	Created bool `json:"created,omitempty"`
 }
 
+const (
+	// ReadyCondition is True when the cluster is Ready, its reason is the one of the first condition
+	// that is not True.
+	ReadyCondition = "Ready"
+
+	// SubjectTokenReadyCondition is True while the KTSubjectToken of the cluster holds a token.
+	SubjectTokenReadyCondition = "SubjectTokenReady"
+
+	// NetworksReadyCondition is True once the tier networks of the managed subnets exist.
+	NetworksReadyCondition = "NetworksReady"
+
+	// SecurityGroupsReadyCondition is True once the managed security groups have their rules.
+	SecurityGroupsReadyCondition = "SecurityGroupsReady"
+
+	// LoadBalancerReadyCondition is True once the API server load balancer has a VIP.
+	LoadBalancerReadyCondition = "LoadBalancerReady"
+
+	// ReconciledReason is the reason of the readiness conditions that are True.
+	ReconciledReason = "Reconciled"
+
+	// WaitingForSubjectTokenReason is the reason of conditions waiting for the subject token.
+	WaitingForSubjectTokenReason = "WaitingForSubjectToken"
+
+	// ReconcileFailedReason is the reason of conditions whose last KT Cloud calls failed, they are retried.
+	ReconcileFailedReason = "ReconcileFailed"
+
+	// WaitingForLoadBalancerIPReason is the reason of a False LoadBalancerReady condition while the
+	// load balancer has no VIP yet.
+	WaitingForLoadBalancerIPReason = "WaitingForIP"
+
+	// InvalidConfigurationReason is the reason of conditions that cannot become True until the spec changes.
+	InvalidConfigurationReason = "InvalidConfiguration"
+)
+
+const (
+	// PublicIPPoolAvailableCondition is False while a public IP claim of the cluster cannot be
+	// fulfilled because every public IP in the pool of the cluster is in use.
+	PublicIPPoolAvailableCondition = "PublicIPPoolAvailable"
+
+	// PublicIPPoolExhaustedReason is the reason of a False PublicIPPoolAvailable condition.
+	PublicIPPoolExhaustedReason = "PoolExhausted"
+
+	// PublicIPPoolAvailableReason is the reason of a True PublicIPPoolAvailable condition.
+	PublicIPPoolAvailableReason = "Available"
+)
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready"
+// +kubebuilder:printcolumn:name="Endpoint",type="string",JSONPath=".status.controlPlaneEndpoint.host"
+// +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // KTCluster is the Schema for the ktclusters API.
 type KTCluster struct {
@@ -20,10 +20,20 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// DeleteMachineAnnotation marks a KTMachine to be deleted first when its MachineDeployment is scaled down.
+// Control plane machines are only ever deleted with it, once their etcd member was removed from the cluster.
+const DeleteMachineAnnotation = "infrastructure.dcnlab.ssu.ac.kr/delete-machine"
+
+// ServerCreateRequestedAnnotation is set on a KTMachine before its server is requested from KT Cloud.
+// Until the ID of the server is recorded in the status, the server is looked up by its metadata instead
+// of being created again.
+const ServerCreateRequestedAnnotation = "infrastructure.dcnlab.ssu.ac.kr/server-create-requested"
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 // KTMachineSpec defines the desired state of KTMachine.
+// +kubebuilder:validation:XValidation:rule="!has(self.serverID) || !has(self.remediationPolicy) || self.remediationPolicy != 'Recreate'",message="machines adopting a server cannot use the Recreate remediation policy"
 type KTMachineSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
@@ -36,7 +46,62 @@ type KTMachineSpec struct {
 	Networks           []Networks           `json:"networks,omitempty"`
 	Ports              []Port               `json:"ports,omitempty"`
 	AvailabilityZone   string               `json:"availabilityZone,omitempty"`
-	UserData           string               `json:"userData,omitempty"`
+	// UserData is cloud-init user data the machine is created with as is, instead of the bootstrap data.
+	UserData string `json:"userData,omitempty"`
+	// Bootstrap points to the generated bootstrap data of the machine.
+	Bootstrap KTMachineBootstrap `json:"bootstrap,omitempty"`
+	// RemediationPolicy decides what happens when the server of the machine no longer exists on KT Cloud.
+	// Recreate regenerates the bootstrap data of the machine for its new server.
+	// Machines adopting a server with serverID cannot be recreated.
+	// +kubebuilder:default=None
+	// +optional
+	RemediationPolicy MachineRemediationPolicy `json:"remediationPolicy,omitempty"`
+	// ServerID adopts an existing server on KT Cloud, like one built in the KT console, instead of
+	// creating one. The machine manages the adopted server like the servers it creates.
+	// +optional
+	ServerID string `json:"serverID,omitempty"`
+	// PublicIPIDs are the IDs of the public IPs already bound to the adopted server with static NAT.
+	// They are assigned to the machine when the server is adopted and no public IP is claimed for it.
+	// +optional
+	PublicIPIDs []string `json:"publicIPIDs,omitempty"`
+	// DeletionPolicy decides what happens to the server of the machine when the machine is deleted.
+	// Servers the machine created are deleted and servers adopted with serverID are orphaned by default.
+	// +optional
+	DeletionPolicy ServerDeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// ServerDeletionPolicy is what the operator does with the server of a deleted machine.
+// +kubebuilder:validation:Enum=Delete;Orphan
+type ServerDeletionPolicy string
+
+const (
+	// DeleteServerDeletionPolicy deletes the server and the static NAT of its assigned public IPs.
+	DeleteServerDeletionPolicy ServerDeletionPolicy = "Delete"
+	// OrphanServerDeletionPolicy leaves the server and the static NAT of its assigned public IPs on KT Cloud.
+	OrphanServerDeletionPolicy ServerDeletionPolicy = "Orphan"
+)
+
+// MachineRemediationPolicy is what the operator does with a machine whose server vanished on KT Cloud.
+// +kubebuilder:validation:Enum=None;Recreate;Delete
+type MachineRemediationPolicy string
+
+const (
+	// NoneMachineRemediationPolicy only marks the machine as failed.
+	NoneMachineRemediationPolicy MachineRemediationPolicy = "None"
+	// RecreateMachineRemediationPolicy creates a new server for the machine with regenerated bootstrap data:
+	// a new join token, and a join of the remaining control planes for the one that ran kubeadm init.
+	RecreateMachineRemediationPolicy MachineRemediationPolicy = "Recreate"
+	// DeleteMachineRemediationPolicy deletes the machine, its MachineDeployment replaces it.
+	DeleteMachineRemediationPolicy MachineRemediationPolicy = "Delete"
+)
+
+// KTMachineBootstrap references the bootstrap data of a machine.
+type KTMachineBootstrap struct {
+	// DataSecretName is the Secret holding the cloud-init user data under the key value.
+	// It is generated from the KubeadmControlPlane or KubeadmConfigTemplate the MachineDeployment
+	// of the machine references when empty.
+	// +optional
+	DataSecretName *string `json:"dataSecretName,omitempty"`
 }
 
 type Networks struct {
@@ -46,20 +111,132 @@ type Networks struct {
 type AssignedPublicIps struct {
 	IP string `json:"ip,omitempty"`
 	Id string `json:"id,omitempty"`
+
+	// Port is the public port forwarded to PrivatePort of the machine when the public IP is shared with
+	// port forwarding. Neither is set for static NAT.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// +optional
+	PrivatePort int32 `json:"privatePort,omitempty"`
 }
 
 // KTMachineStatus defines the observed state of KTMachine.
 type KTMachineStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
-	ID             string           `json:"id,omitempty"`
+
+	// Ready is true when the server of the machine is ACTIVE on KT Cloud.
+	// +optional
+	Ready bool `json:"ready"`
+
+	// ID of the server of the machine on KT Cloud.
+	// +optional
+	ID string `json:"id,omitempty"`
+
+	// ProviderID identifies the server of the machine as ktcloud://<zone>/<id>.
+	// +optional
+	ProviderID *string `json:"providerID,omitempty"`
+
+	// InstanceState is the status KT Cloud reports for the server, such as BUILD, ACTIVE or ERROR.
+	// +optional
+	InstanceState string `json:"instanceState,omitempty"`
+
+	// Addresses are the private addresses of the server as InternalIP and the public IPs bound to it
+	// as ExternalIP.
+	// +optional
+	Addresses []MachineAddress `json:"addresses,omitempty"`
+
+	AssignedPublicIps []AssignedPublicIps `json:"AssignedPublicIPs,omitempty"`
+
+	// Phase summarizes the state of the machine.
+	// +optional
+	Phase KTMachinePhase `json:"phase,omitempty"`
+
+	// FailureReason is set when the machine failed in a way it does not recover from, like a server in
+	// the ERROR state or one that no longer exists. The machine has to be replaced, see remediationPolicy.
+	// +optional
+	FailureReason *string `json:"failureReason,omitempty"`
+
+	// FailureMessage explains FailureReason.
+	// +optional
+	FailureMessage *string `json:"failureMessage,omitempty"`
+
+	// Conditions are InstanceReady, PublicIPAttached and BootstrapExecSucceeded.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Server is the server as last reported by KT Cloud, kept for debugging.
+	// +optional
+	Server *KTServerStatus `json:"server,omitempty"`
+}
+
+// MachineAddressType is the kind of a machine address.
+// +kubebuilder:validation:Enum=InternalIP;ExternalIP
+type MachineAddressType string
+
+const (
+	// MachineInternalIP is an address of the server on a tier network.
+	MachineInternalIP MachineAddressType = "InternalIP"
+	// MachineExternalIP is a public IP bound to the server with static NAT or port forwarding.
+	MachineExternalIP MachineAddressType = "ExternalIP"
+)
+
+// MachineAddress is an address of a machine.
+type MachineAddress struct {
+	Type    MachineAddressType `json:"type"`
+	Address string             `json:"address"`
+}
+
+// KTMachinePhase summarizes the state of a KTMachine.
+type KTMachinePhase string
+
+const (
+	// KTMachinePhasePending means the server has not been created yet.
+	KTMachinePhasePending KTMachinePhase = "Pending"
+	// KTMachinePhaseProvisioning means the server is being built.
+	KTMachinePhaseProvisioning KTMachinePhase = "Provisioning"
+	// KTMachinePhaseRunning means the server is ACTIVE.
+	KTMachinePhaseRunning KTMachinePhase = "Running"
+	// KTMachinePhaseDeleting means the machine releases its resources on KT Cloud before it is gone.
+	KTMachinePhaseDeleting KTMachinePhase = "Deleting"
+	// KTMachinePhaseFailed means the machine has a FailureReason.
+	KTMachinePhaseFailed KTMachinePhase = "Failed"
+)
+
+// KTMachine condition types and reasons.
+const (
+	// InstanceReadyCondition is True when the server of the machine is ACTIVE.
+	InstanceReadyCondition = "InstanceReady"
+	// PublicIPAttachedCondition is True when a public IP is bound to a control plane of a cluster with
+	// an external network. Other machines don't have it.
+	PublicIPAttachedCondition = "PublicIPAttached"
+	// BootstrapExecSucceededCondition is True once the node of the machine registered with the workload
+	// cluster, which kubeadm only does after the bootstrap data ran. Machines created from spec.userData
+	// don't have it.
+	BootstrapExecSucceededCondition = "BootstrapExecSucceeded"
+
+	InstanceActiveReason          = "InstanceActive"
+	InstanceProvisioningReason    = "InstanceProvisioning"
+	InstanceErrorReason           = "InstanceError"
+	InstanceNotFoundReason        = "InstanceNotFound"
+	InstanceCreateFailedReason    = "InstanceCreateFailed"
+	InstanceAlreadyAdoptedReason  = "InstanceAlreadyAdopted"
+	WaitingForClusterReason       = "WaitingForCluster"
+	WaitingForBootstrapDataReason = "WaitingForBootstrapData"
+	PublicIPAttachedReason        = "PublicIPAttached"
+	WaitingForPublicIPReason      = "WaitingForPublicIP"
+	NodeRegisteredReason          = "NodeRegistered"
+	WaitingForNodeReason          = "WaitingForNode"
+)
+
+// KTServerStatus is the server of a machine as reported by KT Cloud.
+type KTServerStatus struct {
 	AdminPass      string           `json:"adminPass,omitempty"`
 	Links          []Links          `json:"links,omitempty"`
 	SecurityGroups []SecurityGroups `json:"securityGroups,omitempty"`
 
-	AssignedPublicIps []AssignedPublicIps `json:"AssignedPublicIPs,omitempty"`
-
-	// New fields
 	TenantID string `json:"tenant_id,omitempty"`
 	// Metadata          map[string]interface{} `json:"metadata,omitempty"`
 	Addresses         map[string][]Address `json:"addresses,omitempty"`
@@ -124,6 +301,10 @@ type Flavor struct {
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="KTMachine phase"
+// +kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready"
+// +kubebuilder:printcolumn:name="ProviderID",type="string",JSONPath=".status.providerID"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // KTMachine is the Schema for the ktmachines API.
 type KTMachine struct {
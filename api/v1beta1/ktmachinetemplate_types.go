@@ -45,6 +45,10 @@ type Spec struct {
 	BlockDeviceMapping []BlockDeviceMapping `json:"blockDeviceMapping,omitempty"`
 	NetworkTier        []NetworkTier        `json:"networkTier,omitempty"`
 	Ports              []Port               `json:"ports,omitempty"`
+	// RemediationPolicy of the machines created from the template, see KTMachineSpec. Changing it only
+	// applies to machines created afterwards.
+	// +optional
+	RemediationPolicy MachineRemediationPolicy `json:"remediationPolicy,omitempty"`
 }
 
 type BlockDeviceMapping struct {
@@ -28,7 +28,11 @@ type KTNetworkFirewallSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// Foo is an example field of KTNetworkFirewall. Edit ktnetworkfirewall_types.go to remove/update
+	// ClusterName is the KTCluster whose KT Cloud credentials and zone the rule is created with.
+	ClusterName string `json:"clusterName"`
+
+	// The rule as sent to the NC firewall API. KT Cloud cannot update rules, a changed rule is
+	// deleted and created again.
 	StartPort    string `json:"startport"`
 	Protocol     int    `json:"protocol"`
 	VirtualIPID  string `json:"virtualipid"`
@@ -43,10 +47,23 @@ type KTNetworkFirewallSpec struct {
 type KTNetworkFirewallStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// ID of the rule on KT Cloud, empty while it is not created.
+	ID string `json:"id,omitempty"`
+
+	// State of the rule as reported by KT Cloud.
+	State string `json:"state,omitempty"`
+
+	// ObservedGeneration is the generation of the spec the rule was created from.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".spec.clusterName"
+// +kubebuilder:printcolumn:name="Rule",type="string",JSONPath=".status.id"
+// +kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // KTNetworkFirewall is the Schema for the ktnetworkfirewalls API.
 type KTNetworkFirewall struct {
@@ -17,6 +17,7 @@ limitations under the License.
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -28,18 +29,155 @@ type KTPublicNetworkSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// Foo is an example field of KTPublicNetwork. Edit ktpublicnetwork_types.go to remove/update
-	Foo string `json:"foo,omitempty"`
+	// ClusterName is the KTCluster whose KT Cloud credentials and zone the public IP is claimed with.
+	ClusterName string `json:"clusterName"`
+
+	// PublicIPID adopts the existing public IP with this ID instead of allocating a new one.
+	// +optional
+	PublicIPID string `json:"publicIPID,omitempty"`
+
+	// IP adopts the existing public IP with this address instead of allocating a new one.
+	// +optional
+	IP string `json:"ip,omitempty"`
+
+	// MachineRef is the KTMachine in the same namespace the public IP is bound to with static NAT.
+	// The IP is only claimed while neither it nor PortForwards is set.
+	// +optional
+	MachineRef *corev1.LocalObjectReference `json:"machineRef,omitempty"`
+
+	// PortForwards forward ports of the public IP to machines instead of binding all of it to MachineRef,
+	// so several machines can share the public IP. Cannot be combined with MachineRef.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	PortForwards []PortForward `json:"portForwards,omitempty"`
+
+	// ReclaimPolicy is what happens to the public IP when the claim is deleted. Defaults to Delete for
+	// allocated and Retain for adopted public IPs.
+	// +optional
+	ReclaimPolicy PublicIPReclaimPolicy `json:"reclaimPolicy,omitempty"`
 }
 
+// PortForward forwards a port of the public IP to a port of a machine.
+type PortForward struct {
+	// Name identifies the port forward in the status.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// MachineRef is the KTMachine in the same namespace the port is forwarded to.
+	MachineRef corev1.LocalObjectReference `json:"machineRef"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	PublicPort int32 `json:"publicPort"`
+
+	// PrivatePort defaults to PublicPort.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	PrivatePort int32 `json:"privatePort,omitempty"`
+
+	// Protocol defaults to TCP.
+	// +kubebuilder:validation:Enum=TCP;UDP
+	// +optional
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// PublicIPReclaimPolicy is what happens to a public IP when its claim is deleted.
+// +kubebuilder:validation:Enum=Delete;Retain
+type PublicIPReclaimPolicy string
+
+const (
+	// PublicIPReclaimDelete releases the public IP from the account.
+	PublicIPReclaimDelete PublicIPReclaimPolicy = "Delete"
+	// PublicIPReclaimRetain keeps the public IP in the account, only its static NAT is removed.
+	PublicIPReclaimRetain PublicIPReclaimPolicy = "Retain"
+)
+
+// KTPublicNetworkPhase is the lifecycle phase of a public IP claim.
+type KTPublicNetworkPhase string
+
+const (
+	// KTPublicNetworkPhasePending is a claim without a public IP yet.
+	KTPublicNetworkPhasePending KTPublicNetworkPhase = "Pending"
+	// KTPublicNetworkPhaseClaimed is a claim holding a public IP that is not bound to a machine.
+	KTPublicNetworkPhaseClaimed KTPublicNetworkPhase = "Claimed"
+	// KTPublicNetworkPhaseBound is a claim whose public IP is statically NATed to its machine, or
+	// forwarded to all machines of its port forwards.
+	KTPublicNetworkPhaseBound KTPublicNetworkPhase = "Bound"
+	// KTPublicNetworkPhaseFailed is a claim that cannot be fulfilled, see the message.
+	KTPublicNetworkPhaseFailed KTPublicNetworkPhase = "Failed"
+)
+
 // KTPublicNetworkStatus defines the observed state of KTPublicNetwork.
 type KTPublicNetworkStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// ID of the claimed public IP.
+	ID string `json:"id,omitempty"`
+
+	// IP is the claimed public IP address.
+	IP string `json:"ip,omitempty"`
+
+	// Allocated is true when the public IP was allocated for the claim, not adopted.
+	Allocated bool `json:"allocated,omitempty"`
+
+	// StaticNATID is the ID of the static NAT binding the public IP to the machine.
+	StaticNATID string `json:"staticNATID,omitempty"`
+
+	// Machine is the name of the KTMachine the public IP is bound to.
+	Machine string `json:"machine,omitempty"`
+
+	// PortForwards are the port forwarding rules created on KT Cloud for the port forwards of the spec.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	PortForwards []PortForwardStatus `json:"portForwards,omitempty"`
+
+	// Phase is where the claim is in its lifecycle.
+	Phase KTPublicNetworkPhase `json:"phase,omitempty"`
+
+	// Message explains the phase.
+	Message string `json:"message,omitempty"`
+}
+
+// PortForwardStatus is a port forwarding rule created on KT Cloud.
+type PortForwardStatus struct {
+	// Name of the port forward in the spec.
+	Name string `json:"name"`
+
+	// ID of the port forwarding rule.
+	ID string `json:"id"`
+
+	// Machine is the name of the KTMachine the port is forwarded to.
+	Machine string `json:"machine"`
+
+	// VMGuestIP is the private IP of the machine the port is forwarded to.
+	VMGuestIP string `json:"vmGuestIP"`
+
+	PublicPort  int32  `json:"publicPort"`
+	PrivatePort int32  `json:"privatePort"`
+	Protocol    string `json:"protocol"`
+}
+
+// ReclaimPolicy returns the reclaim policy of the claim with its default applied.
+func (n *KTPublicNetwork) ReclaimPolicy() PublicIPReclaimPolicy {
+	if n.Spec.ReclaimPolicy != "" {
+		return n.Spec.ReclaimPolicy
+	}
+	if n.Status.Allocated {
+		return PublicIPReclaimDelete
+	}
+	return PublicIPReclaimRetain
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="IP",type="string",JSONPath=".status.ip"
+// +kubebuilder:printcolumn:name="Machine",type="string",JSONPath=".status.machine"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // KTPublicNetwork is the Schema for the ktpublicnetworks API.
 type KTPublicNetwork struct {
@@ -53,6 +53,10 @@ type KTSubjectTokenStatus struct {
 	SubjectToken string `json:"subjectToken,omitempty"`
 	Token        Token  `json:"token,omitempty"`
 	CreatedAt    string `json:"createdAt,omitempty"` //The time logged successfully from KTCloud
+	Zone         string `json:"zone,omitempty"`      //The zone the token was issued for, tokens are only valid in this zone
+	// CredentialsHash identifies the credentials the token was issued for, the token is
+	// replaced once the identity secret of the cluster holds other credentials
+	CredentialsHash string `json:"credentialsHash,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -0,0 +1,132 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// KubeadmConfigSpec is the part of the kubeadm configuration that can be set per cluster role.
+// Field names follow kubeadm.k8s.io/v1beta3 so they can be copied from existing kubeadm configs.
+type KubeadmConfigSpec struct {
+	// ClusterConfiguration is used when the first control plane machine runs kubeadm init.
+	// +optional
+	ClusterConfiguration *ClusterConfiguration `json:"clusterConfiguration,omitempty"`
+
+	// InitConfiguration is used when the first control plane machine runs kubeadm init.
+	// +optional
+	InitConfiguration *InitConfiguration `json:"initConfiguration,omitempty"`
+
+	// JoinConfiguration is used when the other machines run kubeadm join.
+	// +optional
+	JoinConfiguration *JoinConfiguration `json:"joinConfiguration,omitempty"`
+
+	// Files are written to the machine before kubeadm runs.
+	// +optional
+	Files []File `json:"files,omitempty"`
+
+	// PreKubeadmCommands run before kubeadm.
+	// +optional
+	PreKubeadmCommands []string `json:"preKubeadmCommands,omitempty"`
+
+	// PostKubeadmCommands run after kubeadm.
+	// +optional
+	PostKubeadmCommands []string `json:"postKubeadmCommands,omitempty"`
+}
+
+// ClusterConfiguration is the cluster wide kubeadm configuration.
+type ClusterConfiguration struct {
+	// ControlPlaneEndpoint is the host:port of the API server shared by all control planes.
+	// Defaults to the private address of the first control plane machine on port 6443.
+	// +optional
+	ControlPlaneEndpoint string `json:"controlPlaneEndpoint,omitempty"`
+
+	// +optional
+	Networking Networking `json:"networking,omitempty"`
+
+	// +optional
+	APIServer APIServer `json:"apiServer,omitempty"`
+
+	// +optional
+	ControllerManager ControlPlaneComponent `json:"controllerManager,omitempty"`
+
+	// +optional
+	Scheduler ControlPlaneComponent `json:"scheduler,omitempty"`
+}
+
+// Networking holds the network ranges of the cluster.
+type Networking struct {
+	// +optional
+	ServiceSubnet string `json:"serviceSubnet,omitempty"`
+	// +optional
+	PodSubnet string `json:"podSubnet,omitempty"`
+	// +optional
+	DNSDomain string `json:"dnsDomain,omitempty"`
+}
+
+// ControlPlaneComponent holds the settings of a control plane component.
+type ControlPlaneComponent struct {
+	// +optional
+	ExtraArgs map[string]string `json:"extraArgs,omitempty"`
+}
+
+// APIServer holds the settings of the API server.
+type APIServer struct {
+	ControlPlaneComponent `json:",inline"`
+
+	// CertSANs are extra names for the API server serving certificate.
+	// +optional
+	CertSANs []string `json:"certSANs,omitempty"`
+}
+
+// InitConfiguration is the node specific configuration of kubeadm init.
+type InitConfiguration struct {
+	// +optional
+	NodeRegistration NodeRegistrationOptions `json:"nodeRegistration,omitempty"`
+}
+
+// JoinConfiguration is the node specific configuration of kubeadm join.
+type JoinConfiguration struct {
+	// +optional
+	NodeRegistration NodeRegistrationOptions `json:"nodeRegistration,omitempty"`
+}
+
+// NodeRegistrationOptions holds how the node registers with the cluster.
+type NodeRegistrationOptions struct {
+	// Name of the node, defaults to the hostname.
+	// +optional
+	Name string `json:"name,omitempty"`
+	// +optional
+	CRISocket string `json:"criSocket,omitempty"`
+	// Taints of the node. Control planes get the kubeadm default taint when nil.
+	// +optional
+	Taints []corev1.Taint `json:"taints,omitempty"`
+	// +optional
+	KubeletExtraArgs map[string]string `json:"kubeletExtraArgs,omitempty"`
+}
+
+// File is written to the machine by cloud-init.
+type File struct {
+	Path string `json:"path"`
+	// Owner is user:group, defaults to root.
+	// +optional
+	Owner string `json:"owner,omitempty"`
+	// Permissions in octal, for example 0600.
+	// +optional
+	Permissions string `json:"permissions,omitempty"`
+	Content     string `json:"content"`
+}
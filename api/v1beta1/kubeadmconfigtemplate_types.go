@@ -28,8 +28,14 @@ type KubeadmConfigTemplateSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// Foo is an example field of KubeadmConfigTemplate. Edit kubeadmconfigtemplate_types.go to remove/update
-	Foo string `json:"foo,omitempty"`
+	// Template is the kubeadm configuration of the worker machines of a MachineDeployment
+	// whose bootstrap configRef points to this template.
+	Template KubeadmConfigTemplateResource `json:"template,omitempty"`
+}
+
+// KubeadmConfigTemplateResource holds the kubeadm configuration of a KubeadmConfigTemplate.
+type KubeadmConfigTemplateResource struct {
+	Spec KubeadmConfigSpec `json:"spec,omitempty"`
 }
 
 // KubeadmConfigTemplateStatus defines the observed state of KubeadmConfigTemplate.
@@ -28,8 +28,14 @@ type KubeadmControlPlaneSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// Foo is an example field of KubeadmControlPlane. Edit kubeadmcontrolplane_types.go to remove/update
-	Foo string `json:"foo,omitempty"`
+	// Version is the Kubernetes version of the control plane machines. Defaults to the
+	// version of the MachineDeployment creating them.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// KubeadmConfigSpec is the kubeadm configuration of the control plane machines of a
+	// MachineDeployment whose bootstrap configRef points to this KubeadmControlPlane.
+	KubeadmConfigSpec KubeadmConfigSpec `json:"kubeadmConfigSpec,omitempty"`
 }
 
 // KubeadmControlPlaneStatus defines the observed state of KubeadmControlPlane.
@@ -18,6 +18,33 @@ package v1beta1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// MachineTemplateHashLabel is set on the KTMachines of a MachineDeployment to the hash of the
+// machine template they were created from. Machines with another hash are replaced on rollout.
+const MachineTemplateHashLabel = "infrastructure.dcnlab.ssu.ac.kr/machine-template-hash"
+
+// MachineDeploymentNameLabel is set on the KTMachines of a MachineDeployment to the name of the
+// deployment. The scale subresource selects the machines of a deployment by it.
+const MachineDeploymentNameLabel = "infrastructure.dcnlab.ssu.ac.kr/deployment-name"
+
+// ClusterNameLabel is the Cluster API label set to the name of the KTCluster on the objects that belong
+// to it: the KTMachines of a MachineDeployment, taken from spec.template.spec.clusterName of the deployment,
+// and the KTNetworkFirewalls, KTPublicNetworks and secrets the operator creates for the cluster.
+const ClusterNameLabel = "cluster.x-k8s.io/cluster-name"
+
+// MachineRoleLabel is set on the KTMachines of a MachineDeployment to their role in the cluster,
+// ControlPlaneMachineRole or WorkerMachineRole. A deployment can set it on itself to override the
+// role derived from its bootstrap configRef.
+const MachineRoleLabel = "infrastructure.dcnlab.ssu.ac.kr/machine-role"
+
+const (
+	// ControlPlaneMachineRole is the role of machines running the Kubernetes control plane. Deployments
+	// bootstrapped from a KubeadmControlPlane have it.
+	ControlPlaneMachineRole = "control-plane"
+	// WorkerMachineRole is the role of all other machines.
+	WorkerMachineRole = "worker"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -33,8 +60,74 @@ type MachineDeploymentSpec struct {
 	Replicas int         `json:"replicas"`
 	Selector Selector    `json:"selector,omitempty"`
 	Template MachineSpec `json:"template,omitempty"`
+
+	// DeletePolicy decides which machines are deleted first when the deployment is scaled down.
+	// Machines annotated with infrastructure.dcnlab.ssu.ac.kr/delete-machine are always deleted before any other.
+	// Control plane machines are only deleted with that annotation, once their etcd member was removed.
+	// Until enough of them are annotated the Progressing condition is False with reason WaitingForDeleteMachineAnnotation.
+	// +kubebuilder:default=Newest
+	// +optional
+	DeletePolicy MachineDeletePolicy `json:"deletePolicy,omitempty"`
+
+	// Strategy replaces machines that were created from an older KTMachineTemplate.
+	// Out-of-date control plane machines are only deleted with the delete-machine annotation, see DeletePolicy.
+	// +optional
+	Strategy *MachineDeploymentStrategy `json:"strategy,omitempty"`
+
+	// RevisionHistoryLimit is the number of previous template revisions kept in the status.
+	// +kubebuilder:default=10
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+}
+
+// MachineDeploymentStrategyType is the way out-of-date machines are replaced.
+// +kubebuilder:validation:Enum=RollingUpdate
+type MachineDeploymentStrategyType string
+
+const (
+	// RollingUpdateMachineDeploymentStrategyType replaces machines a few at a time.
+	RollingUpdateMachineDeploymentStrategyType MachineDeploymentStrategyType = "RollingUpdate"
+)
+
+// MachineDeploymentStrategy describes how to replace out-of-date machines.
+type MachineDeploymentStrategy struct {
+	// Type of the strategy, only RollingUpdate is supported.
+	// +kubebuilder:default=RollingUpdate
+	// +optional
+	Type MachineDeploymentStrategyType `json:"type,omitempty"`
+
+	// RollingUpdate holds the limits of a RollingUpdate.
+	// +optional
+	RollingUpdate *MachineRollingUpdateDeployment `json:"rollingUpdate,omitempty"`
+}
+
+// MachineRollingUpdateDeployment limits how many machines are replaced at a time.
+type MachineRollingUpdateDeployment struct {
+	// MaxUnavailable is the number or percentage of machines below the desired replicas that may be
+	// unavailable during the update. Percentages are rounded down. Defaults to 0.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+
+	// MaxSurge is the number or percentage of machines that may be created above the desired replicas
+	// during the update. Percentages are rounded up. Defaults to 1.
+	// +optional
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
 }
 
+// MachineDeletePolicy is the order in which machines are deleted when a MachineDeployment is scaled down.
+// +kubebuilder:validation:Enum=Newest;Oldest;Unhealthy
+type MachineDeletePolicy string
+
+const (
+	// NewestMachineDeletePolicy deletes the most recently created machines first.
+	NewestMachineDeletePolicy MachineDeletePolicy = "Newest"
+	// OldestMachineDeletePolicy deletes the least recently created machines first.
+	OldestMachineDeletePolicy MachineDeletePolicy = "Oldest"
+	// UnhealthyMachineDeletePolicy deletes machines in an error state first, then the newest.
+	UnhealthyMachineDeletePolicy MachineDeletePolicy = "Unhealthy"
+)
+
 // Selector defines the labels used for matching machines
 type Selector struct {
 	MatchLabels map[string]string `json:"matchLabels,omitempty"`
@@ -46,9 +139,11 @@ type MachineSpec struct {
 
 // MachineSpecDetails holds detailed specifications for a machine
 type MachineSpecDetails struct {
-	Bootstrap         Bootstrap         `json:"bootstrap,omitempty"`
-	ClusterName       string            `json:"clusterName,omitempty"`
-	FailureDomain     string            `json:"failureDomain,omitempty"`
+	Bootstrap Bootstrap `json:"bootstrap,omitempty"`
+	// ClusterName is the name of the KTCluster the machines of the deployment belong to.
+	ClusterName   string `json:"clusterName,omitempty"`
+	FailureDomain string `json:"failureDomain,omitempty"`
+	// InfrastructureRef is the KTMachineTemplate the machines of the deployment are created from.
 	InfrastructureRef InfrastructureRef `json:"infrastructureRef,omitempty"`
 	Version           string            `json:"version,omitempty"`
 }
@@ -76,10 +171,92 @@ type InfrastructureRef struct {
 type MachineDeploymentStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// ObservedGeneration is the generation of the spec the status was computed for.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Selector is the label selector of the machines of the deployment, used by the scale subresource.
+	Selector string `json:"selector,omitempty"`
+
+	// Replicas is the number of machines of the deployment that are not being deleted.
+	Replicas int `json:"replicas,omitempty"`
+	// ReadyReplicas is the number of machines whose server is ACTIVE on KT Cloud.
+	ReadyReplicas int `json:"readyReplicas,omitempty"`
+	// AvailableReplicas is the number of machines that can serve. KT Cloud reports no readiness
+	// beyond the server status, so a machine is available as soon as it is ready.
+	AvailableReplicas int `json:"availableReplicas,omitempty"`
+	// UnavailableReplicas is the number of machines still missing for the desired replicas to be available.
+	UnavailableReplicas int `json:"unavailableReplicas,omitempty"`
+
+	// Phase summarizes the state of the deployment.
+	Phase MachineDeploymentPhase `json:"phase,omitempty"`
+
+	// Conditions are Available, Progressing and MachinesHealthy.
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// TemplateHash is the hash of the machine template the deployment is rolling out.
+	TemplateHash string `json:"templateHash,omitempty"`
+	// Revision is increased every time the machine template changes.
+	Revision int64 `json:"revision,omitempty"`
+	// UpdatedReplicas is the number of machines created from the current machine template.
+	UpdatedReplicas int `json:"updatedReplicas,omitempty"`
+	// RevisionHistory lists the previous revisions of the machine template, oldest first.
+	RevisionHistory []MachineDeploymentRevision `json:"revisionHistory,omitempty"`
+}
+
+// MachineDeploymentPhase summarizes the state of a MachineDeployment.
+type MachineDeploymentPhase string
+
+const (
+	// MachineDeploymentPhaseScalingUp means machines are missing or not ready yet.
+	MachineDeploymentPhaseScalingUp MachineDeploymentPhase = "ScalingUp"
+	// MachineDeploymentPhaseScalingDown means there are more machines than desired replicas.
+	MachineDeploymentPhaseScalingDown MachineDeploymentPhase = "ScalingDown"
+	// MachineDeploymentPhaseRunning means all desired replicas are ready.
+	MachineDeploymentPhaseRunning MachineDeploymentPhase = "Running"
+	// MachineDeploymentPhaseFailed means the server of at least one machine is in an error state.
+	MachineDeploymentPhaseFailed MachineDeploymentPhase = "Failed"
+)
+
+// MachineDeployment condition types and reasons.
+const (
+	// MachineDeploymentAvailableCondition is True when at least replicas - maxUnavailable machines are available.
+	MachineDeploymentAvailableCondition = "Available"
+	// MachineDeploymentProgressingCondition is True while machines are created, deleted or replaced.
+	MachineDeploymentProgressingCondition = "Progressing"
+	// MachineDeploymentMachinesHealthyCondition is False when the server of a machine is in an error state.
+	MachineDeploymentMachinesHealthyCondition = "MachinesHealthy"
+
+	MinimumReplicasAvailableReason   = "MinimumReplicasAvailable"
+	MinimumReplicasUnavailableReason = "MinimumReplicasUnavailable"
+	RollingUpdateReason              = "RollingUpdate"
+	ScalingReason                    = "Scaling"
+	NewMachinesAvailableReason       = "NewMachinesAvailable"
+	MachinesHealthyReason            = "MachinesHealthy"
+	MachineErrorReason               = "MachineError"
+	// WaitingForDeleteMachineAnnotationReason is set on the Progressing condition while control plane
+	// machines the deployment would delete on scale down or rollout are not annotated with DeleteMachineAnnotation.
+	WaitingForDeleteMachineAnnotationReason = "WaitingForDeleteMachineAnnotation"
+)
+
+// MachineDeploymentRevision is a previous revision of the machine template of a MachineDeployment.
+type MachineDeploymentRevision struct {
+	Revision     int64       `json:"revision"`
+	TemplateHash string      `json:"templateHash"`
+	ReplacedAt   metav1.Time `json:"replacedAt"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas,selectorpath=.status.selector
+// +kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".spec.replicas",description="Desired number of machines"
+// +kubebuilder:printcolumn:name="Ready",type="integer",JSONPath=".status.readyReplicas",description="Machines whose server is ACTIVE"
+// +kubebuilder:printcolumn:name="Updated",type="integer",JSONPath=".status.updatedReplicas",description="Machines created from the current template"
+// +kubebuilder:printcolumn:name="Available",type="integer",JSONPath=".status.availableReplicas",description="Machines that can serve"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="MachineDeployment phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // MachineDeployment is the Schema for the machinedeployments API.
 type MachineDeployment struct {
@@ -21,9 +21,48 @@ limitations under the License.
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *APIEndpoint) DeepCopyInto(out *APIEndpoint) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new APIEndpoint.
+func (in *APIEndpoint) DeepCopy() *APIEndpoint {
+	if in == nil {
+		return nil
+	}
+	out := new(APIEndpoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *APIServer) DeepCopyInto(out *APIServer) {
+	*out = *in
+	in.ControlPlaneComponent.DeepCopyInto(&out.ControlPlaneComponent)
+	if in.CertSANs != nil {
+		in, out := &in.CertSANs, &out.CertSANs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new APIServer.
+func (in *APIServer) DeepCopy() *APIServer {
+	if in == nil {
+		return nil
+	}
+	out := new(APIServer)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *APIServerLoadBalancer) DeepCopyInto(out *APIServerLoadBalancer) {
 	*out = *in
@@ -127,6 +166,25 @@ func (in *Cluster) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterConfiguration) DeepCopyInto(out *ClusterConfiguration) {
+	*out = *in
+	out.Networking = in.Networking
+	in.APIServer.DeepCopyInto(&out.APIServer)
+	in.ControllerManager.DeepCopyInto(&out.ControllerManager)
+	in.Scheduler.DeepCopyInto(&out.Scheduler)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterConfiguration.
+func (in *ClusterConfiguration) DeepCopy() *ClusterConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterList) DeepCopyInto(out *ClusterList) {
 	*out = *in
@@ -219,6 +277,121 @@ func (in *ConfigRef) DeepCopy() *ConfigRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ControlPlaneComponent) DeepCopyInto(out *ControlPlaneComponent) {
+	*out = *in
+	if in.ExtraArgs != nil {
+		in, out := &in.ExtraArgs, &out.ExtraArgs
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControlPlaneComponent.
+func (in *ControlPlaneComponent) DeepCopy() *ControlPlaneComponent {
+	if in == nil {
+		return nil
+	}
+	out := new(ControlPlaneComponent)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalFirewall) DeepCopyInto(out *ExternalFirewall) {
+	*out = *in
+	if in.ExtraPorts != nil {
+		in, out := &in.ExtraPorts, &out.ExtraPorts
+		*out = make([]FirewallPort, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalFirewall.
+func (in *ExternalFirewall) DeepCopy() *ExternalFirewall {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalFirewall)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FailureDomainSpec) DeepCopyInto(out *FailureDomainSpec) {
+	*out = *in
+	if in.Attributes != nil {
+		in, out := &in.Attributes, &out.Attributes
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FailureDomainSpec.
+func (in *FailureDomainSpec) DeepCopy() *FailureDomainSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FailureDomainSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in FailureDomains) DeepCopyInto(out *FailureDomains) {
+	{
+		in := &in
+		*out = make(FailureDomains, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FailureDomains.
+func (in FailureDomains) DeepCopy() FailureDomains {
+	if in == nil {
+		return nil
+	}
+	out := new(FailureDomains)
+	in.DeepCopyInto(out)
+	return *out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *File) DeepCopyInto(out *File) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new File.
+func (in *File) DeepCopy() *File {
+	if in == nil {
+		return nil
+	}
+	out := new(File)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FirewallPort) DeepCopyInto(out *FirewallPort) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FirewallPort.
+func (in *FirewallPort) DeepCopy() *FirewallPort {
+	if in == nil {
+		return nil
+	}
+	out := new(FirewallPort)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FixedIP) DeepCopyInto(out *FixedIP) {
 	*out = *in
@@ -291,13 +464,45 @@ func (in *InfrastructureRef) DeepCopy() *InfrastructureRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InitConfiguration) DeepCopyInto(out *InitConfiguration) {
+	*out = *in
+	in.NodeRegistration.DeepCopyInto(&out.NodeRegistration)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InitConfiguration.
+func (in *InitConfiguration) DeepCopy() *InitConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(InitConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JoinConfiguration) DeepCopyInto(out *JoinConfiguration) {
+	*out = *in
+	in.NodeRegistration.DeepCopyInto(&out.NodeRegistration)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JoinConfiguration.
+func (in *JoinConfiguration) DeepCopy() *JoinConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(JoinConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KTCluster) DeepCopyInto(out *KTCluster) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KTCluster.
@@ -355,7 +560,11 @@ func (in *KTClusterSpec) DeepCopyInto(out *KTClusterSpec) {
 	*out = *in
 	out.APIServerLoadBalancer = in.APIServerLoadBalancer
 	out.IdentityRef = in.IdentityRef
-	in.ManagedSecurityGroups.DeepCopyInto(&out.ManagedSecurityGroups)
+	if in.ManagedSecurityGroups != nil {
+		in, out := &in.ManagedSecurityGroups, &out.ManagedSecurityGroups
+		*out = new(ManagedSecurityGroups)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.ManagedSubnets != nil {
 		in, out := &in.ManagedSubnets, &out.ManagedSubnets
 		*out = make([]ManagedSubnet, len(*in))
@@ -363,6 +572,10 @@ func (in *KTClusterSpec) DeepCopyInto(out *KTClusterSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	in.ExternalFirewall.DeepCopyInto(&out.ExternalFirewall)
+	out.ControlPlaneEndpoint = in.ControlPlaneEndpoint
+	in.PublicIPPool.DeepCopyInto(&out.PublicIPPool)
+	out.PortForwarding = in.PortForwarding
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KTClusterSpec.
@@ -378,6 +591,51 @@ func (in *KTClusterSpec) DeepCopy() *KTClusterSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KTClusterStatus) DeepCopyInto(out *KTClusterStatus) {
 	*out = *in
+	out.ControlPlaneEndpoint = in.ControlPlaneEndpoint
+	if in.FailureDomains != nil {
+		in, out := &in.FailureDomains, &out.FailureDomains
+		*out = make(FailureDomains, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.FailureReason != nil {
+		in, out := &in.FailureReason, &out.FailureReason
+		*out = new(string)
+		**out = **in
+	}
+	if in.FailureMessage != nil {
+		in, out := &in.FailureMessage, &out.FailureMessage
+		*out = new(string)
+		**out = **in
+	}
+	if in.LoadBalancer != nil {
+		in, out := &in.LoadBalancer, &out.LoadBalancer
+		*out = new(LoadBalancerStatus)
+		**out = **in
+	}
+	if in.ControlPlaneSecurityGroup != nil {
+		in, out := &in.ControlPlaneSecurityGroup, &out.ControlPlaneSecurityGroup
+		*out = new(SecurityGroupStatus)
+		**out = **in
+	}
+	if in.WorkerSecurityGroup != nil {
+		in, out := &in.WorkerSecurityGroup, &out.WorkerSecurityGroup
+		*out = new(SecurityGroupStatus)
+		**out = **in
+	}
+	if in.Networks != nil {
+		in, out := &in.Networks, &out.Networks
+		*out = make([]NetworkStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KTClusterStatus.
@@ -417,6 +675,26 @@ func (in *KTMachine) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KTMachineBootstrap) DeepCopyInto(out *KTMachineBootstrap) {
+	*out = *in
+	if in.DataSecretName != nil {
+		in, out := &in.DataSecretName, &out.DataSecretName
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KTMachineBootstrap.
+func (in *KTMachineBootstrap) DeepCopy() *KTMachineBootstrap {
+	if in == nil {
+		return nil
+	}
+	out := new(KTMachineBootstrap)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KTMachineList) DeepCopyInto(out *KTMachineList) {
 	*out = *in
@@ -474,6 +752,12 @@ func (in *KTMachineSpec) DeepCopyInto(out *KTMachineSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	in.Bootstrap.DeepCopyInto(&out.Bootstrap)
+	if in.PublicIPIDs != nil {
+		in, out := &in.PublicIPIDs, &out.PublicIPIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KTMachineSpec.
@@ -489,14 +773,14 @@ func (in *KTMachineSpec) DeepCopy() *KTMachineSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KTMachineStatus) DeepCopyInto(out *KTMachineStatus) {
 	*out = *in
-	if in.Links != nil {
-		in, out := &in.Links, &out.Links
-		*out = make([]Links, len(*in))
-		copy(*out, *in)
+	if in.ProviderID != nil {
+		in, out := &in.ProviderID, &out.ProviderID
+		*out = new(string)
+		**out = **in
 	}
-	if in.SecurityGroups != nil {
-		in, out := &in.SecurityGroups, &out.SecurityGroups
-		*out = make([]SecurityGroups, len(*in))
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make([]MachineAddress, len(*in))
 		copy(*out, *in)
 	}
 	if in.AssignedPublicIps != nil {
@@ -504,52 +788,27 @@ func (in *KTMachineStatus) DeepCopyInto(out *KTMachineStatus) {
 		*out = make([]AssignedPublicIps, len(*in))
 		copy(*out, *in)
 	}
-	if in.Addresses != nil {
-		in, out := &in.Addresses, &out.Addresses
-		*out = make(map[string][]Address, len(*in))
-		for key, val := range *in {
-			var outVal []Address
-			if val == nil {
-				(*out)[key] = nil
-			} else {
-				inVal := (*in)[key]
-				in, out := &inVal, &outVal
-				*out = make([]Address, len(*in))
-				copy(*out, *in)
-			}
-			(*out)[key] = outVal
-		}
-	}
-	if in.TaskState != nil {
-		in, out := &in.TaskState, &out.TaskState
-		*out = new(string)
-		**out = **in
-	}
-	if in.Description != nil {
-		in, out := &in.Description, &out.Description
+	if in.FailureReason != nil {
+		in, out := &in.FailureReason, &out.FailureReason
 		*out = new(string)
 		**out = **in
 	}
-	if in.TrustedImageCerts != nil {
-		in, out := &in.TrustedImageCerts, &out.TrustedImageCerts
+	if in.FailureMessage != nil {
+		in, out := &in.FailureMessage, &out.FailureMessage
 		*out = new(string)
 		**out = **in
 	}
-	if in.VolumesAttached != nil {
-		in, out := &in.VolumesAttached, &out.VolumesAttached
-		*out = make([]VolumeAttached, len(*in))
-		copy(*out, *in)
-	}
-	if in.Tags != nil {
-		in, out := &in.Tags, &out.Tags
-		*out = make([]string, len(*in))
-		copy(*out, *in)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
-	in.Flavor.DeepCopyInto(&out.Flavor)
-	if in.TerminatedAt != nil {
-		in, out := &in.TerminatedAt, &out.TerminatedAt
-		*out = new(string)
-		**out = **in
+	if in.Server != nil {
+		in, out := &in.Server, &out.Server
+		*out = new(KTServerStatus)
+		(*in).DeepCopyInto(*out)
 	}
 }
 
@@ -747,8 +1006,8 @@ func (in *KTPublicNetwork) DeepCopyInto(out *KTPublicNetwork) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KTPublicNetwork.
@@ -804,6 +1063,16 @@ func (in *KTPublicNetworkList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KTPublicNetworkSpec) DeepCopyInto(out *KTPublicNetworkSpec) {
 	*out = *in
+	if in.MachineRef != nil {
+		in, out := &in.MachineRef, &out.MachineRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.PortForwards != nil {
+		in, out := &in.PortForwards, &out.PortForwards
+		*out = make([]PortForward, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KTPublicNetworkSpec.
@@ -819,6 +1088,11 @@ func (in *KTPublicNetworkSpec) DeepCopy() *KTPublicNetworkSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KTPublicNetworkStatus) DeepCopyInto(out *KTPublicNetworkStatus) {
 	*out = *in
+	if in.PortForwards != nil {
+		in, out := &in.PortForwards, &out.PortForwards
+		*out = make([]PortForwardStatus, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KTPublicNetworkStatus.
@@ -832,20 +1106,92 @@ func (in *KTPublicNetworkStatus) DeepCopy() *KTPublicNetworkStatus {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KTSubjectToken) DeepCopyInto(out *KTSubjectToken) {
+func (in *KTServerStatus) DeepCopyInto(out *KTServerStatus) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KTSubjectToken.
-func (in *KTSubjectToken) DeepCopy() *KTSubjectToken {
-	if in == nil {
-		return nil
-	}
-	out := new(KTSubjectToken)
+	if in.Links != nil {
+		in, out := &in.Links, &out.Links
+		*out = make([]Links, len(*in))
+		copy(*out, *in)
+	}
+	if in.SecurityGroups != nil {
+		in, out := &in.SecurityGroups, &out.SecurityGroups
+		*out = make([]SecurityGroups, len(*in))
+		copy(*out, *in)
+	}
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make(map[string][]Address, len(*in))
+		for key, val := range *in {
+			var outVal []Address
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				inVal := (*in)[key]
+				in, out := &inVal, &outVal
+				*out = make([]Address, len(*in))
+				copy(*out, *in)
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.TaskState != nil {
+		in, out := &in.TaskState, &out.TaskState
+		*out = new(string)
+		**out = **in
+	}
+	if in.Description != nil {
+		in, out := &in.Description, &out.Description
+		*out = new(string)
+		**out = **in
+	}
+	if in.TrustedImageCerts != nil {
+		in, out := &in.TrustedImageCerts, &out.TrustedImageCerts
+		*out = new(string)
+		**out = **in
+	}
+	if in.VolumesAttached != nil {
+		in, out := &in.VolumesAttached, &out.VolumesAttached
+		*out = make([]VolumeAttached, len(*in))
+		copy(*out, *in)
+	}
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.Flavor.DeepCopyInto(&out.Flavor)
+	if in.TerminatedAt != nil {
+		in, out := &in.TerminatedAt, &out.TerminatedAt
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KTServerStatus.
+func (in *KTServerStatus) DeepCopy() *KTServerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KTServerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KTSubjectToken) DeepCopyInto(out *KTSubjectToken) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KTSubjectToken.
+func (in *KTSubjectToken) DeepCopy() *KTSubjectToken {
+	if in == nil {
+		return nil
+	}
+	out := new(KTSubjectToken)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -923,12 +1269,57 @@ func (in *KTSubjectTokenStatus) DeepCopy() *KTSubjectTokenStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubeadmConfigSpec) DeepCopyInto(out *KubeadmConfigSpec) {
+	*out = *in
+	if in.ClusterConfiguration != nil {
+		in, out := &in.ClusterConfiguration, &out.ClusterConfiguration
+		*out = new(ClusterConfiguration)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.InitConfiguration != nil {
+		in, out := &in.InitConfiguration, &out.InitConfiguration
+		*out = new(InitConfiguration)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.JoinConfiguration != nil {
+		in, out := &in.JoinConfiguration, &out.JoinConfiguration
+		*out = new(JoinConfiguration)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Files != nil {
+		in, out := &in.Files, &out.Files
+		*out = make([]File, len(*in))
+		copy(*out, *in)
+	}
+	if in.PreKubeadmCommands != nil {
+		in, out := &in.PreKubeadmCommands, &out.PreKubeadmCommands
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PostKubeadmCommands != nil {
+		in, out := &in.PostKubeadmCommands, &out.PostKubeadmCommands
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeadmConfigSpec.
+func (in *KubeadmConfigSpec) DeepCopy() *KubeadmConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KubeadmConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubeadmConfigTemplate) DeepCopyInto(out *KubeadmConfigTemplate) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	out.Status = in.Status
 }
 
@@ -982,9 +1373,26 @@ func (in *KubeadmConfigTemplateList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubeadmConfigTemplateResource) DeepCopyInto(out *KubeadmConfigTemplateResource) {
+	*out = *in
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeadmConfigTemplateResource.
+func (in *KubeadmConfigTemplateResource) DeepCopy() *KubeadmConfigTemplateResource {
+	if in == nil {
+		return nil
+	}
+	out := new(KubeadmConfigTemplateResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubeadmConfigTemplateSpec) DeepCopyInto(out *KubeadmConfigTemplateSpec) {
 	*out = *in
+	in.Template.DeepCopyInto(&out.Template)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeadmConfigTemplateSpec.
@@ -1017,7 +1425,7 @@ func (in *KubeadmControlPlane) DeepCopyInto(out *KubeadmControlPlane) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	out.Status = in.Status
 }
 
@@ -1074,6 +1482,7 @@ func (in *KubeadmControlPlaneList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubeadmControlPlaneSpec) DeepCopyInto(out *KubeadmControlPlaneSpec) {
 	*out = *in
+	in.KubeadmConfigSpec.DeepCopyInto(&out.KubeadmConfigSpec)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeadmControlPlaneSpec.
@@ -1116,13 +1525,43 @@ func (in *Links) DeepCopy() *Links {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LoadBalancerStatus) DeepCopyInto(out *LoadBalancerStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoadBalancerStatus.
+func (in *LoadBalancerStatus) DeepCopy() *LoadBalancerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LoadBalancerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MachineAddress) DeepCopyInto(out *MachineAddress) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MachineAddress.
+func (in *MachineAddress) DeepCopy() *MachineAddress {
+	if in == nil {
+		return nil
+	}
+	out := new(MachineAddress)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MachineDeployment) DeepCopyInto(out *MachineDeployment) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MachineDeployment.
@@ -1175,11 +1614,37 @@ func (in *MachineDeploymentList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MachineDeploymentRevision) DeepCopyInto(out *MachineDeploymentRevision) {
+	*out = *in
+	in.ReplacedAt.DeepCopyInto(&out.ReplacedAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MachineDeploymentRevision.
+func (in *MachineDeploymentRevision) DeepCopy() *MachineDeploymentRevision {
+	if in == nil {
+		return nil
+	}
+	out := new(MachineDeploymentRevision)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MachineDeploymentSpec) DeepCopyInto(out *MachineDeploymentSpec) {
 	*out = *in
 	in.Selector.DeepCopyInto(&out.Selector)
 	out.Template = in.Template
+	if in.Strategy != nil {
+		in, out := &in.Strategy, &out.Strategy
+		*out = new(MachineDeploymentStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RevisionHistoryLimit != nil {
+		in, out := &in.RevisionHistoryLimit, &out.RevisionHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MachineDeploymentSpec.
@@ -1195,6 +1660,20 @@ func (in *MachineDeploymentSpec) DeepCopy() *MachineDeploymentSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MachineDeploymentStatus) DeepCopyInto(out *MachineDeploymentStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RevisionHistory != nil {
+		in, out := &in.RevisionHistory, &out.RevisionHistory
+		*out = make([]MachineDeploymentRevision, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MachineDeploymentStatus.
@@ -1207,6 +1686,51 @@ func (in *MachineDeploymentStatus) DeepCopy() *MachineDeploymentStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MachineDeploymentStrategy) DeepCopyInto(out *MachineDeploymentStrategy) {
+	*out = *in
+	if in.RollingUpdate != nil {
+		in, out := &in.RollingUpdate, &out.RollingUpdate
+		*out = new(MachineRollingUpdateDeployment)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MachineDeploymentStrategy.
+func (in *MachineDeploymentStrategy) DeepCopy() *MachineDeploymentStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(MachineDeploymentStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MachineRollingUpdateDeployment) DeepCopyInto(out *MachineRollingUpdateDeployment) {
+	*out = *in
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxSurge != nil {
+		in, out := &in.MaxSurge, &out.MaxSurge
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MachineRollingUpdateDeployment.
+func (in *MachineRollingUpdateDeployment) DeepCopy() *MachineRollingUpdateDeployment {
+	if in == nil {
+		return nil
+	}
+	out := new(MachineRollingUpdateDeployment)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MachineSpec) DeepCopyInto(out *MachineSpec) {
 	*out = *in
@@ -1297,6 +1821,21 @@ func (in *Network) DeepCopy() *Network {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkStatus) DeepCopyInto(out *NetworkStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkStatus.
+func (in *NetworkStatus) DeepCopy() *NetworkStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetworkTier) DeepCopyInto(out *NetworkTier) {
 	*out = *in
@@ -1312,6 +1851,21 @@ func (in *NetworkTier) DeepCopy() *NetworkTier {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Networking) DeepCopyInto(out *Networking) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Networking.
+func (in *Networking) DeepCopy() *Networking {
+	if in == nil {
+		return nil
+	}
+	out := new(Networking)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Networks) DeepCopyInto(out *Networks) {
 	*out = *in
@@ -1327,6 +1881,35 @@ func (in *Networks) DeepCopy() *Networks {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeRegistrationOptions) DeepCopyInto(out *NodeRegistrationOptions) {
+	*out = *in
+	if in.Taints != nil {
+		in, out := &in.Taints, &out.Taints
+		*out = make([]corev1.Taint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.KubeletExtraArgs != nil {
+		in, out := &in.KubeletExtraArgs, &out.KubeletExtraArgs
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeRegistrationOptions.
+func (in *NodeRegistrationOptions) DeepCopy() *NodeRegistrationOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeRegistrationOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Port) DeepCopyInto(out *Port) {
 	*out = *in
@@ -1354,6 +1937,77 @@ func (in *Port) DeepCopy() *Port {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PortForward) DeepCopyInto(out *PortForward) {
+	*out = *in
+	out.MachineRef = in.MachineRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PortForward.
+func (in *PortForward) DeepCopy() *PortForward {
+	if in == nil {
+		return nil
+	}
+	out := new(PortForward)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PortForwardStatus) DeepCopyInto(out *PortForwardStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PortForwardStatus.
+func (in *PortForwardStatus) DeepCopy() *PortForwardStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PortForwardStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PortForwarding) DeepCopyInto(out *PortForwarding) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PortForwarding.
+func (in *PortForwarding) DeepCopy() *PortForwarding {
+	if in == nil {
+		return nil
+	}
+	out := new(PortForwarding)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PublicIPPool) DeepCopyInto(out *PublicIPPool) {
+	*out = *in
+	if in.IDs != nil {
+		in, out := &in.IDs, &out.IDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CIDRs != nil {
+		in, out := &in.CIDRs, &out.CIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PublicIPPool.
+func (in *PublicIPPool) DeepCopy() *PublicIPPool {
+	if in == nil {
+		return nil
+	}
+	out := new(PublicIPPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecurityGroupRule) DeepCopyInto(out *SecurityGroupRule) {
 	*out = *in
@@ -1374,6 +2028,21 @@ func (in *SecurityGroupRule) DeepCopy() *SecurityGroupRule {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecurityGroupStatus) DeepCopyInto(out *SecurityGroupStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecurityGroupStatus.
+func (in *SecurityGroupStatus) DeepCopy() *SecurityGroupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SecurityGroupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecurityGroups) DeepCopyInto(out *SecurityGroups) {
 	*out = *in
@@ -36,7 +36,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	infrastructurev1beta1 "dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/cloudapi"
 	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/controller"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -118,8 +120,13 @@ func main() {
 		// this setup is not recommended for production.
 	}
 
-	// // Make an auth API call
-	// httpapi.KTCloudLogin()
+	// KT Cloud API settings are read from the environment, see cloudapi.Config
+	cloudConfig, err := cloudapi.ProcessEnvVariables()
+	if err != nil {
+		setupLog.Error(err, "unable to read KT Cloud configuration")
+		os.Exit(1)
+	}
+	ktCloud := ktcloud.NewFactory(cloudConfig)
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
@@ -153,8 +160,9 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&controller.KTClusterReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		KTCloud: ktCloud,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KTCluster")
 		os.Exit(1)
@@ -188,29 +196,35 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&controller.KTSubjectTokenReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Config:  cloudConfig,
+		KTCloud: ktCloud,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KTSubjectToken")
 		os.Exit(1)
 	}
 	if err = (&controller.KTMachineReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		KTCloud: ktCloud,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KTMachine")
 		os.Exit(1)
 	}
 	if err = (&controller.KTPublicNetworkReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		KTCloud:   ktCloud,
+		APIReader: mgr.GetAPIReader(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KTPublicNetwork")
 		os.Exit(1)
 	}
 	if err = (&controller.KTNetworkFirewallReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		KTCloud: ktCloud,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KTNetworkFirewall")
 		os.Exit(1)
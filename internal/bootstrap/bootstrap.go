@@ -0,0 +1,199 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bootstrap renders the cloud-init user data that turns a KT Cloud server into a
+// kubeadm node of a workload cluster.
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/pki"
+)
+
+// Role is what the machine becomes in the workload cluster.
+type Role string
+
+const (
+	// RoleInit runs kubeadm init on the first control plane machine of a cluster.
+	RoleInit Role = "init"
+	// RoleJoinControlPlane joins another control plane machine to the first one.
+	RoleJoinControlPlane Role = "join-control-plane"
+	// RoleWorker joins a worker machine.
+	RoleWorker Role = "worker"
+)
+
+// Format is the format of the rendered bootstrap data.
+const Format = "cloud-config"
+
+const (
+	kubeadmConfigPath = "/run/kubeadm/kubeadm.yaml"
+	pkiPath           = "/etc/kubernetes/pki"
+
+	// controlPlaneEndpointPlaceholder is replaced with the private address of the first control plane
+	// on the machine when no endpoint is configured
+	controlPlaneEndpointPlaceholder = "__CONTROL_PLANE_ENDPOINT__"
+)
+
+// Certificates are the certificate authorities and service account keys all control planes of a
+// cluster share. kubeadm uses them instead of generating its own when they exist in /etc/kubernetes/pki.
+type Certificates struct {
+	CA             pki.KeyPair
+	EtcdCA         pki.KeyPair
+	FrontProxyCA   pki.KeyPair
+	ServiceAccount pki.KeyPair
+}
+
+// Input is everything needed to render the bootstrap data of a machine.
+type Input struct {
+	Role Role
+	// KubernetesVersion is the version kubeadm init sets up.
+	KubernetesVersion string
+	// ControlPlaneEndpoint is the host:port of the API server. Joining machines require it,
+	// on init it defaults to the private address of the machine on port 6443.
+	ControlPlaneEndpoint string
+	// Certificates are written to control plane machines, which require them.
+	Certificates *Certificates
+	// Token is the bootstrap token kubeadm init creates and joining machines authenticate with.
+	Token string
+	// TokenTTL is how long the token created by kubeadm init is valid.
+	TokenTTL time.Duration
+	// CACertHash pins the cluster CA for joining machines, in the sha256:<hex> format.
+	CACertHash string
+	// Config is the kubeadm configuration of the role.
+	Config v1beta1.KubeadmConfigSpec
+}
+
+type cloudConfig struct {
+	WriteFiles []cloudInitFile `json:"write_files,omitempty"`
+	RunCmd     []string        `json:"runcmd"`
+}
+
+type cloudInitFile struct {
+	Path        string `json:"path"`
+	Owner       string `json:"owner,omitempty"`
+	Permissions string `json:"permissions,omitempty"`
+	Content     string `json:"content"`
+}
+
+// Render returns the cloud-config user data for the machine described by input.
+func Render(input Input) ([]byte, error) {
+	switch input.Role {
+	case RoleInit, RoleJoinControlPlane, RoleWorker:
+	default:
+		return nil, fmt.Errorf("unknown bootstrap role %q", input.Role)
+	}
+	if input.Token == "" {
+		return nil, errors.New("bootstrap token is required")
+	}
+	if input.Role != RoleWorker && input.Certificates == nil {
+		return nil, errors.New("certificates are required to bootstrap a control plane")
+	}
+	if input.Role != RoleInit {
+		if input.ControlPlaneEndpoint == "" {
+			return nil, errors.New("control plane endpoint is required to join a cluster")
+		}
+		if input.CACertHash == "" {
+			return nil, errors.New("CA certificate hash is required to join a cluster")
+		}
+	}
+
+	kubeadm, err := kubeadmConfig(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render kubeadm config: %w", err)
+	}
+
+	config := cloudConfig{}
+	for _, file := range input.Config.Files {
+		config.WriteFiles = append(config.WriteFiles, cloudInitFile(file))
+	}
+	if input.Certificates != nil {
+		config.WriteFiles = append(config.WriteFiles, certificateFiles(input.Certificates)...)
+	}
+	config.WriteFiles = append(config.WriteFiles, cloudInitFile{
+		Path:        kubeadmConfigPath,
+		Owner:       "root:root",
+		Permissions: "0640",
+		Content:     string(kubeadm),
+	})
+
+	config.RunCmd = append(config.RunCmd, input.Config.PreKubeadmCommands...)
+	config.RunCmd = append(config.RunCmd,
+		"swapoff -a",
+		`sed -i '/\bswap\b/d' /etc/fstab`,
+	)
+	if input.Role == RoleInit {
+		config.RunCmd = append(config.RunCmd, initCommands(input)...)
+	} else {
+		config.RunCmd = append(config.RunCmd, "kubeadm join --config "+kubeadmConfigPath)
+	}
+	config.RunCmd = append(config.RunCmd, input.Config.PostKubeadmCommands...)
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render cloud-config: %w", err)
+	}
+	return append([]byte("#cloud-config\n"), data...), nil
+}
+
+func initCommands(input Input) []string {
+	var commands []string
+	if input.ControlPlaneEndpoint == "" && (input.Config.ClusterConfiguration == nil || input.Config.ClusterConfiguration.ControlPlaneEndpoint == "") {
+		commands = append(commands, fmt.Sprintf(`sed -i "s/%s/$(hostname -I | awk '{print $1}'):6443/" %s`, controlPlaneEndpointPlaceholder, kubeadmConfigPath))
+	}
+	return append(commands,
+		"kubeadm init --config "+kubeadmConfigPath,
+		"mkdir -p /home/ubuntu/.kube",
+		"cp /etc/kubernetes/admin.conf /home/ubuntu/.kube/config",
+		"chown $(id -u ubuntu):$(id -g ubuntu) /home/ubuntu/.kube/config",
+	)
+}
+
+// certificateFiles returns the shared certificates at the paths kubeadm looks for them.
+func certificateFiles(certificates *Certificates) []cloudInitFile {
+	var files []cloudInitFile
+	for _, pair := range []struct {
+		name    string
+		keyPair pki.KeyPair
+		public  string
+	}{
+		{name: "ca", keyPair: certificates.CA, public: "crt"},
+		{name: "etcd/ca", keyPair: certificates.EtcdCA, public: "crt"},
+		{name: "front-proxy-ca", keyPair: certificates.FrontProxyCA, public: "crt"},
+		{name: "sa", keyPair: certificates.ServiceAccount, public: "pub"},
+	} {
+		files = append(files,
+			cloudInitFile{
+				Path:        fmt.Sprintf("%s/%s.%s", pkiPath, pair.name, pair.public),
+				Owner:       "root:root",
+				Permissions: "0644",
+				Content:     string(pair.keyPair.Cert),
+			},
+			cloudInitFile{
+				Path:        fmt.Sprintf("%s/%s.key", pkiPath, pair.name),
+				Owner:       "root:root",
+				Permissions: "0600",
+				Content:     string(pair.keyPair.Key),
+			},
+		)
+	}
+	return files
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/yaml"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/pki"
+)
+
+var _ = Describe("Bootstrap", func() {
+	config := v1beta1.KubeadmConfigSpec{
+		ClusterConfiguration: &v1beta1.ClusterConfiguration{
+			Networking: v1beta1.Networking{PodSubnet: "192.168.0.0/16"},
+		},
+		JoinConfiguration: &v1beta1.JoinConfiguration{
+			NodeRegistration: v1beta1.NodeRegistrationOptions{
+				KubeletExtraArgs: map[string]string{"node-labels": "role=worker"},
+			},
+		},
+		Files:               []v1beta1.File{{Path: "/etc/motd", Content: "hello"}},
+		PreKubeadmCommands:  []string{"echo pre"},
+		PostKubeadmCommands: []string{"echo post"},
+	}
+
+	certificates := &Certificates{
+		CA:             pki.KeyPair{Cert: []byte("ca-cert"), Key: []byte("ca-key")},
+		EtcdCA:         pki.KeyPair{Cert: []byte("etcd-cert"), Key: []byte("etcd-key")},
+		FrontProxyCA:   pki.KeyPair{Cert: []byte("front-proxy-cert"), Key: []byte("front-proxy-key")},
+		ServiceAccount: pki.KeyPair{Cert: []byte("sa-pub"), Key: []byte("sa-key")},
+	}
+	const token = "abcdef.0123456789abcdef"
+	const caCertHash = "sha256:0123"
+
+	filesByPath := func(rendered cloudConfig) map[string]cloudInitFile {
+		files := map[string]cloudInitFile{}
+		for _, file := range rendered.WriteFiles {
+			files[file.Path] = file
+		}
+		return files
+	}
+
+	render := func(input Input) (cloudConfig, string) {
+		data, err := Render(input)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(HavePrefix("#cloud-config\n"))
+
+		var rendered cloudConfig
+		Expect(yaml.Unmarshal(data, &rendered)).To(Succeed())
+		Expect(rendered.WriteFiles).NotTo(BeEmpty())
+		kubeadm := rendered.WriteFiles[len(rendered.WriteFiles)-1]
+		Expect(kubeadm.Path).To(Equal(kubeadmConfigPath))
+		return rendered, kubeadm.Content
+	}
+
+	It("should run kubeadm init on the first control plane", func() {
+		rendered, kubeadm := render(Input{
+			Role:              RoleInit,
+			KubernetesVersion: "v1.30.0",
+			Certificates:      certificates,
+			Token:             token,
+			TokenTTL:          15 * time.Minute,
+			Config:            config,
+		})
+
+		Expect(kubeadm).To(ContainSubstring("kind: ClusterConfiguration"))
+		Expect(kubeadm).To(ContainSubstring("kubernetesVersion: v1.30.0"))
+		Expect(kubeadm).To(ContainSubstring("podSubnet: 192.168.0.0/16"))
+		Expect(kubeadm).To(ContainSubstring("controlPlaneEndpoint: " + controlPlaneEndpointPlaceholder))
+		Expect(kubeadm).To(ContainSubstring("token: " + token))
+		Expect(kubeadm).To(ContainSubstring("ttl: 15m0s"))
+		Expect(kubeadm).NotTo(ContainSubstring("JoinConfiguration"))
+
+		Expect(rendered.WriteFiles[0].Path).To(Equal("/etc/motd"))
+		files := filesByPath(rendered)
+		Expect(files).To(HaveKey("/etc/kubernetes/pki/ca.crt"))
+		Expect(files["/etc/kubernetes/pki/etcd/ca.key"].Content).To(Equal("etcd-key"))
+		Expect(files["/etc/kubernetes/pki/etcd/ca.key"].Permissions).To(Equal("0600"))
+		Expect(files["/etc/kubernetes/pki/front-proxy-ca.crt"].Content).To(Equal("front-proxy-cert"))
+		Expect(files["/etc/kubernetes/pki/sa.pub"].Content).To(Equal("sa-pub"))
+		Expect(rendered.RunCmd[0]).To(Equal("echo pre"))
+		Expect(rendered.RunCmd).To(ContainElement("kubeadm init --config " + kubeadmConfigPath))
+		Expect(rendered.RunCmd).To(ContainElement("echo post"))
+		commands := strings.Join(rendered.RunCmd, "\n")
+		Expect(commands).NotTo(ContainSubstring("kubeadm join"))
+		Expect(commands).NotTo(ContainSubstring("http.server"))
+	})
+
+	It("should use the configured control plane endpoint on init", func() {
+		_, kubeadm := render(Input{
+			Role:                 RoleInit,
+			ControlPlaneEndpoint: "10.0.0.10:6443",
+			Certificates:         certificates,
+			Token:                token,
+			Config:               config,
+		})
+		Expect(kubeadm).To(ContainSubstring("controlPlaneEndpoint: 10.0.0.10:6443"))
+	})
+
+	It("should join workers with a bootstrap token and the pinned CA", func() {
+		rendered, kubeadm := render(Input{
+			Role:                 RoleWorker,
+			ControlPlaneEndpoint: "10.0.0.10:6443",
+			Token:                token,
+			CACertHash:           caCertHash,
+			Config:               config,
+		})
+
+		Expect(kubeadm).To(ContainSubstring("kind: JoinConfiguration"))
+		Expect(kubeadm).To(ContainSubstring("apiServerEndpoint: 10.0.0.10:6443"))
+		Expect(kubeadm).To(ContainSubstring("token: " + token))
+		Expect(kubeadm).To(ContainSubstring("- " + caCertHash))
+		Expect(kubeadm).To(ContainSubstring("node-labels: role=worker"))
+		Expect(kubeadm).NotTo(ContainSubstring("controlPlane:"))
+		Expect(kubeadm).NotTo(ContainSubstring("ClusterConfiguration"))
+
+		Expect(rendered.RunCmd).To(ContainElement("kubeadm join --config " + kubeadmConfigPath))
+		for _, file := range rendered.WriteFiles {
+			Expect(file.Path).NotTo(HavePrefix("/etc/kubernetes/pki/"))
+		}
+	})
+
+	It("should write the shared certificates to joining control planes", func() {
+		rendered, kubeadm := render(Input{
+			Role:                 RoleJoinControlPlane,
+			ControlPlaneEndpoint: "10.0.0.10:6443",
+			Certificates:         certificates,
+			Token:                token,
+			CACertHash:           caCertHash,
+			Config:               config,
+		})
+
+		Expect(kubeadm).To(ContainSubstring("controlPlane: {}"))
+		Expect(filesByPath(rendered)["/etc/kubernetes/pki/ca.key"].Content).To(Equal("ca-key"))
+	})
+
+	It("should refuse to render without the credentials of the role", func() {
+		_, err := Render(Input{Role: RoleWorker, Token: token, Config: config})
+		Expect(err).To(HaveOccurred())
+		_, err = Render(Input{Role: RoleWorker, ControlPlaneEndpoint: "10.0.0.10:6443", Token: token, Config: config})
+		Expect(err).To(HaveOccurred())
+		_, err = Render(Input{Role: RoleInit, Token: token, Config: config})
+		Expect(err).To(HaveOccurred())
+		_, err = Render(Input{Role: RoleInit, Certificates: certificates, Config: config})
+		Expect(err).To(HaveOccurred())
+		_, err = Render(Input{Role: "unknown"})
+		Expect(err).To(HaveOccurred())
+	})
+})
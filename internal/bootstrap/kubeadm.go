@@ -0,0 +1,132 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"bytes"
+
+	"sigs.k8s.io/yaml"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+)
+
+// kubeadmAPIVersion is the kubeadm config API the documents are written in
+const kubeadmAPIVersion = "kubeadm.k8s.io/v1beta3"
+
+type typeMeta struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+}
+
+type clusterConfiguration struct {
+	typeMeta
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	v1beta1.ClusterConfiguration
+}
+
+type initConfiguration struct {
+	typeMeta
+	BootstrapTokens  []bootstrapToken                `json:"bootstrapTokens"`
+	NodeRegistration v1beta1.NodeRegistrationOptions `json:"nodeRegistration,omitempty"`
+}
+
+type bootstrapToken struct {
+	Token string `json:"token"`
+	TTL   string `json:"ttl,omitempty"`
+}
+
+type joinConfiguration struct {
+	typeMeta
+	NodeRegistration v1beta1.NodeRegistrationOptions `json:"nodeRegistration,omitempty"`
+	Discovery        discovery                       `json:"discovery"`
+	ControlPlane     *joinControlPlane               `json:"controlPlane,omitempty"`
+}
+
+type discovery struct {
+	BootstrapToken bootstrapTokenDiscovery `json:"bootstrapToken"`
+}
+
+type bootstrapTokenDiscovery struct {
+	APIServerEndpoint string   `json:"apiServerEndpoint"`
+	Token             string   `json:"token"`
+	CACertHashes      []string `json:"caCertHashes"`
+}
+
+type joinControlPlane struct{}
+
+// kubeadmConfig returns the kubeadm config file for the role as YAML documents.
+func kubeadmConfig(input Input) ([]byte, error) {
+	var documents []any
+	switch input.Role {
+	case RoleInit:
+		config := clusterConfiguration{
+			typeMeta:          typeMeta{APIVersion: kubeadmAPIVersion, Kind: "ClusterConfiguration"},
+			KubernetesVersion: input.KubernetesVersion,
+		}
+		if input.Config.ClusterConfiguration != nil {
+			config.ClusterConfiguration = *input.Config.ClusterConfiguration
+		}
+		if config.ControlPlaneEndpoint == "" {
+			config.ControlPlaneEndpoint = input.ControlPlaneEndpoint
+		}
+		if config.ControlPlaneEndpoint == "" {
+			config.ControlPlaneEndpoint = controlPlaneEndpointPlaceholder
+		}
+		// without bootstrapTokens kubeadm init creates a token that is valid for a day
+		token := bootstrapToken{Token: input.Token}
+		if input.TokenTTL > 0 {
+			token.TTL = input.TokenTTL.String()
+		}
+		init := initConfiguration{
+			typeMeta:        typeMeta{APIVersion: kubeadmAPIVersion, Kind: "InitConfiguration"},
+			BootstrapTokens: []bootstrapToken{token},
+		}
+		if input.Config.InitConfiguration != nil {
+			init.NodeRegistration = input.Config.InitConfiguration.NodeRegistration
+		}
+		documents = append(documents, config, init)
+	default:
+		join := joinConfiguration{
+			typeMeta: typeMeta{APIVersion: kubeadmAPIVersion, Kind: "JoinConfiguration"},
+			Discovery: discovery{BootstrapToken: bootstrapTokenDiscovery{
+				APIServerEndpoint: input.ControlPlaneEndpoint,
+				Token:             input.Token,
+				CACertHashes:      []string{input.CACertHash},
+			}},
+		}
+		if input.Config.JoinConfiguration != nil {
+			join.NodeRegistration = input.Config.JoinConfiguration.NodeRegistration
+		}
+		if input.Role == RoleJoinControlPlane {
+			join.ControlPlane = &joinControlPlane{}
+		}
+		documents = append(documents, join)
+	}
+
+	var out bytes.Buffer
+	for i, document := range documents {
+		data, err := yaml.Marshal(document)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			out.WriteString("---\n")
+		}
+		out.Write(data)
+	}
+	return out.Bytes(), nil
+}
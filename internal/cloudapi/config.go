@@ -1,6 +1,10 @@
 package cloudapi
 
-import "time"
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
 
 type Config struct {
 
@@ -12,33 +16,28 @@ type Config struct {
 	// api zone
 	Zone string `envconfig:"ZONE" default:"gd1"`
 
-	// Use "password" value by default
-	IdentityMethods string `envconfig:"IDENTITY_METHODS" default:"password"`
-
-	// Use "default" value by default
+	// Use "default" value by default, used when the identity secret has no domain
 	IdentityPasswordUserDomainId string `envconfig:"IDENTITY_PASSWORD_USER_DOMAIN_ID" default:"default"`
 
-	// User's id
-	IdentityPasswordUserName string `envconfig:"IDENTITY_PASSWORD_USERNAME" default:"soongsil_a050_gov@vple.net"`
-
-	// User's password
-	IdentityPassword string `envconfig:"IDENTITY_PASSWORD" default:"Qlenfrl!#24"`
-
-	// Use "default" value by default
+	// Use "default" value by default, used when the identity secret has no domain
 	ScopeProjectDomainId string `envconfig:"SCOPE_PROJECT_DOMAIN_ID" default:"default"`
 
-	// User's id
-	ScopeProjectName string `envconfig:"SCOPE_PROJECT_NAME" default:"soongsil_a050_gov@vple.net"`
-
-	// Verbosity of the logger.
-	LogLevel string `envconfig:"LOG_LEVEL" default:"info"`
+	// User names, passwords and projects are never configured here, every KTCluster
+	// references its own credentials with spec.identityRef, see Credentials
 
 	// Client token handling approach
 	ClientAuthAutoRenew bool `envconfig:"CLIENT_AUTH_AUTO_RENEW" default:"true"`
 
+	// How long before its expiry a subject token is renewed. Has to be parsable to time.Duration
+	ClientAuthRenewBefore time.Duration `envconfig:"CLIENT_AUTH_RENEW_BEFORE" default:"10m"`
+
 	// RemoteBackendTimeout specifies timeout. Has to be parsable to time.Duration
 	RemoteBackendTimeout time.Duration `envconfig:"REMOTE_BACKEND_TIMEOUT" default:"5s"`
+}
 
-	// Kubeconfig specifies path to a kubeconfig file if the server is run outside of a cluster
-	Kubeconfig string `envconfig:"KUBECONFIG" default:""`
+// ProcessEnvVariables reads the Config from the environment.
+func ProcessEnvVariables() (Config, error) {
+	var config Config
+	err := envconfig.Process("", &config)
+	return config, err
 }
@@ -0,0 +1,85 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Keys read from the Secret referenced by KTCluster.Spec.IdentityRef
+const (
+	SecretKeyUsername = "username"
+	SecretKeyPassword = "password"
+	SecretKeyDomain   = "domain"
+	SecretKeyProject  = "project"
+	SecretKeyZone     = "zone"
+)
+
+// Credentials are the KT Cloud account details a cluster logs in with
+type Credentials struct {
+	Username        string
+	Password        string
+	UserDomainId    string
+	ProjectName     string
+	ProjectDomainId string
+	Zone            string
+}
+
+// CredentialsFromSecret reads the credentials stored in an identity secret.
+// username and password are required, the other keys fall back to config.
+func CredentialsFromSecret(secret *corev1.Secret, config Config) (Credentials, error) {
+	username := string(secret.Data[SecretKeyUsername])
+	password := string(secret.Data[SecretKeyPassword])
+	if username == "" || password == "" {
+		return Credentials{}, fmt.Errorf("secret %s/%s must contain %q and %q", secret.Namespace, secret.Name, SecretKeyUsername, SecretKeyPassword)
+	}
+
+	credentials := Credentials{
+		Username:        username,
+		Password:        password,
+		UserDomainId:    config.IdentityPasswordUserDomainId,
+		ProjectName:     username,
+		ProjectDomainId: config.ScopeProjectDomainId,
+		Zone:            config.Zone,
+	}
+	if domain := string(secret.Data[SecretKeyDomain]); domain != "" {
+		credentials.UserDomainId = domain
+		credentials.ProjectDomainId = domain
+	}
+	// KT Cloud names the default project of an account after the account
+	if project := string(secret.Data[SecretKeyProject]); project != "" {
+		credentials.ProjectName = project
+	}
+	if zone := string(secret.Data[SecretKeyZone]); zone != "" {
+		credentials.Zone = zone
+	}
+	return credentials, nil
+}
+
+// Hash identifies the credentials without revealing them, a token issued for other credentials
+// has to be replaced when the identity secret is rotated.
+func (c Credentials) Hash() string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		c.Username, c.Password, c.UserDomainId, c.ProjectName, c.ProjectDomainId, c.Zone,
+	}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudapi
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Credentials", func() {
+	config := Config{
+		Zone:                         "gd1",
+		IdentityPasswordUserDomainId: "default",
+		ScopeProjectDomainId:         "default",
+	}
+	secret := func(data map[string]string) *corev1.Secret {
+		s := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "cloud-config", Namespace: "default"},
+			Data:       map[string][]byte{},
+		}
+		for key, value := range data {
+			s.Data[key] = []byte(value)
+		}
+		return s
+	}
+
+	It("should require a username and a password", func() {
+		_, err := CredentialsFromSecret(secret(map[string]string{SecretKeyPassword: "secret"}), config)
+		Expect(err).To(MatchError(ContainSubstring("default/cloud-config")))
+
+		_, err = CredentialsFromSecret(secret(map[string]string{SecretKeyUsername: "user"}), config)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should fall back to the configured zone and domains and the project of the account", func() {
+		credentials, err := CredentialsFromSecret(secret(map[string]string{
+			SecretKeyUsername: "user",
+			SecretKeyPassword: "secret",
+		}), config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credentials).To(Equal(Credentials{
+			Username:        "user",
+			Password:        "secret",
+			UserDomainId:    "default",
+			ProjectName:     "user",
+			ProjectDomainId: "default",
+			Zone:            "gd1",
+		}))
+	})
+
+	It("should prefer the domain, project and zone of the secret", func() {
+		credentials, err := CredentialsFromSecret(secret(map[string]string{
+			SecretKeyUsername: "user",
+			SecretKeyPassword: "secret",
+			SecretKeyDomain:   "domain",
+			SecretKeyProject:  "project",
+			SecretKeyZone:     "DX-M1",
+		}), config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credentials.UserDomainId).To(Equal("domain"))
+		Expect(credentials.ProjectDomainId).To(Equal("domain"))
+		Expect(credentials.ProjectName).To(Equal("project"))
+		Expect(credentials.Zone).To(Equal("DX-M1"))
+	})
+
+	It("should hash different credentials differently", func() {
+		credentials := Credentials{Username: "user", Password: "secret", Zone: "gd1"}
+		Expect(credentials.Hash()).To(Equal(credentials.Hash()))
+		Expect(credentials.Hash()).NotTo(ContainSubstring("secret"))
+
+		rotated := credentials
+		rotated.Password = "rotated"
+		Expect(rotated.Hash()).NotTo(Equal(credentials.Hash()))
+	})
+})
@@ -0,0 +1,163 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/bootstrap"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/pki"
+)
+
+const (
+	// suffixes of the cluster certificate secrets, named <cluster>-<suffix> like in Cluster API
+	clusterCASecretSuffix      = "ca"
+	etcdCASecretSuffix         = "etcd"
+	frontProxyCASecretSuffix   = "proxy"
+	serviceAccountSecretSuffix = "sa"
+
+	// bootstrapTokenTTL is how long a bootstrap token minted for a joining machine is valid
+	bootstrapTokenTTL = 30 * time.Minute
+
+	// workloadClientCertificateValidity is how long the admin certificate the operator talks to a
+	// workload cluster with is valid
+	workloadClientCertificateValidity = time.Hour
+)
+
+// clusterCertificateSecretName returns the name of the cluster secret holding the key pair.
+func clusterCertificateSecretName(cluster *v1beta1.KTCluster, suffix string) string {
+	return cluster.Name + "-" + suffix
+}
+
+// getOrCreateClusterCertificates returns the certificate authorities and service account keys of the
+// cluster, generating the secrets holding them when they do not exist yet.
+func (r *KTMachineReconciler) getOrCreateClusterCertificates(ctx context.Context, cluster *v1beta1.KTCluster) (*bootstrap.Certificates, error) {
+	newCA := func(commonName string) func() (*pki.KeyPair, error) {
+		return func() (*pki.KeyPair, error) { return pki.NewCertificateAuthority(commonName) }
+	}
+
+	certificates := &bootstrap.Certificates{}
+	for _, keyPair := range []struct {
+		suffix   string
+		generate func() (*pki.KeyPair, error)
+		into     *pki.KeyPair
+	}{
+		{suffix: clusterCASecretSuffix, generate: newCA("kubernetes"), into: &certificates.CA},
+		{suffix: etcdCASecretSuffix, generate: newCA("etcd-ca"), into: &certificates.EtcdCA},
+		{suffix: frontProxyCASecretSuffix, generate: newCA("front-proxy-ca"), into: &certificates.FrontProxyCA},
+		{suffix: serviceAccountSecretSuffix, generate: pki.NewServiceAccountKeyPair, into: &certificates.ServiceAccount},
+	} {
+		pair, err := r.getOrCreateKeyPairSecret(ctx, cluster, clusterCertificateSecretName(cluster, keyPair.suffix), keyPair.generate)
+		if err != nil {
+			return nil, err
+		}
+		*keyPair.into = *pair
+	}
+	return certificates, nil
+}
+
+// getOrCreateKeyPairSecret reads the key pair from the secret, or generates it into a new secret owned by the cluster.
+func (r *KTMachineReconciler) getOrCreateKeyPairSecret(ctx context.Context, cluster *v1beta1.KTCluster, name string, generate func() (*pki.KeyPair, error)) (*pki.KeyPair, error) {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: cluster.Namespace}, secret)
+	if apierrors.IsNotFound(err) {
+		var keyPair *pki.KeyPair
+		keyPair, err = generate()
+		if err != nil {
+			return nil, err
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cluster.Namespace},
+			Type:       clusterSecretType,
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       keyPair.Cert,
+				corev1.TLSPrivateKeyKey: keyPair.Key,
+			},
+		}
+		if err := controllerutil.SetControllerReference(cluster, secret, r.Scheme); err != nil {
+			return nil, err
+		}
+		err = r.Create(ctx, secret)
+		if err == nil {
+			return keyPair, nil
+		}
+		// another machine of the cluster generated it first, use theirs
+		if apierrors.IsAlreadyExists(err) {
+			err = r.Get(ctx, types.NamespacedName{Name: name, Namespace: cluster.Namespace}, secret)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get certificate secret %s: %w", name, err)
+	}
+
+	keyPair := &pki.KeyPair{Cert: secret.Data[corev1.TLSCertKey], Key: secret.Data[corev1.TLSPrivateKeyKey]}
+	if len(keyPair.Cert) == 0 || len(keyPair.Key) == 0 {
+		return nil, fmt.Errorf("certificate secret %s has no %s or %s", name, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+	}
+	return keyPair, nil
+}
+
+// workloadClusterClient returns a client for the API server of the cluster at endpoint, authenticated
+// with a short-lived admin certificate signed by the cluster CA. Public IPs and load balancer VIPs are not
+// in the serving certificate, so it is verified by a name kubeadm always puts in it.
+func (r *KTMachineReconciler) workloadClusterClient(endpoint string, ca *pki.KeyPair) (client.Client, error) {
+	admin, err := ca.NewClientCertificate("kt-cloud-operator", []string{"system:masters"}, workloadClientCertificateValidity)
+	if err != nil {
+		return nil, err
+	}
+	config := &rest.Config{
+		Host: "https://" + endpoint,
+		TLSClientConfig: rest.TLSClientConfig{
+			CAData:     ca.Cert,
+			CertData:   admin.Cert,
+			KeyData:    admin.Key,
+			ServerName: apiServerServerName,
+		},
+		Timeout: 30 * time.Second,
+	}
+	if r.WorkloadClient != nil {
+		return r.WorkloadClient(config)
+	}
+	return client.New(config, client.Options{})
+}
+
+// createBootstrapToken mints a bootstrap token in the workload cluster that expires after bootstrapTokenTTL.
+func (r *KTMachineReconciler) createBootstrapToken(ctx context.Context, endpoint string, ca *pki.KeyPair) (string, error) {
+	workloadClient, err := r.workloadClusterClient(endpoint, ca)
+	if err != nil {
+		return "", err
+	}
+	token, err := pki.NewBootstrapToken()
+	if err != nil {
+		return "", err
+	}
+	if err := workloadClient.Create(ctx, pki.BootstrapTokenSecret(token, time.Now().Add(bootstrapTokenTTL))); err != nil {
+		return "", err
+	}
+	return token.String(), nil
+}
@@ -20,28 +20,38 @@ import (
 	"context"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
 	infrastructurev1beta1 "dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
 )
 
 // KTClusterReconciler reconciles a KTCluster object
 type KTClusterReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// KTCloud creates the clients used to talk to KT Cloud in the zone of the cluster
+	KTCloud ktcloud.Factory
 }
 
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktclusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktclusters/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktclusters/finalizers,verbs=update
+// +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktmachines,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=machinedeployments,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -67,56 +77,171 @@ func (r *KTClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, err
 	}
 
+	if !ktcluster.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, ktcluster)
+	}
+
 	// Fetch child resources
-	_, err := r.fetchKTSubjectToken(ctx, ktcluster, req)
+	ktSubjectToken, err := r.fetchKTSubjectToken(ctx, ktcluster, req)
 	if err != nil {
 		logger.Error(err, "Failed to find KTSubjectToken")
-		return ctrl.Result{}, nil // Or return an error if this is critical
+		waitForSubjectToken(ktcluster)
+		result, _ := r.updateStatus(ctx, ktcluster, 0)
+		return result, nil // Or return an error if this is critical
 	}
 
-	foundKTMachineTemplateCP, err := r.fetchMachineTemplate(ctx, ktcluster, "-control-plane", req)
+	foundKTMachineTemplateCP, err := r.fetchMachineTemplates(ctx, ktcluster, req)
 	if err != nil {
-		logger.Error(err, "Failed to find control-plane machine template")
-		return ctrl.Result{}, nil // Or return an error if this is critical
+		logger.Error(err, "Failed to find machine templates of the cluster")
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
 	}
 
-	foundKTMachineTemplateMD, err := r.fetchMachineTemplate(ctx, ktcluster, "-md-0", req)
+	// Check if the control plane machine template is missing
+	if foundKTMachineTemplateCP == nil {
+		logger.Info("No control plane MachineDeployment references the cluster yet. Requeuing...")
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	logger.Info("Successfully added owner references", "KTCluster.Name", ktcluster.Name)
+
+	if ktSubjectToken.Status.SubjectToken == "" || ktSubjectToken.Status.Zone == "" {
+		logger.Info("We have to reconcile again to check the Subject token")
+		waitForSubjectToken(ktcluster)
+		return r.updateStatus(ctx, ktcluster, time.Minute)
+	}
+	if managesCloudResources(ktcluster) && controllerutil.AddFinalizer(ktcluster, ktClusterFinalizer) {
+		if err := r.Update(ctx, ktcluster); err != nil {
+			logger.Error(err, "Failed to add finalizer to KTCluster")
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+	}
+	// conditions are set after the update above, which drops changes to the status
+	setClusterCondition(ktcluster, v1beta1.SubjectTokenReadyCondition, nil)
+	cloud := r.KTCloud(ktSubjectToken.Status.Zone, ktSubjectToken.Status.SubjectToken)
+
+	if managesCloudResources(ktcluster) {
+		if err := r.reconcileCloudResources(ctx, cloud, ktcluster, foundKTMachineTemplateCP); err != nil {
+			logger.Error(err, "Failed to reconcile the resources of the cluster on KT Cloud")
+			return r.updateStatus(ctx, ktcluster, time.Minute)
+		}
+	}
+
+	if err := r.reconcileFailureDomains(ctx, cloud, ktcluster); err != nil {
+		// the failure domains of the last successful call are kept
+		logger.Error(err, "Failed to list availability zones of the cluster")
+	}
+
+	endpoint, err := r.controlPlaneEndpoint(ctx, ktcluster)
 	if err != nil {
-		logger.Error(err, "Failed to find -md-0 machine template", "ktCluster", ktcluster.Name, "namespace", ktcluster.Namespace)
-		return ctrl.Result{}, nil // Or return an error if this is critical
+		logger.Error(err, "Failed to find control plane endpoint of the cluster")
+		return r.updateStatus(ctx, ktcluster, time.Minute)
 	}
+	ktcluster.Status.ControlPlaneEndpoint = endpoint
 
-	// Check if any required machine template is missing
-	if foundKTMachineTemplateCP == nil || foundKTMachineTemplateMD == nil {
-		logger.Info("One or more machine templates are missing. Requeuing...")
-		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	requeueAfter, err := r.reconcileKubeconfig(ctx, ktcluster)
+	if err != nil {
+		logger.Error(err, "Failed to write kubeconfig of the cluster")
+		requeueAfter = time.Minute
 	}
 
-	logger.Info("Successfully added owner references", "KTCluster.Name", ktcluster.Name)
-	return ctrl.Result{}, nil
+	return r.updateStatus(ctx, ktcluster, requeueAfter)
 }
 
-func (r *KTClusterReconciler) fetchMachineTemplate(ctx context.Context, ktcluster *v1beta1.KTCluster, suffix string, req ctrl.Request) (*v1beta1.KTMachineTemplate, error) {
+// managesCloudResources returns whether the cluster has resources on KT Cloud the cluster reconciler
+// creates, which have to be deleted with the cluster.
+func managesCloudResources(ktcluster *v1beta1.KTCluster) bool {
+	return ktcluster.Spec.APIServerLoadBalancer.Enabled || len(ktcluster.Spec.ManagedSubnets) > 0 ||
+		ktcluster.Spec.ManagedSecurityGroups != nil
+}
+
+// reconcileDelete deletes the API server load balancer, the managed security groups and the tier networks
+// of the cluster on KT Cloud before letting it go.
+func (r *KTClusterReconciler) reconcileDelete(ctx context.Context, ktcluster *v1beta1.KTCluster) (ctrl.Result, error) {
 	logger := log.FromContext(ctx, "LogFrom", "KTCluster")
 
-	templateName := string(ktcluster.Name + suffix)
-	machineTemplate := &v1beta1.KTMachineTemplate{}
-	err := r.Get(ctx, types.NamespacedName{Name: templateName, Namespace: ktcluster.Namespace}, machineTemplate)
+	if !controllerutil.ContainsFinalizer(ktcluster, ktClusterFinalizer) {
+		return ctrl.Result{}, nil
+	}
 
-	if err != nil {
-		if apierrors.IsNotFound(err) {
-			logger.Info("MachineTemplate not found for "+templateName, "Name", templateName, "Namespace", ktcluster.Namespace)
-			return &v1beta1.KTMachineTemplate{}, err
+	status := ktcluster.Status
+	if status.LoadBalancer != nil || len(status.Networks) > 0 || status.ControlPlaneSecurityGroup != nil || status.WorkerSecurityGroup != nil {
+		// ktsubjecttoken.name is always the same to cluster.name, it is owned by the cluster and outlives it
+		ktSubjectToken := &v1beta1.KTSubjectToken{}
+		err := r.Get(ctx, types.NamespacedName{Name: ktcluster.Name, Namespace: ktcluster.Namespace}, ktSubjectToken)
+		if err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, "Failed to get KTSubjectToken to delete the cluster resources")
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+		if err == nil {
+			if ktSubjectToken.Status.SubjectToken == "" || ktSubjectToken.Status.Zone == "" {
+				logger.Info("Subject token is not ready yet, waiting to delete the cluster resources")
+				return ctrl.Result{RequeueAfter: time.Minute}, nil
+			}
+			cloud := r.KTCloud(ktSubjectToken.Status.Zone, ktSubjectToken.Status.SubjectToken)
+			if err := r.deleteLoadBalancer(ctx, cloud, ktcluster); err != nil {
+				logger.Error(err, "Failed to delete API server load balancer on KT Cloud")
+				return ctrl.Result{RequeueAfter: time.Minute}, nil
+			}
+			// the security groups and networks can only be deleted once the machines attached to them are gone
+			if err := r.deleteSecurityGroups(ctx, cloud, ktcluster); err != nil {
+				logger.Error(err, "Failed to delete managed security groups on KT Cloud")
+				return ctrl.Result{RequeueAfter: time.Minute}, nil
+			}
+			if err := r.deleteNetworks(ctx, cloud, ktcluster); err != nil {
+				logger.Error(err, "Failed to delete tier networks on KT Cloud")
+				return ctrl.Result{RequeueAfter: time.Minute}, nil
+			}
+		} else {
+			logger.Info("KTSubjectToken of the cluster is gone, leaving the resources of the cluster on KT Cloud")
 		}
-		return &v1beta1.KTMachineTemplate{}, err
 	}
 
-	// Add owner references
-	if err := r.ktClusterForMachineTemplate(ktcluster, machineTemplate, ctx, req); err != nil {
-		logger.Error(err, "Failed to add owner reference to control-plane machine template")
+	controllerutil.RemoveFinalizer(ktcluster, ktClusterFinalizer)
+	if err := r.Update(ctx, ktcluster); err != nil {
+		logger.Error(err, "Failed to remove finalizer from KTCluster")
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
 	}
+	return ctrl.Result{}, nil
+}
+
+// fetchMachineTemplates adds owner references to the KTMachineTemplates the MachineDeployments of the
+// cluster point to with their infrastructureRef, and returns the one of the control plane deployment,
+// nil while the cluster has none.
+func (r *KTClusterReconciler) fetchMachineTemplates(ctx context.Context, ktcluster *v1beta1.KTCluster, req ctrl.Request) (*v1beta1.KTMachineTemplate, error) {
+	logger := log.FromContext(ctx, "LogFrom", "KTCluster")
 
-	return machineTemplate, nil
+	machineDeployments, err := clusterMachineDeployments(ctx, r.Client, ktcluster)
+	if err != nil {
+		return nil, err
+	}
+
+	var controlPlaneTemplate *v1beta1.KTMachineTemplate
+	for i := range machineDeployments {
+		machineDeployment := &machineDeployments[i]
+		templateKey, err := machineTemplateKey(machineDeployment)
+		if err != nil {
+			return nil, err
+		}
+		machineTemplate := &v1beta1.KTMachineTemplate{}
+		if err := r.Get(ctx, templateKey, machineTemplate); err != nil {
+			if apierrors.IsNotFound(err) {
+				logger.Info("MachineTemplate not found for "+templateKey.Name, "Name", templateKey.Name, "Namespace", templateKey.Namespace, "MachineDeployment", machineDeployment.Name)
+			}
+			return nil, err
+		}
+
+		// Add owner references
+		if !metav1.IsControlledBy(machineTemplate, ktcluster) {
+			if err := r.ktClusterForMachineTemplate(ktcluster, machineTemplate, ctx, req); err != nil {
+				logger.Error(err, "Failed to add owner reference to machine template", "Name", machineTemplate.Name)
+			}
+		}
+
+		if controlPlaneTemplate == nil && machineDeploymentRole(machineDeployment) == v1beta1.ControlPlaneMachineRole {
+			controlPlaneTemplate = machineTemplate
+		}
+	}
+	return controlPlaneTemplate, nil
 }
 
 func (r *KTClusterReconciler) fetchKTSubjectToken(ctx context.Context, ktcluster *v1beta1.KTCluster, req ctrl.Request) (*v1beta1.KTSubjectToken, error) {
@@ -189,6 +314,10 @@ func (r *KTClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&infrastructurev1beta1.KTCluster{}).
 		Owns(&v1beta1.KTSubjectToken{}).
 		Owns(&v1beta1.KTMachineTemplate{}).
+		Owns(&corev1.Secret{}).
+		Watches(&v1beta1.KTMachine{}, handler.EnqueueRequestsFromMapFunc(clusterForControlPlaneMachine)).
+		// the machine templates of the cluster are found through its deployments
+		Watches(&v1beta1.MachineDeployment{}, handler.EnqueueRequestsFromMapFunc(clusterForMachineDeployment)).
 		Named("ktcluster").
 		Complete(r)
 }
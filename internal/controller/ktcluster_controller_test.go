@@ -18,16 +18,26 @@ package controller
 
 import (
 	"context"
+	"strconv"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	infrastructurev1beta1 "dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud/fake"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/pki"
 )
 
 var _ = Describe("KTCluster Controller", func() {
@@ -69,8 +79,9 @@ var _ = Describe("KTCluster Controller", func() {
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
 			controllerReconciler := &KTClusterReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: fake.New().Factory(),
 			}
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
@@ -81,4 +92,483 @@ var _ = Describe("KTCluster Controller", func() {
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
 	})
+
+	Context("When writing the kubeconfig of a cluster", func() {
+		const resourceName = "test-kubeconfig"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		initMachineKey := types.NamespacedName{Name: resourceName + "-control-plane", Namespace: "default"}
+
+		BeforeEach(func() {
+			ktCluster := &infrastructurev1beta1.KTCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        resourceName,
+					Namespace:   "default",
+					Annotations: map[string]string{infrastructurev1beta1.ControlPlaneInitMachineAnnotation: initMachineKey.Name},
+				},
+			}
+			Expect(k8sClient.Create(ctx, ktCluster)).To(Succeed())
+
+			ca, err := pki.NewCertificateAuthority("kubernetes")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-ca", Namespace: "default"},
+				Data:       map[string][]byte{corev1.TLSCertKey: ca.Cert, corev1.TLSPrivateKeyKey: ca.Key},
+			})).To(Succeed())
+
+			initMachine := &infrastructurev1beta1.KTMachine{
+				ObjectMeta: metav1.ObjectMeta{Name: initMachineKey.Name, Namespace: "default"},
+			}
+			Expect(k8sClient.Create(ctx, initMachine)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			for _, obj := range []client.Object{
+				&infrastructurev1beta1.KTMachine{ObjectMeta: metav1.ObjectMeta{Name: initMachineKey.Name, Namespace: "default"}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-ca", Namespace: "default"}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-kubeconfig", Namespace: "default"}},
+				&infrastructurev1beta1.KTCluster{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}},
+			} {
+				Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, obj))).To(Succeed())
+			}
+		})
+
+		It("should point the kubeconfig at the public IP of the first control plane", func() {
+			controllerReconciler := &KTClusterReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			ktCluster := &infrastructurev1beta1.KTCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			secretKey := types.NamespacedName{Name: resourceName + "-kubeconfig", Namespace: "default"}
+
+			By("waiting for the public IP of the first control plane")
+			requeueAfter, err := controllerReconciler.reconcileKubeconfig(ctx, ktCluster)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(Equal(waitForKubeconfigDuration))
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, secretKey, &corev1.Secret{}))).To(BeTrue())
+
+			By("writing the kubeconfig once the public IP is assigned")
+			initMachine := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, initMachineKey, initMachine)).To(Succeed())
+			initMachine.Status.AssignedPublicIps = []infrastructurev1beta1.AssignedPublicIps{{IP: "211.0.0.10", Id: "ip-1"}}
+			Expect(k8sClient.Status().Update(ctx, initMachine)).To(Succeed())
+
+			requeueAfter, err = controllerReconciler.reconcileKubeconfig(ctx, ktCluster)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeueAfter).To(Equal(kubeconfigCertificateValidity - kubeconfigRotateBefore))
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, secretKey, secret)).To(Succeed())
+			Expect(secret.Type).To(Equal(clusterSecretType))
+			Expect(secret.Labels).To(HaveKeyWithValue(infrastructurev1beta1.ClusterNameLabel, resourceName))
+			Expect(metav1.IsControlledBy(secret, ktCluster)).To(BeTrue())
+			config, err := clientcmd.Load(secret.Data["value"])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Clusters[resourceName].Server).To(Equal("https://211.0.0.10:6443"))
+			Expect(config.Clusters[resourceName].TLSServerName).To(Equal("kubernetes"))
+
+			By("keeping the kubeconfig while it is valid")
+			resourceVersion := secret.ResourceVersion
+			_, err = controllerReconciler.reconcileKubeconfig(ctx, ktCluster)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, secretKey, secret)).To(Succeed())
+			Expect(secret.ResourceVersion).To(Equal(resourceVersion))
+
+			By("rewriting the kubeconfig when the control plane endpoint changes")
+			ktCluster.Spec.ControlPlaneEndpoint = infrastructurev1beta1.APIEndpoint{Host: "211.0.0.20", Port: 6443}
+			Expect(k8sClient.Update(ctx, ktCluster)).To(Succeed())
+			_, err = controllerReconciler.reconcileKubeconfig(ctx, ktCluster)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, secretKey, secret)).To(Succeed())
+			config, err = clientcmd.Load(secret.Data["value"])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Clusters[resourceName].Server).To(Equal("https://211.0.0.20:6443"))
+		})
+	})
+
+	Context("When provisioning the API server load balancer", func() {
+		const resourceName = "test-apiserver-lb"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"}
+		machineNames := []string{resourceName + "-a", resourceName + "-b", resourceName + "-worker"}
+
+		BeforeEach(func() {
+			ktCluster := &infrastructurev1beta1.KTCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+			}
+			ktCluster.Spec.APIServerLoadBalancer = infrastructurev1beta1.APIServerLoadBalancer{Enabled: true}
+			Expect(k8sClient.Create(ctx, ktCluster)).To(Succeed())
+
+			for i, name := range machineNames {
+				role := infrastructurev1beta1.ControlPlaneMachineRole
+				if i == 2 {
+					role = infrastructurev1beta1.WorkerMachineRole
+				}
+				ktMachine := &infrastructurev1beta1.KTMachine{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{
+						infrastructurev1beta1.ClusterNameLabel: resourceName,
+						infrastructurev1beta1.MachineRoleLabel: role,
+					}},
+				}
+				Expect(k8sClient.Create(ctx, ktMachine)).To(Succeed())
+				ktMachine.Status.ID = "vm-" + strconv.Itoa(i)
+				ktMachine.Status.Addresses = []infrastructurev1beta1.MachineAddress{{Type: infrastructurev1beta1.MachineInternalIP, Address: "172.25.0." + strconv.Itoa(10+i)}}
+				Expect(k8sClient.Status().Update(ctx, ktMachine)).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			for _, obj := range []client.Object{
+				&infrastructurev1beta1.KTMachine{ObjectMeta: metav1.ObjectMeta{Name: machineNames[0], Namespace: "default"}},
+				&infrastructurev1beta1.KTMachine{ObjectMeta: metav1.ObjectMeta{Name: machineNames[1], Namespace: "default"}},
+				&infrastructurev1beta1.KTMachine{ObjectMeta: metav1.ObjectMeta{Name: machineNames[2], Namespace: "default"}},
+				&infrastructurev1beta1.KTCluster{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}},
+			} {
+				Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, obj))).To(Succeed())
+			}
+		})
+
+		It("should register the control planes and expose the VIP as the control plane endpoint", func() {
+			cloud := fake.New()
+			controllerReconciler := &KTClusterReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+			ktClient := cloud.Factory()("gd1", "token")
+			ktCluster := &infrastructurev1beta1.KTCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+
+			By("creating the load balancer on the network of the control planes, leaving out workers")
+			Expect(controllerReconciler.reconcileLoadBalancer(ctx, ktClient, ktCluster, "tier-1")).To(Succeed())
+			Expect(cloud.LoadBalancers).To(HaveLen(1))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			Expect(ktCluster.Status.LoadBalancer).NotTo(BeNil())
+			loadBalancer := cloud.LoadBalancers[ktCluster.Status.LoadBalancer.ID]
+			Expect(loadBalancer.Name).To(Equal(resourceName + "-apiserver"))
+			Expect(loadBalancer.ServicePort).To(Equal("6443"))
+			endpoint, err := controllerReconciler.controlPlaneEndpoint(ctx, ktCluster)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(endpoint).To(Equal(infrastructurev1beta1.APIEndpoint{Host: loadBalancer.ServiceIP, Port: 6443}))
+			Expect(cloud.LoadBalancerServers[loadBalancer.ID]).To(ConsistOf(
+				HaveField("VMID", "vm-0"),
+				HaveField("VMID", "vm-1"),
+			))
+
+			By("finding the load balancer again instead of creating another one")
+			Expect(controllerReconciler.reconcileLoadBalancer(ctx, ktClient, ktCluster, "tier-1")).To(Succeed())
+			Expect(cloud.LoadBalancers).To(HaveLen(1))
+			Expect(cloud.LoadBalancerServers[loadBalancer.ID]).To(HaveLen(2))
+
+			By("deregistering a control plane that is gone")
+			Expect(k8sClient.Delete(ctx, &infrastructurev1beta1.KTMachine{
+				ObjectMeta: metav1.ObjectMeta{Name: machineNames[1], Namespace: "default"},
+			})).To(Succeed())
+			Expect(controllerReconciler.reconcileLoadBalancer(ctx, ktClient, ktCluster, "tier-1")).To(Succeed())
+			Expect(cloud.LoadBalancerServers[loadBalancer.ID]).To(ConsistOf(HaveField("VMID", "vm-0")))
+
+			By("deleting the load balancer with the cluster")
+			Expect(controllerReconciler.deleteLoadBalancer(ctx, ktClient, ktCluster)).To(Succeed())
+			Expect(cloud.LoadBalancers).To(BeEmpty())
+			Expect(controllerReconciler.deleteLoadBalancer(ctx, ktClient, ktCluster)).To(Succeed())
+		})
+	})
+
+	Context("When managing the tier networks of the managed subnets", func() {
+		const resourceName = "test-managed-subnets"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"}
+
+		BeforeEach(func() {
+			ktCluster := &infrastructurev1beta1.KTCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+			}
+			ktCluster.Spec.ManagedSubnets = []infrastructurev1beta1.ManagedSubnet{
+				{CIDR: "10.6.0.0/24", DNSNameServers: []string{"8.8.8.8"}},
+				{CIDR: "10.7.0.0/24"},
+			}
+			Expect(k8sClient.Create(ctx, ktCluster)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			ktCluster := &infrastructurev1beta1.KTCluster{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, ktCluster))).To(Succeed())
+		})
+
+		It("should create or adopt a network per subnet and only delete the created ones", func() {
+			cloud := fake.New()
+			cloud.Networks["network-adopted"] = &ktcloud.Network{ID: "network-adopted", Name: "shared", CIDR: "10.7.0.0/24", Type: "tier"}
+			controllerReconciler := &KTClusterReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+			ktClient := cloud.Factory()("gd1", "token")
+			ktCluster := &infrastructurev1beta1.KTCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+
+			By("waiting for the networks before defaulting the network tier of machines")
+			_, ready := managedNetworkTier(ktCluster)
+			Expect(ready).To(BeFalse())
+
+			By("creating the missing network and adopting the existing one")
+			Expect(controllerReconciler.reconcileNetworks(ctx, ktClient, ktCluster)).To(Succeed())
+			Expect(cloud.Networks).To(HaveLen(2))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			Expect(ktCluster.Status.Networks).To(HaveLen(2))
+			created := ktCluster.Status.Networks[0]
+			Expect(created.Name).To(Equal(resourceName + "-tier-0"))
+			Expect(created.Created).To(BeTrue())
+			Expect(cloud.Networks[created.ID].DNSNameServers).To(Equal([]string{"8.8.8.8"}))
+			Expect(ktCluster.Status.Networks[1]).To(Equal(infrastructurev1beta1.NetworkStatus{
+				ID: "network-adopted", Name: "shared", CIDR: "10.7.0.0/24",
+			}))
+
+			networkTier, ready := managedNetworkTier(ktCluster)
+			Expect(ready).To(BeTrue())
+			Expect(networkTier).To(Equal([]infrastructurev1beta1.NetworkTier{{ID: created.ID}, {ID: "network-adopted"}}))
+
+			By("keeping the networks on the next reconcile")
+			Expect(controllerReconciler.reconcileNetworks(ctx, ktClient, ktCluster)).To(Succeed())
+			Expect(cloud.Networks).To(HaveLen(2))
+			Expect(ktCluster.Status.Networks[0]).To(Equal(created))
+
+			By("deleting only the created networks with the cluster")
+			Expect(controllerReconciler.deleteNetworks(ctx, ktClient, ktCluster)).To(Succeed())
+			Expect(cloud.Networks).To(HaveKey("network-adopted"))
+			Expect(cloud.Networks).NotTo(HaveKey(created.ID))
+		})
+	})
+
+	Context("When managing the security groups of a cluster", func() {
+		const resourceName = "test-security-groups"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"}
+
+		BeforeEach(func() {
+			ktCluster := &infrastructurev1beta1.KTCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+			}
+			ktCluster.Spec.ManagedSecurityGroups = &infrastructurev1beta1.ManagedSecurityGroups{
+				AllNodesSecurityGroupRules: []infrastructurev1beta1.SecurityGroupRule{{
+					Name:                "BGP (Calico)",
+					Direction:           "ingress",
+					EtherType:           "IPv4",
+					Protocol:            "tcp",
+					PortRangeMin:        179,
+					PortRangeMax:        179,
+					RemoteManagedGroups: []string{"controlplane", "worker"},
+				}},
+			}
+			Expect(k8sClient.Create(ctx, ktCluster)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			ktCluster := &infrastructurev1beta1.KTCluster{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, ktCluster))).To(Succeed())
+		})
+
+		It("should create the groups with the Kubernetes rules and repair drift", func() {
+			cloud := fake.New()
+			controllerReconciler := &KTClusterReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+			ktClient := cloud.Factory()("gd1", "token")
+			ktCluster := &infrastructurev1beta1.KTCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+
+			By("waiting for the groups before creating machines")
+			_, ready := machineSecurityGroups(ktCluster, true)
+			Expect(ready).To(BeFalse())
+
+			By("creating the control plane and worker groups")
+			Expect(controllerReconciler.reconcileSecurityGroups(ctx, ktClient, ktCluster)).To(Succeed())
+			Expect(cloud.SecurityGroups).To(HaveLen(2))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			controlPlane := cloud.SecurityGroups[ktCluster.Status.ControlPlaneSecurityGroup.ID]
+			worker := cloud.SecurityGroups[ktCluster.Status.WorkerSecurityGroup.ID]
+			Expect(controlPlane.Name).To(Equal(resourceName + "-controlplane"))
+			Expect(worker.Name).To(Equal(resourceName + "-worker"))
+			Expect(controlPlane.Rules).To(ContainElements(
+				And(HaveField("Protocol", "tcp"), HaveField("PortRangeMin", 6443), HaveField("RemoteGroupID", "")),
+				And(HaveField("PortRangeMin", 2379), HaveField("PortRangeMax", 2380), HaveField("RemoteGroupID", controlPlane.ID)),
+				And(HaveField("PortRangeMin", 179), HaveField("RemoteGroupID", controlPlane.ID)),
+				And(HaveField("PortRangeMin", 179), HaveField("RemoteGroupID", worker.ID)),
+			))
+			Expect(worker.Rules).To(ContainElement(And(HaveField("PortRangeMin", 30000), HaveField("PortRangeMax", 32767))))
+			for _, group := range []*ktcloud.SecurityGroup{controlPlane, worker} {
+				for _, remote := range []string{controlPlane.ID, worker.ID} {
+					Expect(group.Rules).To(ContainElements(
+						And(HaveField("Direction", "ingress"), HaveField("Protocol", ""), HaveField("PortRangeMin", 0), HaveField("RemoteGroupID", remote)),
+						And(HaveField("Direction", "ingress"), HaveField("Protocol", "tcp"), HaveField("PortRangeMin", 10250), HaveField("RemoteGroupID", remote)),
+					), "rules of %s from %s", group.Name, remote)
+				}
+			}
+			Expect(worker.Rules).NotTo(ContainElement(HaveField("PortRangeMin", 2379)))
+
+			securityGroups, ready := machineSecurityGroups(ktCluster, true)
+			Expect(ready).To(BeTrue())
+			Expect(securityGroups).To(Equal([]ktcloud.SecurityGroup{{Name: resourceName + "-controlplane"}}))
+
+			By("removing rules added on KT Cloud and restoring deleted ones")
+			rules := len(controlPlane.Rules)
+			controlPlane.Rules = append(controlPlane.Rules[1:], ktcloud.SecurityGroupRule{
+				ID: "rogue", SecurityGroupID: controlPlane.ID, Direction: "ingress", EtherType: "IPv4", Protocol: "tcp", PortRangeMin: 22, PortRangeMax: 22,
+			})
+			Expect(controllerReconciler.reconcileSecurityGroups(ctx, ktClient, ktCluster)).To(Succeed())
+			Expect(cloud.SecurityGroups).To(HaveLen(2))
+			Expect(controlPlane.Rules).To(HaveLen(rules))
+			Expect(controlPlane.Rules).NotTo(ContainElement(HaveField("ID", "rogue")))
+
+			By("rejecting rules for unknown managed groups")
+			ktCluster.Spec.ManagedSecurityGroups.AllNodesSecurityGroupRules[0].RemoteManagedGroups = []string{"bastion"}
+			Expect(controllerReconciler.reconcileSecurityGroups(ctx, ktClient, ktCluster)).To(MatchError(ContainSubstring("bastion")))
+
+			By("deleting the groups with the cluster")
+			Expect(controllerReconciler.deleteSecurityGroups(ctx, ktClient, ktCluster)).To(Succeed())
+			Expect(cloud.SecurityGroups).To(BeEmpty())
+		})
+	})
+
+	Context("When reporting the status of a cluster", func() {
+		const resourceName = "test-cluster-status"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"}
+
+		BeforeEach(func() {
+			ktSubjectToken := &infrastructurev1beta1.KTSubjectToken{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+			}
+			Expect(k8sClient.Create(ctx, ktSubjectToken)).To(Succeed())
+			ktSubjectToken.Status.SubjectToken = "token"
+			ktSubjectToken.Status.Zone = "gd1"
+			Expect(k8sClient.Status().Update(ctx, ktSubjectToken)).To(Succeed())
+
+			// the templates and deployments are named freely, the cluster follows the references
+			for name, configKind := range map[string]string{"masters": "KubeadmControlPlane", "gpu-workers": "KubeadmConfigTemplate"} {
+				ktMachineTemplate := &infrastructurev1beta1.KTMachineTemplate{
+					ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-" + name + "-template", Namespace: "default"},
+				}
+				ktMachineTemplate.Spec.Template.Spec.NetworkTier = []infrastructurev1beta1.NetworkTier{{ID: "tier-" + name}}
+				Expect(k8sClient.Create(ctx, ktMachineTemplate)).To(Succeed())
+
+				machineDeployment := &infrastructurev1beta1.MachineDeployment{
+					ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-" + name, Namespace: "default"},
+				}
+				machineDeployment.Spec.Template.Spec.ClusterName = resourceName
+				machineDeployment.Spec.Template.Spec.Bootstrap.ConfigRef = infrastructurev1beta1.ConfigRef{Kind: configKind, Name: name}
+				machineDeployment.Spec.Template.Spec.InfrastructureRef = infrastructurev1beta1.InfrastructureRef{Kind: "KTMachineTemplate", Name: ktMachineTemplate.Name}
+				Expect(k8sClient.Create(ctx, machineDeployment)).To(Succeed())
+			}
+
+			ktCluster := &infrastructurev1beta1.KTCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+			}
+			ktCluster.Spec.APIServerLoadBalancer = infrastructurev1beta1.APIServerLoadBalancer{Enabled: true}
+			ktCluster.Spec.ManagedSecurityGroups = &infrastructurev1beta1.ManagedSecurityGroups{}
+			Expect(k8sClient.Create(ctx, ktCluster)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			ktCluster := &infrastructurev1beta1.KTCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			controllerutil.RemoveFinalizer(ktCluster, ktClusterFinalizer)
+			Expect(k8sClient.Update(ctx, ktCluster)).To(Succeed())
+			for _, obj := range []client.Object{
+				&infrastructurev1beta1.MachineDeployment{ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-masters", Namespace: "default"}},
+				&infrastructurev1beta1.MachineDeployment{ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-gpu-workers", Namespace: "default"}},
+				&infrastructurev1beta1.KTMachineTemplate{ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-masters-template", Namespace: "default"}},
+				&infrastructurev1beta1.KTMachineTemplate{ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-gpu-workers-template", Namespace: "default"}},
+				&infrastructurev1beta1.KTSubjectToken{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}},
+				ktCluster,
+			} {
+				Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, obj))).To(Succeed())
+			}
+		})
+
+		It("should become ready with the endpoint and failure domains, and report invalid configuration", func() {
+			cloud := fake.New()
+			cloud.AvailabilityZones = []ktcloud.AvailabilityZone{{Name: "DX-M1"}, {Name: "DX-M2"}}
+			cloud.AvailabilityZones[0].State.Available = true
+			controllerReconciler := &KTClusterReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+
+			By("reconciling the load balancer and security groups")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			ktCluster := &infrastructurev1beta1.KTCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			Expect(ktCluster.Status.Ready).To(BeTrue())
+			Expect(ktCluster.Status.LoadBalancer).NotTo(BeNil())
+			Expect(cloud.LoadBalancers[ktCluster.Status.LoadBalancer.ID].NetworkID).To(Equal("tier-masters"))
+			Expect(ktCluster.Status.ControlPlaneEndpoint).To(Equal(infrastructurev1beta1.APIEndpoint{Host: ktCluster.Status.LoadBalancer.IP, Port: 6443}))
+			Expect(ktCluster.Status.FailureDomains).To(Equal(infrastructurev1beta1.FailureDomains{"DX-M1": {ControlPlane: true}}))
+			Expect(ktCluster.Status.FailureReason).To(BeNil())
+			for _, conditionType := range []string{
+				infrastructurev1beta1.ReadyCondition,
+				infrastructurev1beta1.SubjectTokenReadyCondition,
+				infrastructurev1beta1.SecurityGroupsReadyCondition,
+				infrastructurev1beta1.LoadBalancerReadyCondition,
+			} {
+				Expect(meta.IsStatusConditionTrue(ktCluster.Status.Conditions, conditionType)).To(BeTrue(), conditionType)
+			}
+			Expect(meta.FindStatusCondition(ktCluster.Status.Conditions, infrastructurev1beta1.NetworksReadyCondition)).To(BeNil())
+			for _, name := range []string{"masters", "gpu-workers"} {
+				ktMachineTemplate := &infrastructurev1beta1.KTMachineTemplate{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-" + name + "-template", Namespace: "default"}, ktMachineTemplate)).To(Succeed())
+				Expect(metav1.IsControlledBy(ktMachineTemplate, ktCluster)).To(BeTrue())
+			}
+
+			By("reporting a security group rule that cannot be resolved")
+			ktCluster.Spec.ManagedSecurityGroups.AllNodesSecurityGroupRules = []infrastructurev1beta1.SecurityGroupRule{{
+				Name: "SSH", Protocol: "tcp", PortRangeMin: 22, PortRangeMax: 22, RemoteManagedGroups: []string{"bastion"},
+			}}
+			Expect(k8sClient.Update(ctx, ktCluster)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			Expect(ktCluster.Status.Ready).To(BeFalse())
+			ready := meta.FindStatusCondition(ktCluster.Status.Conditions, infrastructurev1beta1.ReadyCondition)
+			Expect(ready.Reason).To(Equal(infrastructurev1beta1.InvalidConfigurationReason))
+			Expect(ktCluster.Status.FailureReason).To(HaveValue(Equal(infrastructurev1beta1.InvalidConfigurationReason)))
+			Expect(ktCluster.Status.FailureMessage).To(HaveValue(ContainSubstring("bastion")))
+		})
+	})
+
+	Context("When checking whether a kubeconfig has to be rotated", func() {
+		It("should rotate before the client certificate expires or when the server changed", func() {
+			ca, err := pki.NewCertificateAuthority("kubernetes")
+			Expect(err).NotTo(HaveOccurred())
+			kubeconfig, err := newKubeconfig("cluster", "https://211.0.0.10:6443", ca)
+			Expect(err).NotTo(HaveOccurred())
+
+			rotateAt := kubeconfigRotationTime(kubeconfig, "https://211.0.0.10:6443", ca.Cert)
+			Expect(rotateAt).To(BeTemporally("~", time.Now().Add(kubeconfigCertificateValidity-kubeconfigRotateBefore), time.Minute))
+
+			Expect(kubeconfigRotationTime(kubeconfig, "https://211.0.0.20:6443", ca.Cert).IsZero()).To(BeTrue())
+			otherCA, err := pki.NewCertificateAuthority("kubernetes")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kubeconfigRotationTime(kubeconfig, "https://211.0.0.10:6443", otherCA.Cert).IsZero()).To(BeTrue())
+			Expect(kubeconfigRotationTime([]byte("garbage"), "https://211.0.0.10:6443", ca.Cert).IsZero()).To(BeTrue())
+		})
+	})
 })
@@ -0,0 +1,234 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/pki"
+)
+
+const (
+	// kubeconfigCertificateValidity is how long the client certificate in the kubeconfig is valid
+	kubeconfigCertificateValidity = 365 * 24 * time.Hour
+
+	// kubeconfigRotateBefore is how long before its client certificate expires the kubeconfig is rewritten
+	kubeconfigRotateBefore = 90 * 24 * time.Hour
+
+	// waitForKubeconfigDuration is how often the cluster checks whether the kubeconfig can be written
+	waitForKubeconfigDuration = 30 * time.Second
+
+	// apiServerServerName is a name in the serving certificate of every kubeadm API server. The public
+	// IP of a control plane is not, so the kubeconfig verifies the certificate against this name.
+	apiServerServerName = "kubernetes"
+)
+
+// kubeconfigSecretName returns the name of the secret the kubeconfig of the cluster is written to.
+func kubeconfigSecretName(ktCluster *v1beta1.KTCluster) string {
+	return ktCluster.Name + "-kubeconfig"
+}
+
+// reconcileKubeconfig writes an admin kubeconfig for the cluster into the <cluster>-kubeconfig secret in
+// the Cluster API format, and rewrites it when the endpoint or CA changed or its client certificate is
+// about to expire. It returns when the kubeconfig has to be checked again.
+func (r *KTClusterReconciler) reconcileKubeconfig(ctx context.Context, ktCluster *v1beta1.KTCluster) (time.Duration, error) {
+	logger := log.FromContext(ctx, "LogFrom", "KTCluster")
+
+	endpoint, err := r.kubeconfigEndpoint(ctx, ktCluster)
+	if err != nil {
+		return 0, err
+	}
+	if endpoint == "" {
+		logger.Info("Waiting for the public IP of the first control plane to write the kubeconfig")
+		return waitForKubeconfigDuration, nil
+	}
+	server := "https://" + endpoint
+
+	caSecret := &corev1.Secret{}
+	caSecretName := clusterCertificateSecretName(ktCluster, clusterCASecretSuffix)
+	if err := r.Get(ctx, types.NamespacedName{Name: caSecretName, Namespace: ktCluster.Namespace}, caSecret); err != nil {
+		if apierrors.IsNotFound(err) {
+			logger.Info("Waiting for the cluster CA to write the kubeconfig")
+			return waitForKubeconfigDuration, nil
+		}
+		return 0, err
+	}
+	ca := &pki.KeyPair{Cert: caSecret.Data[corev1.TLSCertKey], Key: caSecret.Data[corev1.TLSPrivateKeyKey]}
+
+	secret := &corev1.Secret{}
+	err = r.Get(ctx, types.NamespacedName{Name: kubeconfigSecretName(ktCluster), Namespace: ktCluster.Namespace}, secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return 0, err
+	}
+	exists := err == nil
+	if exists {
+		if rotateAt := kubeconfigRotationTime(secret.Data["value"], server, ca.Cert); time.Now().Before(rotateAt) {
+			return time.Until(rotateAt), nil
+		}
+	}
+
+	kubeconfig, err := newKubeconfig(ktCluster.Name, server, ca)
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate kubeconfig: %w", err)
+	}
+	if !exists {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      kubeconfigSecretName(ktCluster),
+				Namespace: ktCluster.Namespace,
+			},
+			Type: clusterSecretType,
+		}
+	}
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+	secret.Labels[v1beta1.ClusterNameLabel] = ktCluster.Name
+	secret.Data = map[string][]byte{"value": kubeconfig}
+	if err := controllerutil.SetControllerReference(ktCluster, secret, r.Scheme); err != nil {
+		return 0, err
+	}
+	if exists {
+		err = r.Update(ctx, secret)
+	} else {
+		err = r.Create(ctx, secret)
+	}
+	if err != nil {
+		return 0, err
+	}
+	logger.Info("Wrote kubeconfig of the cluster", "Secret", secret.Name, "Server", server)
+
+	return kubeconfigCertificateValidity - kubeconfigRotateBefore, nil
+}
+
+// kubeconfigEndpoint returns the host:port clients reach the API server of the cluster at, it is empty
+// while none is known.
+func (r *KTClusterReconciler) kubeconfigEndpoint(ctx context.Context, ktCluster *v1beta1.KTCluster) (string, error) {
+	endpoint, err := r.controlPlaneEndpoint(ctx, ktCluster)
+	if err != nil || endpoint.IsZero() {
+		return "", err
+	}
+	return endpoint.String(), nil
+}
+
+// controlPlaneEndpoint returns where clients reach the API server of the cluster: the configured control
+// plane endpoint, the VIP of the API server load balancer, otherwise the control plane endpoint IP of the
+// public IP pool or the public IP of the first control plane, or of another one once it is gone, at the port
+// forwarded to its API server when the IP is shared. It is zero while none is known.
+func (r *KTClusterReconciler) controlPlaneEndpoint(ctx context.Context, ktCluster *v1beta1.KTCluster) (v1beta1.APIEndpoint, error) {
+	if !ktCluster.Spec.ControlPlaneEndpoint.IsZero() {
+		return ktCluster.Spec.ControlPlaneEndpoint, nil
+	}
+	if ktCluster.Spec.APIServerLoadBalancer.Enabled {
+		if ktCluster.Status.LoadBalancer == nil || ktCluster.Status.LoadBalancer.IP == "" {
+			return v1beta1.APIEndpoint{}, nil
+		}
+		return v1beta1.APIEndpoint{Host: ktCluster.Status.LoadBalancer.IP, Port: apiServerPort}, nil
+	}
+
+	if ip := ktCluster.Spec.PublicIPPool.ControlPlaneEndpointIP; ip != "" {
+		port := int32(apiServerPort)
+		if ktCluster.Spec.PortForwarding.Enabled {
+			port = apiServerBasePort(ktCluster)
+		}
+		return v1beta1.APIEndpoint{Host: ip, Port: port}, nil
+	}
+
+	// the first control plane while it is around, otherwise any other one with a public IP
+	machines, err := controlPlaneCandidates(ctx, r.Client, ktCluster)
+	if err != nil {
+		return v1beta1.APIEndpoint{}, err
+	}
+	for _, machine := range machines {
+		for _, publicIP := range machine.Status.AssignedPublicIps {
+			switch {
+			case publicIP.IP == "":
+			case publicIP.Port == 0:
+				return v1beta1.APIEndpoint{Host: publicIP.IP, Port: apiServerPort}, nil
+			case publicIP.PrivatePort == apiServerPort:
+				return v1beta1.APIEndpoint{Host: publicIP.IP, Port: publicIP.Port}, nil
+			}
+		}
+	}
+	return v1beta1.APIEndpoint{}, nil
+}
+
+// newKubeconfig returns a kubeconfig for server with a client certificate in the system:masters group.
+func newKubeconfig(clusterName, server string, ca *pki.KeyPair) ([]byte, error) {
+	admin, err := ca.NewClientCertificate("kubernetes-admin", []string{"system:masters"}, kubeconfigCertificateValidity)
+	if err != nil {
+		return nil, err
+	}
+
+	userName := clusterName + "-admin"
+	contextName := userName + "@" + clusterName
+	config := clientcmdapi.NewConfig()
+	config.Clusters[clusterName] = &clientcmdapi.Cluster{
+		Server:                   server,
+		CertificateAuthorityData: ca.Cert,
+		TLSServerName:            apiServerServerName,
+	}
+	config.AuthInfos[userName] = &clientcmdapi.AuthInfo{
+		ClientCertificateData: admin.Cert,
+		ClientKeyData:         admin.Key,
+	}
+	config.Contexts[contextName] = &clientcmdapi.Context{
+		Cluster:  clusterName,
+		AuthInfo: userName,
+	}
+	config.CurrentContext = contextName
+	return clientcmd.Write(*config)
+}
+
+// kubeconfigRotationTime returns when the kubeconfig has to be rewritten. It is zero when the kubeconfig
+// cannot be parsed or does not point to server with the cluster CA anymore.
+func kubeconfigRotationTime(kubeconfig []byte, server string, caCert []byte) time.Time {
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return time.Time{}
+	}
+	kubeContext, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return time.Time{}
+	}
+	cluster, ok := config.Clusters[kubeContext.Cluster]
+	if !ok || cluster.Server != server || !bytes.Equal(cluster.CertificateAuthorityData, caCert) {
+		return time.Time{}
+	}
+	authInfo, ok := config.AuthInfos[kubeContext.AuthInfo]
+	if !ok {
+		return time.Time{}
+	}
+	notAfter, err := pki.CertificateNotAfter(authInfo.ClientCertificateData)
+	if err != nil {
+		return time.Time{}
+	}
+	return notAfter.Add(-kubeconfigRotateBefore)
+}
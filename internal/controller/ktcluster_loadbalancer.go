@@ -0,0 +1,193 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
+)
+
+// ktClusterFinalizer keeps a KTCluster around until its API server load balancer is deleted on KT Cloud
+const ktClusterFinalizer = "infrastructure.dcnlab.ssu.ac.kr/ktcluster"
+
+// loadBalancerName returns the name of the API server load balancer of the cluster on KT Cloud.
+func loadBalancerName(ktCluster *v1beta1.KTCluster) string {
+	return ktCluster.Name + "-apiserver"
+}
+
+// reconcileLoadBalancer creates the API server load balancer of the cluster, or finds it again by name,
+// records it in the status of the cluster and registers the running control planes with it.
+// networkID is the tier network the load balancer listens on when it has to be created.
+func (r *KTClusterReconciler) reconcileLoadBalancer(ctx context.Context, cloud ktcloud.Client, ktCluster *v1beta1.KTCluster, networkID string) error {
+	logger := log.FromContext(ctx, "LogFrom", "KTCluster")
+
+	loadBalancers, err := cloud.LoadBalancers().List(ctx)
+	if err != nil {
+		return err
+	}
+	var loadBalancer *ktcloud.LoadBalancer
+	for i := range loadBalancers {
+		if ktCluster.Status.LoadBalancer != nil && loadBalancers[i].ID == ktCluster.Status.LoadBalancer.ID ||
+			loadBalancers[i].Name == loadBalancerName(ktCluster) {
+			loadBalancer = &loadBalancers[i]
+			break
+		}
+	}
+
+	if loadBalancer == nil {
+		if networkID == "" {
+			return fmt.Errorf("%w: no network for the API server load balancer, set apiServerLoadBalancer.networkID", errInvalidClusterConfiguration)
+		}
+		id, err := cloud.LoadBalancers().Create(ctx, ktcloud.CreateLoadBalancerOpts{
+			Name:            loadBalancerName(ktCluster),
+			NetworkID:       networkID,
+			ServicePort:     strconv.Itoa(apiServerPort),
+			ServiceType:     "TCP",
+			Option:          "roundrobin",
+			HealthCheckType: "tcp",
+		})
+		if err != nil {
+			return err
+		}
+		logger.Info("Created API server load balancer", "ID", id)
+		if loadBalancers, err = cloud.LoadBalancers().List(ctx); err != nil {
+			return err
+		}
+		for i := range loadBalancers {
+			if loadBalancers[i].ID == id {
+				loadBalancer = &loadBalancers[i]
+			}
+		}
+		if loadBalancer == nil {
+			return fmt.Errorf("load balancer %s not found after creating it", id)
+		}
+	}
+
+	ktCluster.Status.LoadBalancer = &v1beta1.LoadBalancerStatus{ID: loadBalancer.ID, IP: loadBalancer.ServiceIP}
+	if err := r.Status().Update(ctx, ktCluster); err != nil {
+		return err
+	}
+
+	return r.reconcileLoadBalancerServers(ctx, cloud, ktCluster, loadBalancer.ID)
+}
+
+// reconcileLoadBalancerServers registers the control planes of the cluster that have a server with the
+// load balancer and deregisters the servers of control planes that are gone or being deleted.
+func (r *KTClusterReconciler) reconcileLoadBalancerServers(ctx context.Context, cloud ktcloud.Client, ktCluster *v1beta1.KTCluster, loadBalancerID string) error {
+	logger := log.FromContext(ctx, "LogFrom", "KTCluster")
+
+	machines, err := controlPlaneMachines(ctx, r.Client, ktCluster)
+	if err != nil {
+		return err
+	}
+	wanted := map[string]string{}
+	for _, ktMachine := range machines {
+		addresses := machineAddresses(&ktMachine)
+		if ktMachine.Status.ID == "" || len(addresses) == 0 || !ktMachine.DeletionTimestamp.IsZero() {
+			continue
+		}
+		wanted[ktMachine.Status.ID] = addresses[0]
+	}
+
+	servers, err := cloud.LoadBalancers().ListServers(ctx, loadBalancerID)
+	if err != nil {
+		return err
+	}
+	registered := map[string]bool{}
+	for _, server := range servers {
+		if _, ok := wanted[server.VMID]; ok {
+			registered[server.VMID] = true
+			continue
+		}
+		if err := cloud.LoadBalancers().RemoveServer(ctx, loadBalancerID, server.ID); err != nil && !ktcloud.IsNotFound(err) {
+			return err
+		}
+		logger.Info("Deregistered server from API server load balancer", "VMID", server.VMID)
+	}
+	for vmID, address := range wanted {
+		if registered[vmID] {
+			continue
+		}
+		if _, err := cloud.LoadBalancers().AddServer(ctx, loadBalancerID, ktcloud.AddLoadBalancerServerOpts{
+			VMID:       vmID,
+			IPAddress:  address,
+			PublicPort: strconv.Itoa(apiServerPort),
+		}); err != nil {
+			return err
+		}
+		logger.Info("Registered server with API server load balancer", "VMID", vmID, "IP", address)
+	}
+	return nil
+}
+
+// deleteLoadBalancer deletes the API server load balancer of the cluster on KT Cloud.
+func (r *KTClusterReconciler) deleteLoadBalancer(ctx context.Context, cloud ktcloud.Client, ktCluster *v1beta1.KTCluster) error {
+	if ktCluster.Status.LoadBalancer == nil {
+		return nil
+	}
+	if err := cloud.LoadBalancers().Delete(ctx, ktCluster.Status.LoadBalancer.ID); err != nil && !ktcloud.IsNotFound(err) {
+		return err
+	}
+	log.FromContext(ctx, "LogFrom", "KTCluster").Info("Deleted API server load balancer", "ID", ktCluster.Status.LoadBalancer.ID)
+	return nil
+}
+
+// controlPlaneMachines returns the KTMachines labelled as control planes of the cluster.
+func controlPlaneMachines(ctx context.Context, c client.Reader, ktCluster *v1beta1.KTCluster) ([]v1beta1.KTMachine, error) {
+	machines := &v1beta1.KTMachineList{}
+	if err := c.List(ctx, machines, client.InNamespace(ktCluster.Namespace), client.MatchingLabels{
+		v1beta1.ClusterNameLabel: ktCluster.Name,
+		v1beta1.MachineRoleLabel: v1beta1.ControlPlaneMachineRole,
+	}); err != nil {
+		return nil, err
+	}
+	return machines.Items, nil
+}
+
+// clusterForControlPlaneMachine maps a control plane KTMachine to its KTCluster, so the load balancer
+// follows the control planes as they come and go.
+func clusterForControlPlaneMachine(_ context.Context, obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	if labels[v1beta1.MachineRoleLabel] != v1beta1.ControlPlaneMachineRole || labels[v1beta1.ClusterNameLabel] == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{
+		Name:      labels[v1beta1.ClusterNameLabel],
+		Namespace: obj.GetNamespace(),
+	}}}
+}
+
+// clusterForMachineDeployment maps a MachineDeployment to the KTCluster named by its clusterName.
+func clusterForMachineDeployment(_ context.Context, obj client.Object) []reconcile.Request {
+	machineDeployment, ok := obj.(*v1beta1.MachineDeployment)
+	if !ok || machineDeployment.Spec.Template.Spec.ClusterName == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{
+		Name:      machineDeployment.Spec.Template.Spec.ClusterName,
+		Namespace: machineDeployment.Namespace,
+	}}}
+}
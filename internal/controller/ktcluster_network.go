@@ -0,0 +1,136 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
+)
+
+// managedNetworkName returns the name of the tier network created for the i-th managed subnet of the cluster.
+func managedNetworkName(ktCluster *v1beta1.KTCluster, i int) string {
+	return fmt.Sprintf("%s-tier-%d", ktCluster.Name, i)
+}
+
+// reconcileNetworks creates a tier network for every managed subnet of the cluster, or adopts the
+// tier network that already has its CIDR, and records them in the status of the cluster. Networks
+// created for subnets that were removed from the spec are deleted, they stay in the status until
+// the deletion succeeded.
+func (r *KTClusterReconciler) reconcileNetworks(ctx context.Context, cloud ktcloud.Client, ktCluster *v1beta1.KTCluster) error {
+	logger := log.FromContext(ctx, "LogFrom", "KTCluster")
+
+	existing, err := cloud.Networks().List(ctx)
+	if err != nil {
+		return err
+	}
+	byCIDR := map[string]ktcloud.Network{}
+	for _, network := range existing {
+		byCIDR[network.CIDR] = network
+	}
+	recorded := map[string]v1beta1.NetworkStatus{}
+	for _, network := range ktCluster.Status.Networks {
+		recorded[network.CIDR] = network
+	}
+
+	var networks []v1beta1.NetworkStatus
+	var errs []error
+	wanted := map[string]bool{}
+	for i, subnet := range ktCluster.Spec.ManagedSubnets {
+		wanted[subnet.CIDR] = true
+		if network, ok := byCIDR[subnet.CIDR]; ok {
+			// a network named after the cluster was created by it even if the status did not record it
+			created := network.Name == managedNetworkName(ktCluster, i)
+			if status, ok := recorded[subnet.CIDR]; ok && status.ID == network.ID {
+				created = status.Created
+			} else if !created {
+				logger.Info("Adopted tier network of managed subnet", "CIDR", subnet.CIDR, "ID", network.ID)
+			}
+			networks = append(networks, v1beta1.NetworkStatus{ID: network.ID, Name: network.Name, CIDR: network.CIDR, Created: created})
+			continue
+		}
+
+		name := managedNetworkName(ktCluster, i)
+		id, err := cloud.Networks().Create(ctx, ktcloud.CreateNetworkOpts{
+			Name:           name,
+			CIDR:           subnet.CIDR,
+			Type:           "tier",
+			DNSNameServers: subnet.DNSNameServers,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to create tier network for managed subnet %s: %w", subnet.CIDR, err))
+			continue
+		}
+		logger.Info("Created tier network of managed subnet", "CIDR", subnet.CIDR, "ID", id)
+		networks = append(networks, v1beta1.NetworkStatus{ID: id, Name: name, CIDR: subnet.CIDR, Created: true})
+	}
+
+	for _, network := range ktCluster.Status.Networks {
+		if wanted[network.CIDR] || !network.Created {
+			continue
+		}
+		if err := cloud.Networks().Delete(ctx, network.ID); err != nil && !ktcloud.IsNotFound(err) {
+			// machines still attached to the network keep it from being deleted
+			errs = append(errs, fmt.Errorf("failed to delete tier network %s of removed subnet %s: %w", network.ID, network.CIDR, err))
+			networks = append(networks, network)
+			continue
+		}
+		logger.Info("Deleted tier network of removed subnet", "CIDR", network.CIDR, "ID", network.ID)
+	}
+
+	ktCluster.Status.Networks = networks
+	if err := r.Status().Update(ctx, ktCluster); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// deleteNetworks deletes the tier networks created for the cluster on KT Cloud, adopted networks are left alone.
+func (r *KTClusterReconciler) deleteNetworks(ctx context.Context, cloud ktcloud.Client, ktCluster *v1beta1.KTCluster) error {
+	for _, network := range ktCluster.Status.Networks {
+		if !network.Created {
+			continue
+		}
+		if err := cloud.Networks().Delete(ctx, network.ID); err != nil && !ktcloud.IsNotFound(err) {
+			return fmt.Errorf("failed to delete tier network %s: %w", network.ID, err)
+		}
+		log.FromContext(ctx, "LogFrom", "KTCluster").Info("Deleted tier network", "CIDR", network.CIDR, "ID", network.ID)
+	}
+	return nil
+}
+
+// managedNetworkTier returns the tier networks KTMachines of the cluster without a network tier are
+// attached to. ready is false while a managed subnet has no network yet.
+func managedNetworkTier(ktCluster *v1beta1.KTCluster) (networkTier []v1beta1.NetworkTier, ready bool) {
+	byCIDR := map[string]string{}
+	for _, network := range ktCluster.Status.Networks {
+		byCIDR[network.CIDR] = network.ID
+	}
+	for _, subnet := range ktCluster.Spec.ManagedSubnets {
+		id, ok := byCIDR[subnet.CIDR]
+		if !ok {
+			return nil, false
+		}
+		networkTier = append(networkTier, v1beta1.NetworkTier{ID: id})
+	}
+	return networkTier, true
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
+)
+
+// securityGroupRoles are the managed security groups every cluster with managed security groups has.
+var securityGroupRoles = []string{v1beta1.ControlPlaneSecurityGroup, v1beta1.WorkerSecurityGroup}
+
+// securityGroupName returns the name of the managed security group of the cluster for role.
+func securityGroupName(ktCluster *v1beta1.KTCluster, role string) string {
+	return ktCluster.Name + "-" + role
+}
+
+// kubernetesSecurityGroupRules returns the rules the nodes with role need for Kubernetes to work.
+// The egress rules are the ones KT Cloud adds to new security groups, they are kept so the nodes can
+// reach anything. All traffic between the nodes of the cluster is allowed, the pod network of the CNI
+// plugin (VXLAN, IP-in-IP, BGP) and webhooks served by pods depend on it.
+func kubernetesSecurityGroupRules(role string) []v1beta1.SecurityGroupRule {
+	rules := []v1beta1.SecurityGroupRule{
+		{Name: "Egress (IPv4)", Direction: "egress", EtherType: "IPv4"},
+		{Name: "Egress (IPv6)", Direction: "egress", EtherType: "IPv6"},
+		{
+			Name:                "In-cluster traffic",
+			Description:         "Created by kt-cloud-operator - In-cluster traffic",
+			Direction:           "ingress",
+			EtherType:           "IPv4",
+			RemoteManagedGroups: []string{v1beta1.ControlPlaneSecurityGroup, v1beta1.WorkerSecurityGroup},
+		},
+		{
+			Name:                "Kubelet API",
+			Description:         "Created by kt-cloud-operator - Kubelet API",
+			Direction:           "ingress",
+			EtherType:           "IPv4",
+			Protocol:            "tcp",
+			PortRangeMin:        10250,
+			PortRangeMax:        10250,
+			RemoteManagedGroups: []string{v1beta1.ControlPlaneSecurityGroup, v1beta1.WorkerSecurityGroup},
+		},
+	}
+	switch role {
+	case v1beta1.ControlPlaneSecurityGroup:
+		rules = append(rules,
+			v1beta1.SecurityGroupRule{
+				Name:         "Kubernetes API",
+				Description:  "Created by kt-cloud-operator - Kubernetes API",
+				Direction:    "ingress",
+				EtherType:    "IPv4",
+				Protocol:     "tcp",
+				PortRangeMin: apiServerPort,
+				PortRangeMax: apiServerPort,
+			},
+			v1beta1.SecurityGroupRule{
+				Name:                "Etcd",
+				Description:         "Created by kt-cloud-operator - Etcd",
+				Direction:           "ingress",
+				EtherType:           "IPv4",
+				Protocol:            "tcp",
+				PortRangeMin:        2379,
+				PortRangeMax:        2380,
+				RemoteManagedGroups: []string{v1beta1.ControlPlaneSecurityGroup},
+			},
+		)
+	case v1beta1.WorkerSecurityGroup:
+		rules = append(rules, v1beta1.SecurityGroupRule{
+			Name:         "Node Port Services",
+			Description:  "Created by kt-cloud-operator - Node Port Services",
+			Direction:    "ingress",
+			EtherType:    "IPv4",
+			Protocol:     "tcp",
+			PortRangeMin: 30000,
+			PortRangeMax: 32767,
+		})
+	}
+	return rules
+}
+
+// desiredSecurityGroupRules returns the rules of the security group of the cluster for role, with the
+// remote managed groups resolved to the IDs in groupIDs. A rule is repeated for every remote group.
+func desiredSecurityGroupRules(ktCluster *v1beta1.KTCluster, role string, groupIDs map[string]string) ([]ktcloud.CreateSecurityGroupRuleOpts, error) {
+	rules := kubernetesSecurityGroupRules(role)
+	if ktCluster.Spec.ManagedSecurityGroups != nil {
+		rules = append(rules, ktCluster.Spec.ManagedSecurityGroups.AllNodesSecurityGroupRules...)
+	}
+
+	var desired []ktcloud.CreateSecurityGroupRuleOpts
+	for _, rule := range rules {
+		opts := ktcloud.CreateSecurityGroupRuleOpts{
+			SecurityGroupID: groupIDs[role],
+			Description:     rule.Description,
+			Direction:       rule.Direction,
+			EtherType:       rule.EtherType,
+			Protocol:        rule.Protocol,
+			PortRangeMin:    rule.PortRangeMin,
+			PortRangeMax:    rule.PortRangeMax,
+		}
+		if opts.Direction == "" {
+			opts.Direction = "ingress"
+		}
+		if opts.EtherType == "" {
+			opts.EtherType = "IPv4"
+		}
+		if len(rule.RemoteManagedGroups) == 0 {
+			desired = append(desired, opts)
+			continue
+		}
+		for _, remote := range rule.RemoteManagedGroups {
+			id, ok := groupIDs[remote]
+			if !ok {
+				return nil, fmt.Errorf("%w: security group rule %q refers to unknown managed group %q, use %s",
+					errInvalidClusterConfiguration, rule.Name, remote, strings.Join(securityGroupRoles, " or "))
+			}
+			opts.RemoteGroupID = id
+			desired = append(desired, opts)
+		}
+	}
+	return desired, nil
+}
+
+// securityGroupRuleKey identifies what a rule matches, rules with the same key are the same rule.
+func securityGroupRuleKey(direction, etherType, protocol string, portRangeMin, portRangeMax int, remoteGroupID, remoteIPPrefix string) string {
+	return fmt.Sprintf("%s/%s/%s/%d-%d/%s/%s", direction, etherType, strings.ToLower(protocol), portRangeMin, portRangeMax, remoteGroupID, remoteIPPrefix)
+}
+
+// reconcileSecurityGroups creates the control plane and worker security groups of the cluster, or finds
+// them again by name, records them in the status of the cluster and brings their rules back to the
+// Kubernetes rules plus the rules for all nodes, removing rules that were added on KT Cloud.
+func (r *KTClusterReconciler) reconcileSecurityGroups(ctx context.Context, cloud ktcloud.Client, ktCluster *v1beta1.KTCluster) error {
+	logger := log.FromContext(ctx, "LogFrom", "KTCluster")
+
+	groups, err := cloud.SecurityGroups().List(ctx)
+	if err != nil {
+		return err
+	}
+	byName := map[string]ktcloud.SecurityGroup{}
+	for _, group := range groups {
+		byName[group.Name] = group
+	}
+
+	existing := map[string]ktcloud.SecurityGroup{}
+	groupIDs := map[string]string{}
+	for _, role := range securityGroupRoles {
+		name := securityGroupName(ktCluster, role)
+		group, ok := byName[name]
+		if !ok {
+			created, err := cloud.SecurityGroups().Create(ctx, ktcloud.CreateSecurityGroupOpts{
+				Name:        name,
+				Description: "Created by kt-cloud-operator for the " + role + " nodes of cluster " + ktCluster.Name,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create %s security group: %w", role, err)
+			}
+			logger.Info("Created security group", "Name", name, "ID", created.ID)
+			group = *created
+		}
+		existing[role] = group
+		groupIDs[role] = group.ID
+	}
+
+	ktCluster.Status.ControlPlaneSecurityGroup = &v1beta1.SecurityGroupStatus{
+		ID:   groupIDs[v1beta1.ControlPlaneSecurityGroup],
+		Name: securityGroupName(ktCluster, v1beta1.ControlPlaneSecurityGroup),
+	}
+	ktCluster.Status.WorkerSecurityGroup = &v1beta1.SecurityGroupStatus{
+		ID:   groupIDs[v1beta1.WorkerSecurityGroup],
+		Name: securityGroupName(ktCluster, v1beta1.WorkerSecurityGroup),
+	}
+	if err := r.Status().Update(ctx, ktCluster); err != nil {
+		return err
+	}
+
+	for _, role := range securityGroupRoles {
+		desired, err := desiredSecurityGroupRules(ktCluster, role, groupIDs)
+		if err != nil {
+			return err
+		}
+		wanted := map[string]ktcloud.CreateSecurityGroupRuleOpts{}
+		for _, rule := range desired {
+			wanted[securityGroupRuleKey(rule.Direction, rule.EtherType, rule.Protocol, rule.PortRangeMin, rule.PortRangeMax, rule.RemoteGroupID, rule.RemoteIPPrefix)] = rule
+		}
+
+		for _, rule := range existing[role].Rules {
+			key := securityGroupRuleKey(rule.Direction, rule.EtherType, rule.Protocol, rule.PortRangeMin, rule.PortRangeMax, rule.RemoteGroupID, rule.RemoteIPPrefix)
+			if _, ok := wanted[key]; ok {
+				delete(wanted, key)
+				continue
+			}
+			if err := cloud.SecurityGroups().DeleteRule(ctx, rule.ID); err != nil && !ktcloud.IsNotFound(err) {
+				return fmt.Errorf("failed to delete rule %s of %s security group: %w", rule.ID, role, err)
+			}
+			logger.Info("Deleted security group rule", "SecurityGroup", existing[role].Name, "Rule", key)
+		}
+
+		for key, rule := range wanted {
+			if _, err := cloud.SecurityGroups().CreateRule(ctx, rule); err != nil {
+				return fmt.Errorf("failed to add rule %s to %s security group: %w", key, role, err)
+			}
+			logger.Info("Added security group rule", "SecurityGroup", existing[role].Name, "Rule", key)
+		}
+	}
+	return nil
+}
+
+// deleteSecurityGroups deletes the managed security groups of the cluster on KT Cloud.
+func (r *KTClusterReconciler) deleteSecurityGroups(ctx context.Context, cloud ktcloud.Client, ktCluster *v1beta1.KTCluster) error {
+	for _, group := range []*v1beta1.SecurityGroupStatus{ktCluster.Status.ControlPlaneSecurityGroup, ktCluster.Status.WorkerSecurityGroup} {
+		if group == nil {
+			continue
+		}
+		if err := cloud.SecurityGroups().Delete(ctx, group.ID); err != nil && !ktcloud.IsNotFound(err) {
+			return fmt.Errorf("failed to delete security group %s: %w", group.Name, err)
+		}
+		log.FromContext(ctx, "LogFrom", "KTCluster").Info("Deleted security group", "Name", group.Name, "ID", group.ID)
+	}
+	return nil
+}
+
+// machineSecurityGroups returns the managed security groups a machine of the cluster is created with,
+// the control plane or the worker one. ready is false while the cluster has not created them yet.
+func machineSecurityGroups(ktCluster *v1beta1.KTCluster, controlPlane bool) (securityGroups []ktcloud.SecurityGroup, ready bool) {
+	if ktCluster.Spec.ManagedSecurityGroups == nil {
+		return nil, true
+	}
+	group := ktCluster.Status.WorkerSecurityGroup
+	if controlPlane {
+		group = ktCluster.Status.ControlPlaneSecurityGroup
+	}
+	if group == nil {
+		return nil, false
+	}
+	return []ktcloud.SecurityGroup{{Name: group.Name}}, true
+}
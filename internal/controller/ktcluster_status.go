@@ -0,0 +1,198 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
+)
+
+// errInvalidClusterConfiguration is wrapped by errors that persist until the spec of the cluster changes
+var errInvalidClusterConfiguration = errors.New("invalid cluster configuration")
+
+// clusterReadinessConditions are the conditions the Ready condition of a cluster summarizes, in the order
+// the cluster reconciler works through them.
+var clusterReadinessConditions = []string{
+	v1beta1.SubjectTokenReadyCondition,
+	v1beta1.NetworksReadyCondition,
+	v1beta1.SecurityGroupsReadyCondition,
+	v1beta1.LoadBalancerReadyCondition,
+}
+
+// setClusterCondition sets the condition of the cluster after reconciling what it covers returned err.
+func setClusterCondition(ktCluster *v1beta1.KTCluster, conditionType string, err error) {
+	condition := metav1.Condition{
+		Type:               conditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             v1beta1.ReconciledReason,
+		ObservedGeneration: ktCluster.Generation,
+	}
+	switch {
+	case errors.Is(err, errInvalidClusterConfiguration):
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = v1beta1.InvalidConfigurationReason
+		condition.Message = err.Error()
+	case err != nil:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = v1beta1.ReconcileFailedReason
+		condition.Message = err.Error()
+	}
+	meta.SetStatusCondition(&ktCluster.Status.Conditions, condition)
+}
+
+// waitForSubjectToken marks the readiness conditions of everything the cluster manages on KT Cloud as
+// waiting for the subject token.
+func waitForSubjectToken(ktCluster *v1beta1.KTCluster) {
+	for _, conditionType := range clusterReadinessConditions {
+		if conditionType != v1beta1.SubjectTokenReadyCondition && meta.FindStatusCondition(ktCluster.Status.Conditions, conditionType) == nil {
+			continue
+		}
+		meta.SetStatusCondition(&ktCluster.Status.Conditions, metav1.Condition{
+			Type:               conditionType,
+			Status:             metav1.ConditionFalse,
+			Reason:             v1beta1.WaitingForSubjectTokenReason,
+			Message:            "Waiting for KTSubjectToken " + ktCluster.Name + " to hold a token",
+			ObservedGeneration: ktCluster.Generation,
+		})
+	}
+}
+
+// reconcileCloudResources reconciles the tier networks, security groups and API server load balancer of
+// the cluster in that order, recording a readiness condition for each of them that is enabled. It stops at
+// the first error, as the load balancer may be placed on a managed network.
+func (r *KTClusterReconciler) reconcileCloudResources(ctx context.Context, cloud ktcloud.Client, ktCluster *v1beta1.KTCluster, controlPlaneTemplate *v1beta1.KTMachineTemplate) error {
+	if len(ktCluster.Spec.ManagedSubnets) > 0 || len(ktCluster.Status.Networks) > 0 {
+		err := r.reconcileNetworks(ctx, cloud, ktCluster)
+		if len(ktCluster.Spec.ManagedSubnets) > 0 {
+			setClusterCondition(ktCluster, v1beta1.NetworksReadyCondition, err)
+		} else {
+			meta.RemoveStatusCondition(&ktCluster.Status.Conditions, v1beta1.NetworksReadyCondition)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if ktCluster.Spec.ManagedSecurityGroups != nil {
+		err := r.reconcileSecurityGroups(ctx, cloud, ktCluster)
+		setClusterCondition(ktCluster, v1beta1.SecurityGroupsReadyCondition, err)
+		if err != nil {
+			return err
+		}
+	} else {
+		meta.RemoveStatusCondition(&ktCluster.Status.Conditions, v1beta1.SecurityGroupsReadyCondition)
+	}
+
+	if ktCluster.Spec.APIServerLoadBalancer.Enabled {
+		networkID := ktCluster.Spec.APIServerLoadBalancer.NetworkID
+		if networkID == "" && len(controlPlaneTemplate.Spec.Template.Spec.NetworkTier) > 0 {
+			networkID = controlPlaneTemplate.Spec.Template.Spec.NetworkTier[0].ID
+		}
+		if networkID == "" && len(ktCluster.Status.Networks) > 0 {
+			networkID = ktCluster.Status.Networks[0].ID
+		}
+		err := r.reconcileLoadBalancer(ctx, cloud, ktCluster, networkID)
+		if err == nil && (ktCluster.Status.LoadBalancer == nil || ktCluster.Status.LoadBalancer.IP == "") {
+			meta.SetStatusCondition(&ktCluster.Status.Conditions, metav1.Condition{
+				Type:               v1beta1.LoadBalancerReadyCondition,
+				Status:             metav1.ConditionFalse,
+				Reason:             v1beta1.WaitingForLoadBalancerIPReason,
+				Message:            "Waiting for KT Cloud to assign an IP to load balancer " + loadBalancerName(ktCluster),
+				ObservedGeneration: ktCluster.Generation,
+			})
+		} else {
+			setClusterCondition(ktCluster, v1beta1.LoadBalancerReadyCondition, err)
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		meta.RemoveStatusCondition(&ktCluster.Status.Conditions, v1beta1.LoadBalancerReadyCondition)
+	}
+	return nil
+}
+
+// reconcileFailureDomains records the available availability zones of the zone of the cluster as its
+// failure domains, control planes may be placed in all of them.
+func (r *KTClusterReconciler) reconcileFailureDomains(ctx context.Context, cloud ktcloud.Client, ktCluster *v1beta1.KTCluster) error {
+	zones, err := cloud.Servers().ListAvailabilityZones(ctx)
+	if err != nil {
+		return err
+	}
+	failureDomains := v1beta1.FailureDomains{}
+	for _, zone := range zones {
+		if zone.State.Available {
+			failureDomains[zone.Name] = v1beta1.FailureDomainSpec{ControlPlane: true}
+		}
+	}
+	ktCluster.Status.FailureDomains = failureDomains
+	return nil
+}
+
+// updateStatus summarizes the readiness conditions of the cluster in Ready, its Ready condition and failure
+// reason, writes the status and requeues the cluster after requeueAfter.
+func (r *KTClusterReconciler) updateStatus(ctx context.Context, ktCluster *v1beta1.KTCluster, requeueAfter time.Duration) (ctrl.Result, error) {
+	logger := log.FromContext(ctx, "LogFrom", "KTCluster")
+
+	ready := metav1.Condition{
+		Type:               v1beta1.ReadyCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             v1beta1.ReconciledReason,
+		ObservedGeneration: ktCluster.Generation,
+	}
+	ktCluster.Status.FailureReason = nil
+	ktCluster.Status.FailureMessage = nil
+	for _, conditionType := range clusterReadinessConditions {
+		condition := meta.FindStatusCondition(ktCluster.Status.Conditions, conditionType)
+		if condition == nil {
+			if conditionType == v1beta1.SubjectTokenReadyCondition {
+				ready.Status = metav1.ConditionFalse
+				ready.Reason = v1beta1.WaitingForSubjectTokenReason
+				break
+			}
+			continue
+		}
+		if condition.Status != metav1.ConditionTrue {
+			ready.Status = metav1.ConditionFalse
+			ready.Reason = condition.Reason
+			ready.Message = condition.Message
+			if condition.Reason == v1beta1.InvalidConfigurationReason {
+				reason, message := condition.Reason, condition.Message
+				ktCluster.Status.FailureReason = &reason
+				ktCluster.Status.FailureMessage = &message
+			}
+			break
+		}
+	}
+	meta.SetStatusCondition(&ktCluster.Status.Conditions, ready)
+	ktCluster.Status.Ready = ready.Status == metav1.ConditionTrue
+
+	if err := r.Status().Update(ctx, ktCluster); err != nil {
+		logger.Error(err, "Failed to update KTCluster status")
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
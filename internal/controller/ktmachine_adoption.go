@@ -0,0 +1,154 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
+)
+
+// adoptServer imports the existing server named by the serverID of the machine instead of creating one,
+// together with the public IPs bound to it, and tags it like the servers the operator creates. The machine
+// fails if the server does not exist or another machine already holds it.
+func (r *KTMachineReconciler) adoptServer(ctx context.Context, cloud ktcloud.Client, zone string, ktMachine *v1beta1.KTMachine, original *v1beta1.KTMachineStatus) (ctrl.Result, error) {
+	logger := log.FromContext(ctx, "LogFrom", "KTMachine")
+
+	serverID := ktMachine.Spec.ServerID
+	holder, err := r.machineHoldingServer(ctx, ktMachine, serverID)
+	if err != nil {
+		logger.Error(err, "Failed to list the machines holding the server to adopt", "ID", serverID)
+		return ctrl.Result{}, err
+	}
+	if holder != "" {
+		logger.Info("Server to adopt is already held by another machine", "ID", serverID, "KTMachine", holder)
+		reason, message := v1beta1.InstanceAlreadyAdoptedReason, "Server "+serverID+" to adopt is already held by KTMachine "+holder
+		ktMachine.Status.FailureReason = &reason
+		ktMachine.Status.FailureMessage = &message
+		setMachineCondition(ktMachine, v1beta1.InstanceReadyCondition, metav1.ConditionFalse, reason, message)
+		return r.updateMachineStatus(ctx, ktMachine, original, machineResyncDuration)
+	}
+
+	server, err := cloud.Servers().Get(ctx, serverID)
+	if ktcloud.IsNotFound(err) {
+		logger.Info("Server to adopt does not exist on KT Cloud", "ID", serverID)
+		reason, message := v1beta1.InstanceNotFoundReason, "Server "+serverID+" to adopt does not exist on KT Cloud"
+		ktMachine.Status.FailureReason = &reason
+		ktMachine.Status.FailureMessage = &message
+		setMachineCondition(ktMachine, v1beta1.InstanceReadyCondition, metav1.ConditionFalse, reason, message)
+		return r.updateMachineStatus(ctx, ktMachine, original, machineResyncDuration)
+	}
+	if err != nil {
+		logger.Error(err, "Failed to query the server to adopt on KT Cloud", "ID", serverID)
+		return ctrl.Result{}, err
+	}
+
+	cluster, err := r.GetMachineAssociatedCluster(ctx, ktMachine, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(ktMachine)})
+	if err != nil {
+		logger.Error(err, "Failed to retrieve cluster for Machine")
+		return ctrl.Result{}, err
+	}
+	if err := cloud.Servers().SetMetadata(ctx, server.ID, serverMetadata(cluster, ktMachine)); err != nil {
+		logger.Error(err, "Failed to tag the server to adopt on KT Cloud", "ID", server.ID)
+		return r.updateMachineStatusWithError(ctx, ktMachine, original, err)
+	}
+
+	if len(ktMachine.Spec.PublicIPIDs) > 0 {
+		assigned, err := adoptedPublicIPs(ctx, cloud, ktMachine.Spec.PublicIPIDs)
+		if err != nil {
+			logger.Error(err, "Failed to look up the public IPs of the server to adopt")
+			return r.updateMachineStatusWithError(ctx, ktMachine, original, err)
+		}
+		ktMachine.Status.AssignedPublicIps = assigned
+	}
+
+	logger.Info("Adopted existing server on KT Cloud", "ID", server.ID)
+	setStatusFromServer(ktMachine, zone, server)
+	return r.updateMachineStatus(ctx, ktMachine, original, machineRequeueDuration(ktMachine))
+}
+
+// machineHoldingServer returns the name of another machine in the namespace that holds the server, or ""
+// if there is none. Of two machines adopting the same server, the one created first holds it.
+func (r *KTMachineReconciler) machineHoldingServer(ctx context.Context, ktMachine *v1beta1.KTMachine, serverID string) (string, error) {
+	ktMachines := &v1beta1.KTMachineList{}
+	if err := r.List(ctx, ktMachines, client.InNamespace(ktMachine.Namespace)); err != nil {
+		return "", err
+	}
+	for _, other := range ktMachines.Items {
+		if other.Name == ktMachine.Name {
+			continue
+		}
+		if other.Status.ID == serverID {
+			return other.Name, nil
+		}
+		if other.Spec.ServerID == serverID && createdBefore(&other, ktMachine) {
+			return other.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// createdBefore reports whether a was created before b, ordering machines created in the same second by name.
+func createdBefore(a, b *v1beta1.KTMachine) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Name < b.Name
+}
+
+// serverDeletionPolicy returns the deletion policy of the machine. Without one, adopted servers are left
+// on KT Cloud and the servers the machine created are deleted.
+func serverDeletionPolicy(ktMachine *v1beta1.KTMachine) v1beta1.ServerDeletionPolicy {
+	if ktMachine.Spec.DeletionPolicy != "" {
+		return ktMachine.Spec.DeletionPolicy
+	}
+	if ktMachine.Spec.ServerID != "" {
+		return v1beta1.OrphanServerDeletionPolicy
+	}
+	return v1beta1.DeleteServerDeletionPolicy
+}
+
+// adoptedPublicIPs returns the public IPs with the given IDs as assigned to the machine.
+func adoptedPublicIPs(ctx context.Context, cloud ktcloud.Client, ids []string) ([]v1beta1.AssignedPublicIps, error) {
+	publicIPs, err := cloud.IPAddresses().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	assigned := make([]v1beta1.AssignedPublicIps, 0, len(ids))
+	for _, id := range ids {
+		found := false
+		for _, publicIP := range publicIPs {
+			if publicIP.Id == id {
+				assigned = append(assigned, v1beta1.AssignedPublicIps{Id: publicIP.Id, IP: publicIP.IP})
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("public IP %s does not exist on KT Cloud", id)
+		}
+	}
+	return assigned, nil
+}
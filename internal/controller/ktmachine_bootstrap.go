@@ -0,0 +1,353 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/bootstrap"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/pki"
+)
+
+const (
+	// clusterSecretType is the Cluster API type of the secrets generated for clusters and machines
+	clusterSecretType corev1.SecretType = "cluster.x-k8s.io/secret"
+
+	// waitForBootstrapDataDuration is how often a machine checks whether it can be bootstrapped
+	waitForBootstrapDataDuration = 15 * time.Second
+)
+
+// errBootstrapNotReady is wrapped with what the machine waits for, such as the first control plane,
+// before its bootstrap data can be generated
+var errBootstrapNotReady = errors.New("bootstrap data not ready")
+
+// bootstrapDataSecretName returns the name of the secret the bootstrap data of the machine is generated into.
+func bootstrapDataSecretName(ktMachine *v1beta1.KTMachine) string {
+	return ktMachine.Name + "-bootstrap"
+}
+
+// getUserData returns the cloud-init user data to create the machine with: spec.userData when set,
+// otherwise the bootstrap data, which is generated on first use. The error wraps errBootstrapNotReady
+// with what the machine waits for while its bootstrap data cannot be generated yet.
+func (r *KTMachineReconciler) getUserData(ctx context.Context, ktMachine *v1beta1.KTMachine, req ctrl.Request) (string, error) {
+	if ktMachine.Spec.UserData != "" {
+		return ktMachine.Spec.UserData, nil
+	}
+
+	if ktMachine.Spec.Bootstrap.DataSecretName == nil {
+		if err := r.generateBootstrapData(ctx, ktMachine, req); err != nil {
+			return "", err
+		}
+	}
+
+	secret := &corev1.Secret{}
+	secretName := *ktMachine.Spec.Bootstrap.DataSecretName
+	if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: ktMachine.Namespace}, secret); err != nil {
+		return "", fmt.Errorf("failed to get bootstrap data secret %s: %w", secretName, err)
+	}
+	value, ok := secret.Data["value"]
+	if !ok {
+		return "", fmt.Errorf("bootstrap data secret %s has no value", secretName)
+	}
+	return string(value), nil
+}
+
+// generateBootstrapData renders the bootstrap data of the machine into a secret owned by the
+// machine and points spec.bootstrap.dataSecretName to it.
+func (r *KTMachineReconciler) generateBootstrapData(ctx context.Context, ktMachine *v1beta1.KTMachine, req ctrl.Request) error {
+	logger := log.FromContext(ctx, "LogFrom", "Machine")
+
+	input, err := r.bootstrapInput(ctx, ktMachine, req)
+	if err != nil {
+		return err
+	}
+	data, err := bootstrap.Render(input)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      bootstrapDataSecretName(ktMachine),
+			Namespace: ktMachine.Namespace,
+		},
+		Type: clusterSecretType,
+		Data: map[string][]byte{
+			"value":  data,
+			"format": []byte(bootstrap.Format),
+		},
+	}
+	if err := controllerutil.SetControllerReference(ktMachine, secret, r.Scheme); err != nil {
+		return err
+	}
+	// a previous reconcile may have created the secret but failed to update the machine
+	if err := r.Create(ctx, secret); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	logger.Info("Generated bootstrap data for machine", "Role", input.Role, "Secret", secret.Name)
+
+	ktMachine.Spec.Bootstrap.DataSecretName = &secret.Name
+	return r.Update(ctx, ktMachine)
+}
+
+// bootstrapInput collects the kubeadm configuration of the machine's role from the bootstrap
+// configRef of its MachineDeployment: a KubeadmControlPlane for control planes, a KubeadmConfigTemplate
+// for workers. The first control plane of the cluster runs kubeadm init, all other machines join a running
+// control plane with a bootstrap token minted in the workload cluster, which the operator reaches at the control
+// plane endpoint of the cluster rather than the address the machine joins at. Control planes get the cluster certificates.
+func (r *KTMachineReconciler) bootstrapInput(ctx context.Context, ktMachine *v1beta1.KTMachine, req ctrl.Request) (bootstrap.Input, error) {
+	input := bootstrap.Input{Role: bootstrap.RoleWorker}
+
+	machineDeployment, err := r.getOwnerMachineDeployment(ctx, ktMachine)
+	if err != nil {
+		return input, err
+	}
+	if machineDeployment == nil {
+		return input, errors.New("machine has no MachineDeployment to bootstrap it from")
+	}
+	input.KubernetesVersion = machineDeployment.Spec.Template.Spec.Version
+
+	configRef := machineDeployment.Spec.Template.Spec.Bootstrap.ConfigRef
+	configKey := types.NamespacedName{Name: configRef.Name, Namespace: machineDeployment.Namespace}
+	switch configRef.Kind {
+	case "KubeadmControlPlane":
+		kubeadmControlPlane := &v1beta1.KubeadmControlPlane{}
+		if err := r.Get(ctx, configKey, kubeadmControlPlane); err != nil {
+			return input, fmt.Errorf("failed to get KubeadmControlPlane %s: %w", configRef.Name, err)
+		}
+		input.Role = bootstrap.RoleInit
+		input.Config = kubeadmControlPlane.Spec.KubeadmConfigSpec
+		if kubeadmControlPlane.Spec.Version != "" {
+			input.KubernetesVersion = kubeadmControlPlane.Spec.Version
+		}
+	case "KubeadmConfigTemplate":
+		kubeadmConfigTemplate := &v1beta1.KubeadmConfigTemplate{}
+		if err := r.Get(ctx, configKey, kubeadmConfigTemplate); err != nil {
+			return input, fmt.Errorf("failed to get KubeadmConfigTemplate %s: %w", configRef.Name, err)
+		}
+		input.Config = kubeadmConfigTemplate.Spec.Template.Spec
+	case "":
+		// deployments without a bootstrap config are control planes when labelled so
+		if machineDeploymentRole(machineDeployment) == v1beta1.ControlPlaneMachineRole {
+			input.Role = bootstrap.RoleInit
+		}
+	default:
+		return input, fmt.Errorf("unsupported bootstrap configRef kind %q", configRef.Kind)
+	}
+
+	cluster, err := r.GetMachineAssociatedCluster(ctx, ktMachine, req)
+	if err != nil {
+		return input, err
+	}
+	if cluster == nil {
+		return input, errors.New("cluster empty from get-associated-cluster for machine")
+	}
+
+	certificates, err := r.getOrCreateClusterCertificates(ctx, cluster)
+	if err != nil {
+		return input, err
+	}
+
+	// with an API server load balancer every control plane is reached at its VIP, kubeadm init included
+	loadBalancerEndpoint := ""
+	if cluster.Spec.APIServerLoadBalancer.Enabled {
+		if cluster.Status.LoadBalancer == nil || cluster.Status.LoadBalancer.IP == "" {
+			return input, fmt.Errorf("%w: waiting for the API server load balancer of the cluster", errBootstrapNotReady)
+		}
+		loadBalancerEndpoint = net.JoinHostPort(cluster.Status.LoadBalancer.IP, strconv.Itoa(apiServerPort))
+	}
+
+	initMachineName := cluster.Annotations[v1beta1.ControlPlaneInitMachineAnnotation]
+	if input.Role == bootstrap.RoleInit {
+		if initMachineName == "" {
+			// the update fails on conflict when another control plane claimed init concurrently
+			if cluster.Annotations == nil {
+				cluster.Annotations = map[string]string{}
+			}
+			cluster.Annotations[v1beta1.ControlPlaneInitMachineAnnotation] = ktMachine.Name
+			if err := r.Update(ctx, cluster); err != nil {
+				return input, fmt.Errorf("failed to claim control plane init for machine: %w", err)
+			}
+			initMachineName = ktMachine.Name
+		}
+		input.Certificates = certificates
+		if initMachineName == ktMachine.Name {
+			// kubeadm init creates the token, nobody else can reach the API server before it
+			token, err := pki.NewBootstrapToken()
+			if err != nil {
+				return input, err
+			}
+			input.Token = token.String()
+			input.TokenTTL = bootstrapTokenTTL
+			input.ControlPlaneEndpoint = loadBalancerEndpoint
+			return input, nil
+		}
+		input.Role = bootstrap.RoleJoinControlPlane
+	}
+	if initMachineName == "" {
+		return input, fmt.Errorf("%w: waiting for the first control plane of the cluster", errBootstrapNotReady)
+	}
+
+	joinMachine, err := joinControlPlaneMachine(ctx, r.Client, cluster)
+	if err != nil {
+		return input, fmt.Errorf("failed to find a control plane machine to join: %w", err)
+	}
+	if joinMachine == nil {
+		return input, fmt.Errorf("%w: waiting for a control plane of the cluster with an address to join", errBootstrapNotReady)
+	}
+	addresses := machineAddresses(joinMachine)
+	if input.Config.ClusterConfiguration != nil && input.Config.ClusterConfiguration.ControlPlaneEndpoint != "" {
+		input.ControlPlaneEndpoint = input.Config.ClusterConfiguration.ControlPlaneEndpoint
+	} else if loadBalancerEndpoint != "" {
+		input.ControlPlaneEndpoint = loadBalancerEndpoint
+	} else {
+		input.ControlPlaneEndpoint = addresses[0] + ":6443"
+	}
+
+	input.CACertHash, err = pki.CertificateHash(certificates.CA.Cert)
+	if err != nil {
+		return input, err
+	}
+	// the machine joins at an address of the tier, the operator reaches the API server from outside KT Cloud
+	if cluster.Status.ControlPlaneEndpoint.Host == "" {
+		return input, fmt.Errorf("%w: waiting for the control plane endpoint of the cluster", errBootstrapNotReady)
+	}
+	workloadEndpoint := cluster.Status.ControlPlaneEndpoint.String()
+	input.Token, err = r.createBootstrapToken(ctx, workloadEndpoint, &certificates.CA)
+	if err != nil {
+		// the API server is unreachable until kubeadm init finished on the first control plane
+		return input, fmt.Errorf("%w: failed to create bootstrap token in the workload cluster at %s: %s",
+			errBootstrapNotReady, workloadEndpoint, err.Error())
+	}
+	return input, nil
+}
+
+// controlPlaneCandidates returns the control plane machines of the cluster that are not being deleted: the
+// machine named by the ControlPlaneInitMachineAnnotation first while it is around, then the others by name.
+func controlPlaneCandidates(ctx context.Context, c client.Reader, cluster *v1beta1.KTCluster) ([]v1beta1.KTMachine, error) {
+	var candidates []v1beta1.KTMachine
+
+	// the init machine is looked up by name, it may predate the role labels
+	initMachineName := cluster.Annotations[v1beta1.ControlPlaneInitMachineAnnotation]
+	if initMachineName != "" {
+		initMachine := &v1beta1.KTMachine{}
+		err := c.Get(ctx, types.NamespacedName{Name: initMachineName, Namespace: cluster.Namespace}, initMachine)
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		if err == nil && initMachine.DeletionTimestamp.IsZero() {
+			candidates = append(candidates, *initMachine)
+		}
+	}
+
+	machines, err := controlPlaneMachines(ctx, c, cluster)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(machines, func(i, j int) bool { return machines[i].Name < machines[j].Name })
+	for _, machine := range machines {
+		if machine.Name != initMachineName && machine.DeletionTimestamp.IsZero() {
+			candidates = append(candidates, machine)
+		}
+	}
+	return candidates, nil
+}
+
+// joinControlPlaneMachine returns the control plane machine other machines join the cluster through: the
+// machine that ran kubeadm init once it has an address, otherwise any running control plane with one. It
+// returns nil while there is none.
+func joinControlPlaneMachine(ctx context.Context, c client.Reader, cluster *v1beta1.KTCluster) (*v1beta1.KTMachine, error) {
+	candidates, err := controlPlaneCandidates(ctx, c, cluster)
+	if err != nil {
+		return nil, err
+	}
+	initMachineName := cluster.Annotations[v1beta1.ControlPlaneInitMachineAnnotation]
+	for i, candidate := range candidates {
+		running := candidate.Name == initMachineName || candidate.Status.InstanceState == "ACTIVE"
+		if running && len(machineAddresses(&candidate)) > 0 {
+			return &candidates[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// releaseControlPlaneInit moves the ControlPlaneInitMachineAnnotation of the cluster away from a machine that
+// is deleted or gets a new server, see moveControlPlaneInit.
+func (r *KTMachineReconciler) releaseControlPlaneInit(ctx context.Context, ktMachine *v1beta1.KTMachine, req ctrl.Request) error {
+	cluster, err := r.GetMachineAssociatedCluster(ctx, ktMachine, req)
+	if client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	if cluster == nil {
+		return nil
+	}
+	return moveControlPlaneInit(ctx, r.Client, cluster, ktMachine.Name)
+}
+
+// moveControlPlaneInit moves the ControlPlaneInitMachineAnnotation of the cluster away from the named machine
+// to the control plane the others join next, preferring a running one. It is removed once no other control
+// plane is left, the next control plane then inits the cluster again.
+func moveControlPlaneInit(ctx context.Context, c client.Client, cluster *v1beta1.KTCluster, machineName string) error {
+	logger := log.FromContext(ctx, "LogFrom", "Machine")
+
+	if cluster.Annotations[v1beta1.ControlPlaneInitMachineAnnotation] != machineName {
+		return nil
+	}
+
+	candidates, err := controlPlaneCandidates(ctx, c, cluster)
+	if err != nil {
+		return err
+	}
+	var next *v1beta1.KTMachine
+	for i, candidate := range candidates {
+		if candidate.Name == machineName {
+			continue
+		}
+		if candidate.Status.InstanceState == "ACTIVE" && len(machineAddresses(&candidate)) > 0 {
+			next = &candidates[i]
+			break
+		}
+		if next == nil {
+			next = &candidates[i]
+		}
+	}
+
+	if next != nil {
+		cluster.Annotations[v1beta1.ControlPlaneInitMachineAnnotation] = next.Name
+		logger.Info("Moved control plane init of the cluster to another machine", "Cluster", cluster.Name, "Machine", next.Name)
+	} else {
+		delete(cluster.Annotations, v1beta1.ControlPlaneInitMachineAnnotation)
+		logger.Info("Removed control plane init of the cluster, no other control plane is left", "Cluster", cluster.Name)
+	}
+	return c.Update(ctx, cluster)
+}
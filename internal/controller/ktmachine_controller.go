@@ -18,39 +18,96 @@ package controller
 
 import (
 	"context"
-	"strings"
+	"encoding/base64"
+	"fmt"
+	"slices"
 	"time"
 
 	"errors"
 
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
 	infrastructurev1beta1 "dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
-	"dcnlab.ssu.ac.kr/kt-cloud-operator/cmd/httpapi"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
 )
 
+const (
+	// ktMachineFinalizer keeps a KTMachine around until its server and public IPs are released on KT Cloud
+	ktMachineFinalizer = "infrastructure.dcnlab.ssu.ac.kr/ktmachine"
+
+	// ktMachineDeletePollInterval is how often a deleted machine checks whether its server is gone
+	ktMachineDeletePollInterval = 10 * time.Second
+
+	// waitForBuildingServerDuration is how often a machine checks on its server while KT Cloud builds it
+	waitForBuildingServerDuration = 10 * time.Second
+
+	// waitForNodeDuration is how often a machine checks whether its node registered with the workload cluster
+	waitForNodeDuration = 30 * time.Second
+
+	// machineResyncDuration is how often a machine is reconciled when nothing it watches changes: once its
+	// server settled, or while it waits for its cluster and token
+	machineResyncDuration = time.Hour / 2
+
+	// ktCloudBackoffBase and ktCloudBackoffMax bound the exponential backoff of machines whose reconcile
+	// failed, mostly on KT Cloud API errors
+	ktCloudBackoffBase = 5 * time.Second
+	ktCloudBackoffMax  = 5 * time.Minute
+
+	// serverClusterNameMetadata, serverNamespaceMetadata and serverMachineUIDMetadata tag the servers of
+	// KTMachines on KT Cloud, a requested server is found again by the UID of its machine
+	serverClusterNameMetadata = "kt-cloud-operator/cluster-name"
+	serverNamespaceMetadata   = "kt-cloud-operator/namespace"
+	serverMachineUIDMetadata  = "kt-cloud-operator/machine-uid"
+)
+
+// errMachineHasNoCluster is returned for machines that neither carry the cluster-name label nor belong
+// to a MachineDeployment.
+var errMachineHasNoCluster = errors.New("machine does not belong to a cluster")
+
 // KTMachineReconciler reconciles a KTMachine object
 type KTMachineReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// KTCloud creates the clients used to talk to KT Cloud in the zone of the machine's cluster
+	KTCloud ktcloud.Factory
+
+	// WorkloadClient creates the clients used to mint bootstrap tokens in workload clusters,
+	// defaults to client.New
+	WorkloadClient func(config *rest.Config) (client.Client, error)
 }
 
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktmachines,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktmachines/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktmachines/finalizers,verbs=update
-
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the KTMachine object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
+// +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktclusters,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktsubjecttokens,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=kubeadmcontrolplanes;kubeadmconfigtemplates,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktnetworkfirewalls,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktpublicnetworks,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile creates the server of the KTMachine on KT Cloud and keeps the status in sync with it.
+// It waits for the KTSubjectToken of the cluster, then adopts the server named by spec.serverID or
+// creates one in the tier networks and security groups of the cluster, booted with the bootstrap
+// data generated for the role of the machine. Once the server exists its state and addresses are
+// copied to the status, control planes get a public IP claimed and bound, and a server that
+// vanished on KT Cloud is handled by the remediation policy. Deleted machines are handed to
+// reconcileDelete.
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.19.1/pkg/reconcile
@@ -68,110 +125,484 @@ func (r *KTMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, err
 	}
 
+	if !ktMachine.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, ktMachine, req)
+	}
+
+	if controllerutil.AddFinalizer(ktMachine, ktMachineFinalizer) {
+		if err := r.Update(ctx, ktMachine); err != nil {
+			logger.Error(err, "Failed to add finalizer to KTMachine")
+			return ctrl.Result{}, err
+		}
+	}
+
 	//first get the token associated for the cluster and find token
-	subjectToken, err := r.getSubjectToken(ctx, ktMachine, req)
+	// the KTCluster and KTSubjectToken watches requeue the machine once they show up or change
+	ktSubjectToken, err := r.getSubjectToken(ctx, ktMachine, req)
+	if apierrors.IsNotFound(err) || errors.Is(err, errMachineHasNoCluster) {
+		logger.Info("Waiting for the cluster and KTSubjectToken of the machine", "Reason", err.Error())
+		return ctrl.Result{RequeueAfter: machineResyncDuration}, nil
+	}
 	if err != nil {
 		logger.Error(err, "Failed to find KTSubject token matching cluster")
-		return ctrl.Result{RequeueAfter: time.Minute}, nil
+		return ctrl.Result{}, err
 	}
 
-	if subjectToken == "" {
-		logger.Error(err, "We have to reconcile again to check the Subject token")
-		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	// tokens are only valid in the zone of the cluster credentials they were issued for
+	subjectToken := ktSubjectToken.Status.SubjectToken
+	zone := ktSubjectToken.Status.Zone
+	if subjectToken == "" || zone == "" {
+		logger.Info("Waiting for the KTSubjectToken of the cluster to be issued")
+		return ctrl.Result{RequeueAfter: machineResyncDuration}, nil
+	}
+	cloud := r.KTCloud(zone, subjectToken)
+
+	// conditions are only set once spec and metadata updates are done, those drop status changes
+	original := ktMachine.Status.DeepCopy()
+
+	if ktMachine.Status.ID == "" && ktMachine.Spec.ServerID != "" {
+		return r.adoptServer(ctx, cloud, zone, ktMachine, original)
 	}
 
 	//trigger to create machine on KTCloud by calling API
 	if ktMachine.Status.ID == "" {
 		logger.Info("Machine has no ID in the status field, create it on KT Cloud")
 
-		err = httpapi.CreateVM(ktMachine, subjectToken)
+		cluster, err := r.GetMachineAssociatedCluster(ctx, ktMachine, req)
+		if err != nil {
+			logger.Error(err, "Failed to retrieve cluster for Machine")
+			return ctrl.Result{}, err
+		}
+		var securityGroups []ktcloud.SecurityGroup
+		if cluster != nil {
+			if len(ktMachine.Spec.NetworkTier) == 0 {
+				ready, err := r.defaultNetworkTier(ctx, cluster, ktMachine)
+				if err != nil {
+					logger.Error(err, "Failed to default the network tier of the machine")
+					return ctrl.Result{}, err
+				}
+				if !ready {
+					logger.Info("Waiting for the tier networks of the managed subnets of the cluster")
+					setMachineCondition(ktMachine, v1beta1.InstanceReadyCondition, metav1.ConditionFalse, v1beta1.WaitingForClusterReason,
+						"Waiting for the tier networks of the managed subnets of the cluster")
+					return r.updateMachineStatus(ctx, ktMachine, original, machineResyncDuration)
+				}
+			}
+
+			var ready bool
+			securityGroups, ready = machineSecurityGroups(cluster, isControlPlaneMachine(ktMachine))
+			if !ready {
+				logger.Info("Waiting for the managed security groups of the cluster")
+				setMachineCondition(ktMachine, v1beta1.InstanceReadyCondition, metav1.ConditionFalse, v1beta1.WaitingForClusterReason,
+					"Waiting for the managed security groups of the cluster")
+				return r.updateMachineStatus(ctx, ktMachine, original, machineResyncDuration)
+			}
+		}
+
+		userData, err := r.getUserData(ctx, ktMachine, req)
+		if errors.Is(err, errBootstrapNotReady) {
+			logger.Info("Waiting before bootstrapping the machine", "Reason", err.Error())
+			setMachineCondition(ktMachine, v1beta1.InstanceReadyCondition, metav1.ConditionFalse, v1beta1.WaitingForBootstrapDataReason, err.Error())
+			return r.updateMachineStatus(ctx, ktMachine, original, waitForBootstrapDataDuration)
+		}
 		if err != nil {
-			logger.Error(err, "Failed to create VM on KT Cloud during API Call")
-			return ctrl.Result{RequeueAfter: time.Minute}, nil
+			logger.Error(err, "Failed to get bootstrap data for machine")
+			return ctrl.Result{}, err
+		}
+
+		// a server requested before may not have made it into the status, it is adopted instead of created twice
+		server, err := findRequestedServer(ctx, cloud, ktMachine)
+		if err != nil {
+			logger.Error(err, "Failed to look up the requested server of the machine on KT Cloud")
+			return ctrl.Result{}, err
+		}
+		if server == nil {
+			if err := r.recordServerCreateRequested(ctx, ktMachine); err != nil {
+				logger.Error(err, "Failed to record the server creation request on KTMachine")
+				return ctrl.Result{}, err
+			}
+			server, err = r.createVM(ctx, cloud, cluster, ktMachine, userData, securityGroups)
+			if err != nil {
+				logger.Error(err, "Failed to create VM on KT Cloud during API Call")
+				setMachineCondition(ktMachine, v1beta1.InstanceReadyCondition, metav1.ConditionFalse, v1beta1.InstanceCreateFailedReason, err.Error())
+				return r.updateMachineStatusWithError(ctx, ktMachine, original, err)
+			}
 		}
 
 		//use the response to from the api and update the machine
-		return ctrl.Result{RequeueAfter: time.Minute}, nil
+		setStatusFromServer(ktMachine, zone, server)
+		return r.updateMachineStatus(ctx, ktMachine, original, waitForBuildingServerDuration)
 	} else {
 		logger.Info("Machine already created and has ID")
 		//call API and check if machine is ready
-		// if ktMachine.Status.Status == "Creating" {
-		// if ktMachine.Status.Status == "Creating" {
-		serverResponse, err := httpapi.GetCreatedVM(ktMachine, subjectToken)
-		if err != nil && serverResponse != nil {
+		server, err := cloud.Servers().Get(ctx, ktMachine.Status.ID)
+		if ktcloud.IsNotFound(err) {
+			return r.reconcileMissingServer(ctx, ktMachine, original)
+		}
+		if err != nil {
 			logger.Error(err, "Failed to query VM on KT Cloud during API Call")
-			return ctrl.Result{RequeueAfter: time.Minute}, nil
+			return ctrl.Result{}, err
 		}
+		setStatusFromServer(ktMachine, zone, server)
 
-		logger.Info("Got the machine we have to update if the states dont match")
-		if ktMachine.Status.Status != serverResponse.Status {
-			ktMachine.Status = *serverResponse
-			if err := r.Status().Update(ctx, ktMachine); err != nil {
-				logger.Error(err, "Can't update for machine with status on cloud")
-				return ctrl.Result{RequeueAfter: time.Minute}, nil
-			}
-
+		cluster, err := r.GetMachineAssociatedCluster(ctx, ktMachine, req)
+		if err != nil {
+			logger.Error(err, "Failed to retrieve cluster for Machine")
+			return r.updateMachineStatusWithError(ctx, ktMachine, original, err)
 		}
 
-		logger.Info("Machine state is not creating")
-		logger.Info("The status is the same on cloud and cluster")
-		// logger.Info("Do we need to reconcile again when the machine is all ready?")
-		//what happens if 404 on cloud but present on cluster?
-
-		//check if machine is control plane and get kubeadm data
-		//if we already kubeadm data, join worker nodes if not joined
-
 		//we have to attach public IP to all control planes
 		// check if current machine is control plane
-		machineName := ktMachine.Name
-		substring := "control-plane"
-
-		if strings.Contains(machineName, substring) {
-			logger.Info("The machine name contains 'control-plane', therefore Control Plane.")
+		if isControlPlaneMachine(ktMachine) {
+			logger.Info("The machine has the control plane role, therefore Control Plane.")
 			//attach public IP
-			cluster, err := r.GetMachineAssociatedCluster(ctx, ktMachine, req)
-			if cluster == nil || err != nil {
-				if cluster == nil {
-					logger.Error(errors.New("cluster empty from get-associated-cluster for machine"), "Failed to retrieve cluster for Machine")
-					return ctrl.Result{RequeueAfter: time.Minute}, nil
-				} else if err != nil {
-					logger.Error(err, "Failed to retrieve cluster for Machine")
-					return ctrl.Result{RequeueAfter: time.Minute}, nil
+			if cluster == nil {
+				logger.Info("Waiting for the cluster of the control plane machine")
+				return r.updateMachineStatus(ctx, ktMachine, original, machineResyncDuration)
+			}
+
+			setPublicIPCondition(ktMachine, cluster.Spec.ControlPlaneExternalNetworkEnable)
+			if cluster.Spec.ControlPlaneExternalNetworkEnable && cluster.Spec.PortForwarding.Enabled {
+				if err := r.forwardAPIServerPort(ctx, cluster, ktMachine); err != nil {
+					logger.Error(err, "Failed to forward port of shared public IP to Machine")
+					return r.updateMachineStatusWithError(ctx, ktMachine, original, err)
+				}
+			} else if cluster.Spec.ControlPlaneExternalNetworkEnable && len(ktMachine.Spec.PublicIPIDs) == 0 {
+				// adopted servers keep the public IPs they were bound to
+				if err := r.claimPublicIP(ctx, cluster, ktMachine); err != nil {
+					logger.Error(err, "Failed to claim public IP for Machine")
+					return r.updateMachineStatusWithError(ctx, ktMachine, original, err)
 				}
 			}
 
-			if cluster.Spec.ControlPlaneExternalNetworkEnable && len(ktMachine.Status.AssignedPublicIps) == 0 {
-				err = httpapi.AttachPublicIP(ktMachine, subjectToken)
-				if err != nil {
-					logger.Error(err, "Failed to attach network to Machine")
-					return ctrl.Result{RequeueAfter: time.Minute}, nil
+			if cluster.Spec.ControlPlaneExternalNetworkEnable {
+				if err := r.reconcileFirewalls(ctx, cloud, cluster, ktMachine); err != nil {
+					logger.Error(err, "Failed to open firewall for the public IP of Machine")
+					return r.updateMachineStatusWithError(ctx, ktMachine, original, err)
 				}
-				//we have to fix firewall settings
 			}
-			logger.Info("Skip adding public IP address to Machine already added")
 
 		} else {
 			logger.Info("This is a worker machine")
+			setPublicIPCondition(ktMachine, false)
 		}
 
-		return ctrl.Result{RequeueAfter: time.Hour / 2}, nil
+		r.reconcileBootstrapCondition(ctx, cluster, ktMachine)
+		return r.updateMachineStatus(ctx, ktMachine, original, machineRequeueDuration(ktMachine))
 	}
 
 	// return ctrl.Result{RequeueAfter: time.Hour}, nil
 }
 
-func (r *KTMachineReconciler) getSubjectToken(ctx context.Context, ktMachine *infrastructurev1beta1.KTMachine, req ctrl.Request) (string, error) {
+// reconcileDelete releases what the machine holds on KT Cloud before letting it go: the static NAT
+// of its public IPs first, then the server itself. The finalizer is only removed once the server is gone.
+// Machines with the Orphan deletion policy leave both on KT Cloud, so do machines whose cluster and
+// KTSubjectToken were deleted before them as there are no credentials left to delete the server with.
+func (r *KTMachineReconciler) reconcileDelete(ctx context.Context, ktMachine *v1beta1.KTMachine, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx, "LogFrom", "KTMachine")
+
+	if !controllerutil.ContainsFinalizer(ktMachine, ktMachineFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	if ktMachine.Status.Phase != v1beta1.KTMachinePhaseDeleting {
+		ktMachine.Status.Phase = v1beta1.KTMachinePhaseDeleting
+		if err := r.Status().Update(ctx, ktMachine); err != nil {
+			logger.Error(err, "Failed to update KTMachine status")
+			return ctrl.Result{}, err
+		}
+	}
 
+	// machines joining the cluster from now on go through another control plane
+	if err := r.releaseControlPlaneInit(ctx, ktMachine, req); err != nil {
+		logger.Error(err, "Failed to move control plane init of the cluster away from machine")
+		return ctrl.Result{}, err
+	}
+
+	// port forwarding rules to the machine are deleted by the claims of the shared public IPs
+	forwarded, err := r.removePortForwards(ctx, ktMachine)
+	if err != nil {
+		logger.Error(err, "Failed to remove port forwards to machine")
+		return ctrl.Result{}, err
+	}
+	if forwarded {
+		logger.Info("Waiting for port forwards to machine to be deleted on KT Cloud")
+		return ctrl.Result{RequeueAfter: ktMachineDeletePollInterval}, nil
+	}
+
+	if serverDeletionPolicy(ktMachine) == v1beta1.OrphanServerDeletionPolicy {
+		logger.Info("Leaving the server of the machine on KT Cloud", "ID", ktMachine.Status.ID)
+	} else if ktMachine.Status.ID != "" || len(ktMachine.Status.AssignedPublicIps) > 0 {
+		ktSubjectToken, err := r.getSubjectToken(ctx, ktMachine, req)
+		if apierrors.IsNotFound(err) || errors.Is(err, errMachineHasNoCluster) {
+			// without the cluster there are no credentials left to delete the server with
+			logger.Info("Cluster or KTSubjectToken of the machine is gone, leaving the server on KT Cloud", "ID", ktMachine.Status.ID, "Reason", err.Error())
+			return r.removeFinalizer(ctx, ktMachine)
+		}
+		if err != nil {
+			logger.Error(err, "Failed to find KTSubject token matching cluster to delete the machine")
+			return ctrl.Result{}, err
+		}
+		if ktSubjectToken.Status.SubjectToken == "" || ktSubjectToken.Status.Zone == "" {
+			logger.Info("Subject token is not ready yet, waiting to delete the machine")
+			return ctrl.Result{RequeueAfter: machineResyncDuration}, nil
+		}
+		cloud := r.KTCloud(ktSubjectToken.Status.Zone, ktSubjectToken.Status.SubjectToken)
+
+		if len(ktMachine.Status.AssignedPublicIps) > 0 {
+			if err := r.releasePublicIPs(ctx, cloud, ktMachine); err != nil {
+				logger.Error(err, "Failed to release public IPs of machine on KT Cloud")
+				return ctrl.Result{}, err
+			}
+		}
+
+		if ktMachine.Status.ID != "" {
+			deleted, err := r.deleteVM(ctx, cloud, ktMachine)
+			if err != nil {
+				logger.Error(err, "Failed to delete VM on KT Cloud during API Call")
+				return ctrl.Result{}, err
+			}
+			if !deleted {
+				logger.Info("Waiting for machine to be deleted on KT Cloud", "ID", ktMachine.Status.ID)
+				return ctrl.Result{RequeueAfter: ktMachineDeletePollInterval}, nil
+			}
+		}
+	}
+
+	logger.Info("Machine released on KT Cloud, removing finalizer")
+	return r.removeFinalizer(ctx, ktMachine)
+}
+
+func (r *KTMachineReconciler) removeFinalizer(ctx context.Context, ktMachine *v1beta1.KTMachine) (ctrl.Result, error) {
+	if controllerutil.RemoveFinalizer(ktMachine, ktMachineFinalizer) {
+		if err := r.Update(ctx, ktMachine); err != nil {
+			log.FromContext(ctx, "LogFrom", "KTMachine").Error(err, "Failed to remove finalizer from KTMachine")
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// releasePublicIPs disables the static NAT between the assigned public IPs and the machine and
+// clears them from the machine status. IPs that are no longer bound to the machine are skipped.
+func (r *KTMachineReconciler) releasePublicIPs(ctx context.Context, cloud ktcloud.Client, ktMachine *v1beta1.KTMachine) error {
 	logger := log.FromContext(ctx, "LogFrom", "Machine")
 
-	cluster, err := r.GetMachineAssociatedCluster(ctx, ktMachine, req)
-	if cluster == nil || err != nil {
-		if cluster == nil {
-			return "", errors.New("Failed to retrieve cluster for Machine")
-		} else if err != nil {
-			return "", err
+	publicIPs, err := cloud.IPAddresses().List(ctx)
+	if err != nil {
+		return err
+	}
+
+	machinePrivateAddresses := machineAddresses(ktMachine)
+	for _, assigned := range ktMachine.Status.AssignedPublicIps {
+		if assigned.Port != 0 {
+			// a port forward of a shared public IP, not a static NAT
+			continue
+		}
+		for _, publicIP := range publicIPs {
+			if publicIP.Id != assigned.Id {
+				continue
+			}
+			for _, virtualIP := range publicIP.VirtualIps {
+				if !slices.Contains(machinePrivateAddresses, virtualIP.VMGuestIP) {
+					continue
+				}
+				if err := cloud.StaticNAT().Disable(ctx, virtualIP.Id); err != nil {
+					return err
+				}
+				logger.Info("Disabled static NAT of machine", "IP", assigned.IP, "VMGuestIP", virtualIP.VMGuestIP)
+			}
+		}
+	}
+
+	ktMachine.Status.AssignedPublicIps = nil
+	ktMachine.Status.Addresses = machineStatusAddresses(machinePrivateAddresses, nil)
+	return r.Status().Update(ctx, ktMachine)
+}
+
+// deleteVM requests the deletion of the machine's server on KT Cloud unless it is already being
+// deleted, and reports whether the server is gone.
+func (r *KTMachineReconciler) deleteVM(ctx context.Context, cloud ktcloud.Client, ktMachine *v1beta1.KTMachine) (bool, error) {
+	logger := log.FromContext(ctx, "LogFrom", "Machine")
+
+	server, err := cloud.Servers().Get(ctx, ktMachine.Status.ID)
+	if ktcloud.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if server.TaskState != nil && *server.TaskState == "deleting" {
+		return false, nil
+	}
+
+	if err := cloud.Servers().Delete(ctx, ktMachine.Status.ID); err != nil {
+		if ktcloud.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	logger.Info("Requested deletion of machine on KT Cloud", "ID", ktMachine.Status.ID)
+	return false, nil
+}
+
+// defaultNetworkTier attaches a machine without a network tier to the tier networks of the managed
+// subnets of its cluster. It returns false while the cluster has not created them yet.
+func (r *KTMachineReconciler) defaultNetworkTier(ctx context.Context, cluster *v1beta1.KTCluster, ktMachine *v1beta1.KTMachine) (bool, error) {
+	if len(cluster.Spec.ManagedSubnets) == 0 {
+		return true, nil
+	}
+	networkTier, ready := managedNetworkTier(cluster)
+	if !ready {
+		return false, nil
+	}
+	ktMachine.Spec.NetworkTier = networkTier
+	if err := r.Update(ctx, ktMachine); err != nil {
+		return false, err
+	}
+	log.FromContext(ctx, "LogFrom", "KTMachine").Info("Defaulted network tier to the managed subnets of the cluster", "Cluster", cluster.Name)
+	return true, nil
+}
+
+// recordServerCreateRequested sets the ServerCreateRequestedAnnotation on the machine before its server is
+// requested, so the server is looked up if the status recording its ID is never written.
+func (r *KTMachineReconciler) recordServerCreateRequested(ctx context.Context, ktMachine *v1beta1.KTMachine) error {
+	if _, ok := ktMachine.Annotations[v1beta1.ServerCreateRequestedAnnotation]; ok {
+		return nil
+	}
+	if ktMachine.Annotations == nil {
+		ktMachine.Annotations = map[string]string{}
+	}
+	ktMachine.Annotations[v1beta1.ServerCreateRequestedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	return r.Update(ctx, ktMachine)
+}
+
+// findRequestedServer returns the server tagged with the UID of the machine if its creation was requested
+// before, or nil if there is none.
+func findRequestedServer(ctx context.Context, cloud ktcloud.Client, ktMachine *v1beta1.KTMachine) (*ktcloud.Server, error) {
+	if _, ok := ktMachine.Annotations[v1beta1.ServerCreateRequestedAnnotation]; !ok {
+		return nil, nil
+	}
+
+	servers, err := cloud.Servers().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, server := range servers {
+		if server.Metadata[serverMachineUIDMetadata] == string(ktMachine.UID) && server.Status != "DELETED" {
+			log.FromContext(ctx, "LogFrom", "KTMachine").Info("Found the requested server of the machine on KT Cloud", "ID", server.ID)
+			return &servers[i], nil
 		}
 	}
+	return nil, nil
+}
+
+// createVM creates the server for the machine on KT Cloud in securityGroups and returns it as KT Cloud reported it.
+// The server is tagged with the cluster, namespace and UID of the machine.
+func (r *KTMachineReconciler) createVM(ctx context.Context, cloud ktcloud.Client, cluster *v1beta1.KTCluster, ktMachine *v1beta1.KTMachine, userData string, securityGroups []ktcloud.SecurityGroup) (*ktcloud.Server, error) {
+	logger := log.FromContext(ctx, "LogFrom", "Machine")
+
+	networks := []ktcloud.ServerNetwork{}
+	for _, network := range ktMachine.Spec.NetworkTier {
+		networks = append(networks, ktcloud.ServerNetwork{UUID: network.ID})
+	}
+
+	blockDeviceMappings := []ktcloud.BlockDeviceMappingV2{}
+	for _, blockDeviceMapping := range ktMachine.Spec.BlockDeviceMapping {
+		blockDeviceMappings = append(blockDeviceMappings, ktcloud.BlockDeviceMappingV2{
+			UUID:            blockDeviceMapping.ID,
+			BootIndex:       blockDeviceMapping.BootIndex,
+			VolumeSize:      blockDeviceMapping.VolumeSize,
+			SourceType:      blockDeviceMapping.SourceType,
+			DestinationType: blockDeviceMapping.DestinationType,
+		})
+	}
+
+	server, err := cloud.Servers().Create(ctx, ktcloud.CreateServerOpts{
+		Name:                 ktMachine.Name,
+		KeyName:              ktMachine.Spec.SSHKeyName,
+		FlavorRef:            ktMachine.Spec.Flavor,
+		AvailabilityZone:     ktMachine.Spec.AvailabilityZone,
+		Networks:             networks,
+		BlockDeviceMappingV2: blockDeviceMappings,
+		SecurityGroups:       securityGroups,
+		UserData:             base64.StdEncoding.EncodeToString([]byte(userData)),
+		Metadata:             serverMetadata(cluster, ktMachine),
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Created machine on KT Cloud", "ID", server.ID)
+	return server, nil
+}
+
+// serverMetadata returns the metadata tagging the server of the machine on KT Cloud.
+func serverMetadata(cluster *v1beta1.KTCluster, ktMachine *v1beta1.KTMachine) map[string]string {
+	metadata := map[string]string{
+		serverNamespaceMetadata:  ktMachine.Namespace,
+		serverMachineUIDMetadata: string(ktMachine.UID),
+	}
+	if cluster != nil {
+		metadata[serverClusterNameMetadata] = cluster.Name
+	}
+	return metadata
+}
+
+// claimPublicIP creates the KTPublicNetwork that claims a public IP for the machine and binds it with
+// static NAT: the control plane endpoint IP of the cluster for the first control plane, otherwise one
+// from the public IP pool of the cluster or a newly allocated one. The claim is owned by the machine, so
+// its public IP is reclaimed once the machine is gone.
+func (r *KTMachineReconciler) claimPublicIP(ctx context.Context, cluster *v1beta1.KTCluster, ktMachine *v1beta1.KTMachine) error {
+	logger := log.FromContext(ctx, "LogFrom", "Machine")
+
+	claim := &v1beta1.KTPublicNetwork{}
+	err := r.Get(ctx, types.NamespacedName{Name: publicIPClaimName(ktMachine), Namespace: ktMachine.Namespace}, claim)
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	claim = &v1beta1.KTPublicNetwork{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      publicIPClaimName(ktMachine),
+			Namespace: ktMachine.Namespace,
+			Labels:    map[string]string{v1beta1.ClusterNameLabel: cluster.Name},
+		},
+		Spec: v1beta1.KTPublicNetworkSpec{
+			ClusterName: cluster.Name,
+			MachineRef:  &corev1.LocalObjectReference{Name: ktMachine.Name},
+		},
+	}
+	if cluster.Annotations[v1beta1.ControlPlaneInitMachineAnnotation] == ktMachine.Name {
+		// DNS records of the cluster point to the endpoint IP, it belongs to the first control plane
+		claim.Spec.IP = cluster.Spec.PublicIPPool.ControlPlaneEndpointIP
+	}
+	if err := controllerutil.SetControllerReference(ktMachine, claim, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Create(ctx, claim); err != nil {
+		return err
+	}
+	logger.Info("Claimed public IP for machine", "KTPublicNetwork", claim.Name)
+	return nil
+}
+
+// publicIPClaimName returns the name of the KTPublicNetwork claiming the public IP of the machine.
+func publicIPClaimName(ktMachine *v1beta1.KTMachine) string {
+	return ktMachine.Name + "-public-ip"
+}
+
+func (r *KTMachineReconciler) getSubjectToken(ctx context.Context, ktMachine *infrastructurev1beta1.KTMachine, req ctrl.Request) (*v1beta1.KTSubjectToken, error) {
+
+	logger := log.FromContext(ctx, "LogFrom", "Machine")
+
+	cluster, err := r.GetMachineAssociatedCluster(ctx, ktMachine, req)
+	if err != nil {
+		return nil, err
+	}
+	if cluster == nil {
+		return nil, errMachineHasNoCluster
+	}
 
 	//ktsubjecttoken.name is always the same to cluster.name
 
@@ -181,16 +612,44 @@ func (r *KTMachineReconciler) getSubjectToken(ctx context.Context, ktMachine *in
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			logger.Error(err, "Failed to get KTSubjectTokens associated with cluster", "Name", cluster.Name, "Namespace", cluster.Namespace)
-			return "nil", err
+			return nil, err
 		}
-		return "", err
+		return nil, err
 	}
 
-	return ktSubjectToken.Spec.SubjectToken, nil
+	// the token is filled in and kept fresh by the KTSubjectToken controller
+	return ktSubjectToken, nil
 
 }
 
+// GetMachineAssociatedCluster returns the KTCluster named by the cluster label of the machine, or by the
+// clusterName of its MachineDeployment for machines that are not labelled yet. It returns nil if the
+// machine has neither.
 func (r *KTMachineReconciler) GetMachineAssociatedCluster(ctx context.Context, ktMachine *infrastructurev1beta1.KTMachine, req ctrl.Request) (*v1beta1.KTCluster, error) {
+	clusterName := ktMachine.Labels[v1beta1.ClusterNameLabel]
+	if clusterName == "" {
+		ownerMachineDeployment, err := r.getOwnerMachineDeployment(ctx, ktMachine)
+		if err != nil {
+			return nil, err
+		}
+		if ownerMachineDeployment == nil {
+			return nil, nil
+		}
+		clusterName = ownerMachineDeployment.Spec.Template.Spec.ClusterName
+		if clusterName == "" {
+			return nil, fmt.Errorf("MachineDeployment %s of the machine has no clusterName", ownerMachineDeployment.Name)
+		}
+	}
+
+	ktCluster := &v1beta1.KTCluster{}
+	if err := r.Get(ctx, types.NamespacedName{Name: clusterName, Namespace: ktMachine.Namespace}, ktCluster); err != nil {
+		return nil, err
+	}
+	return ktCluster, nil
+}
+
+// getOwnerMachineDeployment returns the MachineDeployment owning the machine, or nil if there is none.
+func (r *KTMachineReconciler) getOwnerMachineDeployment(ctx context.Context, ktMachine *v1beta1.KTMachine) (*v1beta1.MachineDeployment, error) {
 	logger := log.FromContext(ctx, "LogFrom", "Machine")
 
 	ktMachineDeploymentList := &v1beta1.MachineDeploymentList{}
@@ -201,59 +660,57 @@ func (r *KTMachineReconciler) GetMachineAssociatedCluster(ctx context.Context, k
 	}
 
 	// Filter by ownerReferences
-	var ownerMachineDeployment v1beta1.MachineDeployment
-	for _, machineDeployment := range ktMachineDeploymentList.Items {
+	for i, machineDeployment := range ktMachineDeploymentList.Items {
 		for _, ref := range ktMachine.OwnerReferences {
 			if ref.UID == machineDeployment.UID {
-				ownerMachineDeployment = machineDeployment
-				logger.Info("Found owned MachineDeployment", "name", machineDeployment.Name)
-				break
+				logger.V(1).Info("Found owned MachineDeployment", "name", machineDeployment.Name)
+				return &ktMachineDeploymentList.Items[i], nil
 			}
 		}
 	}
+	return nil, nil
+}
 
-	// we found matching machine deployment owner
-	// we have to find the cluster from this
-	// KTMachineTemplate is owned by KTCluster and KTMachineTemplate.Name = MachineDeployment.Name, KTMachineTemplate.NameSpace = MachineDeployment.NameSpace
-	// therefore, use MachineDeployment to MachineTemplate to find Cluster then token for the cluster
-	if ownerMachineDeployment.UID != "" {
-		ktMachineTemplate := &v1beta1.KTMachineTemplate{}
-		err := r.Get(ctx, types.NamespacedName{Name: ownerMachineDeployment.Name, Namespace: ownerMachineDeployment.Namespace}, ktMachineTemplate)
-
-		if err != nil {
-			if apierrors.IsNotFound(err) {
-				logger.Error(err, "KTMachineTemplate not found no need to proceed for finding SubjectToken To Auth API", "Name", ownerMachineDeployment.Name, "Namespace", ownerMachineDeployment.Namespace)
-				return nil, err
-			}
-			return nil, err
-		}
-
-		var clusterName string
-
-		for _, ref := range ktMachineTemplate.OwnerReferences {
-			if ref.Kind == "KTCluster" {
-				clusterName = ref.Name
-				break
-
-			}
-		}
-
-		ktCluster := &v1beta1.KTCluster{}
-		err = r.Get(ctx, types.NamespacedName{Name: clusterName, Namespace: ktMachine.Namespace}, ktCluster)
-		if err != nil {
-			return nil, err
+// machineAddresses returns the private addresses of the machine, ordered by network name.
+func machineAddresses(ktMachine *v1beta1.KTMachine) []string {
+	var addresses []string
+	for _, address := range ktMachine.Status.Addresses {
+		if address.Type == v1beta1.MachineInternalIP {
+			addresses = append(addresses, address.Address)
 		}
-
-		return ktCluster, err
 	}
-
-	return nil, nil
+	return addresses
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *KTMachineReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrastructurev1beta1.KTMachine{}).
+		Owns(&infrastructurev1beta1.KTNetworkFirewall{}).
+		Owns(&infrastructurev1beta1.KTPublicNetwork{}).
+		// machines wait for the token, networks and security groups of their cluster
+		Watches(&infrastructurev1beta1.KTSubjectToken{}, handler.EnqueueRequestsFromMapFunc(machinesForCluster(mgr.GetClient()))).
+		Watches(&infrastructurev1beta1.KTCluster{}, handler.EnqueueRequestsFromMapFunc(machinesForCluster(mgr.GetClient()))).
+		WithOptions(controller.Options{
+			RateLimiter: workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](ktCloudBackoffBase, ktCloudBackoffMax),
+		}).
 		Named("ktmachine").
 		Complete(r)
 }
+
+// machinesForCluster returns a map function enqueueing the KTMachines of the cluster a KTCluster or
+// KTSubjectToken belongs to, the token has the name of the cluster.
+func machinesForCluster(c client.Reader) func(context.Context, client.Object) []reconcile.Request {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		ktMachines := &v1beta1.KTMachineList{}
+		if err := c.List(ctx, ktMachines, client.InNamespace(obj.GetNamespace()),
+			client.MatchingLabels{v1beta1.ClusterNameLabel: obj.GetName()}); err != nil {
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, ktMachine := range ktMachines.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&ktMachine)})
+		}
+		return requests
+	}
+}
@@ -18,16 +18,36 @@ package controller
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	infrastructurev1beta1 "dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud/fake"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/pki"
 )
 
 var _ = Describe("KTMachine Controller", func() {
@@ -65,20 +85,1015 @@ var _ = Describe("KTMachine Controller", func() {
 
 			By("Cleanup the specific resource instance KTMachine")
 			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			By("Reconciling the deleted resource to remove the finalizer")
+			controllerReconciler := &KTMachineReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: fake.New().Factory(),
+			}
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, resource))).To(BeTrue())
 		})
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
 			controllerReconciler := &KTMachineReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: fake.New().Factory(),
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(controllerutil.ContainsFinalizer(resource, ktMachineFinalizer)).To(BeTrue())
+		})
+	})
+
+	Context("When deleting a machine created on KT Cloud", func() {
+		const resourceName = "test-delete"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var cloud *fake.Cloud
+
+		BeforeEach(func() {
+			cloud = fake.New()
+			server, err := cloud.Factory()("gd1", "token").Servers().Create(ctx, ktcloud.CreateServerOpts{
+				Name:     resourceName,
+				Networks: []ktcloud.ServerNetwork{{UUID: "tier"}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			guestIP := server.Addresses["tier"][0].Addr
+			cloud.PublicIPs = []ktcloud.PublicIP{{
+				Id:   "public-ip",
+				IP:   "211.0.0.1",
+				Type: "ASSOCIATE",
+				VirtualIps: []ktcloud.VirtualIP{{
+					Id:          "static-nat",
+					VMGuestIP:   guestIP,
+					IPAddressId: "public-ip",
+				}},
+			}}
+
+			By("creating the cluster, template, deployment and token the machine belongs to")
+			machineDeployment := createMachineOwners(ctx, typeNamespacedName, infrastructurev1beta1.ConfigRef{})
+
+			By("creating the machine with its server and public IP")
+			ktMachine := &infrastructurev1beta1.KTMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       resourceName,
+					Namespace:  "default",
+					Finalizers: []string{ktMachineFinalizer},
+				},
+			}
+			Expect(controllerutil.SetControllerReference(machineDeployment, ktMachine, k8sClient.Scheme())).To(Succeed())
+			Expect(k8sClient.Create(ctx, ktMachine)).To(Succeed())
+			ktMachine.Status.ID = server.ID
+			ktMachine.Status.Addresses = []infrastructurev1beta1.MachineAddress{{Type: infrastructurev1beta1.MachineInternalIP, Address: guestIP}}
+			ktMachine.Status.AssignedPublicIps = []infrastructurev1beta1.AssignedPublicIps{{Id: "public-ip", IP: "211.0.0.1"}}
+			Expect(k8sClient.Status().Update(ctx, ktMachine)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			deleteMachineOwners(ctx, typeNamespacedName)
+		})
+
+		It("should release the public IP and delete the server before removing the finalizer", func() {
+			controllerReconciler := &KTMachineReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+
+			resource := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			serverID := resource.Status.ID
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			By("Reconciling the deleted resource")
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(ktMachineDeletePollInterval))
+			Expect(cloud.PublicIPs[0].VirtualIps).To(BeEmpty())
+			Expect(cloud.Servers).NotTo(HaveKey(serverID))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.AssignedPublicIps).To(BeEmpty())
+			Expect(resource.Finalizers).To(ContainElement(ktMachineFinalizer))
+
+			By("Reconciling again once the server is gone")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, resource))).To(BeTrue())
+		})
+
+		It("should leave the server behind once the cluster and token were deleted first", func() {
+			controllerReconciler := &KTMachineReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+
+			By("deleting the cluster and its token before the machine")
+			for _, obj := range []client.Object{&infrastructurev1beta1.KTSubjectToken{}, &infrastructurev1beta1.KTCluster{}} {
+				Expect(k8sClient.Get(ctx, typeNamespacedName, obj)).To(Succeed())
+				Expect(k8sClient.Delete(ctx, obj)).To(Succeed())
 			}
+			resource := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			serverID := resource.Status.ID
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
 
+			By("Reconciling the deleted resource")
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
 				NamespacedName: typeNamespacedName,
 			})
 			Expect(err).NotTo(HaveOccurred())
-			// TODO(user): Add more specific assertions depending on your controller's reconciliation logic.
-			// Example: If you expect a certain status condition after reconciliation, verify it here.
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, resource))).To(BeTrue())
+			Expect(cloud.Servers).To(HaveKey(serverID))
+		})
+	})
+
+	Context("When adopting a server built outside the operator", func() {
+		const resourceName = "test-adopt"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var cloud *fake.Cloud
+		var server *ktcloud.Server
+
+		BeforeEach(func() {
+			cloud = fake.New()
+			var err error
+			server, err = cloud.Factory()("gd1", "token").Servers().Create(ctx, ktcloud.CreateServerOpts{
+				Name:     "built-by-hand",
+				Networks: []ktcloud.ServerNetwork{{UUID: "tier"}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			cloud.Servers[server.ID].Status = "ACTIVE"
+			cloud.PublicIPs = []ktcloud.PublicIP{{
+				Id:   "public-ip",
+				IP:   "211.0.0.1",
+				Type: "ASSOCIATE",
+				VirtualIps: []ktcloud.VirtualIP{{
+					Id:          "static-nat",
+					VMGuestIP:   server.Addresses["tier"][0].Addr,
+					IPAddressId: "public-ip",
+				}},
+			}}
+
+			By("creating the cluster and token the machine belongs to")
+			createMachineOwners(ctx, typeNamespacedName, infrastructurev1beta1.ConfigRef{})
+
+			By("creating the machine adopting the server and its public IP")
+			ktMachine := &infrastructurev1beta1.KTMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+					Labels: map[string]string{
+						infrastructurev1beta1.ClusterNameLabel: resourceName,
+						infrastructurev1beta1.MachineRoleLabel: infrastructurev1beta1.WorkerMachineRole,
+					},
+				},
+				Spec: infrastructurev1beta1.KTMachineSpec{
+					ServerID:    server.ID,
+					PublicIPIDs: []string{"public-ip"},
+				},
+			}
+			Expect(k8sClient.Create(ctx, ktMachine)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			deleteMachineOwners(ctx, typeNamespacedName)
+		})
+
+		It("should reject the Recreate remediation policy", func() {
+			resource := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.RemediationPolicy = infrastructurev1beta1.RecreateMachineRemediationPolicy
+			Expect(errors.IsInvalid(k8sClient.Update(ctx, resource))).To(BeTrue())
+
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should import the server without creating one and leave it behind once deleted", func() {
+			controllerReconciler := &KTMachineReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+
+			By("Reconciling the machine")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			resource := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.ID).To(Equal(server.ID))
+			Expect(resource.Status.Phase).To(Equal(infrastructurev1beta1.KTMachinePhaseRunning))
+			Expect(resource.Status.AssignedPublicIps).To(Equal([]infrastructurev1beta1.AssignedPublicIps{{Id: "public-ip", IP: "211.0.0.1"}}))
+			Expect(cloud.Servers).To(HaveLen(1))
+			Expect(cloud.Servers[server.ID].Metadata).To(Equal(map[string]string{
+				serverClusterNameMetadata: resourceName,
+				serverNamespaceMetadata:   "default",
+				serverMachineUIDMetadata:  string(resource.UID),
+			}))
+
+			By("Reconciling the deleted machine without a deletion policy")
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, resource))).To(BeTrue())
+			Expect(cloud.Servers).To(HaveKey(server.ID))
+			Expect(cloud.PublicIPs[0].VirtualIps).To(HaveLen(1))
+		})
+
+		It("should refuse to adopt a server another machine holds", func() {
+			controllerReconciler := &KTMachineReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+			secondName := types.NamespacedName{Name: resourceName + "-second", Namespace: "default"}
+			Expect(k8sClient.Create(ctx, &infrastructurev1beta1.KTMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      secondName.Name,
+					Namespace: "default",
+					Labels: map[string]string{
+						infrastructurev1beta1.ClusterNameLabel: resourceName,
+						infrastructurev1beta1.MachineRoleLabel: infrastructurev1beta1.WorkerMachineRole,
+					},
+				},
+				Spec: infrastructurev1beta1.KTMachineSpec{ServerID: server.ID},
+			})).To(Succeed())
+
+			By("Reconciling the machine created first")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			resource := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.ID).To(Equal(server.ID))
+
+			By("Reconciling the machine adopting the same server")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: secondName})
+			Expect(err).NotTo(HaveOccurred())
+			second := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, secondName, second)).To(Succeed())
+			Expect(second.Status.ID).To(BeEmpty())
+			Expect(second.Status.FailureReason).NotTo(BeNil())
+			Expect(*second.Status.FailureReason).To(Equal(infrastructurev1beta1.InstanceAlreadyAdoptedReason))
+			Expect(cloud.Servers[server.ID].Metadata).To(HaveKeyWithValue(serverMachineUIDMetadata, string(resource.UID)))
+
+			for _, name := range []types.NamespacedName{typeNamespacedName, secondName} {
+				Expect(k8sClient.Get(ctx, name, resource)).To(Succeed())
+				Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: name})
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(cloud.Servers).To(HaveKey(server.ID))
+		})
+	})
+
+	Context("When reporting the status of a machine", func() {
+		const resourceName = "test-status"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var cloud *fake.Cloud
+		var server *ktcloud.Server
+
+		BeforeEach(func() {
+			cloud = fake.New()
+			var err error
+			server, err = cloud.Factory()("gd1", "token").Servers().Create(ctx, ktcloud.CreateServerOpts{
+				Name:     resourceName,
+				Networks: []ktcloud.ServerNetwork{{UUID: "tier"}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("creating the cluster, template, deployment and token the machine belongs to")
+			machineDeployment := createMachineOwners(ctx, typeNamespacedName, infrastructurev1beta1.ConfigRef{})
+
+			By("creating the worker machine with its server")
+			ktMachine := &infrastructurev1beta1.KTMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       resourceName,
+					Namespace:  "default",
+					Finalizers: []string{ktMachineFinalizer},
+					Labels:     map[string]string{infrastructurev1beta1.MachineRoleLabel: infrastructurev1beta1.WorkerMachineRole},
+				},
+				Spec: infrastructurev1beta1.KTMachineSpec{UserData: "#cloud-config"},
+			}
+			Expect(controllerutil.SetControllerReference(machineDeployment, ktMachine, k8sClient.Scheme())).To(Succeed())
+			Expect(k8sClient.Create(ctx, ktMachine)).To(Succeed())
+			ktMachine.Status.ID = server.ID
+			ktMachine.Status.AssignedPublicIps = []infrastructurev1beta1.AssignedPublicIps{{Id: "public-ip", IP: "211.0.0.1"}}
+			Expect(k8sClient.Status().Update(ctx, ktMachine)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			controllerutil.RemoveFinalizer(resource, ktMachineFinalizer)
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			deleteMachineOwners(ctx, typeNamespacedName)
+		})
+
+		It("should report the provider ID, addresses, phase and conditions of the server", func() {
+			controllerReconciler := &KTMachineReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+			reconcileStatus := func(requeueAfter time.Duration) infrastructurev1beta1.KTMachineStatus {
+				result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.RequeueAfter).To(Equal(requeueAfter))
+				resource := &infrastructurev1beta1.KTMachine{}
+				Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+				return resource.Status
+			}
+
+			By("Reconciling while the server is being built")
+			status := reconcileStatus(waitForBuildingServerDuration)
+			Expect(status.ProviderID).To(HaveValue(Equal("ktcloud://gd1/" + server.ID)))
+			Expect(status.Addresses).To(Equal([]infrastructurev1beta1.MachineAddress{
+				{Type: infrastructurev1beta1.MachineInternalIP, Address: server.Addresses["tier"][0].Addr},
+				{Type: infrastructurev1beta1.MachineExternalIP, Address: "211.0.0.1"},
+			}))
+			Expect(status.Ready).To(BeFalse())
+			Expect(status.Phase).To(Equal(infrastructurev1beta1.KTMachinePhaseProvisioning))
+			Expect(meta.IsStatusConditionFalse(status.Conditions, infrastructurev1beta1.InstanceReadyCondition)).To(BeTrue())
+			Expect(meta.FindStatusCondition(status.Conditions, infrastructurev1beta1.PublicIPAttachedCondition)).To(BeNil())
+
+			By("Reconciling once the server is active")
+			cloud.Servers[server.ID].Status = "ACTIVE"
+			status = reconcileStatus(machineResyncDuration)
+			Expect(status.Ready).To(BeTrue())
+			Expect(status.InstanceState).To(Equal("ACTIVE"))
+			Expect(status.Phase).To(Equal(infrastructurev1beta1.KTMachinePhaseRunning))
+			Expect(meta.IsStatusConditionTrue(status.Conditions, infrastructurev1beta1.InstanceReadyCondition)).To(BeTrue())
+
+			By("Reconciling once the server failed")
+			cloud.Servers[server.ID].Status = "ERROR"
+			status = reconcileStatus(machineResyncDuration)
+			Expect(status.Ready).To(BeFalse())
+			Expect(status.Phase).To(Equal(infrastructurev1beta1.KTMachinePhaseFailed))
+			Expect(status.FailureReason).To(HaveValue(Equal(infrastructurev1beta1.InstanceErrorReason)))
+		})
+
+		It("should fail the machine or recreate its server once the server vanished on KT Cloud", func() {
+			controllerReconciler := &KTMachineReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+			delete(cloud.Servers, server.ID)
+
+			By("Reconciling without a remediation policy")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			resource := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Spec.RemediationPolicy).To(Equal(infrastructurev1beta1.NoneMachineRemediationPolicy))
+			Expect(resource.Status.Phase).To(Equal(infrastructurev1beta1.KTMachinePhaseFailed))
+			Expect(resource.Status.FailureReason).To(HaveValue(Equal(infrastructurev1beta1.InstanceNotFoundReason)))
+			Expect(resource.Status.ID).To(Equal(server.ID))
+
+			By("Reconciling with the Recreate remediation policy")
+			resource.Spec.RemediationPolicy = infrastructurev1beta1.RecreateMachineRemediationPolicy
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.ID).To(BeEmpty())
+			Expect(resource.Status.FailureReason).To(BeNil())
+			Expect(resource.Status.Phase).To(Equal(infrastructurev1beta1.KTMachinePhasePending))
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.ID).NotTo(BeEmpty())
+			Expect(resource.Status.ID).NotTo(Equal(server.ID))
+			Expect(cloud.Servers).To(HaveKey(resource.Status.ID))
+		})
+
+		It("should adopt the server it requested instead of creating another one", func() {
+			controllerReconciler := &KTMachineReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+			resource := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Status.ID = ""
+			Expect(k8sClient.Status().Update(ctx, resource)).To(Succeed())
+
+			By("Reconciling the machine without a server")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Annotations).To(HaveKey(infrastructurev1beta1.ServerCreateRequestedAnnotation))
+			requestedID := resource.Status.ID
+			Expect(cloud.Servers).To(HaveKey(requestedID))
+			Expect(cloud.Servers[requestedID].Metadata).To(Equal(map[string]string{
+				serverClusterNameMetadata: resourceName,
+				serverNamespaceMetadata:   "default",
+				serverMachineUIDMetadata:  string(resource.UID),
+			}))
+
+			By("Reconciling again as if the status recording the server was lost")
+			resource.Status.ID = ""
+			Expect(k8sClient.Status().Update(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.ID).To(Equal(requestedID))
+			Expect(cloud.Servers).To(HaveLen(2))
+		})
+	})
+
+	Context("When bootstrapping control plane machines", func() {
+		const resourceName = "test-bootstrap"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var cloud *fake.Cloud
+
+		BeforeEach(func() {
+			cloud = fake.New()
+
+			By("creating the KubeadmControlPlane the deployment bootstraps from")
+			kubeadmControlPlane := &infrastructurev1beta1.KubeadmControlPlane{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec: infrastructurev1beta1.KubeadmControlPlaneSpec{
+					Version: "v1.30.0",
+					KubeadmConfigSpec: infrastructurev1beta1.KubeadmConfigSpec{
+						PostKubeadmCommands: []string{"echo control plane ready"},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, kubeadmControlPlane)).To(Succeed())
+
+			machineDeployment := createMachineOwners(ctx, typeNamespacedName, infrastructurev1beta1.ConfigRef{
+				Kind: "KubeadmControlPlane",
+				Name: resourceName,
+			})
+			for _, name := range []string{resourceName + "-a", resourceName + "-b"} {
+				ktMachine := &infrastructurev1beta1.KTMachine{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+					Spec: infrastructurev1beta1.KTMachineSpec{
+						NetworkTier: []infrastructurev1beta1.NetworkTier{{ID: "tier"}},
+					},
+				}
+				Expect(controllerutil.SetControllerReference(machineDeployment, ktMachine, k8sClient.Scheme())).To(Succeed())
+				Expect(k8sClient.Create(ctx, ktMachine)).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			for _, name := range []string{resourceName + "-a", resourceName + "-b"} {
+				ktMachine := &infrastructurev1beta1.KTMachine{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, ktMachine)).To(Succeed())
+				ktMachine.Finalizers = nil
+				Expect(k8sClient.Update(ctx, ktMachine)).To(Succeed())
+				// machines deleted by a test are gone once their finalizer is removed
+				Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, ktMachine))).To(Succeed())
+			}
+			kubeadmControlPlane := &infrastructurev1beta1.KubeadmControlPlane{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, kubeadmControlPlane)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, kubeadmControlPlane)).To(Succeed())
+			deleteMachineOwners(ctx, typeNamespacedName)
+		})
+
+		It("should init the first control plane and join the others to it", func() {
+			var workloadHost string
+			var workloadErr error
+			controllerReconciler := &KTMachineReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+				// the test environment stands in for the workload cluster
+				WorkloadClient: func(config *rest.Config) (client.Client, error) {
+					workloadHost = config.Host
+					return k8sClient, workloadErr
+				},
+			}
+			first := types.NamespacedName{Name: resourceName + "-a", Namespace: "default"}
+			second := types.NamespacedName{Name: resourceName + "-b", Namespace: "default"}
+
+			By("Reconciling the first control plane")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: first})
+			Expect(err).NotTo(HaveOccurred())
+
+			ktMachine := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, first, ktMachine)).To(Succeed())
+			Expect(ktMachine.Status.ID).NotTo(BeEmpty())
+			Expect(ktMachine.Spec.Bootstrap.DataSecretName).To(HaveValue(Equal(resourceName + "-a-bootstrap")))
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-a-bootstrap", Namespace: "default"}, secret)).To(Succeed())
+			Expect(string(secret.Data["value"])).To(ContainSubstring("kubeadm init"))
+			Expect(string(secret.Data["value"])).To(ContainSubstring("echo control plane ready"))
+			Expect(string(secret.Data["value"])).To(ContainSubstring("/etc/kubernetes/pki/ca.key"))
+			Expect(string(secret.Data["value"])).NotTo(ContainSubstring("http.server"))
+			Expect(metav1.IsControlledBy(secret, ktMachine)).To(BeTrue())
+
+			caSecret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-ca", Namespace: "default"}, caSecret)).To(Succeed())
+			Expect(caSecret.Data).To(HaveKey(corev1.TLSPrivateKeyKey))
+
+			ktCluster := &infrastructurev1beta1.KTCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			Expect(ktCluster.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.ControlPlaneInitMachineAnnotation, first.Name))
+
+			By("Reconciling the second control plane before the first one has an address")
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: second})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(waitForBootstrapDataDuration))
+
+			By("Reconciling the second control plane before the cluster has a control plane endpoint")
+			ktMachine.Status.Addresses = []infrastructurev1beta1.MachineAddress{{Type: infrastructurev1beta1.MachineInternalIP, Address: "172.25.0.10"}}
+			Expect(k8sClient.Status().Update(ctx, ktMachine)).To(Succeed())
+			result, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: second})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(waitForBootstrapDataDuration))
+			Expect(workloadHost).To(BeEmpty())
+			waiting := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, second, waiting)).To(Succeed())
+			condition := meta.FindStatusCondition(waiting.Status.Conditions, infrastructurev1beta1.InstanceReadyCondition)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Reason).To(Equal(infrastructurev1beta1.WaitingForBootstrapDataReason))
+			Expect(condition.Message).To(ContainSubstring("control plane endpoint"))
+
+			By("Reporting a workload cluster that cannot be reached at the control plane endpoint")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			ktCluster.Status.ControlPlaneEndpoint = infrastructurev1beta1.APIEndpoint{Host: "203.0.113.10", Port: 6443}
+			Expect(k8sClient.Status().Update(ctx, ktCluster)).To(Succeed())
+			workloadErr = fmt.Errorf("connection refused")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: second})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, second, waiting)).To(Succeed())
+			condition = meta.FindStatusCondition(waiting.Status.Conditions, infrastructurev1beta1.InstanceReadyCondition)
+			Expect(condition.Reason).To(Equal(infrastructurev1beta1.WaitingForBootstrapDataReason))
+			Expect(condition.Message).To(ContainSubstring("203.0.113.10:6443"))
+			Expect(condition.Message).To(ContainSubstring("connection refused"))
+			Expect(waiting.Spec.Bootstrap.DataSecretName).To(BeNil())
+
+			By("Reconciling the second control plane once the workload cluster is reachable")
+			workloadErr = nil
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: second})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-b-bootstrap", Namespace: "default"}, secret)).To(Succeed())
+			Expect(string(secret.Data["value"])).To(ContainSubstring("kubeadm join"))
+			Expect(string(secret.Data["value"])).To(ContainSubstring("apiServerEndpoint: 172.25.0.10:6443"))
+			Expect(string(secret.Data["value"])).To(ContainSubstring("controlPlane: {}"))
+			Expect(string(secret.Data["value"])).To(ContainSubstring(strings.Split(string(caSecret.Data[corev1.TLSPrivateKeyKey]), "\n")[1]))
+			// the operator reaches the API server at the endpoint of the cluster, the machine at its private address
+			Expect(workloadHost).To(Equal("https://203.0.113.10:6443"))
+
+			tokenSecrets := &corev1.SecretList{}
+			Expect(k8sClient.List(ctx, tokenSecrets, client.InNamespace("kube-system"))).To(Succeed())
+			Expect(tokenSecrets.Items).To(ContainElement(HaveField("Type", pki.BootstrapTokenSecretType)))
+			for _, tokenSecret := range tokenSecrets.Items {
+				if tokenSecret.Type == pki.BootstrapTokenSecretType {
+					Expect(k8sClient.Delete(ctx, &tokenSecret)).To(Succeed())
+				}
+			}
+		})
+
+		It("should join the first control plane to the others once its server is recreated", func() {
+			controllerReconciler := &KTMachineReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+				WorkloadClient: func(config *rest.Config) (client.Client, error) {
+					return k8sClient, nil
+				},
+			}
+			first := types.NamespacedName{Name: resourceName + "-a", Namespace: "default"}
+			second := types.NamespacedName{Name: resourceName + "-b", Namespace: "default"}
+			bootstrapKey := types.NamespacedName{Name: resourceName + "-a-bootstrap", Namespace: "default"}
+
+			By("Reconciling the first control plane")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: first})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Running the second control plane")
+			ktMachine := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, second, ktMachine)).To(Succeed())
+			ktMachine.Labels = map[string]string{
+				infrastructurev1beta1.ClusterNameLabel: resourceName,
+				infrastructurev1beta1.MachineRoleLabel: infrastructurev1beta1.ControlPlaneMachineRole,
+			}
+			Expect(k8sClient.Update(ctx, ktMachine)).To(Succeed())
+			ktMachine.Status.InstanceState = "ACTIVE"
+			ktMachine.Status.Addresses = []infrastructurev1beta1.MachineAddress{{Type: infrastructurev1beta1.MachineInternalIP, Address: "172.25.0.11"}}
+			Expect(k8sClient.Status().Update(ctx, ktMachine)).To(Succeed())
+			ktCluster := &infrastructurev1beta1.KTCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			ktCluster.Status.ControlPlaneEndpoint = infrastructurev1beta1.APIEndpoint{Host: "203.0.113.11", Port: 6443}
+			Expect(k8sClient.Status().Update(ctx, ktCluster)).To(Succeed())
+
+			By("Reconciling the first control plane once its server vanished")
+			Expect(k8sClient.Get(ctx, first, ktMachine)).To(Succeed())
+			ktMachine.Spec.RemediationPolicy = infrastructurev1beta1.RecreateMachineRemediationPolicy
+			Expect(k8sClient.Update(ctx, ktMachine)).To(Succeed())
+			delete(cloud.Servers, ktMachine.Status.ID)
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: first})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, first, ktMachine)).To(Succeed())
+			Expect(ktMachine.Status.ID).To(BeEmpty())
+			Expect(ktMachine.Spec.Bootstrap.DataSecretName).To(BeNil())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, bootstrapKey, &corev1.Secret{}))).To(BeTrue())
+			ktCluster = &infrastructurev1beta1.KTCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			Expect(ktCluster.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.ControlPlaneInitMachineAnnotation, second.Name))
+
+			By("Reconciling the first control plane again to create its new server")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: first})
+			Expect(err).NotTo(HaveOccurred())
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, bootstrapKey, secret)).To(Succeed())
+			Expect(string(secret.Data["value"])).To(ContainSubstring("kubeadm join"))
+			Expect(string(secret.Data["value"])).NotTo(ContainSubstring("kubeadm init"))
+			Expect(string(secret.Data["value"])).To(ContainSubstring("apiServerEndpoint: 172.25.0.11:6443"))
+
+			tokenSecrets := &corev1.SecretList{}
+			Expect(k8sClient.List(ctx, tokenSecrets, client.InNamespace("kube-system"))).To(Succeed())
+			for _, tokenSecret := range tokenSecrets.Items {
+				if tokenSecret.Type == pki.BootstrapTokenSecretType {
+					Expect(k8sClient.Delete(ctx, &tokenSecret)).To(Succeed())
+				}
+			}
+		})
+
+		It("should join new machines to another control plane once the first one is deleted", func() {
+			var workloadHost string
+			controllerReconciler := &KTMachineReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+				WorkloadClient: func(config *rest.Config) (client.Client, error) {
+					workloadHost = config.Host
+					return k8sClient, nil
+				},
+			}
+			first := types.NamespacedName{Name: resourceName + "-a", Namespace: "default"}
+			second := types.NamespacedName{Name: resourceName + "-b", Namespace: "default"}
+
+			By("Reconciling the first control plane")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: first})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Running the second control plane")
+			ktMachine := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, second, ktMachine)).To(Succeed())
+			ktMachine.Labels = map[string]string{
+				infrastructurev1beta1.ClusterNameLabel: resourceName,
+				infrastructurev1beta1.MachineRoleLabel: infrastructurev1beta1.ControlPlaneMachineRole,
+			}
+			Expect(k8sClient.Update(ctx, ktMachine)).To(Succeed())
+			ktMachine.Status.InstanceState = "ACTIVE"
+			ktMachine.Status.Addresses = []infrastructurev1beta1.MachineAddress{{Type: infrastructurev1beta1.MachineInternalIP, Address: "172.25.0.11"}}
+			Expect(k8sClient.Status().Update(ctx, ktMachine)).To(Succeed())
+			ktCluster := &infrastructurev1beta1.KTCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			ktCluster.Status.ControlPlaneEndpoint = infrastructurev1beta1.APIEndpoint{Host: "203.0.113.11", Port: 6443}
+			Expect(k8sClient.Status().Update(ctx, ktCluster)).To(Succeed())
+
+			By("Deleting the first control plane")
+			Expect(k8sClient.Get(ctx, first, ktMachine)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, ktMachine)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: first})
+			Expect(err).NotTo(HaveOccurred())
+
+			ktCluster = &infrastructurev1beta1.KTCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			Expect(ktCluster.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.ControlPlaneInitMachineAnnotation, second.Name))
+
+			By("Creating a worker once the first control plane is gone")
+			workers := &infrastructurev1beta1.MachineDeployment{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-workers", Namespace: "default"},
+			}
+			workers.Spec.Template.Spec.ClusterName = resourceName
+			Expect(k8sClient.Create(ctx, workers)).To(Succeed())
+			worker := &infrastructurev1beta1.KTMachine{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-worker", Namespace: "default"},
+				Spec: infrastructurev1beta1.KTMachineSpec{
+					NetworkTier: []infrastructurev1beta1.NetworkTier{{ID: "tier"}},
+				},
+			}
+			Expect(controllerutil.SetControllerReference(workers, worker, k8sClient.Scheme())).To(Succeed())
+			Expect(k8sClient.Create(ctx, worker)).To(Succeed())
+			workerKey := client.ObjectKeyFromObject(worker)
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: workerKey})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, workerKey, worker)).To(Succeed())
+			Expect(worker.Status.ID).NotTo(BeEmpty())
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-worker-bootstrap", Namespace: "default"}, secret)).To(Succeed())
+			Expect(string(secret.Data["value"])).To(ContainSubstring("kubeadm join"))
+			Expect(string(secret.Data["value"])).To(ContainSubstring("apiServerEndpoint: 172.25.0.11:6443"))
+			Expect(workloadHost).To(Equal("https://203.0.113.11:6443"))
+
+			worker.Finalizers = nil
+			Expect(k8sClient.Update(ctx, worker)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, worker)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, workers)).To(Succeed())
+			tokenSecrets := &corev1.SecretList{}
+			Expect(k8sClient.List(ctx, tokenSecrets, client.InNamespace("kube-system"))).To(Succeed())
+			for _, tokenSecret := range tokenSecrets.Items {
+				if tokenSecret.Type == pki.BootstrapTokenSecretType {
+					Expect(k8sClient.Delete(ctx, &tokenSecret)).To(Succeed())
+				}
+			}
+		})
+	})
+	Context("When opening the firewall for the public IP of a control plane", func() {
+		const resourceName = "test-firewall-control-plane"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			ktMachine := &infrastructurev1beta1.KTMachine{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+			}
+			Expect(k8sClient.Create(ctx, ktMachine)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			firewalls := &infrastructurev1beta1.KTNetworkFirewallList{}
+			Expect(k8sClient.List(ctx, firewalls, client.InNamespace("default"))).To(Succeed())
+			for i := range firewalls.Items {
+				Expect(k8sClient.Delete(ctx, &firewalls.Items[i])).To(Succeed())
+			}
+			ktMachine := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktMachine)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, ktMachine)).To(Succeed())
+		})
+
+		It("should create a KTNetworkFirewall per port owned by the machine", func() {
+			cloud := fake.New()
+			cloud.PublicIPs = []ktcloud.PublicIP{{
+				Id:   "ip-1",
+				IP:   "211.0.0.10",
+				Type: "ASSOCIATE",
+				VirtualIps: []ktcloud.VirtualIP{{
+					Id:        "virtualip-1",
+					VMGuestIP: "172.25.0.10",
+					NetworkId: "tier",
+				}},
+			}}
+			controllerReconciler := &KTMachineReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+			cloudClient := cloud.Factory()("gd1", "token")
+			ktCluster := &infrastructurev1beta1.KTCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "edge", Namespace: "default"},
+				Spec: infrastructurev1beta1.KTClusterSpec{
+					ControlPlaneExternalNetworkEnable: true,
+				},
+			}
+			ktMachine := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktMachine)).To(Succeed())
+			ktMachine.Status.Addresses = []infrastructurev1beta1.MachineAddress{{Type: infrastructurev1beta1.MachineInternalIP, Address: "172.25.0.10"}}
+			ktMachine.Status.AssignedPublicIps = []infrastructurev1beta1.AssignedPublicIps{{Id: "ip-1", IP: "211.0.0.10"}}
+			listFirewalls := func() []infrastructurev1beta1.KTNetworkFirewall {
+				firewalls := &infrastructurev1beta1.KTNetworkFirewallList{}
+				Expect(k8sClient.List(ctx, firewalls, client.InNamespace("default"))).To(Succeed())
+				return firewalls.Items
+			}
+
+			By("skipping the rules without the external network of the cluster")
+			Expect(controllerReconciler.reconcileFirewalls(ctx, cloudClient, ktCluster, ktMachine)).To(Succeed())
+			Expect(listFirewalls()).To(BeEmpty())
+
+			By("opening the API server and extra ports")
+			ktCluster.Spec.ExternalFirewall = infrastructurev1beta1.ExternalFirewall{
+				ExternalNetworkID: "external",
+				ExtraPorts:        []infrastructurev1beta1.FirewallPort{{Name: "nodeports", StartPort: 30000, EndPort: 32767}},
+			}
+			Expect(controllerReconciler.reconcileFirewalls(ctx, cloudClient, ktCluster, ktMachine)).To(Succeed())
+			Expect(listFirewalls()).To(HaveLen(2))
+
+			apiServer := &infrastructurev1beta1.KTNetworkFirewall{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-apiserver", Namespace: "default"}, apiServer)).To(Succeed())
+			Expect(metav1.IsControlledBy(apiServer, ktMachine)).To(BeTrue())
+			Expect(apiServer.Labels).To(HaveKeyWithValue(infrastructurev1beta1.ClusterNameLabel, "edge"))
+			Expect(apiServer.Spec).To(Equal(infrastructurev1beta1.KTNetworkFirewallSpec{
+				ClusterName:  "edge",
+				StartPort:    "6443",
+				EndPort:      "6443",
+				Protocol:     6,
+				Action:       1,
+				VirtualIPID:  "virtualip-1",
+				SrcNetworkID: "external",
+				DstIP:        "172.25.0.10",
+				DstNetworkID: "tier",
+			}))
+
+			nodePorts := &infrastructurev1beta1.KTNetworkFirewall{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-nodeports", Namespace: "default"}, nodePorts)).To(Succeed())
+			Expect(nodePorts.Spec.StartPort).To(Equal("30000"))
+			Expect(nodePorts.Spec.EndPort).To(Equal("32767"))
+
+			By("deleting the firewall of a port removed from the cluster")
+			ktCluster.Spec.ExternalFirewall.ExtraPorts = nil
+			Expect(controllerReconciler.reconcileFirewalls(ctx, cloudClient, ktCluster, ktMachine)).To(Succeed())
+			Expect(listFirewalls()).To(ConsistOf(HaveField("Name", resourceName+"-apiserver")))
+		})
+	})
+
+	Context("When sharing a public IP between control planes", func() {
+		ctx := context.Background()
+
+		It("should forward the next free port to each control plane", func() {
+			controllerReconciler := &KTMachineReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			ktCluster := &infrastructurev1beta1.KTCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "default"},
+				Spec: infrastructurev1beta1.KTClusterSpec{
+					ControlPlaneExternalNetworkEnable: true,
+					PortForwarding:                    infrastructurev1beta1.PortForwarding{Enabled: true},
+				},
+			}
+			Expect(k8sClient.Create(ctx, ktCluster)).To(Succeed())
+			claimKey := types.NamespacedName{Name: "shared-control-plane-public-ip", Namespace: "default"}
+
+			for _, name := range []string{"shared-control-plane-a", "shared-control-plane-b"} {
+				ktMachine := &infrastructurev1beta1.KTMachine{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+				Expect(controllerReconciler.forwardAPIServerPort(ctx, ktCluster, ktMachine)).To(Succeed())
+				// forwarding again is a no-op
+				Expect(controllerReconciler.forwardAPIServerPort(ctx, ktCluster, ktMachine)).To(Succeed())
+			}
+
+			claim := &infrastructurev1beta1.KTPublicNetwork{}
+			Expect(k8sClient.Get(ctx, claimKey, claim)).To(Succeed())
+			Expect(metav1.IsControlledBy(claim, ktCluster)).To(BeTrue())
+			Expect(claim.Spec.ClusterName).To(Equal("shared"))
+			Expect(claim.Spec.PortForwards).To(HaveLen(2))
+			Expect(claim.Spec.PortForwards[0].PublicPort).To(Equal(int32(6443)))
+			Expect(claim.Spec.PortForwards[1].PublicPort).To(Equal(int32(6444)))
+			Expect(claim.Spec.PortForwards[1].PrivatePort).To(Equal(int32(6443)))
+
+			By("removing the port forward of a deleted machine")
+			forwarded, err := controllerReconciler.removePortForwards(ctx, &infrastructurev1beta1.KTMachine{
+				ObjectMeta: metav1.ObjectMeta{Name: "shared-control-plane-a", Namespace: "default"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(forwarded).To(BeFalse())
+			Expect(k8sClient.Get(ctx, claimKey, claim)).To(Succeed())
+			Expect(claim.Spec.PortForwards).To(ConsistOf(HaveField("Name", "shared-control-plane-b")))
+
+			Expect(k8sClient.Delete(ctx, claim)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, ktCluster)).To(Succeed())
+		})
+	})
+
+	Context("When talking to the API server of a workload cluster", func() {
+		It("should verify the serving certificate at an endpoint IP that is not in it", func() {
+			ca, err := pki.NewCertificateAuthority("kubernetes")
+			Expect(err).NotTo(HaveOccurred())
+			caPair, err := tls.X509KeyPair(ca.Cert, ca.Key)
+			Expect(err).NotTo(HaveOccurred())
+			caCert, err := x509.ParseCertificate(caPair.Certificate[0])
+			Expect(err).NotTo(HaveOccurred())
+
+			By("serving a certificate that only names kubernetes, like kubeadm does for public IPs")
+			serverKey, err := rsa.GenerateKey(rand.Reader, 2048)
+			Expect(err).NotTo(HaveOccurred())
+			serverCert, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+				SerialNumber: big.NewInt(2),
+				Subject:      pkix.Name{CommonName: "kube-apiserver"},
+				DNSNames:     []string{"kubernetes"},
+				NotBefore:    time.Now().Add(-time.Minute),
+				NotAfter:     time.Now().Add(time.Hour),
+				KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+				ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			}, caCert, &serverKey.PublicKey, caPair.PrivateKey)
+			Expect(err).NotTo(HaveOccurred())
+
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch req.URL.Path {
+				case "/api":
+					_, _ = io.WriteString(w, `{"kind": "APIVersions", "versions": ["v1"]}`)
+				case "/apis":
+					_, _ = io.WriteString(w, `{"kind": "APIGroupList", "apiVersion": "v1", "groups": []}`)
+				case "/api/v1":
+					_, _ = io.WriteString(w, `{"kind": "APIResourceList", "groupVersion": "v1", "resources": [{"name": "nodes", "singularName": "node", "namespaced": false, "kind": "Node", "verbs": ["get"]}]}`)
+				case "/api/v1/nodes/node":
+					_, _ = io.WriteString(w, `{"kind": "Node", "apiVersion": "v1", "metadata": {"name": "node"}}`)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert}, PrivateKey: serverKey}}}
+			server.StartTLS()
+			defer server.Close()
+
+			By("getting a node through the endpoint IP")
+			controllerReconciler := &KTMachineReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+			workloadClient, err := controllerReconciler.workloadClusterClient(strings.TrimPrefix(server.URL, "https://"), ca)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(workloadClient.Get(context.Background(), types.NamespacedName{Name: "node"}, &corev1.Node{})).To(Succeed())
 		})
 	})
 })
+
+// createMachineOwners creates the KTCluster, KTMachineTemplate, MachineDeployment and a ready
+// KTSubjectToken a KTMachine owned by the returned MachineDeployment is reconciled against.
+func createMachineOwners(ctx context.Context, key types.NamespacedName, bootstrapConfigRef infrastructurev1beta1.ConfigRef) *infrastructurev1beta1.MachineDeployment {
+	ktCluster := &infrastructurev1beta1.KTCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+	}
+	Expect(k8sClient.Create(ctx, ktCluster)).To(Succeed())
+
+	ktMachineTemplate := &infrastructurev1beta1.KTMachineTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+	}
+	Expect(controllerutil.SetControllerReference(ktCluster, ktMachineTemplate, k8sClient.Scheme())).To(Succeed())
+	Expect(k8sClient.Create(ctx, ktMachineTemplate)).To(Succeed())
+
+	machineDeployment := &infrastructurev1beta1.MachineDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+	}
+	machineDeployment.Spec.Template.Spec.Bootstrap.ConfigRef = bootstrapConfigRef
+	machineDeployment.Spec.Template.Spec.ClusterName = ktCluster.Name
+	machineDeployment.Spec.Template.Spec.InfrastructureRef = infrastructurev1beta1.InfrastructureRef{Kind: "KTMachineTemplate", Name: ktMachineTemplate.Name}
+	Expect(k8sClient.Create(ctx, machineDeployment)).To(Succeed())
+
+	ktSubjectToken := &infrastructurev1beta1.KTSubjectToken{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+	}
+	Expect(k8sClient.Create(ctx, ktSubjectToken)).To(Succeed())
+	ktSubjectToken.Status.SubjectToken = "token"
+	ktSubjectToken.Status.Zone = "gd1"
+	Expect(k8sClient.Status().Update(ctx, ktSubjectToken)).To(Succeed())
+
+	return machineDeployment
+}
+
+// deleteMachineOwners deletes what createMachineOwners created.
+func deleteMachineOwners(ctx context.Context, key types.NamespacedName) {
+	for _, obj := range []client.Object{
+		&infrastructurev1beta1.KTSubjectToken{},
+		&infrastructurev1beta1.MachineDeployment{},
+		&infrastructurev1beta1.KTMachineTemplate{},
+		&infrastructurev1beta1.KTCluster{},
+	} {
+		// some tests delete the cluster and its token before the machines
+		err := k8sClient.Get(ctx, key, obj)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Delete(ctx, obj)).To(Succeed())
+	}
+}
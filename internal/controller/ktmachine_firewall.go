@@ -0,0 +1,182 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
+)
+
+const (
+	// firewallProtocolTCP and firewallActionAllow are how the NC firewall API numbers TCP and allowing traffic
+	firewallProtocolTCP = 6
+	firewallActionAllow = 1
+
+	// apiServerPort is the port kubeadm binds the API server to
+	apiServerPort = 6443
+
+	// apiServerFirewallName is the port name of the API server firewall rule
+	apiServerFirewallName = "apiserver"
+)
+
+// desiredFirewalls returns the KTNetworkFirewalls that open the API server port and the extra ports of the
+// cluster on each public IP statically NATed to the machine. publicIPs are the public IPs of the zone.
+func desiredFirewalls(cluster *v1beta1.KTCluster, ktMachine *v1beta1.KTMachine, publicIPs []ktcloud.PublicIP) []v1beta1.KTNetworkFirewall {
+	ports := append([]v1beta1.FirewallPort{{
+		Name:      apiServerFirewallName,
+		StartPort: apiServerPort,
+	}}, cluster.Spec.ExternalFirewall.ExtraPorts...)
+
+	guestIPs := map[string]bool{}
+	for _, address := range machineAddresses(ktMachine) {
+		guestIPs[address] = true
+	}
+
+	var firewalls []v1beta1.KTNetworkFirewall
+	seen := map[string]bool{}
+	for i, assigned := range ktMachine.Status.AssignedPublicIps {
+		// a public IP shared with port forwarding is listed once per forwarded port
+		if seen[assigned.Id] {
+			continue
+		}
+		seen[assigned.Id] = true
+		virtualIP := findVirtualIP(publicIPs, assigned.Id, guestIPs)
+		if virtualIP == nil {
+			continue
+		}
+		for _, port := range ports {
+			name := ktMachine.Name + "-" + port.Name
+			if i > 0 {
+				name += "-" + strconv.Itoa(i)
+			}
+			endPort := port.EndPort
+			if endPort == 0 {
+				endPort = port.StartPort
+			}
+			protocol := port.Protocol
+			if protocol == 0 {
+				protocol = firewallProtocolTCP
+			}
+			firewalls = append(firewalls, v1beta1.KTNetworkFirewall{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: ktMachine.Namespace,
+					Labels:    map[string]string{v1beta1.ClusterNameLabel: cluster.Name},
+				},
+				Spec: v1beta1.KTNetworkFirewallSpec{
+					ClusterName:  cluster.Name,
+					StartPort:    strconv.Itoa(int(port.StartPort)),
+					EndPort:      strconv.Itoa(int(endPort)),
+					Protocol:     protocol,
+					Action:       firewallActionAllow,
+					VirtualIPID:  virtualIP.Id,
+					SrcNetworkID: cluster.Spec.ExternalFirewall.ExternalNetworkID,
+					DstIP:        virtualIP.VMGuestIP,
+					DstNetworkID: virtualIP.NetworkId,
+				},
+			})
+		}
+	}
+	return firewalls
+}
+
+// findVirtualIP returns the static NAT of the public IP with the given ID to one of guestIPs.
+func findVirtualIP(publicIPs []ktcloud.PublicIP, publicIPID string, guestIPs map[string]bool) *ktcloud.VirtualIP {
+	for i := range publicIPs {
+		if publicIPs[i].Id != publicIPID {
+			continue
+		}
+		for j := range publicIPs[i].VirtualIps {
+			if guestIPs[publicIPs[i].VirtualIps[j].VMGuestIP] {
+				return &publicIPs[i].VirtualIps[j]
+			}
+		}
+	}
+	return nil
+}
+
+// reconcileFirewalls creates and updates the KTNetworkFirewalls of the machine's public IPs and deletes
+// the ones no longer wanted. They are owned by the machine and garbage collected with it.
+func (r *KTMachineReconciler) reconcileFirewalls(ctx context.Context, cloud ktcloud.Client, cluster *v1beta1.KTCluster, ktMachine *v1beta1.KTMachine) error {
+	logger := log.FromContext(ctx, "LogFrom", "Machine")
+
+	if cluster.Spec.ExternalFirewall.ExternalNetworkID == "" {
+		logger.Info("Skip firewall rules for the public IP of the machine, the cluster has no externalFirewall.externalNetworkID")
+		return nil
+	}
+
+	publicIPs, err := cloud.IPAddresses().List(ctx)
+	if err != nil {
+		return err
+	}
+
+	wanted := map[string]bool{}
+	for _, firewall := range desiredFirewalls(cluster, ktMachine, publicIPs) {
+		wanted[firewall.Name] = true
+
+		existing := &v1beta1.KTNetworkFirewall{}
+		err := r.Get(ctx, types.NamespacedName{Name: firewall.Name, Namespace: firewall.Namespace}, existing)
+		if apierrors.IsNotFound(err) {
+			if err := controllerutil.SetControllerReference(ktMachine, &firewall, r.Scheme); err != nil {
+				return err
+			}
+			if err := r.Create(ctx, &firewall); err != nil {
+				return fmt.Errorf("failed to create KTNetworkFirewall %s: %w", firewall.Name, err)
+			}
+			logger.Info("Created firewall for the public IP of the machine", "KTNetworkFirewall", firewall.Name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !equality.Semantic.DeepEqual(existing.Spec, firewall.Spec) {
+			existing.Spec = firewall.Spec
+			if err := r.Update(ctx, existing); err != nil {
+				return fmt.Errorf("failed to update KTNetworkFirewall %s: %w", firewall.Name, err)
+			}
+			logger.Info("Updated firewall for the public IP of the machine", "KTNetworkFirewall", firewall.Name)
+		}
+	}
+
+	firewalls := &v1beta1.KTNetworkFirewallList{}
+	if err := r.List(ctx, firewalls, client.InNamespace(ktMachine.Namespace), client.MatchingLabels{v1beta1.ClusterNameLabel: cluster.Name}); err != nil {
+		return err
+	}
+	for i := range firewalls.Items {
+		firewall := &firewalls.Items[i]
+		if wanted[firewall.Name] || !metav1.IsControlledBy(firewall, ktMachine) {
+			continue
+		}
+		if err := r.Delete(ctx, firewall); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete KTNetworkFirewall %s: %w", firewall.Name, err)
+		}
+		logger.Info("Deleted firewall no longer wanted for the machine", "KTNetworkFirewall", firewall.Name)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+)
+
+// sharedPublicIPClaimName returns the name of the KTPublicNetwork the control planes of the cluster
+// share with port forwarding.
+func sharedPublicIPClaimName(cluster *v1beta1.KTCluster) string {
+	return cluster.Name + "-control-plane-public-ip"
+}
+
+// apiServerBasePort returns the public port forwarded to the API server of the first control plane.
+func apiServerBasePort(cluster *v1beta1.KTCluster) int32 {
+	if cluster.Spec.PortForwarding.APIServerBasePort != 0 {
+		return cluster.Spec.PortForwarding.APIServerBasePort
+	}
+	return apiServerPort
+}
+
+// forwardAPIServerPort adds a port forward to the API server of the machine to the public IP the control
+// planes of the cluster share, creating its KTPublicNetwork owned by the KTCluster when needed. The
+// machine gets the first free public port from the API server base port of the cluster.
+func (r *KTMachineReconciler) forwardAPIServerPort(ctx context.Context, cluster *v1beta1.KTCluster, ktMachine *v1beta1.KTMachine) error {
+	logger := log.FromContext(ctx, "LogFrom", "Machine")
+
+	claim := &v1beta1.KTPublicNetwork{}
+	err := r.Get(ctx, types.NamespacedName{Name: sharedPublicIPClaimName(cluster), Namespace: cluster.Namespace}, claim)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+	if !exists {
+		claim = &v1beta1.KTPublicNetwork{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      sharedPublicIPClaimName(cluster),
+				Namespace: cluster.Namespace,
+				Labels:    map[string]string{v1beta1.ClusterNameLabel: cluster.Name},
+			},
+			Spec: v1beta1.KTPublicNetworkSpec{
+				ClusterName: cluster.Name,
+				// DNS records of the cluster point to the endpoint IP, the control planes share it
+				IP: cluster.Spec.PublicIPPool.ControlPlaneEndpointIP,
+			},
+		}
+		if err := controllerutil.SetControllerReference(cluster, claim, r.Scheme); err != nil {
+			return err
+		}
+	}
+
+	for _, portForward := range claim.Spec.PortForwards {
+		if portForward.MachineRef.Name == ktMachine.Name {
+			return nil
+		}
+	}
+
+	port := apiServerBasePort(cluster)
+	for slices.ContainsFunc(claim.Spec.PortForwards, func(portForward v1beta1.PortForward) bool {
+		return portForward.PublicPort == port
+	}) {
+		port++
+	}
+	claim.Spec.PortForwards = append(claim.Spec.PortForwards, v1beta1.PortForward{
+		Name:        ktMachine.Name,
+		MachineRef:  corev1.LocalObjectReference{Name: ktMachine.Name},
+		PublicPort:  port,
+		PrivatePort: apiServerPort,
+	})
+
+	// a conflict means another control plane took a port first, the machine is requeued and picks again
+	if exists {
+		err = r.Update(ctx, claim)
+	} else {
+		err = r.Create(ctx, claim)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to forward API server port on KTPublicNetwork %s: %w", claim.Name, err)
+	}
+	logger.Info("Forwarded API server port of shared public IP to machine", "KTPublicNetwork", claim.Name, "Port", port)
+	return nil
+}
+
+// removePortForwards removes the port forwards to the machine from the KTPublicNetworks in its namespace.
+// It returns true while a claim still has a port forwarding rule to the machine on KT Cloud.
+func (r *KTMachineReconciler) removePortForwards(ctx context.Context, ktMachine *v1beta1.KTMachine) (bool, error) {
+	logger := log.FromContext(ctx, "LogFrom", "Machine")
+
+	claims := &v1beta1.KTPublicNetworkList{}
+	if err := r.List(ctx, claims, client.InNamespace(ktMachine.Namespace)); err != nil {
+		return false, err
+	}
+
+	forwarded := false
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		portForwards := slices.DeleteFunc(slices.Clone(claim.Spec.PortForwards), func(portForward v1beta1.PortForward) bool {
+			return portForward.MachineRef.Name == ktMachine.Name
+		})
+		if len(portForwards) != len(claim.Spec.PortForwards) {
+			claim.Spec.PortForwards = portForwards
+			if err := r.Update(ctx, claim); err != nil {
+				return false, fmt.Errorf("failed to remove port forward from KTPublicNetwork %s: %w", claim.Name, err)
+			}
+			logger.Info("Removed port forward to machine", "KTPublicNetwork", claim.Name)
+		}
+		forwarded = forwarded || slices.ContainsFunc(claim.Status.PortForwards, func(status v1beta1.PortForwardStatus) bool {
+			return status.Machine == ktMachine.Name
+		})
+	}
+	return forwarded, nil
+}
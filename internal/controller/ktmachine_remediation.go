@@ -0,0 +1,103 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+)
+
+// reconcileMissingServer handles a machine whose server no longer exists on KT Cloud as its remediation
+// policy says: Recreate forgets the server so a new one is created with fresh bootstrap data, Delete
+// deletes the machine for its MachineDeployment to replace, and None only marks the machine as failed.
+func (r *KTMachineReconciler) reconcileMissingServer(ctx context.Context, ktMachine *v1beta1.KTMachine, original *v1beta1.KTMachineStatus) (ctrl.Result, error) {
+	logger := log.FromContext(ctx, "LogFrom", "KTMachine")
+
+	serverID := ktMachine.Status.ID
+	reason, message := v1beta1.InstanceNotFoundReason, "Server "+serverID+" no longer exists on KT Cloud"
+
+	switch ktMachine.Spec.RemediationPolicy {
+	case v1beta1.RecreateMachineRemediationPolicy:
+		logger.Info("Server of machine no longer exists on KT Cloud, recreating it", "ID", serverID)
+		if err := r.resetBootstrapData(ctx, ktMachine); err != nil {
+			logger.Error(err, "Failed to reset the bootstrap data of the machine to recreate")
+			return ctrl.Result{}, err
+		}
+		forgetServer(ktMachine)
+		setMachineCondition(ktMachine, v1beta1.InstanceReadyCondition, metav1.ConditionFalse, reason, message+", recreating it")
+		return r.updateMachineStatus(ctx, ktMachine, original, waitForBuildingServerDuration)
+
+	case v1beta1.DeleteMachineRemediationPolicy:
+		// the deleted machine reports the Deleting phase from now on
+		logger.Info("Server of machine no longer exists on KT Cloud, deleting the machine", "ID", serverID)
+		if err := r.Delete(ctx, ktMachine); client.IgnoreNotFound(err) != nil {
+			logger.Error(err, "Failed to delete KTMachine whose server no longer exists")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+
+	default:
+		logger.Info("Server of machine no longer exists on KT Cloud, marking the machine as failed", "ID", serverID)
+		ktMachine.Status.InstanceState = ""
+		ktMachine.Status.FailureReason = &reason
+		ktMachine.Status.FailureMessage = &message
+		setMachineCondition(ktMachine, v1beta1.InstanceReadyCondition, metav1.ConditionFalse, reason, message)
+		return r.updateMachineStatus(ctx, ktMachine, original, machineResyncDuration)
+	}
+}
+
+// resetBootstrapData drops the generated bootstrap data of a machine whose server is recreated, its bootstrap
+// token expired long ago and the first control plane must join the cluster it initialized instead of running
+// kubeadm init again. The data is generated anew for the new server. Bootstrap data the machine was given is kept.
+func (r *KTMachineReconciler) resetBootstrapData(ctx context.Context, ktMachine *v1beta1.KTMachine) error {
+	if err := r.releaseControlPlaneInit(ctx, ktMachine, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(ktMachine)}); err != nil {
+		return err
+	}
+
+	dataSecretName := ktMachine.Spec.Bootstrap.DataSecretName
+	if dataSecretName == nil || *dataSecretName != bootstrapDataSecretName(ktMachine) {
+		return nil
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: *dataSecretName, Namespace: ktMachine.Namespace}}
+	if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	ktMachine.Spec.Bootstrap.DataSecretName = nil
+	return r.Update(ctx, ktMachine)
+}
+
+// forgetServer clears what the machine status records about its server, so the machine is created again.
+// The public IPs claimed for the machine are kept and bound to the new server.
+func forgetServer(ktMachine *v1beta1.KTMachine) {
+	status := &ktMachine.Status
+	status.ID = ""
+	status.ProviderID = nil
+	status.InstanceState = ""
+	status.Server = nil
+	status.Addresses = nil
+	status.FailureReason = nil
+	status.FailureMessage = nil
+	meta.RemoveStatusCondition(&status.Conditions, v1beta1.BootstrapExecSucceededCondition)
+}
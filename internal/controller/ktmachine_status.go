@@ -0,0 +1,280 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
+)
+
+// providerID returns the provider ID of the server with the given ID in zone.
+func providerID(zone, id string) string {
+	return "ktcloud://" + zone + "/" + id
+}
+
+// setMachineCondition sets the condition of the machine.
+func setMachineCondition(ktMachine *v1beta1.KTMachine, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&ktMachine.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: ktMachine.Generation,
+	})
+}
+
+// setStatusFromServer records the server as reported by KT Cloud in zone in the machine status, and
+// whether it is ready. A server in the ERROR state fails the machine. The public IPs the operator
+// attached are kept.
+func setStatusFromServer(ktMachine *v1beta1.KTMachine, zone string, server *ktcloud.Server) {
+	status := &ktMachine.Status
+	status.ID = server.ID
+	id := providerID(zone, server.ID)
+	status.ProviderID = &id
+	status.InstanceState = server.Status
+	status.Server = serverStatus(server)
+	status.Addresses = machineStatusAddresses(server.PrivateAddresses(), status.AssignedPublicIps)
+
+	status.FailureReason = nil
+	status.FailureMessage = nil
+	switch server.Status {
+	case "ACTIVE":
+		setMachineCondition(ktMachine, v1beta1.InstanceReadyCondition, metav1.ConditionTrue, v1beta1.InstanceActiveReason, "")
+	case "ERROR":
+		reason, message := v1beta1.InstanceErrorReason, "Server "+server.ID+" is in the ERROR state on KT Cloud"
+		status.FailureReason = &reason
+		status.FailureMessage = &message
+		setMachineCondition(ktMachine, v1beta1.InstanceReadyCondition, metav1.ConditionFalse, reason, message)
+	case "":
+		// KT Cloud only returns the ID of a server it was just asked to create
+		setMachineCondition(ktMachine, v1beta1.InstanceReadyCondition, metav1.ConditionFalse, v1beta1.InstanceProvisioningReason,
+			"Server "+server.ID+" is being created on KT Cloud")
+	default:
+		setMachineCondition(ktMachine, v1beta1.InstanceReadyCondition, metav1.ConditionFalse, v1beta1.InstanceProvisioningReason,
+			"Server "+server.ID+" is "+server.Status+" on KT Cloud")
+	}
+}
+
+// serverStatus copies the server as reported by KT Cloud into the debug field of the machine status.
+func serverStatus(server *ktcloud.Server) *v1beta1.KTServerStatus {
+	status := &v1beta1.KTServerStatus{}
+	status.AdminPass = server.AdminPass
+	for _, link := range server.Links {
+		status.Links = append(status.Links, v1beta1.Links{Rel: link.Rel, Href: link.Href})
+	}
+	for _, group := range server.SecurityGroups {
+		status.SecurityGroups = append(status.SecurityGroups, v1beta1.SecurityGroups{Name: group.Name})
+	}
+	status.TenantID = server.TenantID
+	if len(server.Addresses) > 0 {
+		status.Addresses = map[string][]v1beta1.Address{}
+		for network, addresses := range server.Addresses {
+			for _, address := range addresses {
+				status.Addresses[network] = append(status.Addresses[network], v1beta1.Address{
+					MACAddr: address.MACAddr,
+					Type:    address.Type,
+					Addr:    address.Addr,
+					Version: address.Version,
+				})
+			}
+		}
+	}
+	status.TaskState = server.TaskState
+	status.Description = server.Description
+	status.DiskConfig = server.DiskConfig
+	status.TrustedImageCerts = server.TrustedImageCerts
+	status.AvailabilityZone = server.AvailabilityZone
+	status.PowerState = server.PowerState
+	for _, volume := range server.VolumesAttached {
+		status.VolumesAttached = append(status.VolumesAttached, v1beta1.VolumeAttached{
+			DeleteOnTermination: volume.DeleteOnTermination,
+			ID:                  volume.ID,
+		})
+	}
+	status.Locked = server.Locked
+	status.Image = server.Image
+	status.AccessIPv4 = server.AccessIPv4
+	status.AccessIPv6 = server.AccessIPv6
+	status.Created = server.Created
+	status.HostID = server.HostID
+	status.Tags = server.Tags
+	status.Flavor = v1beta1.Flavor{
+		Disk:       server.Flavor.Disk,
+		Swap:       server.Flavor.Swap,
+		Original:   server.Flavor.Original,
+		ExtraSpecs: server.Flavor.ExtraSpecs,
+		Ephemeral:  server.Flavor.Ephemeral,
+		VCPUs:      server.Flavor.VCPUs,
+		RAM:        server.Flavor.RAM,
+	}
+	status.KeyName = server.KeyName
+	status.VMState = server.VMState
+	status.UserID = server.UserID
+	status.Name = server.Name
+	status.Progress = server.Progress
+	status.LaunchedAt = server.LaunchedAt
+	status.Updated = server.Updated
+	status.Status = server.Status
+	status.TerminatedAt = server.TerminatedAt
+	status.ConfigDrive = server.ConfigDrive
+	return status
+}
+
+// machineStatusAddresses returns the private addresses as InternalIP addresses followed by the public
+// IPs bound to the machine as ExternalIP addresses. A public IP shared with port forwarding is listed once.
+func machineStatusAddresses(private []string, assigned []v1beta1.AssignedPublicIps) []v1beta1.MachineAddress {
+	var addresses []v1beta1.MachineAddress
+	for _, address := range private {
+		addresses = append(addresses, v1beta1.MachineAddress{Type: v1beta1.MachineInternalIP, Address: address})
+	}
+	for _, publicIP := range assigned {
+		address := v1beta1.MachineAddress{Type: v1beta1.MachineExternalIP, Address: publicIP.IP}
+		if publicIP.IP != "" && !slices.Contains(addresses, address) {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// setPublicIPCondition records whether a public IP is bound to the machine when it needs one.
+func setPublicIPCondition(ktMachine *v1beta1.KTMachine, needsPublicIP bool) {
+	switch {
+	case !needsPublicIP:
+		meta.RemoveStatusCondition(&ktMachine.Status.Conditions, v1beta1.PublicIPAttachedCondition)
+	case len(ktMachine.Status.AssignedPublicIps) > 0:
+		setMachineCondition(ktMachine, v1beta1.PublicIPAttachedCondition, metav1.ConditionTrue, v1beta1.PublicIPAttachedReason, "")
+	default:
+		setMachineCondition(ktMachine, v1beta1.PublicIPAttachedCondition, metav1.ConditionFalse, v1beta1.WaitingForPublicIPReason,
+			"Waiting for KTPublicNetwork to bind a public IP to the machine")
+	}
+}
+
+// reconcileBootstrapCondition checks whether the node of an ACTIVE machine registered with the workload
+// cluster, which means kubeadm ran the bootstrap data successfully. Once it did the cluster is not asked again.
+func (r *KTMachineReconciler) reconcileBootstrapCondition(ctx context.Context, cluster *v1beta1.KTCluster, ktMachine *v1beta1.KTMachine) {
+	if ktMachine.Spec.UserData != "" || ktMachine.Spec.Bootstrap.DataSecretName == nil {
+		meta.RemoveStatusCondition(&ktMachine.Status.Conditions, v1beta1.BootstrapExecSucceededCondition)
+		return
+	}
+	if ktMachine.Status.InstanceState != "ACTIVE" || meta.IsStatusConditionTrue(ktMachine.Status.Conditions, v1beta1.BootstrapExecSucceededCondition) {
+		return
+	}
+	if cluster == nil || cluster.Status.ControlPlaneEndpoint.Host == "" {
+		setMachineCondition(ktMachine, v1beta1.BootstrapExecSucceededCondition, metav1.ConditionFalse, v1beta1.WaitingForNodeReason,
+			"Waiting for the control plane endpoint of the cluster")
+		return
+	}
+
+	certificates, err := r.getOrCreateClusterCertificates(ctx, cluster)
+	if err != nil {
+		setMachineCondition(ktMachine, v1beta1.BootstrapExecSucceededCondition, metav1.ConditionFalse, v1beta1.WaitingForNodeReason, err.Error())
+		return
+	}
+	endpoint := net.JoinHostPort(cluster.Status.ControlPlaneEndpoint.Host, strconv.Itoa(int(cluster.Status.ControlPlaneEndpoint.Port)))
+	workloadClient, err := r.workloadClusterClient(endpoint, &certificates.CA)
+	if err != nil {
+		setMachineCondition(ktMachine, v1beta1.BootstrapExecSucceededCondition, metav1.ConditionFalse, v1beta1.WaitingForNodeReason, err.Error())
+		return
+	}
+
+	// kubeadm registers the node under the hostname, which KT Cloud sets to the server name
+	nodeName := strings.ToLower(ktMachine.Name)
+	err = workloadClient.Get(ctx, types.NamespacedName{Name: nodeName}, &corev1.Node{})
+	switch {
+	case apierrors.IsNotFound(err):
+		setMachineCondition(ktMachine, v1beta1.BootstrapExecSucceededCondition, metav1.ConditionFalse, v1beta1.WaitingForNodeReason,
+			"Node "+nodeName+" has not registered with the cluster yet")
+	case err != nil:
+		setMachineCondition(ktMachine, v1beta1.BootstrapExecSucceededCondition, metav1.ConditionFalse, v1beta1.WaitingForNodeReason,
+			"Failed to get node "+nodeName+": "+err.Error())
+	default:
+		setMachineCondition(ktMachine, v1beta1.BootstrapExecSucceededCondition, metav1.ConditionTrue, v1beta1.NodeRegisteredReason, "")
+	}
+}
+
+// machinePhase summarizes the status of the machine.
+func machinePhase(ktMachine *v1beta1.KTMachine) v1beta1.KTMachinePhase {
+	switch {
+	case !ktMachine.DeletionTimestamp.IsZero():
+		return v1beta1.KTMachinePhaseDeleting
+	case ktMachine.Status.FailureReason != nil:
+		return v1beta1.KTMachinePhaseFailed
+	case ktMachine.Status.ID == "":
+		return v1beta1.KTMachinePhasePending
+	case ktMachine.Status.InstanceState == "ACTIVE":
+		return v1beta1.KTMachinePhaseRunning
+	default:
+		return v1beta1.KTMachinePhaseProvisioning
+	}
+}
+
+// machineRequeueDuration returns when the server of the machine is checked again: soon while KT Cloud
+// builds it or its node has yet to register, rarely once it settled.
+func machineRequeueDuration(ktMachine *v1beta1.KTMachine) time.Duration {
+	switch {
+	case ktMachine.Status.InstanceState != "ACTIVE" && ktMachine.Status.InstanceState != "ERROR":
+		return waitForBuildingServerDuration
+	case meta.IsStatusConditionFalse(ktMachine.Status.Conditions, v1beta1.BootstrapExecSucceededCondition):
+		return waitForNodeDuration
+	default:
+		return machineResyncDuration
+	}
+}
+
+// updateMachineStatus derives the addresses, ready flag and phase of the machine, writes the status if it
+// changed from original and requeues the machine after requeueAfter.
+func (r *KTMachineReconciler) updateMachineStatus(ctx context.Context, ktMachine *v1beta1.KTMachine, original *v1beta1.KTMachineStatus, requeueAfter time.Duration) (ctrl.Result, error) {
+	status := &ktMachine.Status
+	status.Addresses = machineStatusAddresses(machineAddresses(ktMachine), status.AssignedPublicIps)
+	status.Ready = status.InstanceState == "ACTIVE"
+	status.Phase = machinePhase(ktMachine)
+
+	if equality.Semantic.DeepEqual(original, status) {
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	if err := r.Status().Update(ctx, ktMachine); err != nil {
+		log.FromContext(ctx, "LogFrom", "KTMachine").Error(err, "Failed to update KTMachine status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// updateMachineStatusWithError writes the status like updateMachineStatus and returns err, so the machine is
+// retried with the exponential backoff of the controller.
+func (r *KTMachineReconciler) updateMachineStatusWithError(ctx context.Context, ktMachine *v1beta1.KTMachine, original *v1beta1.KTMachineStatus, err error) (ctrl.Result, error) {
+	if _, statusErr := r.updateMachineStatus(ctx, ktMachine, original, 0); statusErr != nil {
+		return ctrl.Result{}, errors.Join(err, statusErr)
+	}
+	return ctrl.Result{}, err
+}
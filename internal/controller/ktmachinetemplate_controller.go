@@ -21,12 +21,14 @@ import (
 	"time"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
 	infrastructurev1beta1 "dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
@@ -71,25 +73,28 @@ func (r *KTMachineTemplateReconciler) Reconcile(ctx context.Context, req ctrl.Re
 	}
 
 	// check child resources and add owner references
-	foundMachineDeployment := &v1beta1.MachineDeployment{}
-
-	err := r.Get(ctx, types.NamespacedName{Name: ktMachineTemplate.Name, Namespace: ktMachineTemplate.Namespace}, foundMachineDeployment)
-	if err != nil && apierrors.IsNotFound(err) {
-		logger.Info("MachineDeployment not found matching machine template")
-		// Requeue the request to ensure the Cluster is given Owner ref
+	machineDeployments, err := templateMachineDeployments(ctx, r.Client, ktMachineTemplate)
+	if err != nil {
+		logger.Error(err, "Failed to list MachineDeployments of machine template")
 		return ctrl.Result{RequeueAfter: time.Minute}, nil
-	} else if err != nil {
-		logger.Error(err, "Failed to get MachineDeployment, maybe dont have")
-		return ctrl.Result{}, err
+	}
+	if len(machineDeployments) == 0 {
+		logger.Info("No MachineDeployment references the machine template")
+		return ctrl.Result{}, nil
 	}
 
-	// Read through the cluster Object
-	err = r.ktMachineTemplateForMachineDeployment(ktMachineTemplate, foundMachineDeployment, ctx, req)
-	if err != nil {
-		logger.Error(err, "Failed to add owner ref to ", "MachineDeployment.Namespace ", ktMachineTemplate.Namespace, "MachineDeployment.Name", ktMachineTemplate.Name)
-		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	for i := range machineDeployments {
+		foundMachineDeployment := &machineDeployments[i]
+		if metav1.IsControlledBy(foundMachineDeployment, ktMachineTemplate) {
+			continue
+		}
+		err = r.ktMachineTemplateForMachineDeployment(ktMachineTemplate, foundMachineDeployment, ctx, req)
+		if err != nil {
+			logger.Error(err, "Failed to add owner ref to ", "MachineDeployment.Namespace ", foundMachineDeployment.Namespace, "MachineDeployment.Name", foundMachineDeployment.Name)
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+		logger.Info("Added owner ref to ", "MachineDeployment.Namespace ", foundMachineDeployment.Namespace, "MachineDeployment.Name", foundMachineDeployment.Name)
 	}
-	logger.Info("Added owner ref to ", "MachineDeployment.Namespace ", foundMachineDeployment.Namespace, "MachineDeployment.Name", foundMachineDeployment.Name)
 
 	return ctrl.Result{}, nil
 }
@@ -119,6 +124,16 @@ func (r *KTMachineTemplateReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrastructurev1beta1.KTMachineTemplate{}).
 		Owns(&infrastructurev1beta1.MachineDeployment{}).
+		// a deployment referencing the template may be created after it
+		Watches(&infrastructurev1beta1.MachineDeployment{}, handler.EnqueueRequestsFromMapFunc(
+			func(ctx context.Context, obj client.Object) []reconcile.Request {
+				machineDeployment := obj.(*infrastructurev1beta1.MachineDeployment)
+				key, err := machineTemplateKey(machineDeployment)
+				if err != nil {
+					return nil
+				}
+				return []reconcile.Request{{NamespacedName: key}}
+			})).
 		Named("ktmachinetemplate").
 		Complete(r)
 }
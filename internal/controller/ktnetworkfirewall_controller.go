@@ -18,42 +18,225 @@ package controller
 
 import (
 	"context"
+	"time"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
 	infrastructurev1beta1 "dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
+)
+
+const (
+	// ktNetworkFirewallFinalizer keeps a KTNetworkFirewall around until its rule is deleted on KT Cloud
+	ktNetworkFirewallFinalizer = "infrastructure.dcnlab.ssu.ac.kr/ktnetworkfirewall"
+
+	// waitForFirewallRuleDuration is how long a created rule is given to show up in the rules KT Cloud lists
+	waitForFirewallRuleDuration = 10 * time.Second
 )
 
 // KTNetworkFirewallReconciler reconciles a KTNetworkFirewall object
 type KTNetworkFirewallReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// KTCloud creates the clients used to talk to KT Cloud in the zone of the rule's cluster
+	KTCloud ktcloud.Factory
 }
 
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktnetworkfirewalls,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktnetworkfirewalls/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktnetworkfirewalls/finalizers,verbs=update
+// +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktsubjecttokens,verbs=get;list;watch
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the KTNetworkFirewall object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
+// Reconcile creates the firewall rule of the KTNetworkFirewall on KT Cloud with the KTSubjectToken of
+// its cluster and reports the state KT Cloud lists for it. KT Cloud cannot update rules, so a rule is
+// replaced when the spec changes. A rule found with the fields of the spec is adopted instead of
+// created twice, and a listed rule that disappears is created again. Deleted KTNetworkFirewalls
+// delete their rule before the finalizer is removed.
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.19.1/pkg/reconcile
 func (r *KTNetworkFirewallReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
+	logger := log.FromContext(ctx, "LogFrom", "KTNetworkFirewall")
+	logger.V(1).Info("KTNetworkFirewall Reconcile", "KTNetworkFirewall", req)
+
+	firewall := &v1beta1.KTNetworkFirewall{}
+	if err := r.Get(ctx, req.NamespacedName, firewall); err != nil {
+		if apierrors.IsNotFound(err) {
+			logger.Info("KTNetworkFirewall resource not found. Ignoring since it must be deleted")
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get KTNetworkFirewall resource")
+		return ctrl.Result{}, err
+	}
+
+	// the rule is created with the token of the cluster, ktsubjecttoken.name is always the same to cluster.name
+	ktSubjectToken := &v1beta1.KTSubjectToken{}
+	err := r.Get(ctx, types.NamespacedName{Name: firewall.Spec.ClusterName, Namespace: firewall.Namespace}, ktSubjectToken)
+	if apierrors.IsNotFound(err) && !firewall.DeletionTimestamp.IsZero() {
+		// without the cluster there are no credentials left to delete the rule with
+		logger.Info("KTSubjectToken of the cluster is gone, leaving the firewall rule on KT Cloud", "Rule", firewall.Status.ID)
+		return r.removeFinalizer(ctx, firewall)
+	}
+	if err != nil {
+		logger.Error(err, "Failed to find KTSubjectToken of the cluster", "Cluster", firewall.Spec.ClusterName)
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	subjectToken := ktSubjectToken.Status.SubjectToken
+	zone := ktSubjectToken.Status.Zone
+	if subjectToken == "" || zone == "" {
+		logger.Info("We have to reconcile again to check the Subject token")
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	rules := r.KTCloud(zone, subjectToken).Firewall()
+
+	if !firewall.DeletionTimestamp.IsZero() {
+		if firewall.Status.ID != "" {
+			if err := rules.Delete(ctx, firewall.Status.ID); err != nil && !ktcloud.IsNotFound(err) {
+				logger.Error(err, "Failed to delete firewall rule on KT Cloud", "Rule", firewall.Status.ID)
+				return ctrl.Result{RequeueAfter: time.Minute}, nil
+			}
+			logger.Info("Deleted firewall rule on KT Cloud", "Rule", firewall.Status.ID)
+		}
+		return r.removeFinalizer(ctx, firewall)
+	}
+
+	if controllerutil.AddFinalizer(firewall, ktNetworkFirewallFinalizer) {
+		if err := r.Update(ctx, firewall); err != nil {
+			logger.Error(err, "Failed to add finalizer to KTNetworkFirewall")
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+	}
+
+	// KT Cloud cannot update a rule, replace it when the spec changed
+	if firewall.Status.ID != "" && firewall.Status.ObservedGeneration != firewall.Generation {
+		if err := rules.Delete(ctx, firewall.Status.ID); err != nil && !ktcloud.IsNotFound(err) {
+			logger.Error(err, "Failed to delete outdated firewall rule on KT Cloud", "Rule", firewall.Status.ID)
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+		logger.Info("Deleted outdated firewall rule on KT Cloud", "Rule", firewall.Status.ID)
+		firewall.Status.ID = ""
+		firewall.Status.State = ""
+	}
+
+	existing, err := rules.List(ctx)
+	if err != nil {
+		logger.Error(err, "Failed to list firewall rules on KT Cloud")
+		// keep the deletion of an outdated rule recorded
+		if err := r.Status().Update(ctx, firewall); err != nil {
+			logger.Error(err, "Failed to update KTNetworkFirewall status")
+		}
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
 
-	// TODO(user): your logic here
+	if firewall.Status.ID == "" {
+		opts := firewallRuleOpts(firewall)
+		// a rule created before may not have made it into the status, or was only listed late
+		if rule := matchingFirewallRule(existing, opts); rule != nil {
+			logger.Info("Found firewall rule on KT Cloud", "Rule", rule.ID)
+			firewall.Status.ID = rule.ID
+			firewall.Status.State = rule.State
+			firewall.Status.ObservedGeneration = firewall.Generation
+			if err := r.Status().Update(ctx, firewall); err != nil {
+				logger.Error(err, "Failed to update KTNetworkFirewall status")
+				return ctrl.Result{RequeueAfter: time.Minute}, nil
+			}
+			return ctrl.Result{RequeueAfter: time.Hour / 2}, nil
+		}
 
+		id, err := rules.Create(ctx, opts)
+		if err != nil {
+			logger.Error(err, "Failed to create firewall rule on KT Cloud")
+			if statusErr := r.Status().Update(ctx, firewall); statusErr != nil {
+				logger.Error(statusErr, "Failed to update KTNetworkFirewall status")
+			}
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+		logger.Info("Created firewall rule on KT Cloud", "Rule", id)
+		firewall.Status.ID = id
+		firewall.Status.ObservedGeneration = firewall.Generation
+
+		// KT Cloud may list the rule a while after creating it, its state is looked up on the next reconcile
+		if err := r.Status().Update(ctx, firewall); err != nil {
+			logger.Error(err, "Failed to update KTNetworkFirewall status")
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+		return ctrl.Result{RequeueAfter: waitForFirewallRuleDuration}, nil
+	}
+
+	found := false
+	for _, rule := range existing {
+		if rule.ID == firewall.Status.ID {
+			firewall.Status.State = rule.State
+			found = true
+			break
+		}
+	}
+	if !found && firewall.Status.State == "" {
+		// a rule that was never listed is still on its way, creating it again would duplicate it
+		logger.Info("Waiting for the created firewall rule to be listed on KT Cloud", "Rule", firewall.Status.ID)
+		return ctrl.Result{RequeueAfter: waitForFirewallRuleDuration}, nil
+	}
+	if !found {
+		// the rule was deleted outside of the operator, create it again on the next reconcile
+		logger.Info("Firewall rule not found on KT Cloud, recreating it", "Rule", firewall.Status.ID)
+		firewall.Status.ID = ""
+		firewall.Status.State = ""
+	}
+
+	if err := r.Status().Update(ctx, firewall); err != nil {
+		logger.Error(err, "Failed to update KTNetworkFirewall status")
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	if !found {
+		return ctrl.Result{Requeue: true}, nil
+	}
+	return ctrl.Result{RequeueAfter: time.Hour / 2}, nil
+}
+
+// matchingFirewallRule returns the rule that opts would create, or nil if there is none.
+func matchingFirewallRule(rules []ktcloud.FirewallRule, opts ktcloud.CreateFirewallRuleOpts) *ktcloud.FirewallRule {
+	for i, rule := range rules {
+		if rule.StartPort == opts.StartPort && rule.EndPort == opts.EndPort && rule.Protocol == opts.Protocol &&
+			rule.Action == opts.Action && rule.VirtualIPID == opts.VirtualIPID && rule.SrcNetworkID == opts.SrcNetworkID &&
+			rule.DstIP == opts.DstIP && rule.DstNetworkID == opts.DstNetworkID {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+func (r *KTNetworkFirewallReconciler) removeFinalizer(ctx context.Context, firewall *v1beta1.KTNetworkFirewall) (ctrl.Result, error) {
+	if controllerutil.RemoveFinalizer(firewall, ktNetworkFirewallFinalizer) {
+		if err := r.Update(ctx, firewall); err != nil {
+			log.FromContext(ctx, "LogFrom", "KTNetworkFirewall").Error(err, "Failed to remove finalizer from KTNetworkFirewall")
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+	}
 	return ctrl.Result{}, nil
 }
 
+// firewallRuleOpts returns the request creating the rule of the firewall.
+func firewallRuleOpts(firewall *v1beta1.KTNetworkFirewall) ktcloud.CreateFirewallRuleOpts {
+	return ktcloud.CreateFirewallRuleOpts{
+		StartPort:    firewall.Spec.StartPort,
+		EndPort:      firewall.Spec.EndPort,
+		Protocol:     firewall.Spec.Protocol,
+		Action:       firewall.Spec.Action,
+		VirtualIPID:  firewall.Spec.VirtualIPID,
+		SrcNetworkID: firewall.Spec.SrcNetworkID,
+		DstIP:        firewall.Spec.DstIP,
+		DstNetworkID: firewall.Spec.DstNetworkID,
+	}
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *KTNetworkFirewallReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
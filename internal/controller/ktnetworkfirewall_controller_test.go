@@ -28,6 +28,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	infrastructurev1beta1 "dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud/fake"
 )
 
 var _ = Describe("KTNetworkFirewall Controller", func() {
@@ -69,8 +70,9 @@ var _ = Describe("KTNetworkFirewall Controller", func() {
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
 			controllerReconciler := &KTNetworkFirewallReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: fake.New().Factory(),
 			}
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
@@ -81,4 +83,146 @@ var _ = Describe("KTNetworkFirewall Controller", func() {
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
 	})
+
+	Context("When managing a rule on KT Cloud", func() {
+		const resourceName = "test-firewall"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var cloud *fake.Cloud
+
+		BeforeEach(func() {
+			cloud = fake.New()
+
+			ktSubjectToken := &infrastructurev1beta1.KTSubjectToken{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+			}
+			Expect(k8sClient.Create(ctx, ktSubjectToken)).To(Succeed())
+			ktSubjectToken.Status.SubjectToken = "token"
+			ktSubjectToken.Status.Zone = "gd1"
+			Expect(k8sClient.Status().Update(ctx, ktSubjectToken)).To(Succeed())
+
+			Expect(k8sClient.Create(ctx, &infrastructurev1beta1.KTNetworkFirewall{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec: infrastructurev1beta1.KTNetworkFirewallSpec{
+					ClusterName:  resourceName,
+					StartPort:    "6443",
+					EndPort:      "6443",
+					Protocol:     6,
+					Action:       1,
+					VirtualIPID:  "vip-1",
+					SrcNetworkID: "external",
+					DstIP:        "172.25.0.10",
+					DstNetworkID: "tier",
+				},
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			ktSubjectToken := &infrastructurev1beta1.KTSubjectToken{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktSubjectToken)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, ktSubjectToken)).To(Succeed())
+		})
+
+		It("should create, replace and delete the rule", func() {
+			controllerReconciler := &KTNetworkFirewallReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+			firewall := &infrastructurev1beta1.KTNetworkFirewall{}
+
+			By("creating the rule")
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(waitForFirewallRuleDuration))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, firewall)).To(Succeed())
+			Expect(firewall.Finalizers).To(ContainElement(ktNetworkFirewallFinalizer))
+			Expect(firewall.Status.ID).NotTo(BeEmpty())
+			Expect(firewall.Status.ObservedGeneration).To(Equal(firewall.Generation))
+			Expect(cloud.FirewallRules).To(HaveKey(firewall.Status.ID))
+			Expect(cloud.FirewallRules[firewall.Status.ID].DstIP).To(Equal("172.25.0.10"))
+
+			By("reporting the state of the rule once KT Cloud lists it")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, firewall)).To(Succeed())
+			Expect(firewall.Status.State).To(Equal("Active"))
+
+			By("finding the rule again when its ID was not recorded")
+			ruleID := firewall.Status.ID
+			firewall.Status.ID = ""
+			Expect(k8sClient.Status().Update(ctx, firewall)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, firewall)).To(Succeed())
+			Expect(firewall.Status.ID).To(Equal(ruleID))
+			Expect(cloud.FirewallRules).To(HaveLen(1))
+
+			By("replacing the rule when the spec changes")
+			oldID := firewall.Status.ID
+			firewall.Spec.EndPort = "6444"
+			Expect(k8sClient.Update(ctx, firewall)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, firewall)).To(Succeed())
+			Expect(firewall.Status.ID).NotTo(Equal(oldID))
+			Expect(cloud.FirewallRules).NotTo(HaveKey(oldID))
+			Expect(cloud.FirewallRules[firewall.Status.ID].EndPort).To(Equal("6444"))
+
+			By("deleting the rule with the resource")
+			Expect(k8sClient.Delete(ctx, firewall)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cloud.FirewallRules).To(BeEmpty())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, firewall))).To(BeTrue())
+		})
+
+		It("should wait for KT Cloud to list a created rule instead of creating it again", func() {
+			controllerReconciler := &KTNetworkFirewallReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+			firewall := &infrastructurev1beta1.KTNetworkFirewall{}
+			cloud.FirewallRuleListDelay = 2
+
+			By("creating the rule")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, firewall)).To(Succeed())
+			ruleID := firewall.Status.ID
+			Expect(ruleID).NotTo(BeEmpty())
+
+			By("keeping the rule while KT Cloud does not list it")
+			for i := 0; i < 2; i++ {
+				result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.RequeueAfter).To(Equal(waitForFirewallRuleDuration))
+				Expect(k8sClient.Get(ctx, typeNamespacedName, firewall)).To(Succeed())
+				Expect(firewall.Status.ID).To(Equal(ruleID))
+				Expect(firewall.Status.State).To(BeEmpty())
+			}
+
+			By("reporting the state of the rule once KT Cloud lists it")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, firewall)).To(Succeed())
+			Expect(firewall.Status.ID).To(Equal(ruleID))
+			Expect(firewall.Status.State).To(Equal("Active"))
+			Expect(cloud.FirewallRuleCreates).To(Equal(1))
+			Expect(cloud.FirewallRules).To(HaveLen(1))
+
+			By("deleting the rule with the resource")
+			Expect(k8sClient.Delete(ctx, firewall)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, firewall))).To(BeTrue())
+		})
+	})
 })
@@ -18,42 +18,657 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
 	infrastructurev1beta1 "dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
+)
+
+const (
+	// ktPublicNetworkFinalizer keeps a KTPublicNetwork around until its public IP is unbound and reclaimed
+	ktPublicNetworkFinalizer = "infrastructure.dcnlab.ssu.ac.kr/ktpublicnetwork"
+
+	// waitForMachineAddressDuration is how often a claim checks whether its machine has an address to bind to
+	waitForMachineAddressDuration = 15 * time.Second
+)
+
+var (
+	// errPublicIPClaimFailed is returned when a claim cannot be fulfilled without a change to its spec
+	errPublicIPClaimFailed = errors.New("public IP claim failed")
+
+	// errPublicIPPoolExhausted is returned while every public IP in the pool of the cluster is in use
+	errPublicIPPoolExhausted = errors.New("no free public IP in the pool of the cluster")
 )
 
 // KTPublicNetworkReconciler reconciles a KTPublicNetwork object
 type KTPublicNetworkReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// KTCloud creates the clients used to talk to KT Cloud in the zone of the claim's cluster
+	KTCloud ktcloud.Factory
+	// APIReader reads the claims of other KTPublicNetworks past the cache, a claim that was just
+	// fulfilled must not hand its public IP to a second claim. Client is used when unset.
+	APIReader client.Reader
 }
 
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktpublicnetworks,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktpublicnetworks/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktpublicnetworks/finalizers,verbs=update
+// +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktmachines,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktmachines/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktsubjecttokens,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktclusters,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktclusters/status,verbs=get;update;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the KTPublicNetwork object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
+// A KTPublicNetwork claims a public IP, either a newly allocated or an adopted one, and binds
+// it to its machine with static NAT or shares it between machines with port forwarding. Only one
+// claim can hold a public IP.
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.19.1/pkg/reconcile
 func (r *KTPublicNetworkReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
+	logger := log.FromContext(ctx, "LogFrom", "KTPublicNetwork")
+	logger.V(1).Info("KTPublicNetwork Reconcile", "KTPublicNetwork", req)
+
+	claim := &v1beta1.KTPublicNetwork{}
+	if err := r.Get(ctx, req.NamespacedName, claim); err != nil {
+		if apierrors.IsNotFound(err) {
+			logger.Info("KTPublicNetwork resource not found. Ignoring since it must be deleted")
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get KTPublicNetwork resource")
+		return ctrl.Result{}, err
+	}
+
+	// the IP is claimed with the token of the cluster, ktsubjecttoken.name is always the same to cluster.name
+	ktSubjectToken := &v1beta1.KTSubjectToken{}
+	err := r.Get(ctx, types.NamespacedName{Name: claim.Spec.ClusterName, Namespace: claim.Namespace}, ktSubjectToken)
+	if apierrors.IsNotFound(err) && !claim.DeletionTimestamp.IsZero() {
+		// without the cluster there are no credentials left to reclaim the IP with
+		logger.Info("KTSubjectToken of the cluster is gone, leaving the public IP on KT Cloud", "IP", claim.Status.IP)
+		return r.removeFinalizer(ctx, claim)
+	}
+	if err != nil {
+		logger.Error(err, "Failed to find KTSubjectToken of the cluster", "Cluster", claim.Spec.ClusterName)
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	subjectToken := ktSubjectToken.Status.SubjectToken
+	zone := ktSubjectToken.Status.Zone
+	if subjectToken == "" || zone == "" {
+		logger.Info("We have to reconcile again to check the Subject token")
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	cloud := r.KTCloud(zone, subjectToken)
+
+	if !claim.DeletionTimestamp.IsZero() {
+		if err := r.reclaimPublicIP(ctx, cloud, claim); err != nil {
+			logger.Error(err, "Failed to reclaim public IP", "IP", claim.Status.IP)
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+		return r.removeFinalizer(ctx, claim)
+	}
+
+	if controllerutil.AddFinalizer(claim, ktPublicNetworkFinalizer) {
+		if err := r.Update(ctx, claim); err != nil {
+			logger.Error(err, "Failed to add finalizer to KTPublicNetwork")
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+	}
+
+	result, err := r.reconcileClaim(ctx, cloud, claim)
+	if errors.Is(err, errPublicIPClaimFailed) {
+		claim.Status.Phase = v1beta1.KTPublicNetworkPhaseFailed
+		claim.Status.Message = err.Error()
+		result, err = ctrl.Result{RequeueAfter: time.Hour / 2}, nil
+	}
+	if errors.Is(err, errPublicIPPoolExhausted) {
+		logger.Info("Waiting for a public IP in the pool of the cluster to be free")
+		claim.Status.Message = err.Error()
+		result, err = ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	if err != nil {
+		logger.Error(err, "Failed to claim public IP")
+		result = ctrl.Result{RequeueAfter: time.Minute}
+	}
+
+	// the status is written in any case so an allocated IP is never forgotten
+	if err := r.Status().Update(ctx, claim); err != nil {
+		logger.Error(err, "Failed to update KTPublicNetwork status")
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	return result, nil
+}
+
+// reconcileClaim claims the public IP and binds it to the machine of the claim. It only changes the
+// status of the claim, the caller writes it.
+func (r *KTPublicNetworkReconciler) reconcileClaim(ctx context.Context, cloud ktcloud.Client, claim *v1beta1.KTPublicNetwork) (ctrl.Result, error) {
+	logger := log.FromContext(ctx, "LogFrom", "KTPublicNetwork")
+
+	publicIPs, err := cloud.IPAddresses().List(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if claim.Status.ID == "" {
+		claim.Status.Phase = v1beta1.KTPublicNetworkPhasePending
+		cluster := &v1beta1.KTCluster{}
+		err := r.Get(ctx, types.NamespacedName{Name: claim.Spec.ClusterName, Namespace: claim.Namespace}, cluster)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		pool := cluster.Spec.PublicIPPool
+
+		switch {
+		case claim.Spec.PublicIPID != "" || claim.Spec.IP != "":
+			if err := r.adoptPublicIP(ctx, claim, pool, publicIPs); err != nil {
+				return ctrl.Result{}, err
+			}
+			logger.Info("Adopted public IP", "IP", claim.Status.IP)
+		case !pool.IsZero():
+			if err := r.adoptPoolPublicIP(ctx, claim, cluster, publicIPs); err != nil {
+				return ctrl.Result{}, err
+			}
+			logger.Info("Adopted public IP from the pool of the cluster", "IP", claim.Status.IP)
+		default:
+			id, err := cloud.IPAddresses().Allocate(ctx)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			claim.Status.ID = id
+			claim.Status.Allocated = true
+			logger.Info("Allocated public IP", "ID", id)
+			if publicIPs, err = cloud.IPAddresses().List(ctx); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	publicIP := findPublicIP(publicIPs, claim.Status.ID)
+	if publicIP == nil {
+		return ctrl.Result{}, fmt.Errorf("%w: public IP %s no longer exists on KT Cloud", errPublicIPClaimFailed, claim.Status.ID)
+	}
+	claim.Status.IP = publicIP.IP
+	claim.Status.Phase = v1beta1.KTPublicNetworkPhaseClaimed
+	claim.Status.Message = ""
+
+	if len(claim.Spec.PortForwards) > 0 {
+		if claim.Spec.MachineRef != nil {
+			return ctrl.Result{}, fmt.Errorf("%w: machineRef and portForwards cannot be combined", errPublicIPClaimFailed)
+		}
+		return r.reconcilePortForwards(ctx, cloud, claim, publicIP)
+	}
+	if len(claim.Status.PortForwards) > 0 {
+		// the claim switched back to static NAT, the port forwards have to go first
+		if err := r.deletePortForwards(ctx, cloud, claim, nil); err != nil {
+			return ctrl.Result{}, err
+		}
+		if publicIPs, err = cloud.IPAddresses().List(ctx); err != nil {
+			return ctrl.Result{}, err
+		}
+		if publicIP = findPublicIP(publicIPs, claim.Status.ID); publicIP == nil {
+			return ctrl.Result{}, fmt.Errorf("%w: public IP %s no longer exists on KT Cloud", errPublicIPClaimFailed, claim.Status.ID)
+		}
+	}
+
+	var ktMachine *v1beta1.KTMachine
+	if claim.Spec.MachineRef != nil {
+		ktMachine = &v1beta1.KTMachine{}
+		err := r.Get(ctx, types.NamespacedName{Name: claim.Spec.MachineRef.Name, Namespace: claim.Namespace}, ktMachine)
+		if apierrors.IsNotFound(err) {
+			ktMachine = nil
+		} else if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if ktMachine != nil && !ktMachine.DeletionTimestamp.IsZero() {
+		// the machine disables the static NAT itself before its server is deleted
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+
+	guestIPs := []string{}
+	if ktMachine != nil {
+		guestIPs = machineAddresses(ktMachine)
+	}
+	if !slices.ContainsFunc(publicIP.VirtualIps, func(virtualIP ktcloud.VirtualIP) bool { return virtualIP.Id == claim.Status.StaticNATID }) {
+		// the static NAT went away with the server it pointed to, the machine got a new one
+		claim.Status.StaticNATID = ""
+	}
+	for _, virtualIP := range publicIP.VirtualIps {
+		switch {
+		case slices.Contains(guestIPs, virtualIP.VMGuestIP):
+			claim.Status.StaticNATID = virtualIP.Id
+		case virtualIP.Id == claim.Status.StaticNATID:
+			// the claim was bound to another machine before
+			if err := cloud.StaticNAT().Disable(ctx, virtualIP.Id); err != nil {
+				return ctrl.Result{}, err
+			}
+			logger.Info("Disabled static NAT of public IP to previous machine", "IP", publicIP.IP, "VMGuestIP", virtualIP.VMGuestIP)
+			claim.Status.StaticNATID = ""
+			claim.Status.Machine = ""
+		default:
+			return ctrl.Result{}, fmt.Errorf("%w: public IP %s is statically NATed to %s outside of the claim", errPublicIPClaimFailed, publicIP.IP, virtualIP.VMGuestIP)
+		}
+	}
+
+	if ktMachine == nil {
+		if claim.Spec.MachineRef != nil {
+			claim.Status.Message = "Waiting for KTMachine " + claim.Spec.MachineRef.Name
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+		return ctrl.Result{RequeueAfter: time.Hour / 2}, nil
+	}
+	if len(guestIPs) == 0 || len(ktMachine.Spec.NetworkTier) == 0 {
+		claim.Status.Message = "Waiting for the private address of KTMachine " + ktMachine.Name
+		return ctrl.Result{RequeueAfter: waitForMachineAddressDuration}, nil
+	}
+
+	if claim.Status.Machine != ktMachine.Name || claim.Status.StaticNATID == "" {
+		if claim.Status.StaticNATID == "" {
+			err := cloud.StaticNAT().Enable(ctx, ktcloud.EnableStaticNATOpts{
+				VMGuestIP:     guestIPs[0],                      //just get the first IP address
+				VMNetworkId:   ktMachine.Spec.NetworkTier[0].ID, //just get the first tier
+				EntPublicIPId: publicIP.Id,
+			})
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if publicIPs, err = cloud.IPAddresses().List(ctx); err != nil {
+				return ctrl.Result{}, err
+			}
+			virtualIP := findVirtualIP(publicIPs, publicIP.Id, map[string]bool{guestIPs[0]: true})
+			if virtualIP == nil {
+				return ctrl.Result{}, fmt.Errorf("static NAT of public IP %s to %s not found after enabling it", publicIP.IP, guestIPs[0])
+			}
+			claim.Status.StaticNATID = virtualIP.Id
+			logger.Info("Bound public IP to machine", "IP", publicIP.IP, "KTMachine", ktMachine.Name)
+		}
+		claim.Status.Machine = ktMachine.Name
+	}
+
+	// the machine reports its public IPs, its firewall rules are opened for them
+	assigned := v1beta1.AssignedPublicIps{Id: publicIP.Id, IP: publicIP.IP}
+	if err := r.recordPublicIP(ctx, claim.Namespace, ktMachine.Name, assigned, true); err != nil {
+		return ctrl.Result{}, err
+	}
+	claim.Status.Phase = v1beta1.KTPublicNetworkPhaseBound
+	return ctrl.Result{RequeueAfter: time.Hour / 2}, nil
+}
+
+// adoptPublicIP claims the existing public IP the spec points to, unless another claim holds it or
+// it is outside of the public IP pool of the cluster.
+func (r *KTPublicNetworkReconciler) adoptPublicIP(ctx context.Context, claim *v1beta1.KTPublicNetwork, pool v1beta1.PublicIPPool, publicIPs []ktcloud.PublicIP) error {
+	var publicIP *ktcloud.PublicIP
+	for i := range publicIPs {
+		if (claim.Spec.PublicIPID == "" || publicIPs[i].Id == claim.Spec.PublicIPID) &&
+			(claim.Spec.IP == "" || publicIPs[i].IP == claim.Spec.IP) {
+			publicIP = &publicIPs[i]
+			break
+		}
+	}
+	if publicIP == nil {
+		return fmt.Errorf("%w: public IP %s%s not found on KT Cloud", errPublicIPClaimFailed, claim.Spec.PublicIPID, claim.Spec.IP)
+	}
+	if !pool.IsZero() && !pool.Contains(publicIP.Id, publicIP.IP) && publicIP.IP != pool.ControlPlaneEndpointIP {
+		return fmt.Errorf("%w: public IP %s is not in the public IP pool of cluster %s", errPublicIPClaimFailed, publicIP.IP, claim.Spec.ClusterName)
+	}
+
+	claimed, err := r.claimedPublicIPs(ctx, claim)
+	if err != nil {
+		return err
+	}
+	if other, ok := claimed[publicIP.Id]; ok {
+		return fmt.Errorf("%w: public IP %s is already claimed by %s", errPublicIPClaimFailed, publicIP.IP, other)
+	}
+
+	claim.Status.ID = publicIP.Id
+	claim.Status.IP = publicIP.IP
+	return nil
+}
+
+// adoptPoolPublicIP claims a free public IP from the pool of the cluster. The control plane endpoint IP
+// of the pool is left for the first control plane. It reports on the cluster whether the pool is exhausted.
+func (r *KTPublicNetworkReconciler) adoptPoolPublicIP(ctx context.Context, claim *v1beta1.KTPublicNetwork, cluster *v1beta1.KTCluster, publicIPs []ktcloud.PublicIP) error {
+	pool := cluster.Spec.PublicIPPool
+
+	claimed, err := r.claimedPublicIPs(ctx, claim)
+	if err != nil {
+		return err
+	}
+
+	var publicIP *ktcloud.PublicIP
+	for i := range publicIPs {
+		candidate := &publicIPs[i]
+		if _, ok := claimed[candidate.Id]; ok || !candidate.IsAvailable() || candidate.IP == pool.ControlPlaneEndpointIP {
+			continue
+		}
+		if pool.Contains(candidate.Id, candidate.IP) {
+			publicIP = candidate
+			break
+		}
+	}
 
-	// TODO(user): your logic here
+	if publicIP == nil {
+		if err := r.setPublicIPPoolCondition(ctx, cluster, metav1.ConditionFalse, v1beta1.PublicIPPoolExhaustedReason,
+			fmt.Sprintf("No free public IP in the pool for KTPublicNetwork %s", claim.Name)); err != nil {
+			return err
+		}
+		return errPublicIPPoolExhausted
+	}
+	if err := r.setPublicIPPoolCondition(ctx, cluster, metav1.ConditionTrue, v1beta1.PublicIPPoolAvailableReason, ""); err != nil {
+		return err
+	}
 
+	claim.Status.ID = publicIP.Id
+	claim.Status.IP = publicIP.IP
+	return nil
+}
+
+// claimedPublicIPs returns the IDs of the public IPs held by claims other than claim, mapped to the claim names.
+// The claims are read with the APIReader as the cache may not have seen a claim fulfilled moments ago.
+func (r *KTPublicNetworkReconciler) claimedPublicIPs(ctx context.Context, claim *v1beta1.KTPublicNetwork) (map[string]string, error) {
+	var reader client.Reader = r.Client
+	if r.APIReader != nil {
+		reader = r.APIReader
+	}
+	claims := &v1beta1.KTPublicNetworkList{}
+	if err := reader.List(ctx, claims, client.InNamespace(claim.Namespace)); err != nil {
+		return nil, err
+	}
+	claimed := map[string]string{}
+	for _, other := range claims.Items {
+		if other.Name != claim.Name && other.Status.ID != "" {
+			claimed[other.Status.ID] = other.Name
+		}
+	}
+	return claimed, nil
+}
+
+// setPublicIPPoolCondition sets the PublicIPPoolAvailable condition of the cluster. Claims without a
+// KTCluster have no pool to report on.
+func (r *KTPublicNetworkReconciler) setPublicIPPoolCondition(ctx context.Context, cluster *v1beta1.KTCluster, status metav1.ConditionStatus, reason, message string) error {
+	if cluster.Name == "" {
+		return nil
+	}
+	if !meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+		Type:               v1beta1.PublicIPPoolAvailableCondition,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: cluster.Generation,
+	}) {
+		return nil
+	}
+	return r.Status().Update(ctx, cluster)
+}
+
+// reclaimPublicIP disables the static NAT of the claim and releases the public IP when its reclaim policy says so.
+func (r *KTPublicNetworkReconciler) reclaimPublicIP(ctx context.Context, cloud ktcloud.Client, claim *v1beta1.KTPublicNetwork) error {
+	logger := log.FromContext(ctx, "LogFrom", "KTPublicNetwork")
+
+	if claim.Status.ID == "" {
+		return nil
+	}
+	publicIPs, err := cloud.IPAddresses().List(ctx)
+	if err != nil {
+		return err
+	}
+	publicIP := findPublicIP(publicIPs, claim.Status.ID)
+	if publicIP == nil {
+		return nil
+	}
+
+	if err := r.deletePortForwards(ctx, cloud, claim, nil); err != nil {
+		return err
+	}
+
+	for _, virtualIP := range publicIP.VirtualIps {
+		if virtualIP.Id != claim.Status.StaticNATID {
+			continue
+		}
+		if err := cloud.StaticNAT().Disable(ctx, virtualIP.Id); err != nil {
+			return err
+		}
+		logger.Info("Disabled static NAT of public IP", "IP", publicIP.IP, "VMGuestIP", virtualIP.VMGuestIP)
+	}
+
+	if claim.ReclaimPolicy() != v1beta1.PublicIPReclaimDelete {
+		logger.Info("Retaining public IP", "IP", publicIP.IP)
+		return nil
+	}
+	if err := cloud.IPAddresses().Release(ctx, publicIP.Id); err != nil && !ktcloud.IsNotFound(err) {
+		return err
+	}
+	logger.Info("Released public IP", "IP", publicIP.IP)
+	return nil
+}
+
+func (r *KTPublicNetworkReconciler) removeFinalizer(ctx context.Context, claim *v1beta1.KTPublicNetwork) (ctrl.Result, error) {
+	if controllerutil.RemoveFinalizer(claim, ktPublicNetworkFinalizer) {
+		if err := r.Update(ctx, claim); err != nil {
+			log.FromContext(ctx, "LogFrom", "KTPublicNetwork").Error(err, "Failed to remove finalizer from KTPublicNetwork")
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+	}
 	return ctrl.Result{}, nil
 }
 
+// reconcilePortForwards forwards the ports of the spec to their machines and deletes the rules of port
+// forwards that were removed or changed. The static NAT of the claim is disabled first.
+func (r *KTPublicNetworkReconciler) reconcilePortForwards(ctx context.Context, cloud ktcloud.Client, claim *v1beta1.KTPublicNetwork, publicIP *ktcloud.PublicIP) (ctrl.Result, error) {
+	logger := log.FromContext(ctx, "LogFrom", "KTPublicNetwork")
+
+	disabledStaticNATID := claim.Status.StaticNATID
+	if claim.Status.StaticNATID != "" {
+		for _, virtualIP := range publicIP.VirtualIps {
+			if virtualIP.Id == claim.Status.StaticNATID {
+				if err := cloud.StaticNAT().Disable(ctx, virtualIP.Id); err != nil {
+					return ctrl.Result{}, err
+				}
+				logger.Info("Disabled static NAT of public IP to share it with port forwarding", "IP", publicIP.IP)
+			}
+		}
+		if claim.Status.Machine != "" {
+			assigned := v1beta1.AssignedPublicIps{Id: publicIP.Id, IP: publicIP.IP}
+			if err := r.recordPublicIP(ctx, claim.Namespace, claim.Status.Machine, assigned, false); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		claim.Status.StaticNATID = ""
+		claim.Status.Machine = ""
+	}
+
+	rules, err := cloud.PortForwarding().List(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	ruleIDs := map[string]bool{}
+	ownVirtualIPs := map[string]bool{}
+	for _, rule := range rules {
+		ruleIDs[rule.ID] = true
+		for _, status := range claim.Status.PortForwards {
+			if status.ID == rule.ID {
+				ownVirtualIPs[rule.VirtualIPId] = true
+			}
+		}
+	}
+	for _, virtualIP := range publicIP.VirtualIps {
+		if virtualIP.Id != disabledStaticNATID && !ownVirtualIPs[virtualIP.Id] {
+			return ctrl.Result{}, fmt.Errorf("%w: public IP %s is used by %s outside of the claim", errPublicIPClaimFailed, publicIP.IP, virtualIP.VMGuestIP)
+		}
+	}
+
+	// rules of port forwards that are gone from the spec, changed or deleted on KT Cloud are recreated
+	wanted := map[string]v1beta1.PortForward{}
+	for _, portForward := range claim.Spec.PortForwards {
+		wanted[portForward.Name] = withPortForwardDefaults(portForward)
+	}
+	if err := r.deletePortForwards(ctx, cloud, claim, func(status v1beta1.PortForwardStatus) bool {
+		portForward, ok := wanted[status.Name]
+		return ok && ruleIDs[status.ID] &&
+			portForward.MachineRef.Name == status.Machine &&
+			portForward.PublicPort == status.PublicPort &&
+			portForward.PrivatePort == status.PrivatePort &&
+			portForward.Protocol == status.Protocol
+	}); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var waiting []string
+	for _, portForward := range claim.Spec.PortForwards {
+		portForward = withPortForwardDefaults(portForward)
+		if slices.ContainsFunc(claim.Status.PortForwards, func(status v1beta1.PortForwardStatus) bool {
+			return status.Name == portForward.Name
+		}) {
+			continue
+		}
+
+		ktMachine := &v1beta1.KTMachine{}
+		err := r.Get(ctx, types.NamespacedName{Name: portForward.MachineRef.Name, Namespace: claim.Namespace}, ktMachine)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		guestIPs := machineAddresses(ktMachine)
+		if err != nil || !ktMachine.DeletionTimestamp.IsZero() || len(guestIPs) == 0 || len(ktMachine.Spec.NetworkTier) == 0 {
+			waiting = append(waiting, portForward.MachineRef.Name)
+			continue
+		}
+
+		id, err := cloud.PortForwarding().Create(ctx, ktcloud.CreatePortForwardingRuleOpts{
+			VMGuestIP:     guestIPs[0],                      //just get the first IP address
+			VMNetworkId:   ktMachine.Spec.NetworkTier[0].ID, //just get the first tier
+			EntPublicIPId: publicIP.Id,
+			PublicPort:    strconv.Itoa(int(portForward.PublicPort)),
+			PrivatePort:   strconv.Itoa(int(portForward.PrivatePort)),
+			Protocol:      portForward.Protocol,
+		})
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to forward port %d of public IP %s: %w", portForward.PublicPort, publicIP.IP, err)
+		}
+		claim.Status.PortForwards = append(claim.Status.PortForwards, v1beta1.PortForwardStatus{
+			Name:        portForward.Name,
+			ID:          id,
+			Machine:     ktMachine.Name,
+			VMGuestIP:   guestIPs[0],
+			PublicPort:  portForward.PublicPort,
+			PrivatePort: portForward.PrivatePort,
+			Protocol:    portForward.Protocol,
+		})
+		logger.Info("Forwarded port of public IP to machine", "IP", publicIP.IP, "Port", portForward.PublicPort, "KTMachine", ktMachine.Name)
+	}
+
+	for _, status := range claim.Status.PortForwards {
+		if err := r.recordPublicIP(ctx, claim.Namespace, status.Machine, portForwardAssignment(claim, status), true); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if len(waiting) > 0 {
+		claim.Status.Message = "Waiting for the private address of KTMachines " + strings.Join(waiting, ", ")
+		return ctrl.Result{RequeueAfter: waitForMachineAddressDuration}, nil
+	}
+	claim.Status.Phase = v1beta1.KTPublicNetworkPhaseBound
+	return ctrl.Result{RequeueAfter: time.Hour / 2}, nil
+}
+
+// deletePortForwards deletes the port forwarding rules in the status of the claim, except the ones keep
+// returns true for, and removes them from the machines they forwarded to. A nil keep deletes all of them.
+func (r *KTPublicNetworkReconciler) deletePortForwards(ctx context.Context, cloud ktcloud.Client, claim *v1beta1.KTPublicNetwork, keep func(v1beta1.PortForwardStatus) bool) error {
+	logger := log.FromContext(ctx, "LogFrom", "KTPublicNetwork")
+
+	var kept []v1beta1.PortForwardStatus
+	for i, status := range claim.Status.PortForwards {
+		if keep != nil && keep(status) {
+			kept = append(kept, status)
+			continue
+		}
+		if err := cloud.PortForwarding().Delete(ctx, status.ID); err != nil && !ktcloud.IsNotFound(err) {
+			claim.Status.PortForwards = append(kept, claim.Status.PortForwards[i:]...)
+			return err
+		}
+		logger.Info("Deleted port forward of public IP", "IP", claim.Status.IP, "Port", status.PublicPort, "KTMachine", status.Machine)
+		if err := r.recordPublicIP(ctx, claim.Namespace, status.Machine, portForwardAssignment(claim, status), false); err != nil {
+			claim.Status.PortForwards = append(kept, claim.Status.PortForwards[i+1:]...)
+			return err
+		}
+	}
+	claim.Status.PortForwards = kept
+	return nil
+}
+
+// withPortForwardDefaults returns the port forward with its private port and protocol defaulted.
+func withPortForwardDefaults(portForward v1beta1.PortForward) v1beta1.PortForward {
+	if portForward.PrivatePort == 0 {
+		portForward.PrivatePort = portForward.PublicPort
+	}
+	if portForward.Protocol == "" {
+		portForward.Protocol = "TCP"
+	}
+	return portForward
+}
+
+// portForwardAssignment returns how the port forward is recorded on the status of its machine.
+func portForwardAssignment(claim *v1beta1.KTPublicNetwork, status v1beta1.PortForwardStatus) v1beta1.AssignedPublicIps {
+	return v1beta1.AssignedPublicIps{
+		Id:          claim.Status.ID,
+		IP:          claim.Status.IP,
+		Port:        status.PublicPort,
+		PrivatePort: status.PrivatePort,
+	}
+}
+
+// recordPublicIP adds or removes the public IP on the status of the machine, along with its ExternalIP
+// address. Machines that are gone or being deleted are skipped, they release their public IPs themselves.
+func (r *KTPublicNetworkReconciler) recordPublicIP(ctx context.Context, namespace, machineName string, assigned v1beta1.AssignedPublicIps, add bool) error {
+	ktMachine := &v1beta1.KTMachine{}
+	if err := r.Get(ctx, types.NamespacedName{Name: machineName, Namespace: namespace}, ktMachine); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !ktMachine.DeletionTimestamp.IsZero() || slices.Contains(ktMachine.Status.AssignedPublicIps, assigned) == add {
+		return nil
+	}
+	if add {
+		ktMachine.Status.AssignedPublicIps = append(ktMachine.Status.AssignedPublicIps, assigned)
+	} else {
+		ktMachine.Status.AssignedPublicIps = slices.DeleteFunc(ktMachine.Status.AssignedPublicIps, func(other v1beta1.AssignedPublicIps) bool {
+			return other == assigned
+		})
+	}
+	ktMachine.Status.Addresses = machineStatusAddresses(machineAddresses(ktMachine), ktMachine.Status.AssignedPublicIps)
+	if err := r.Status().Update(ctx, ktMachine); err != nil {
+		return fmt.Errorf("failed to record public IP on KTMachine %s: %w", machineName, err)
+	}
+	return nil
+}
+
+// findPublicIP returns the public IP with the given ID.
+func findPublicIP(publicIPs []ktcloud.PublicIP, id string) *ktcloud.PublicIP {
+	for i := range publicIPs {
+		if publicIPs[i].Id == id {
+			return &publicIPs[i]
+		}
+	}
+	return nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *KTPublicNetworkReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
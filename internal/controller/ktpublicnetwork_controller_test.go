@@ -21,13 +21,18 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	infrastructurev1beta1 "dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud/fake"
 )
 
 var _ = Describe("KTPublicNetwork Controller", func() {
@@ -69,8 +74,9 @@ var _ = Describe("KTPublicNetwork Controller", func() {
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
 			controllerReconciler := &KTPublicNetworkReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: fake.New().Factory(),
 			}
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
@@ -81,4 +87,342 @@ var _ = Describe("KTPublicNetwork Controller", func() {
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
 	})
+	Context("When claiming a public IP on KT Cloud", func() {
+		const resourceName = "test-claim"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var cloud *fake.Cloud
+
+		BeforeEach(func() {
+			cloud = fake.New()
+
+			ktSubjectToken := &infrastructurev1beta1.KTSubjectToken{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+			}
+			Expect(k8sClient.Create(ctx, ktSubjectToken)).To(Succeed())
+			ktSubjectToken.Status.SubjectToken = "token"
+			ktSubjectToken.Status.Zone = "gd1"
+			Expect(k8sClient.Status().Update(ctx, ktSubjectToken)).To(Succeed())
+
+			ktMachine := &infrastructurev1beta1.KTMachine{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec: infrastructurev1beta1.KTMachineSpec{
+					NetworkTier: []infrastructurev1beta1.NetworkTier{{ID: "tier"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, ktMachine)).To(Succeed())
+			ktMachine.Status.Addresses = []infrastructurev1beta1.MachineAddress{{Type: infrastructurev1beta1.MachineInternalIP, Address: "172.25.0.10"}}
+			Expect(k8sClient.Status().Update(ctx, ktMachine)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			ktSubjectToken := &infrastructurev1beta1.KTSubjectToken{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktSubjectToken)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, ktSubjectToken)).To(Succeed())
+			ktMachine := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktMachine)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, ktMachine)).To(Succeed())
+		})
+
+		It("should allocate, bind and release a public IP", func() {
+			controllerReconciler := &KTPublicNetworkReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+			Expect(k8sClient.Create(ctx, &infrastructurev1beta1.KTPublicNetwork{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec: infrastructurev1beta1.KTPublicNetworkSpec{
+					ClusterName: resourceName,
+					MachineRef:  &corev1.LocalObjectReference{Name: resourceName},
+				},
+			})).To(Succeed())
+
+			By("allocating the public IP and binding it to the machine")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			claim := &infrastructurev1beta1.KTPublicNetwork{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, claim)).To(Succeed())
+			Expect(claim.Finalizers).To(ContainElement(ktPublicNetworkFinalizer))
+			Expect(claim.Status.Allocated).To(BeTrue())
+			Expect(claim.Status.Phase).To(Equal(infrastructurev1beta1.KTPublicNetworkPhaseBound))
+			Expect(claim.Status.Machine).To(Equal(resourceName))
+			Expect(cloud.PublicIPs).To(HaveLen(1))
+			Expect(cloud.PublicIPs[0].Id).To(Equal(claim.Status.ID))
+			Expect(cloud.PublicIPs[0].VirtualIps).To(ConsistOf(HaveField("VMGuestIP", "172.25.0.10")))
+			Expect(claim.Status.StaticNATID).To(Equal(cloud.PublicIPs[0].VirtualIps[0].Id))
+
+			ktMachine := &infrastructurev1beta1.KTMachine{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktMachine)).To(Succeed())
+			Expect(ktMachine.Status.AssignedPublicIps).To(ConsistOf(infrastructurev1beta1.AssignedPublicIps{
+				Id: claim.Status.ID,
+				IP: claim.Status.IP,
+			}))
+
+			By("releasing the public IP with the claim")
+			Expect(k8sClient.Delete(ctx, claim)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cloud.PublicIPs).To(BeEmpty())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, claim))).To(BeTrue())
+		})
+
+		It("should adopt a public IP once and retain it", func() {
+			controllerReconciler := &KTPublicNetworkReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+			cloud.PublicIPs = []ktcloud.PublicIP{{Id: "ip-1", IP: "211.0.0.10", Type: "ASSOCIATE"}}
+			Expect(k8sClient.Create(ctx, &infrastructurev1beta1.KTPublicNetwork{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec: infrastructurev1beta1.KTPublicNetworkSpec{
+					ClusterName: resourceName,
+					IP:          "211.0.0.10",
+				},
+			})).To(Succeed())
+			secondName := types.NamespacedName{Name: resourceName + "-second", Namespace: "default"}
+			Expect(k8sClient.Create(ctx, &infrastructurev1beta1.KTPublicNetwork{
+				ObjectMeta: metav1.ObjectMeta{Name: secondName.Name, Namespace: "default"},
+				Spec: infrastructurev1beta1.KTPublicNetworkSpec{
+					ClusterName: resourceName,
+					PublicIPID:  "ip-1",
+				},
+			})).To(Succeed())
+
+			By("adopting the public IP without binding it")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			claim := &infrastructurev1beta1.KTPublicNetwork{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, claim)).To(Succeed())
+			Expect(claim.Status.ID).To(Equal("ip-1"))
+			Expect(claim.Status.Allocated).To(BeFalse())
+			Expect(claim.Status.Phase).To(Equal(infrastructurev1beta1.KTPublicNetworkPhaseClaimed))
+
+			By("failing a second claim of the same public IP")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: secondName})
+			Expect(err).NotTo(HaveOccurred())
+			second := &infrastructurev1beta1.KTPublicNetwork{}
+			Expect(k8sClient.Get(ctx, secondName, second)).To(Succeed())
+			Expect(second.Status.ID).To(BeEmpty())
+			Expect(second.Status.Phase).To(Equal(infrastructurev1beta1.KTPublicNetworkPhaseFailed))
+
+			By("retaining the adopted public IP when the claims are deleted")
+			for _, name := range []types.NamespacedName{typeNamespacedName, secondName} {
+				Expect(k8sClient.Get(ctx, name, claim)).To(Succeed())
+				Expect(k8sClient.Delete(ctx, claim)).To(Succeed())
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: name})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(errors.IsNotFound(k8sClient.Get(ctx, name, claim))).To(BeTrue())
+			}
+			Expect(cloud.PublicIPs).To(HaveLen(1))
+		})
+
+		It("should only adopt free public IPs from the pool of the cluster", func() {
+			controllerReconciler := &KTPublicNetworkReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+			cloud.PublicIPs = []ktcloud.PublicIP{
+				{Id: "ip-other-team", IP: "198.51.100.1", Type: "ASSOCIATE"},
+				{Id: "ip-endpoint", IP: "211.0.0.1", Type: "ASSOCIATE"},
+				{Id: "ip-pool", IP: "211.0.0.2", Type: "ASSOCIATE"},
+			}
+			ktCluster := &infrastructurev1beta1.KTCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec: infrastructurev1beta1.KTClusterSpec{
+					PublicIPPool: infrastructurev1beta1.PublicIPPool{
+						CIDRs:                  []string{"211.0.0.0/24"},
+						ControlPlaneEndpointIP: "211.0.0.1",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, ktCluster)).To(Succeed())
+			secondName := types.NamespacedName{Name: resourceName + "-second", Namespace: "default"}
+			for _, name := range []string{typeNamespacedName.Name, secondName.Name} {
+				Expect(k8sClient.Create(ctx, &infrastructurev1beta1.KTPublicNetwork{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+					Spec:       infrastructurev1beta1.KTPublicNetworkSpec{ClusterName: resourceName},
+				})).To(Succeed())
+			}
+
+			By("adopting the free public IP of the pool that is not the endpoint IP")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			claim := &infrastructurev1beta1.KTPublicNetwork{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, claim)).To(Succeed())
+			Expect(claim.Status.ID).To(Equal("ip-pool"))
+			Expect(claim.Status.Allocated).To(BeFalse())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(ktCluster.Status.Conditions, infrastructurev1beta1.PublicIPPoolAvailableCondition)).To(BeTrue())
+
+			By("reporting the exhausted pool instead of allocating")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: secondName})
+			Expect(err).NotTo(HaveOccurred())
+			second := &infrastructurev1beta1.KTPublicNetwork{}
+			Expect(k8sClient.Get(ctx, secondName, second)).To(Succeed())
+			Expect(second.Status.ID).To(BeEmpty())
+			Expect(second.Status.Phase).To(Equal(infrastructurev1beta1.KTPublicNetworkPhasePending))
+			Expect(cloud.PublicIPs).To(HaveLen(3))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			condition := meta.FindStatusCondition(ktCluster.Status.Conditions, infrastructurev1beta1.PublicIPPoolAvailableCondition)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(infrastructurev1beta1.PublicIPPoolExhaustedReason))
+
+			By("refusing to adopt a public IP outside of the pool")
+			Expect(k8sClient.Get(ctx, secondName, second)).To(Succeed())
+			second.Spec.IP = "198.51.100.1"
+			Expect(k8sClient.Update(ctx, second)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: secondName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, secondName, second)).To(Succeed())
+			Expect(second.Status.Phase).To(Equal(infrastructurev1beta1.KTPublicNetworkPhaseFailed))
+
+			By("retaining the public IPs of the pool")
+			for _, name := range []types.NamespacedName{typeNamespacedName, secondName} {
+				Expect(k8sClient.Get(ctx, name, claim)).To(Succeed())
+				Expect(k8sClient.Delete(ctx, claim)).To(Succeed())
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: name})
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(cloud.PublicIPs).To(HaveLen(3))
+			Expect(k8sClient.Delete(ctx, ktCluster)).To(Succeed())
+		})
+
+		It("should not adopt a public IP of the pool twice while the cache lags behind", func() {
+			controllerReconciler := &KTPublicNetworkReconciler{
+				Client:    staleClaimsClient{Client: k8sClient},
+				Scheme:    k8sClient.Scheme(),
+				KTCloud:   cloud.Factory(),
+				APIReader: k8sClient,
+			}
+			cloud.PublicIPs = []ktcloud.PublicIP{
+				{Id: "ip-pool-1", IP: "211.0.0.2", Type: "ASSOCIATE"},
+				{Id: "ip-pool-2", IP: "211.0.0.3", Type: "ASSOCIATE"},
+			}
+			ktCluster := &infrastructurev1beta1.KTCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec: infrastructurev1beta1.KTClusterSpec{
+					PublicIPPool: infrastructurev1beta1.PublicIPPool{CIDRs: []string{"211.0.0.0/24"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, ktCluster)).To(Succeed())
+			secondName := types.NamespacedName{Name: resourceName + "-second", Namespace: "default"}
+			names := []types.NamespacedName{typeNamespacedName, secondName}
+			for _, name := range names {
+				Expect(k8sClient.Create(ctx, &infrastructurev1beta1.KTPublicNetwork{
+					ObjectMeta: metav1.ObjectMeta{Name: name.Name, Namespace: "default"},
+					Spec:       infrastructurev1beta1.KTPublicNetworkSpec{ClusterName: resourceName},
+				})).To(Succeed())
+			}
+
+			By("adopting a different public IP for each claim")
+			claimed := map[string]bool{}
+			claim := &infrastructurev1beta1.KTPublicNetwork{}
+			for _, name := range names {
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: name})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(k8sClient.Get(ctx, name, claim)).To(Succeed())
+				Expect(claim.Status.ID).NotTo(BeEmpty())
+				claimed[claim.Status.ID] = true
+			}
+			Expect(claimed).To(HaveLen(2))
+
+			for _, name := range names {
+				Expect(k8sClient.Get(ctx, name, claim)).To(Succeed())
+				Expect(k8sClient.Delete(ctx, claim)).To(Succeed())
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: name})
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(k8sClient.Delete(ctx, ktCluster)).To(Succeed())
+		})
+
+		It("should share a public IP between machines with port forwarding", func() {
+			controllerReconciler := &KTPublicNetworkReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				KTCloud: cloud.Factory(),
+			}
+			otherName := types.NamespacedName{Name: resourceName + "-other", Namespace: "default"}
+			otherMachine := &infrastructurev1beta1.KTMachine{
+				ObjectMeta: metav1.ObjectMeta{Name: otherName.Name, Namespace: "default"},
+				Spec: infrastructurev1beta1.KTMachineSpec{
+					NetworkTier: []infrastructurev1beta1.NetworkTier{{ID: "tier"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, otherMachine)).To(Succeed())
+			otherMachine.Status.Addresses = []infrastructurev1beta1.MachineAddress{{Type: infrastructurev1beta1.MachineInternalIP, Address: "172.25.0.11"}}
+			Expect(k8sClient.Status().Update(ctx, otherMachine)).To(Succeed())
+			Expect(k8sClient.Create(ctx, &infrastructurev1beta1.KTPublicNetwork{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec: infrastructurev1beta1.KTPublicNetworkSpec{
+					ClusterName: resourceName,
+					PortForwards: []infrastructurev1beta1.PortForward{
+						{Name: "first", MachineRef: corev1.LocalObjectReference{Name: resourceName}, PublicPort: 6443},
+						{Name: "second", MachineRef: corev1.LocalObjectReference{Name: otherName.Name}, PublicPort: 6444, PrivatePort: 6443},
+					},
+				},
+			})).To(Succeed())
+
+			By("forwarding a port of one public IP to each machine")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			claim := &infrastructurev1beta1.KTPublicNetwork{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, claim)).To(Succeed())
+			Expect(claim.Status.Phase).To(Equal(infrastructurev1beta1.KTPublicNetworkPhaseBound))
+			Expect(claim.Status.StaticNATID).To(BeEmpty())
+			Expect(cloud.PublicIPs).To(HaveLen(1))
+			Expect(cloud.PortForwardingRules).To(HaveLen(2))
+			Expect(claim.Status.PortForwards).To(HaveLen(2))
+			for _, status := range claim.Status.PortForwards {
+				Expect(cloud.PortForwardingRules).To(HaveKey(status.ID))
+			}
+			Expect(k8sClient.Get(ctx, otherName, otherMachine)).To(Succeed())
+			Expect(otherMachine.Status.AssignedPublicIps).To(ConsistOf(infrastructurev1beta1.AssignedPublicIps{
+				Id:          claim.Status.ID,
+				IP:          claim.Status.IP,
+				Port:        6444,
+				PrivatePort: 6443,
+			}))
+
+			By("deleting the rule of a port forward removed from the spec")
+			claim.Spec.PortForwards = claim.Spec.PortForwards[:1]
+			Expect(k8sClient.Update(ctx, claim)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, claim)).To(Succeed())
+			Expect(claim.Status.PortForwards).To(ConsistOf(HaveField("Name", "first")))
+			Expect(cloud.PortForwardingRules).To(HaveLen(1))
+			Expect(k8sClient.Get(ctx, otherName, otherMachine)).To(Succeed())
+			Expect(otherMachine.Status.AssignedPublicIps).To(BeEmpty())
+
+			By("deleting the rules before releasing the public IP")
+			Expect(k8sClient.Delete(ctx, claim)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cloud.PortForwardingRules).To(BeEmpty())
+			Expect(cloud.PublicIPs).To(BeEmpty())
+			Expect(k8sClient.Delete(ctx, otherMachine)).To(Succeed())
+		})
+	})
 })
+
+// staleClaimsClient lists no KTPublicNetworks, like a cache that has not seen any claim yet.
+type staleClaimsClient struct {
+	client.Client
+}
+
+func (c staleClaimsClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if _, ok := list.(*infrastructurev1beta1.KTPublicNetworkList); ok {
+		return nil
+	}
+	return c.Client.List(ctx, list, opts...)
+}
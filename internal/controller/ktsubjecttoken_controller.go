@@ -18,46 +18,209 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
 	infrastructurev1beta1 "dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/cloudapi"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
 )
 
+// subjectTokenTimeLayout is the format KT Cloud uses for token timestamps
+const subjectTokenTimeLayout = "2006-01-02T15:04:05.000000Z"
+
 // KTSubjectTokenReconciler reconciles a KTSubjectToken object
 type KTSubjectTokenReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// Config holds the token renewal settings and defaults for the cluster credentials
+	Config cloudapi.Config
+	// KTCloud creates the clients used to log in to KT Cloud
+	KTCloud ktcloud.Factory
 }
 
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktsubjecttokens,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktsubjecttokens/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktsubjecttokens/finalizers,verbs=update
+// +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktclusters,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the KTSubjectToken object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
+// Reconcile logs in to the KT Cloud identity API with the credentials of the
+// KTCluster the token belongs to whenever the KTSubjectToken has no token for
+// the cluster's zone and current credentials yet, and, when CLIENT_AUTH_AUTO_RENEW is enabled, renews
+// the token CLIENT_AUTH_RENEW_BEFORE ahead of its expiry.
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.19.1/pkg/reconcile
 func (r *KTSubjectTokenReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
+	logger := log.FromContext(ctx, "LogFrom", "KTSubjectToken")
+	logger.V(1).Info("KTSubjectToken Reconcile", "KTSubjectToken", req)
+
+	ktSubjectToken := &v1beta1.KTSubjectToken{}
+	if err := r.Get(ctx, req.NamespacedName, ktSubjectToken); err != nil {
+		if apierrors.IsNotFound(err) {
+			logger.Info("KTSubjectToken resource not found. Ignoring since it must be deleted")
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get KTSubjectToken resource")
+		return ctrl.Result{}, err
+	}
+
+	credentials, err := r.getClusterCredentials(ctx, ktSubjectToken)
+	if err != nil {
+		logger.Error(err, "Failed to get KT Cloud credentials for KTSubjectToken")
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+
+	now := time.Now()
+	credentialsHash := credentials.Hash()
+	if ktSubjectToken.Status.SubjectToken != "" && ktSubjectToken.Status.Zone == credentials.Zone &&
+		ktSubjectToken.Status.CredentialsHash == credentialsHash {
+		renewAt, err := r.subjectTokenRenewTime(ktSubjectToken)
+		switch {
+		case err != nil:
+			logger.Error(err, "Failed to parse the expiry of the current subject token, logging in again")
+		case now.Before(renewAt):
+			logger.Info("Subject token is still valid", "ExpiresAt", ktSubjectToken.Status.Token.ExpiresAt)
+			return r.requeueForRenewal(renewAt, now), nil
+		case !r.Config.ClientAuthAutoRenew:
+			logger.Info("Subject token is about to expire but auto renew is disabled", "ExpiresAt", ktSubjectToken.Status.Token.ExpiresAt)
+			return ctrl.Result{}, nil
+		}
+	}
+
+	logger.Info("Logging in to KT Cloud to get a new subject token")
+	token, err := r.KTCloud(credentials.Zone, "").Identity().Login(ctx, credentials)
+	if err != nil {
+		logger.Error(err, "Failed to login to KT Cloud")
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+
+	ktSubjectToken.Status.SubjectToken = token.SubjectToken
+	ktSubjectToken.Status.Token = v1beta1.Token{
+		ExpiresAt: token.ExpiresAt,
+		IsDomain:  token.IsDomain,
+	}
+	ktSubjectToken.Status.CreatedAt = now.UTC().Format(subjectTokenTimeLayout)
+	ktSubjectToken.Status.Zone = credentials.Zone
+	ktSubjectToken.Status.CredentialsHash = credentialsHash
+	if err := r.Status().Update(ctx, ktSubjectToken); err != nil {
+		logger.Error(err, "Can't update KTSubjectToken status with the new subject token")
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	logger.Info("Updated KTSubjectToken with a new subject token", "ExpiresAt", ktSubjectToken.Status.Token.ExpiresAt)
+
+	renewAt, err := r.subjectTokenRenewTime(ktSubjectToken)
+	if err != nil {
+		logger.Error(err, "Failed to parse the expiry of the new subject token")
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	return r.requeueForRenewal(renewAt, now), nil
+}
+
+// getClusterCredentials reads the credentials from the identity secret of the KTCluster the token
+// belongs to. That is spec.clusterRef when set, otherwise the KTCluster with the same name as the token.
+func (r *KTSubjectTokenReconciler) getClusterCredentials(ctx context.Context, ktSubjectToken *v1beta1.KTSubjectToken) (cloudapi.Credentials, error) {
+	clusterName := subjectTokenClusterName(ktSubjectToken)
+	ktCluster := &v1beta1.KTCluster{}
+	if err := r.Get(ctx, types.NamespacedName{Name: clusterName, Namespace: ktSubjectToken.Namespace}, ktCluster); err != nil {
+		return cloudapi.Credentials{}, fmt.Errorf("failed to get KTCluster %s: %w", clusterName, err)
+	}
 
-	// TODO(user): your logic here
+	if ktCluster.Spec.IdentityRef.Name == "" {
+		return cloudapi.Credentials{}, fmt.Errorf("KTCluster %s has no spec.identityRef.name", clusterName)
+	}
 
-	return ctrl.Result{}, nil
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: ktCluster.Spec.IdentityRef.Name, Namespace: ktCluster.Namespace}, secret); err != nil {
+		return cloudapi.Credentials{}, fmt.Errorf("failed to get identity secret %s: %w", ktCluster.Spec.IdentityRef.Name, err)
+	}
+
+	return cloudapi.CredentialsFromSecret(secret, r.Config)
+}
+
+// subjectTokenClusterName returns the name of the KTCluster a token belongs to.
+func subjectTokenClusterName(ktSubjectToken *v1beta1.KTSubjectToken) string {
+	if ktSubjectToken.Spec.ClusterRef.Name != "" {
+		return ktSubjectToken.Spec.ClusterRef.Name
+	}
+	return ktSubjectToken.Name
+}
+
+// requeueForRenewal schedules the next reconcile at renewAt if tokens are auto renewed.
+func (r *KTSubjectTokenReconciler) requeueForRenewal(renewAt, now time.Time) ctrl.Result {
+	if !r.Config.ClientAuthAutoRenew {
+		return ctrl.Result{}
+	}
+	// tokens living shorter than the renewal margin would otherwise be renewed in a hot loop
+	if renewAt.Sub(now) < time.Minute {
+		return ctrl.Result{RequeueAfter: time.Minute}
+	}
+	return ctrl.Result{RequeueAfter: renewAt.Sub(now)}
+}
+
+// subjectTokenRenewTime returns the time at which the token held in the status has to be renewed.
+func (r *KTSubjectTokenReconciler) subjectTokenRenewTime(ktSubjectToken *v1beta1.KTSubjectToken) (time.Time, error) {
+	expiresAt, err := time.Parse(subjectTokenTimeLayout, ktSubjectToken.Status.Token.ExpiresAt)
+	if err != nil {
+		// fall back to plain RFC3339 for tokens that were pasted in by hand
+		expiresAt, err = time.Parse(time.RFC3339, ktSubjectToken.Status.Token.ExpiresAt)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return expiresAt.Add(-r.Config.ClientAuthRenewBefore), nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *KTSubjectTokenReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrastructurev1beta1.KTSubjectToken{}).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(tokensForIdentitySecret(mgr.GetClient()))).
 		Named("ktsubjecttoken").
 		Complete(r)
 }
+
+// tokensForIdentitySecret maps an identity secret to the tokens of the KTClusters referencing it,
+// so rotated credentials are logged in with right away.
+func tokensForIdentitySecret(c client.Reader) func(context.Context, client.Object) []reconcile.Request {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		ktClusters := &v1beta1.KTClusterList{}
+		if err := c.List(ctx, ktClusters, client.InNamespace(obj.GetNamespace())); err != nil {
+			return nil
+		}
+		clusterNames := map[string]bool{}
+		for _, ktCluster := range ktClusters.Items {
+			if ktCluster.Spec.IdentityRef.Name == obj.GetName() {
+				clusterNames[ktCluster.Name] = true
+			}
+		}
+		if len(clusterNames) == 0 {
+			return nil
+		}
+
+		ktSubjectTokens := &v1beta1.KTSubjectTokenList{}
+		if err := c.List(ctx, ktSubjectTokens, client.InNamespace(obj.GetNamespace())); err != nil {
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, ktSubjectToken := range ktSubjectTokens.Items {
+			if clusterNames[subjectTokenClusterName(&ktSubjectToken)] {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&ktSubjectToken)})
+			}
+		}
+		return requests
+	}
+}
@@ -18,9 +18,11 @@ package controller
 
 import (
 	"context"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -28,6 +30,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	infrastructurev1beta1 "dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/cloudapi"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud/fake"
 )
 
 var _ = Describe("KTSubjectToken Controller", func() {
@@ -41,10 +45,46 @@ var _ = Describe("KTSubjectToken Controller", func() {
 			Namespace: "default", // TODO(user):Modify as needed
 		}
 		ktsubjecttoken := &infrastructurev1beta1.KTSubjectToken{}
+		cloudConfig := cloudapi.Config{
+			Zone:                         "gd1",
+			IdentityPasswordUserDomainId: "default",
+			ScopeProjectDomainId:         "default",
+			ClientAuthAutoRenew:          true,
+			ClientAuthRenewBefore:        10 * time.Minute,
+		}
 
 		BeforeEach(func() {
+			By("creating the identity secret and KTCluster the token belongs to")
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName + "-cloud-config",
+					Namespace: "default",
+				},
+				StringData: map[string]string{
+					cloudapi.SecretKeyUsername: "user",
+					cloudapi.SecretKeyPassword: "secret",
+				},
+			}
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, &corev1.Secret{})
+			if err != nil && errors.IsNotFound(err) {
+				Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			}
+			ktCluster := &infrastructurev1beta1.KTCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: infrastructurev1beta1.KTClusterSpec{
+					IdentityRef: infrastructurev1beta1.IdentityRef{Name: secret.Name},
+				},
+			}
+			err = k8sClient.Get(ctx, typeNamespacedName, &infrastructurev1beta1.KTCluster{})
+			if err != nil && errors.IsNotFound(err) {
+				Expect(k8sClient.Create(ctx, ktCluster)).To(Succeed())
+			}
+
 			By("creating the custom resource for the Kind KTSubjectToken")
-			err := k8sClient.Get(ctx, typeNamespacedName, ktsubjecttoken)
+			err = k8sClient.Get(ctx, typeNamespacedName, ktsubjecttoken)
 			if err != nil && errors.IsNotFound(err) {
 				resource := &infrastructurev1beta1.KTSubjectToken{
 					ObjectMeta: metav1.ObjectMeta{
@@ -65,20 +105,212 @@ var _ = Describe("KTSubjectToken Controller", func() {
 
 			By("Cleanup the specific resource instance KTSubjectToken")
 			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			ktCluster := &infrastructurev1beta1.KTCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, ktCluster)).To(Succeed())
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-cloud-config", Namespace: "default"}, secret)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
 		})
-		It("should successfully reconcile the resource", func() {
+		It("should log in with the cluster credentials and renew before expiry", func() {
 			By("Reconciling the created resource")
+			cloud := fake.New()
 			controllerReconciler := &KTSubjectTokenReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				Config:  cloudConfig,
+				KTCloud: cloud.Factory(),
 			}
 
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cloud.Logins).To(Equal(1))
+			Expect(result.RequeueAfter).To(BeNumerically("~", cloud.TokenLifetime-cloudConfig.ClientAuthRenewBefore, time.Minute))
+
+			resource := &infrastructurev1beta1.KTSubjectToken{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.SubjectToken).NotTo(BeEmpty())
+			Expect(resource.Status.Token.ExpiresAt).NotTo(BeEmpty())
+			Expect(resource.Status.Zone).To(Equal("gd1"))
+
+			By("Reconciling again while the token is still valid")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cloud.Logins).To(Equal(1))
+		})
+
+		It("should renew the token once it expires within ClientAuthRenewBefore", func() {
+			cloud := fake.New()
+			cloud.TokenLifetime = 5 * time.Minute
+			controllerReconciler := &KTSubjectTokenReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				Config:  cloudConfig,
+				KTCloud: cloud.Factory(),
+			}
+
+			By("Logging in with a token living shorter than the renewal margin")
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cloud.Logins).To(Equal(1))
+			Expect(result.RequeueAfter).To(Equal(time.Minute))
+
+			resource := &infrastructurev1beta1.KTSubjectToken{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			firstToken := resource.Status.SubjectToken
+			Expect(firstToken).NotTo(BeEmpty())
+
+			By("Renewing the token on the next reconcile")
+			result, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cloud.Logins).To(Equal(2))
+			Expect(result.RequeueAfter).To(Equal(time.Minute))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.SubjectToken).NotTo(Equal(firstToken))
+			Expect(resource.Status.Token.ExpiresAt).NotTo(BeEmpty())
+		})
+
+		It("should not renew the token when auto renew is disabled", func() {
+			cloud := fake.New()
+			cloud.TokenLifetime = 5 * time.Minute
+			config := cloudConfig
+			config.ClientAuthAutoRenew = false
+			controllerReconciler := &KTSubjectTokenReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				Config:  config,
+				KTCloud: cloud.Factory(),
+			}
+
+			By("Logging in without scheduling a renewal")
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cloud.Logins).To(Equal(1))
+			Expect(result.RequeueAfter).To(BeZero())
+
+			resource := &infrastructurev1beta1.KTSubjectToken{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			token := resource.Status.SubjectToken
+			Expect(token).NotTo(BeEmpty())
+
+			By("Keeping the token although it is about to expire")
+			result, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cloud.Logins).To(Equal(1))
+			Expect(result.RequeueAfter).To(BeZero())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.SubjectToken).To(Equal(token))
+		})
+
+		It("should log in again once the identity secret is rotated", func() {
+			cloud := fake.New()
+			controllerReconciler := &KTSubjectTokenReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				Config:  cloudConfig,
+				KTCloud: cloud.Factory(),
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cloud.Logins).To(Equal(1))
+
+			resource := &infrastructurev1beta1.KTSubjectToken{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			firstHash := resource.Status.CredentialsHash
+			Expect(firstHash).NotTo(BeEmpty())
+
+			By("Rotating the password in the identity secret")
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-cloud-config", Namespace: "default"}, secret)).To(Succeed())
+			secret.Data[cloudapi.SecretKeyPassword] = []byte("rotated")
+			Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+			Expect(tokensForIdentitySecret(k8sClient)(ctx, secret)).To(ConsistOf(reconcile.Request{NamespacedName: typeNamespacedName}))
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cloud.Logins).To(Equal(2))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.CredentialsHash).NotTo(Equal(firstHash))
+		})
+
+		It("should log in with the identity of the KTCluster named by clusterRef", func() {
+			const otherName = "test-resource-other"
+
+			By("creating a second KTCluster with its own identity secret")
+			otherSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      otherName + "-cloud-config",
+					Namespace: "default",
+				},
+				StringData: map[string]string{
+					cloudapi.SecretKeyUsername: "other",
+					cloudapi.SecretKeyPassword: "secret",
+					cloudapi.SecretKeyZone:     "DX-M1",
+				},
+			}
+			Expect(k8sClient.Create(ctx, otherSecret)).To(Succeed())
+			otherCluster := &infrastructurev1beta1.KTCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      otherName,
+					Namespace: "default",
+				},
+				Spec: infrastructurev1beta1.KTClusterSpec{
+					IdentityRef: infrastructurev1beta1.IdentityRef{Name: otherSecret.Name},
+				},
+			}
+			Expect(k8sClient.Create(ctx, otherCluster)).To(Succeed())
+			defer func() {
+				Expect(k8sClient.Delete(ctx, otherCluster)).To(Succeed())
+				Expect(k8sClient.Delete(ctx, otherSecret)).To(Succeed())
+			}()
+
+			resource := &infrastructurev1beta1.KTSubjectToken{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.ClusterRef.Name = otherName
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			By("mapping only the secret of the referenced KTCluster to the token")
+			Expect(tokensForIdentitySecret(k8sClient)(ctx, otherSecret)).To(ConsistOf(reconcile.Request{NamespacedName: typeNamespacedName}))
+			ownSecret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-cloud-config", Namespace: "default"}, ownSecret)).To(Succeed())
+			Expect(tokensForIdentitySecret(k8sClient)(ctx, ownSecret)).To(BeEmpty())
+
+			cloud := fake.New()
+			controllerReconciler := &KTSubjectTokenReconciler{
+				Client:  k8sClient,
+				Scheme:  k8sClient.Scheme(),
+				Config:  cloudConfig,
+				KTCloud: cloud.Factory(),
+			}
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
 				NamespacedName: typeNamespacedName,
 			})
 			Expect(err).NotTo(HaveOccurred())
-			// TODO(user): Add more specific assertions depending on your controller's reconciliation logic.
-			// Example: If you expect a certain status condition after reconciliation, verify it here.
+			Expect(cloud.Logins).To(Equal(1))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.Zone).To(Equal("DX-M1"))
 		})
 	})
 })
@@ -21,15 +21,18 @@ import (
 	"strings"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 
 	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
 	infrastructurev1beta1 "dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
@@ -43,15 +46,14 @@ type MachineDeploymentReconciler struct {
 }
 
 const (
-	waitForClusterInfrastructureReadyDuration = 15 * time.Second
-	waitForInstanceBecomeActiveToReconcile    = 60 * time.Second
-	waitForBuildingInstanceToReconcile        = 10 * time.Second
-	deleteServerRequeueDelay                  = 10 * time.Second
+	// waitForBuildingInstanceToReconcile is how often a rollout checks whether its new machines became available
+	waitForBuildingInstanceToReconcile = 10 * time.Second
 )
 
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=machinedeployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=machinedeployments/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=machinedeployments/finalizers,verbs=update
+// +kubebuilder:rbac:groups=infrastructure.dcnlab.ssu.ac.kr,resources=ktclusters,verbs=get;list;watch;update;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -79,60 +81,121 @@ func (r *MachineDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Re
 		return ctrl.Result{}, err
 	}
 
+	// the machines are created from the KTMachineTemplate the infrastructureRef points to
+	templateKey, err := machineTemplateKey(machineDeployment)
+	if err != nil {
+		logger.Error(err, "Invalid infrastructureRef of MachineDeployment")
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	foundKTMachineTemplate := &v1beta1.KTMachineTemplate{}
+	if err := r.Get(ctx, templateKey, foundKTMachineTemplate); err != nil {
+		logger.Error(err, "Failed to get KTMachineTemplate", "Name", templateKey.Name, "Namespace", templateKey.Namespace)
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	machineSpec := newKTMachineSpec(machineDeployment, foundKTMachineTemplate)
+	templateHash := machineTemplateHash(machineSpec)
+
 	// create child resources and add owner references
-	countMachinesAvailable, err := r.countChildMachinesByOwner(ctx, machineDeployment)
+	machines, err := r.getChildMachinesByOwner(ctx, machineDeployment)
 	if err != nil {
 		logger.Error(err, "Failed to get Machines for deployment, maybe dont have")
 
 		return ctrl.Result{RequeueAfter: time.Minute}, nil
-	} else if countMachinesAvailable != machineDeployment.Spec.Replicas {
-		logger.Info("KTMachines not found matching machine deployment replicas, we have to create a new one")
-		err := r.ktMachineForMachineDeployment(ctx, machineDeployment, countMachinesAvailable)
-		if err != nil {
-			logger.Error(err, "Failed to find KTMachineTemplate to create Machine from MachineDeployment", "MachineDeployment.Namespace", machineDeployment.Namespace, "MachineDeployment.Name", machineDeployment.Name)
-			return ctrl.Result{}, err
-		}
+	}
+
+	// machines created before the deployment labelled its machines have to be found by the scale selector,
+	// the cluster and by their role
+	if err := r.labelChildMachines(ctx, machineDeployment, machines); err != nil {
+		logger.Error(err, "Failed to label KTMachines of MachineDeployment")
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+
+	result := ctrl.Result{}
+	newMachines, oldMachines := partitionMachinesByTemplateHash(machines, templateHash)
+	if len(oldMachines) > 0 {
+		logger.Info("KTMachines out of date with the machine template, rolling out", "UpdatedMachines", len(newMachines), "OutOfDateMachines", len(oldMachines), "Replicas", machineDeployment.Spec.Replicas)
+		err = r.rolloutMachineDeployment(ctx, machineDeployment, machineSpec, templateHash, newMachines, oldMachines)
+		// new machines becoming available don't change the deployment, keep checking on the rollout
+		result = ctrl.Result{RequeueAfter: waitForBuildingInstanceToReconcile}
+	} else if len(machines) != machineDeployment.Spec.Replicas {
+		logger.Info("KTMachines not matching machine deployment replicas, we have to scale", "Machines", len(machines), "Replicas", machineDeployment.Spec.Replicas)
+		err = r.ktMachineForMachineDeployment(ctx, machineDeployment, machineSpec, templateHash, machines)
+	}
+	if err != nil {
+		logger.Error(err, "Failed to scale KTMachines of MachineDeployment", "MachineDeployment.Namespace", machineDeployment.Namespace, "MachineDeployment.Name", machineDeployment.Name)
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	original := machineDeployment.Status.DeepCopy()
+	recordTemplateRevision(machineDeployment, templateHash, metav1.Now())
+	computeMachineDeploymentStatus(machineDeployment, newMachines, oldMachines)
+	if !equality.Semantic.DeepEqual(original, &machineDeployment.Status) {
+		if err := r.Status().Update(ctx, machineDeployment); err != nil {
+			logger.Error(err, "Failed to update MachineDeployment status")
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+	}
+
+	return result, nil
+}
+
+func (r *MachineDeploymentReconciler) ktMachineForMachineDeployment(ctx context.Context, machineDeployment *v1beta1.MachineDeployment, machineSpec v1beta1.KTMachineSpec, templateHash string, machines []v1beta1.KTMachine) error {
+	if len(machines) > machineDeployment.Spec.Replicas {
+		return r.scaleDownMachineDeployment(ctx, machineDeployment, machines, len(machines)-machineDeployment.Spec.Replicas)
+	}
+	return r.createKTMachines(ctx, machineDeployment, machineSpec, templateHash, machineDeployment.Spec.Replicas-len(machines))
 }
 
-func (r *MachineDeploymentReconciler) ktMachineForMachineDeployment(ctx context.Context, machineDeployment *v1beta1.MachineDeployment, countMachinesAvailable int) error {
+// rolloutMachineDeployment takes one step of a rolling update, creating machines from the current
+// template and deleting out-of-date ones within the maxSurge and maxUnavailable limits.
+func (r *MachineDeploymentReconciler) rolloutMachineDeployment(ctx context.Context, machineDeployment *v1beta1.MachineDeployment, machineSpec v1beta1.KTMachineSpec, templateHash string, newMachines, oldMachines []v1beta1.KTMachine) error {
 	logger := log.FromContext(ctx, "LogFrom", "MachineDeployment")
 
-	foundKTMachineTemplate := &v1beta1.KTMachineTemplate{}
-	err := r.Get(ctx, types.NamespacedName{Name: machineDeployment.Name, Namespace: machineDeployment.Namespace}, foundKTMachineTemplate)
-	if err != nil {
-		logger.Error(err, "Failed to get KTMachineTemplate", "Name", machineDeployment.Name, "Namespace", machineDeployment.Namespace)
+	machinesToCreate, machinesToDelete := planRollout(machineDeployment, newMachines, oldMachines)
+	if err := r.createKTMachines(ctx, machineDeployment, machineSpec, templateHash, machinesToCreate); err != nil {
 		return err
 	}
 
-	machinesToCreate := 0
-	if countMachinesAvailable < machineDeployment.Spec.Replicas {
-		machinesToCreate = machineDeployment.Spec.Replicas - countMachinesAvailable
-	} else if countMachinesAvailable > machineDeployment.Spec.Replicas {
+	deletable, err := r.deletableMachines(ctx, machineDeployment, oldMachines)
+	if err != nil {
+		return err
+	}
+	deletableNames := map[string]bool{}
+	for _, machine := range deletable {
+		deletableNames[machine.Name] = true
+	}
 
-	} else {
-		machinesToCreate = machineDeployment.Spec.Replicas
+	for _, machine := range machinesToDelete {
+		if !deletableNames[machine.Name] {
+			logger.Info("Waiting for the out-of-date control plane KTMachine to be marked for deletion once its etcd member is removed",
+				"KTMachine.Namespace", machine.Namespace, "KTMachine.Name", machine.Name, "Annotation", v1beta1.DeleteMachineAnnotation)
+			continue
+		}
+		logger.Info("Deleting out-of-date KTMachine", "KTMachine.Namespace", machine.Namespace, "KTMachine.Name", machine.Name)
+		if err := r.Delete(ctx, machine); client.IgnoreNotFound(err) != nil {
+			logger.Error(err, "Failed to delete KTMachine", "KTMachine.Namespace", machine.Namespace, "KTMachine.Name", machine.Name)
+			return err
+		}
 	}
+	return nil
+}
+
+// createKTMachines creates count machines with the given spec, labelled with the hash of the template.
+func (r *MachineDeploymentReconciler) createKTMachines(ctx context.Context, machineDeployment *v1beta1.MachineDeployment, machineSpec v1beta1.KTMachineSpec, templateHash string, count int) error {
+	logger := log.FromContext(ctx, "LogFrom", "MachineDeployment")
 
-	for i := 0; i < machinesToCreate; i++ {
+	for i := 0; i < count; i++ {
 		machineName := machineDeployment.Name + "-" + strings.ToLower(utils.RandomString(10))
 
 		machine := &v1beta1.KTMachine{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      machineName,
 				Namespace: machineDeployment.Namespace,
+				Labels:    machineDeploymentMachineLabels(machineDeployment),
 			},
-			Spec: v1beta1.KTMachineSpec{
-				Flavor:             foundKTMachineTemplate.Spec.Template.Spec.Flavor,
-				AvailabilityZone:   machineDeployment.Spec.Template.Spec.FailureDomain,
-				SSHKeyName:         foundKTMachineTemplate.Spec.Template.Spec.SSHKeyName,
-				BlockDeviceMapping: foundKTMachineTemplate.Spec.Template.Spec.BlockDeviceMapping,
-				NetworkTier:        foundKTMachineTemplate.Spec.Template.Spec.NetworkTier,
-			},
+			Spec: *machineSpec.DeepCopy(),
 		}
+		machine.Labels[v1beta1.MachineTemplateHashLabel] = templateHash
 
 		// Set the owner reference for the Machine
 		if err := controllerutil.SetControllerReference(machineDeployment, machine, r.Scheme); err != nil {
@@ -148,32 +211,116 @@ func (r *MachineDeploymentReconciler) ktMachineForMachineDeployment(ctx context.
 	}
 
 	// Ensure all machines are created before returning
-	logger.Info("Successfully created all KTMachine replicas", "Replicas", machineDeployment.Spec.Replicas)
+	logger.Info("Successfully created KTMachine replicas", "Created", count, "Replicas", machineDeployment.Spec.Replicas)
 	return nil
 
 }
 
-func (r *MachineDeploymentReconciler) countChildMachinesByOwner(ctx context.Context, machineDeployment *v1beta1.MachineDeployment) (int, error) {
+// scaleDownMachineDeployment deletes count machines picked by the delete policy of the deployment.
+// The KTMachine finalizer releases the cloud resources of each deleted machine.
+func (r *MachineDeploymentReconciler) scaleDownMachineDeployment(ctx context.Context, machineDeployment *v1beta1.MachineDeployment, machines []v1beta1.KTMachine, count int) error {
+	logger := log.FromContext(ctx, "LogFrom", "MachineDeployment")
+
+	deletable, err := r.deletableMachines(ctx, machineDeployment, machines)
+	if err != nil {
+		return err
+	}
+	if len(deletable) < count {
+		logger.Info("Waiting for control plane KTMachines to be marked for deletion once their etcd members are removed",
+			"Marked", len(deletable), "Surplus", count, "Annotation", v1beta1.DeleteMachineAnnotation)
+		count = len(deletable)
+	}
+
+	for _, machine := range selectMachinesToDelete(deletable, machineDeployment.Spec.DeletePolicy, count) {
+		logger.Info("Deleting KTMachine to scale down", "KTMachine.Namespace", machine.Namespace, "KTMachine.Name", machine.Name, "DeletePolicy", machineDeployment.Spec.DeletePolicy)
+		if err := r.Delete(ctx, machine); client.IgnoreNotFound(err) != nil {
+			logger.Error(err, "Failed to delete KTMachine", "KTMachine.Namespace", machine.Namespace, "KTMachine.Name", machine.Name)
+			return err
+		}
+	}
+
+	logger.Info("Successfully scaled down KTMachine replicas", "Replicas", machineDeployment.Spec.Replicas)
+	return nil
+}
+
+// deletableMachines returns the machines the deployment may delete. Deleting a control plane machine leaves
+// its etcd member behind, so control plane machines are only deleted once they are marked with the
+// delete-machine annotation after their member was removed. The others are moved to join another control
+// plane first if a marked machine is the one the cluster was initialized on.
+func (r *MachineDeploymentReconciler) deletableMachines(ctx context.Context, machineDeployment *v1beta1.MachineDeployment, machines []v1beta1.KTMachine) ([]v1beta1.KTMachine, error) {
+	if machineDeploymentRole(machineDeployment) != v1beta1.ControlPlaneMachineRole {
+		return machines, nil
+	}
+	marked := machinesMarkedForDeletion(machines)
+	clusterName := machineDeployment.Spec.Template.Spec.ClusterName
+	if len(marked) == 0 || clusterName == "" {
+		return marked, nil
+	}
+
+	cluster := &v1beta1.KTCluster{}
+	if err := r.Get(ctx, types.NamespacedName{Name: clusterName, Namespace: machineDeployment.Namespace}, cluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return marked, nil
+		}
+		return nil, err
+	}
+	for _, machine := range marked {
+		if err := moveControlPlaneInit(ctx, r.Client, cluster, machine.Name); err != nil {
+			return nil, err
+		}
+	}
+	return marked, nil
+}
+
+// labelChildMachines adds the selector, cluster and role labels of the deployment to machines that
+// don't have them.
+func (r *MachineDeploymentReconciler) labelChildMachines(ctx context.Context, machineDeployment *v1beta1.MachineDeployment, machines []v1beta1.KTMachine) error {
+	machineLabels := machineDeploymentMachineLabels(machineDeployment)
+	for i := range machines {
+		machine := &machines[i]
+		if labels.SelectorFromSet(machineLabels).Matches(labels.Set(machine.Labels)) {
+			continue
+		}
+		patch := client.MergeFrom(machine.DeepCopy())
+		if machine.Labels == nil {
+			machine.Labels = map[string]string{}
+		}
+		for key, value := range machineLabels {
+			machine.Labels[key] = value
+		}
+		if err := r.Patch(ctx, machine, patch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getChildMachinesByOwner returns the machines of the deployment that are not being deleted already.
+func (r *MachineDeploymentReconciler) getChildMachinesByOwner(ctx context.Context, machineDeployment *v1beta1.MachineDeployment) ([]v1beta1.KTMachine, error) {
 	logger := log.FromContext(ctx, "LogFrom", "MachineDeployment")
 
 	ktMachineList := &v1beta1.KTMachineList{}
 	err := r.List(ctx, ktMachineList, client.InNamespace(machineDeployment.Namespace))
 	if err != nil {
 		logger.Error(err, "failed to list KTMachines")
-		return 0, err
+		return nil, err
 	}
 
 	// Filter by ownerReferences
-	count := 0
+	var machines []v1beta1.KTMachine
 	for _, machine := range ktMachineList.Items {
+		// machines waiting for their cloud resources to be released are already gone for scaling
+		if !machine.DeletionTimestamp.IsZero() {
+			continue
+		}
 		for _, ownerRef := range machine.OwnerReferences {
 			if ownerRef.Kind == "MachineDeployment" && ownerRef.Name == machineDeployment.Name {
-				count++
+				machines = append(machines, machine)
 				break
 			}
 		}
 	}
-	return count, nil
+	return machines, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -181,6 +328,8 @@ func (r *MachineDeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrastructurev1beta1.MachineDeployment{}).
 		Owns(&infrastructurev1beta1.KTMachine{}).
+		// roll out the deployments created from a KTMachineTemplate when it changes
+		Watches(&infrastructurev1beta1.KTMachineTemplate{}, handler.EnqueueRequestsFromMapFunc(machineDeploymentsForTemplate(mgr.GetClient()))).
 		Named("machinedeployment").
 		Complete(r)
 }
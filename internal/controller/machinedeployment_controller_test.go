@@ -18,11 +18,15 @@ package controller
 
 import (
 	"context"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -81,4 +85,358 @@ var _ = Describe("MachineDeployment Controller", func() {
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
 	})
+
+	Context("When scaling down a control plane deployment", func() {
+		const resourceName = "test-control-plane-scale-down"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		listMachines := func() []infrastructurev1beta1.KTMachine {
+			machines := &infrastructurev1beta1.KTMachineList{}
+			Expect(k8sClient.List(ctx, machines, client.InNamespace("default"),
+				client.MatchingLabels{infrastructurev1beta1.ClusterNameLabel: resourceName})).To(Succeed())
+			return machines.Items
+		}
+
+		AfterEach(func() {
+			for _, machine := range listMachines() {
+				Expect(k8sClient.Delete(ctx, &machine)).To(Succeed())
+			}
+			deleteMachineOwners(ctx, typeNamespacedName)
+		})
+
+		It("should only delete machines marked for deletion and move the control plane init off them", func() {
+			controllerReconciler := &MachineDeploymentReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			machineDeployment := createMachineOwners(ctx, typeNamespacedName, infrastructurev1beta1.ConfigRef{Kind: "KubeadmControlPlane", Name: resourceName})
+			machineDeployment.Spec.Replicas = 2
+			Expect(k8sClient.Update(ctx, machineDeployment)).To(Succeed())
+
+			By("creating the control plane machines")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			machines := listMachines()
+			Expect(machines).To(HaveLen(2))
+			initMachine, otherMachine := machines[0], machines[1]
+			ktCluster := &infrastructurev1beta1.KTCluster{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			ktCluster.Annotations = map[string]string{infrastructurev1beta1.ControlPlaneInitMachineAnnotation: initMachine.Name}
+			Expect(k8sClient.Update(ctx, ktCluster)).To(Succeed())
+
+			By("keeping the control plane machines that are not marked for deletion")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, machineDeployment)).To(Succeed())
+			machineDeployment.Spec.Replicas = 1
+			Expect(k8sClient.Update(ctx, machineDeployment)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(listMachines()).To(HaveLen(2))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, machineDeployment)).To(Succeed())
+			progressing := meta.FindStatusCondition(machineDeployment.Status.Conditions, infrastructurev1beta1.MachineDeploymentProgressingCondition)
+			Expect(progressing).NotTo(BeNil())
+			Expect(progressing.Status).To(Equal(metav1.ConditionFalse))
+			Expect(progressing.Reason).To(Equal(infrastructurev1beta1.WaitingForDeleteMachineAnnotationReason))
+			Expect(progressing.Message).To(ContainSubstring(infrastructurev1beta1.DeleteMachineAnnotation))
+
+			By("deleting the marked init machine once the others join another control plane")
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(&initMachine), &initMachine)).To(Succeed())
+			initMachine.Annotations = map[string]string{infrastructurev1beta1.DeleteMachineAnnotation: ""}
+			Expect(k8sClient.Update(ctx, &initMachine)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			machines = listMachines()
+			Expect(machines).To(HaveLen(1))
+			Expect(machines[0].Name).To(Equal(otherMachine.Name))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktCluster)).To(Succeed())
+			Expect(ktCluster.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.ControlPlaneInitMachineAnnotation, otherMachine.Name))
+		})
+
+		It("should only replace out-of-date control plane machines marked for deletion", func() {
+			controllerReconciler := &MachineDeploymentReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			machineDeployment := createMachineOwners(ctx, typeNamespacedName, infrastructurev1beta1.ConfigRef{Kind: "KubeadmControlPlane", Name: resourceName})
+			machineDeployment.Spec.Replicas = 1
+			Expect(k8sClient.Update(ctx, machineDeployment)).To(Succeed())
+			setReady := func() {
+				for _, machine := range listMachines() {
+					machine.Status.Ready = true
+					Expect(k8sClient.Status().Update(ctx, &machine)).To(Succeed())
+				}
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			machines := listMachines()
+			Expect(machines).To(HaveLen(1))
+			oldMachine := machines[0]
+			setReady()
+
+			By("changing the machine template")
+			ktMachineTemplate := &infrastructurev1beta1.KTMachineTemplate{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ktMachineTemplate)).To(Succeed())
+			ktMachineTemplate.Spec.Template.Spec.Flavor = "large"
+			Expect(k8sClient.Update(ctx, ktMachineTemplate)).To(Succeed())
+
+			By("creating the new control plane next to the old one")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(listMachines()).To(HaveLen(2))
+			setReady()
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(listMachines()).To(HaveLen(2))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, machineDeployment)).To(Succeed())
+			progressing := meta.FindStatusCondition(machineDeployment.Status.Conditions, infrastructurev1beta1.MachineDeploymentProgressingCondition)
+			Expect(progressing).NotTo(BeNil())
+			Expect(progressing.Status).To(Equal(metav1.ConditionFalse))
+			Expect(progressing.Reason).To(Equal(infrastructurev1beta1.WaitingForDeleteMachineAnnotationReason))
+			Expect(progressing.Message).To(ContainSubstring(oldMachine.Name))
+
+			By("deleting the old control plane once it is marked for deletion")
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(&oldMachine), &oldMachine)).To(Succeed())
+			oldMachine.Annotations = map[string]string{infrastructurev1beta1.DeleteMachineAnnotation: ""}
+			Expect(k8sClient.Update(ctx, &oldMachine)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			machines = listMachines()
+			Expect(machines).To(HaveLen(1))
+			Expect(machines[0].Name).NotTo(Equal(oldMachine.Name))
+		})
+	})
+
+	Context("When selecting machines to delete on scale down", func() {
+		now := time.Now()
+		machine := func(name string, age time.Duration, status string, annotations map[string]string) infrastructurev1beta1.KTMachine {
+			return infrastructurev1beta1.KTMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              name,
+					CreationTimestamp: metav1.NewTime(now.Add(-age)),
+					Annotations:       annotations,
+				},
+				Status: infrastructurev1beta1.KTMachineStatus{InstanceState: status, Ready: status == "ACTIVE"},
+			}
+		}
+		names := func(machines []*infrastructurev1beta1.KTMachine) []string {
+			var result []string
+			for _, machine := range machines {
+				result = append(result, machine.Name)
+			}
+			return result
+		}
+		machines := func() []infrastructurev1beta1.KTMachine {
+			return []infrastructurev1beta1.KTMachine{
+				machine("old", 3*time.Hour, "ACTIVE", nil),
+				machine("broken", 2*time.Hour, "ERROR", nil),
+				machine("new", time.Hour, "ACTIVE", nil),
+				machine("same-age", time.Hour, "ACTIVE", nil),
+			}
+		}
+
+		It("should delete the newest machines first by default", func() {
+			Expect(names(selectMachinesToDelete(machines(), "", 2))).To(Equal([]string{"new", "same-age"}))
+			Expect(names(selectMachinesToDelete(machines(), infrastructurev1beta1.NewestMachineDeletePolicy, 1))).To(Equal([]string{"new"}))
+		})
+
+		It("should delete the oldest machines first", func() {
+			Expect(names(selectMachinesToDelete(machines(), infrastructurev1beta1.OldestMachineDeletePolicy, 2))).To(Equal([]string{"old", "broken"}))
+		})
+
+		It("should delete unhealthy machines first", func() {
+			Expect(names(selectMachinesToDelete(machines(), infrastructurev1beta1.UnhealthyMachineDeletePolicy, 2))).To(Equal([]string{"broken", "new"}))
+		})
+
+		It("should delete annotated machines before any policy", func() {
+			candidates := append(machines(), machine("victim", 4*time.Hour, "ACTIVE", map[string]string{
+				infrastructurev1beta1.DeleteMachineAnnotation: "",
+			}))
+			Expect(names(selectMachinesToDelete(candidates, infrastructurev1beta1.UnhealthyMachineDeletePolicy, 2))).To(Equal([]string{"victim", "broken"}))
+			Expect(selectMachinesToDelete(candidates, infrastructurev1beta1.NewestMachineDeletePolicy, 10)).To(HaveLen(5))
+		})
+	})
+
+	Context("When rolling out a changed machine template", func() {
+		template := func(flavor string) *infrastructurev1beta1.KTMachineTemplate {
+			return &infrastructurev1beta1.KTMachineTemplate{
+				Spec: infrastructurev1beta1.KTMachineTemplateSpec{
+					Template: infrastructurev1beta1.Template{
+						Spec: infrastructurev1beta1.Spec{Flavor: flavor, SSHKeyName: "key"},
+					},
+				},
+			}
+		}
+		deployment := func(replicas int, maxSurge, maxUnavailable intstr.IntOrString) *infrastructurev1beta1.MachineDeployment {
+			return &infrastructurev1beta1.MachineDeployment{
+				Spec: infrastructurev1beta1.MachineDeploymentSpec{
+					Replicas: replicas,
+					Strategy: &infrastructurev1beta1.MachineDeploymentStrategy{
+						Type: infrastructurev1beta1.RollingUpdateMachineDeploymentStrategyType,
+						RollingUpdate: &infrastructurev1beta1.MachineRollingUpdateDeployment{
+							MaxSurge:       &maxSurge,
+							MaxUnavailable: &maxUnavailable,
+						},
+					},
+				},
+			}
+		}
+		machines := func(prefix string, count int, status string) []infrastructurev1beta1.KTMachine {
+			var result []infrastructurev1beta1.KTMachine
+			for i := 0; i < count; i++ {
+				result = append(result, infrastructurev1beta1.KTMachine{
+					ObjectMeta: metav1.ObjectMeta{Name: prefix + string(rune('a'+i))},
+					Status:     infrastructurev1beta1.KTMachineStatus{InstanceState: status, Ready: status == "ACTIVE"},
+				})
+			}
+			return result
+		}
+
+		It("should hash the template fields copied to the machines", func() {
+			machineDeployment := deployment(1, intstr.FromInt32(1), intstr.FromInt32(0))
+			small := newKTMachineSpec(machineDeployment, template("small"))
+			large := newKTMachineSpec(machineDeployment, template("large"))
+			Expect(machineTemplateHash(small)).To(Equal(machineTemplateHash(*small.DeepCopy())))
+			Expect(machineTemplateHash(small)).NotTo(Equal(machineTemplateHash(large)))
+
+			By("comparing machines without the hash label by their spec")
+			labelled := infrastructurev1beta1.KTMachine{ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{infrastructurev1beta1.MachineTemplateHashLabel: machineTemplateHash(large)},
+			}}
+			unlabelled := infrastructurev1beta1.KTMachine{Spec: small}
+			unlabelled.Spec.UserData = "per machine data is not part of the template"
+			newMachines, oldMachines := partitionMachinesByTemplateHash([]infrastructurev1beta1.KTMachine{labelled, unlabelled}, machineTemplateHash(small))
+			Expect(newMachines).To(HaveLen(1))
+			Expect(oldMachines).To(HaveLen(1))
+			Expect(oldMachines[0].Labels).To(HaveKey(infrastructurev1beta1.MachineTemplateHashLabel))
+		})
+
+		It("should surge before deleting available machines by default", func() {
+			machineDeployment := deployment(3, intstr.FromInt32(1), intstr.FromInt32(0))
+
+			create, remove := planRollout(machineDeployment, nil, machines("old-", 3, "ACTIVE"))
+			Expect(create).To(Equal(1))
+			Expect(remove).To(BeEmpty())
+
+			create, remove = planRollout(machineDeployment, machines("new-", 1, "ACTIVE"), machines("old-", 3, "ACTIVE"))
+			Expect(create).To(Equal(0))
+			Expect(remove).To(HaveLen(1))
+
+			By("waiting for the new machine to become available")
+			create, remove = planRollout(machineDeployment, machines("new-", 1, "BUILD"), machines("old-", 2, "ACTIVE"))
+			Expect(create).To(Equal(1))
+			Expect(remove).To(BeEmpty())
+		})
+
+		It("should delete out-of-date machines within maxUnavailable", func() {
+			machineDeployment := deployment(4, intstr.FromInt32(0), intstr.FromString("50%"))
+
+			create, remove := planRollout(machineDeployment, nil, machines("old-", 4, "ACTIVE"))
+			Expect(create).To(Equal(0))
+			Expect(remove).To(HaveLen(2))
+
+			By("always deleting out-of-date machines that are not available")
+			create, remove = planRollout(machineDeployment, machines("new-", 2, "BUILD"), append(machines("old-", 1, "ACTIVE"), machines("broken-", 1, "ERROR")...))
+			Expect(create).To(Equal(0))
+			Expect(remove).To(HaveLen(1))
+			Expect(remove[0].Name).To(Equal("broken-a"))
+		})
+
+		It("should report replica counts, phase and conditions from the machines", func() {
+			machineDeployment := deployment(3, intstr.FromInt32(1), intstr.FromInt32(0))
+			machineDeployment.Name = "workers"
+			machineDeployment.Generation = 2
+
+			computeMachineDeploymentStatus(machineDeployment, machines("new-", 1, "BUILD"), machines("old-", 3, "ACTIVE"))
+			status := machineDeployment.Status
+			Expect(status.ObservedGeneration).To(Equal(int64(2)))
+			Expect(status.Selector).To(Equal(infrastructurev1beta1.MachineDeploymentNameLabel + "=workers"))
+			Expect(status.Replicas).To(Equal(4))
+			Expect(status.UpdatedReplicas).To(Equal(1))
+			Expect(status.ReadyReplicas).To(Equal(3))
+			Expect(status.AvailableReplicas).To(Equal(3))
+			Expect(status.UnavailableReplicas).To(Equal(0))
+			Expect(status.Phase).To(Equal(infrastructurev1beta1.MachineDeploymentPhaseScalingDown))
+			Expect(meta.IsStatusConditionTrue(status.Conditions, infrastructurev1beta1.MachineDeploymentAvailableCondition)).To(BeTrue())
+			Expect(meta.FindStatusCondition(status.Conditions, infrastructurev1beta1.MachineDeploymentProgressingCondition).Reason).To(Equal(infrastructurev1beta1.RollingUpdateReason))
+
+			computeMachineDeploymentStatus(machineDeployment, append(machines("new-", 2, "ACTIVE"), machines("broken-", 1, "ERROR")...), nil)
+			status = machineDeployment.Status
+			Expect(status.UnavailableReplicas).To(Equal(1))
+			Expect(status.Phase).To(Equal(infrastructurev1beta1.MachineDeploymentPhaseFailed))
+			Expect(meta.IsStatusConditionFalse(status.Conditions, infrastructurev1beta1.MachineDeploymentAvailableCondition)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(status.Conditions, infrastructurev1beta1.MachineDeploymentMachinesHealthyCondition)).To(BeTrue())
+
+			computeMachineDeploymentStatus(machineDeployment, machines("new-", 3, "ACTIVE"), nil)
+			status = machineDeployment.Status
+			Expect(status.Phase).To(Equal(infrastructurev1beta1.MachineDeploymentPhaseRunning))
+			Expect(meta.FindStatusCondition(status.Conditions, infrastructurev1beta1.MachineDeploymentProgressingCondition).Reason).To(Equal(infrastructurev1beta1.NewMachinesAvailableReason))
+			Expect(meta.IsStatusConditionTrue(status.Conditions, infrastructurev1beta1.MachineDeploymentMachinesHealthyCondition)).To(BeTrue())
+		})
+
+		It("should report control plane machines waiting for the delete-machine annotation", func() {
+			machineDeployment := deployment(1, intstr.FromInt32(1), intstr.FromInt32(0))
+			machineDeployment.Labels = map[string]string{infrastructurev1beta1.MachineRoleLabel: infrastructurev1beta1.ControlPlaneMachineRole}
+			controlPlanes := machines("cp-", 3, "ACTIVE")
+
+			computeMachineDeploymentStatus(machineDeployment, controlPlanes, nil)
+			progressing := meta.FindStatusCondition(machineDeployment.Status.Conditions, infrastructurev1beta1.MachineDeploymentProgressingCondition)
+			Expect(progressing.Status).To(Equal(metav1.ConditionFalse))
+			Expect(progressing.Reason).To(Equal(infrastructurev1beta1.WaitingForDeleteMachineAnnotationReason))
+			Expect(progressing.Message).To(HavePrefix("2 control plane machines"))
+			Expect(progressing.Message).To(ContainSubstring(infrastructurev1beta1.DeleteMachineAnnotation))
+
+			By("scaling down once enough machines are marked for deletion")
+			for i := range controlPlanes[1:] {
+				controlPlanes[i+1].Annotations = map[string]string{infrastructurev1beta1.DeleteMachineAnnotation: ""}
+			}
+			computeMachineDeploymentStatus(machineDeployment, controlPlanes, nil)
+			progressing = meta.FindStatusCondition(machineDeployment.Status.Conditions, infrastructurev1beta1.MachineDeploymentProgressingCondition)
+			Expect(progressing.Status).To(Equal(metav1.ConditionTrue))
+			Expect(progressing.Reason).To(Equal(infrastructurev1beta1.ScalingReason))
+
+			By("waiting for out-of-date control plane machines the rollout would delete")
+			computeMachineDeploymentStatus(machineDeployment, machines("new-", 1, "ACTIVE"), machines("old-", 1, "ACTIVE"))
+			progressing = meta.FindStatusCondition(machineDeployment.Status.Conditions, infrastructurev1beta1.MachineDeploymentProgressingCondition)
+			Expect(progressing.Status).To(Equal(metav1.ConditionFalse))
+			Expect(progressing.Reason).To(Equal(infrastructurev1beta1.WaitingForDeleteMachineAnnotationReason))
+			Expect(progressing.Message).To(ContainSubstring("old-a"))
+
+			By("rolling out while the new machines are not available yet")
+			computeMachineDeploymentStatus(machineDeployment, machines("new-", 1, "BUILD"), machines("old-", 1, "ACTIVE"))
+			progressing = meta.FindStatusCondition(machineDeployment.Status.Conditions, infrastructurev1beta1.MachineDeploymentProgressingCondition)
+			Expect(progressing.Reason).To(Equal(infrastructurev1beta1.RollingUpdateReason))
+
+			By("deleting worker machines without the annotation")
+			machineDeployment.Labels = nil
+			computeMachineDeploymentStatus(machineDeployment, machines("worker-", 3, "ACTIVE"), nil)
+			progressing = meta.FindStatusCondition(machineDeployment.Status.Conditions, infrastructurev1beta1.MachineDeploymentProgressingCondition)
+			Expect(progressing.Reason).To(Equal(infrastructurev1beta1.ScalingReason))
+		})
+
+		It("should keep the previous revisions in the status", func() {
+			limit := int32(1)
+			machineDeployment := deployment(1, intstr.FromInt32(1), intstr.FromInt32(0))
+			machineDeployment.Spec.RevisionHistoryLimit = &limit
+			now := metav1.Now()
+
+			recordTemplateRevision(machineDeployment, "first", now)
+			Expect(machineDeployment.Status.Revision).To(Equal(int64(1)))
+			Expect(machineDeployment.Status.RevisionHistory).To(BeEmpty())
+
+			recordTemplateRevision(machineDeployment, "first", now)
+			recordTemplateRevision(machineDeployment, "second", now)
+			recordTemplateRevision(machineDeployment, "third", now)
+			Expect(machineDeployment.Status.Revision).To(Equal(int64(3)))
+			Expect(machineDeployment.Status.TemplateHash).To(Equal("third"))
+			Expect(machineDeployment.Status.RevisionHistory).To(Equal([]infrastructurev1beta1.MachineDeploymentRevision{
+				{Revision: 2, TemplateHash: "second", ReplacedAt: now},
+			}))
+		})
+	})
 })
@@ -0,0 +1,88 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sort"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+)
+
+// machineDeletePriority ranks machines for deletion, lower is deleted first
+type machineDeletePriority int
+
+const (
+	mustDeleteMachine machineDeletePriority = iota
+	betterDeleteMachine
+	couldDeleteMachine
+)
+
+// selectMachinesToDelete returns up to count machines to delete from machines following the policy.
+// Machines carrying the delete-machine annotation always come first. Ties are broken by name so the
+// same machines are picked on every reconcile.
+func selectMachinesToDelete(machines []v1beta1.KTMachine, policy v1beta1.MachineDeletePolicy, count int) []*v1beta1.KTMachine {
+	candidates := make([]*v1beta1.KTMachine, 0, len(machines))
+	for i := range machines {
+		candidates = append(candidates, &machines[i])
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if pa, pb := machineDeletePriorityFor(a, policy), machineDeletePriorityFor(b, policy); pa != pb {
+			return pa < pb
+		}
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			if policy == v1beta1.OldestMachineDeletePolicy {
+				return a.CreationTimestamp.Before(&b.CreationTimestamp)
+			}
+			return b.CreationTimestamp.Before(&a.CreationTimestamp)
+		}
+		return a.Name < b.Name
+	})
+
+	if count > len(candidates) {
+		count = len(candidates)
+	}
+	return candidates[:count]
+}
+
+// machinesMarkedForDeletion returns the machines carrying the delete-machine annotation.
+func machinesMarkedForDeletion(machines []v1beta1.KTMachine) []v1beta1.KTMachine {
+	var marked []v1beta1.KTMachine
+	for _, machine := range machines {
+		if _, ok := machine.Annotations[v1beta1.DeleteMachineAnnotation]; ok {
+			marked = append(marked, machine)
+		}
+	}
+	return marked
+}
+
+func machineDeletePriorityFor(machine *v1beta1.KTMachine, policy v1beta1.MachineDeletePolicy) machineDeletePriority {
+	if _, ok := machine.Annotations[v1beta1.DeleteMachineAnnotation]; ok {
+		return mustDeleteMachine
+	}
+	if policy == v1beta1.UnhealthyMachineDeletePolicy && isMachineUnhealthy(machine) {
+		return betterDeleteMachine
+	}
+	return couldDeleteMachine
+}
+
+// isMachineUnhealthy returns true if KT Cloud reported the server of the machine in an error state
+// or the machine failed.
+func isMachineUnhealthy(machine *v1beta1.KTMachine) bool {
+	return machine.Status.InstanceState == "ERROR" || machine.Status.FailureReason != nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+)
+
+// machineTemplateKey returns the KTMachineTemplate the infrastructureRef of the deployment points to.
+func machineTemplateKey(machineDeployment *v1beta1.MachineDeployment) (types.NamespacedName, error) {
+	ref := machineDeployment.Spec.Template.Spec.InfrastructureRef
+	if ref.Kind != "" && ref.Kind != "KTMachineTemplate" {
+		return types.NamespacedName{}, fmt.Errorf("unsupported infrastructureRef kind %q, only KTMachineTemplate is supported", ref.Kind)
+	}
+	if ref.Name == "" {
+		return types.NamespacedName{}, fmt.Errorf("MachineDeployment %s has no infrastructureRef", machineDeployment.Name)
+	}
+	return types.NamespacedName{Name: ref.Name, Namespace: machineDeployment.Namespace}, nil
+}
+
+// machineDeploymentRole returns the role of the machines of the deployment: the role label of the
+// deployment when set, otherwise control plane for deployments bootstrapped from a KubeadmControlPlane.
+func machineDeploymentRole(machineDeployment *v1beta1.MachineDeployment) string {
+	if role := machineDeployment.Labels[v1beta1.MachineRoleLabel]; role != "" {
+		return role
+	}
+	if machineDeployment.Spec.Template.Spec.Bootstrap.ConfigRef.Kind == "KubeadmControlPlane" {
+		return v1beta1.ControlPlaneMachineRole
+	}
+	return v1beta1.WorkerMachineRole
+}
+
+// machineDeploymentMachineLabels returns the labels the machines of the deployment carry on top of the
+// selector labels: the cluster they belong to and their role in it.
+func machineDeploymentMachineLabels(machineDeployment *v1beta1.MachineDeployment) map[string]string {
+	machineLabels := machineDeploymentSelectorLabels(machineDeployment)
+	machineLabels[v1beta1.MachineRoleLabel] = machineDeploymentRole(machineDeployment)
+	if clusterName := machineDeployment.Spec.Template.Spec.ClusterName; clusterName != "" {
+		machineLabels[v1beta1.ClusterNameLabel] = clusterName
+	}
+	return machineLabels
+}
+
+// isControlPlaneMachine returns whether the machine was created by a control plane deployment.
+func isControlPlaneMachine(ktMachine *v1beta1.KTMachine) bool {
+	return ktMachine.Labels[v1beta1.MachineRoleLabel] == v1beta1.ControlPlaneMachineRole
+}
+
+// clusterMachineDeployments returns the MachineDeployments whose clusterName is the cluster.
+func clusterMachineDeployments(ctx context.Context, c client.Reader, ktCluster *v1beta1.KTCluster) ([]v1beta1.MachineDeployment, error) {
+	machineDeployments := &v1beta1.MachineDeploymentList{}
+	if err := c.List(ctx, machineDeployments, client.InNamespace(ktCluster.Namespace)); err != nil {
+		return nil, err
+	}
+	var owned []v1beta1.MachineDeployment
+	for _, machineDeployment := range machineDeployments.Items {
+		if machineDeployment.Spec.Template.Spec.ClusterName == ktCluster.Name {
+			owned = append(owned, machineDeployment)
+		}
+	}
+	return owned, nil
+}
+
+// templateMachineDeployments returns the MachineDeployments whose infrastructureRef is the template.
+func templateMachineDeployments(ctx context.Context, c client.Reader, ktMachineTemplate client.Object) ([]v1beta1.MachineDeployment, error) {
+	machineDeployments := &v1beta1.MachineDeploymentList{}
+	if err := c.List(ctx, machineDeployments, client.InNamespace(ktMachineTemplate.GetNamespace())); err != nil {
+		return nil, err
+	}
+	var referencing []v1beta1.MachineDeployment
+	for _, machineDeployment := range machineDeployments.Items {
+		key, err := machineTemplateKey(&machineDeployment)
+		if err == nil && key.Name == ktMachineTemplate.GetName() {
+			referencing = append(referencing, machineDeployment)
+		}
+	}
+	return referencing, nil
+}
+
+// machineDeploymentsForTemplate returns a map function enqueueing the MachineDeployments created from a
+// KTMachineTemplate.
+func machineDeploymentsForTemplate(c client.Reader) func(context.Context, client.Object) []reconcile.Request {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		machineDeployments, err := templateMachineDeployments(ctx, c, obj)
+		if err != nil {
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, machineDeployment := range machineDeployments {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&machineDeployment)})
+		}
+		return requests
+	}
+}
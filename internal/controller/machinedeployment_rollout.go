@@ -0,0 +1,191 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/rand"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+)
+
+const (
+	defaultMaxSurge             = 1
+	defaultMaxUnavailable       = 0
+	defaultRevisionHistoryLimit = 10
+)
+
+// newKTMachineSpec returns the spec of the machines the deployment creates from its template.
+func newKTMachineSpec(machineDeployment *v1beta1.MachineDeployment, ktMachineTemplate *v1beta1.KTMachineTemplate) v1beta1.KTMachineSpec {
+	return v1beta1.KTMachineSpec{
+		Flavor:             ktMachineTemplate.Spec.Template.Spec.Flavor,
+		AvailabilityZone:   machineDeployment.Spec.Template.Spec.FailureDomain,
+		SSHKeyName:         ktMachineTemplate.Spec.Template.Spec.SSHKeyName,
+		BlockDeviceMapping: ktMachineTemplate.Spec.Template.Spec.BlockDeviceMapping,
+		NetworkTier:        ktMachineTemplate.Spec.Template.Spec.NetworkTier,
+		RemediationPolicy:  ktMachineTemplate.Spec.Template.Spec.RemediationPolicy,
+	}
+}
+
+// machineTemplateHash hashes the fields of the spec that newKTMachineSpec fills in, so the hash
+// of a machine created by the deployment can also be recomputed from the machine itself. The
+// remediation policy is left out, changing it does not replace the servers.
+func machineTemplateHash(spec v1beta1.KTMachineSpec) string {
+	data, _ := json.Marshal(v1beta1.KTMachineSpec{
+		Flavor:             spec.Flavor,
+		AvailabilityZone:   spec.AvailabilityZone,
+		SSHKeyName:         spec.SSHKeyName,
+		BlockDeviceMapping: spec.BlockDeviceMapping,
+		NetworkTier:        spec.NetworkTier,
+	})
+	hasher := fnv.New32a()
+	_, _ = hasher.Write(data)
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
+
+// partitionMachinesByTemplateHash splits the machines into those created from the template with the
+// given hash and out-of-date ones. Machines created before the hash label existed are compared by spec.
+func partitionMachinesByTemplateHash(machines []v1beta1.KTMachine, templateHash string) ([]v1beta1.KTMachine, []v1beta1.KTMachine) {
+	var newMachines, oldMachines []v1beta1.KTMachine
+	for _, machine := range machines {
+		machineHash, ok := machine.Labels[v1beta1.MachineTemplateHashLabel]
+		if !ok {
+			machineHash = machineTemplateHash(machine.Spec)
+		}
+		if machineHash == templateHash {
+			newMachines = append(newMachines, machine)
+		} else {
+			oldMachines = append(oldMachines, machine)
+		}
+	}
+	return newMachines, oldMachines
+}
+
+// rollingUpdateLimits resolves maxSurge and maxUnavailable of the deployment against its replicas.
+func rollingUpdateLimits(machineDeployment *v1beta1.MachineDeployment) (int, int) {
+	maxSurge := intstr.FromInt32(defaultMaxSurge)
+	maxUnavailable := intstr.FromInt32(defaultMaxUnavailable)
+	if strategy := machineDeployment.Spec.Strategy; strategy != nil && strategy.RollingUpdate != nil {
+		if strategy.RollingUpdate.MaxSurge != nil {
+			maxSurge = *strategy.RollingUpdate.MaxSurge
+		}
+		if strategy.RollingUpdate.MaxUnavailable != nil {
+			maxUnavailable = *strategy.RollingUpdate.MaxUnavailable
+		}
+	}
+
+	replicas := machineDeployment.Spec.Replicas
+	surge, err := intstr.GetScaledValueFromIntOrPercent(&maxSurge, replicas, true)
+	if err != nil || surge < 0 {
+		surge = defaultMaxSurge
+	}
+	unavailable, err := intstr.GetScaledValueFromIntOrPercent(&maxUnavailable, replicas, false)
+	if err != nil || unavailable < 0 {
+		unavailable = defaultMaxUnavailable
+	}
+	// the rollout could never make progress without either
+	if surge == 0 && unavailable == 0 {
+		unavailable = 1
+	}
+	return surge, unavailable
+}
+
+// planRollout returns how many machines to create from the current template and which out-of-date
+// machines to delete in this step of a rolling update. At most maxSurge machines exist above the
+// desired replicas and at most maxUnavailable of the desired replicas are not available.
+func planRollout(machineDeployment *v1beta1.MachineDeployment, newMachines, oldMachines []v1beta1.KTMachine) (int, []*v1beta1.KTMachine) {
+	replicas := machineDeployment.Spec.Replicas
+	maxSurge, maxUnavailable := rollingUpdateLimits(machineDeployment)
+	total := len(newMachines) + len(oldMachines)
+
+	machinesToCreate := 0
+	if len(newMachines) < replicas {
+		machinesToCreate = min(replicas-len(newMachines), replicas+maxSurge-total)
+		machinesToCreate = max(machinesToCreate, 0)
+	}
+
+	available := 0
+	for i := range newMachines {
+		if isMachineAvailable(&newMachines[i]) {
+			available++
+		}
+	}
+	for i := range oldMachines {
+		if isMachineAvailable(&oldMachines[i]) {
+			available++
+		}
+	}
+	deleteBudget := available - (replicas - maxUnavailable)
+
+	// out-of-date machines that are not available can go right away, they don't count towards availability
+	var machinesToDelete []*v1beta1.KTMachine
+	for _, machine := range selectMachinesToDelete(oldMachines, machineDeployment.Spec.DeletePolicy, len(oldMachines)) {
+		if !isMachineAvailable(machine) {
+			machinesToDelete = append(machinesToDelete, machine)
+		}
+	}
+	for _, machine := range selectMachinesToDelete(oldMachines, machineDeployment.Spec.DeletePolicy, len(oldMachines)) {
+		if deleteBudget <= 0 {
+			break
+		}
+		if isMachineAvailable(machine) {
+			machinesToDelete = append(machinesToDelete, machine)
+			deleteBudget--
+		}
+	}
+	return machinesToCreate, machinesToDelete
+}
+
+// recordTemplateRevision moves the status to a new revision when the template hash changed and
+// keeps the previous one in the revision history.
+func recordTemplateRevision(machineDeployment *v1beta1.MachineDeployment, templateHash string, now metav1.Time) {
+	status := &machineDeployment.Status
+	if status.TemplateHash == templateHash {
+		return
+	}
+
+	if status.TemplateHash != "" {
+		status.RevisionHistory = append(status.RevisionHistory, v1beta1.MachineDeploymentRevision{
+			Revision:     status.Revision,
+			TemplateHash: status.TemplateHash,
+			ReplacedAt:   now,
+		})
+	}
+	limit := defaultRevisionHistoryLimit
+	if machineDeployment.Spec.RevisionHistoryLimit != nil {
+		limit = int(*machineDeployment.Spec.RevisionHistoryLimit)
+	}
+	if len(status.RevisionHistory) > limit {
+		status.RevisionHistory = status.RevisionHistory[len(status.RevisionHistory)-limit:]
+	}
+	if len(status.RevisionHistory) == 0 {
+		status.RevisionHistory = nil
+	}
+
+	status.Revision++
+	status.TemplateHash = templateHash
+}
+
+// isMachineAvailable returns true if the server of the machine is up on KT Cloud.
+func isMachineAvailable(machine *v1beta1.KTMachine) bool {
+	return machine.Status.Ready
+}
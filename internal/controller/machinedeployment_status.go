@@ -0,0 +1,142 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/api/v1beta1"
+)
+
+// machineDeploymentSelectorLabels returns the labels every machine of the deployment carries.
+func machineDeploymentSelectorLabels(machineDeployment *v1beta1.MachineDeployment) map[string]string {
+	return map[string]string{
+		v1beta1.MachineDeploymentNameLabel: machineDeployment.Name,
+	}
+}
+
+// computeMachineDeploymentStatus fills in the replica counts, phase and conditions of the deployment
+// from the Ready status of its machines, split into machines of the current and of older templates.
+func computeMachineDeploymentStatus(machineDeployment *v1beta1.MachineDeployment, newMachines, oldMachines []v1beta1.KTMachine) {
+	status := &machineDeployment.Status
+	replicas := machineDeployment.Spec.Replicas
+	machines := append(append([]v1beta1.KTMachine{}, newMachines...), oldMachines...)
+
+	ready := 0
+	var unhealthy []string
+	for i := range machines {
+		if isMachineAvailable(&machines[i]) {
+			ready++
+		}
+		if isMachineUnhealthy(&machines[i]) {
+			unhealthy = append(unhealthy, machines[i].Name)
+		}
+	}
+
+	status.ObservedGeneration = machineDeployment.Generation
+	status.Selector = labels.SelectorFromSet(machineDeploymentSelectorLabels(machineDeployment)).String()
+	status.Replicas = len(machines)
+	status.UpdatedReplicas = len(newMachines)
+	status.ReadyReplicas = ready
+	status.AvailableReplicas = ready
+	status.UnavailableReplicas = max(replicas-ready, 0)
+
+	switch {
+	case len(unhealthy) > 0:
+		status.Phase = v1beta1.MachineDeploymentPhaseFailed
+	case len(machines) > replicas:
+		status.Phase = v1beta1.MachineDeploymentPhaseScalingDown
+	case len(machines) < replicas || ready < replicas:
+		status.Phase = v1beta1.MachineDeploymentPhaseScalingUp
+	default:
+		status.Phase = v1beta1.MachineDeploymentPhaseRunning
+	}
+
+	_, maxUnavailable := rollingUpdateLimits(machineDeployment)
+	available := metav1.Condition{
+		Type:    v1beta1.MachineDeploymentAvailableCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  v1beta1.MinimumReplicasAvailableReason,
+		Message: fmt.Sprintf("%d of %d machines are available", ready, replicas),
+	}
+	if ready < replicas-maxUnavailable {
+		available.Status = metav1.ConditionFalse
+		available.Reason = v1beta1.MinimumReplicasUnavailableReason
+	}
+	setMachineDeploymentCondition(machineDeployment, available)
+
+	progressing := metav1.Condition{
+		Type:    v1beta1.MachineDeploymentProgressingCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  v1beta1.NewMachinesAvailableReason,
+		Message: fmt.Sprintf("Revision %d is rolled out", status.Revision),
+	}
+	surplus := len(machines) - replicas
+	marked := len(machinesMarkedForDeletion(machines))
+	controlPlane := machineDeploymentRole(machineDeployment) == v1beta1.ControlPlaneMachineRole
+	var waitingForDeletion []string
+	if controlPlane && len(oldMachines) > 0 {
+		_, machinesToDelete := planRollout(machineDeployment, newMachines, oldMachines)
+		for _, machine := range machinesToDelete {
+			if _, ok := machine.Annotations[v1beta1.DeleteMachineAnnotation]; !ok {
+				waitingForDeletion = append(waitingForDeletion, machine.Name)
+			}
+		}
+	}
+	switch {
+	case len(waitingForDeletion) > 0:
+		progressing.Status = metav1.ConditionFalse
+		progressing.Reason = v1beta1.WaitingForDeleteMachineAnnotationReason
+		progressing.Message = fmt.Sprintf("%d of %d machines are updated to revision %d, out-of-date control plane machines %s wait for the %s annotation, set once their etcd members are removed",
+			len(newMachines), replicas, status.Revision, strings.Join(waitingForDeletion, ", "), v1beta1.DeleteMachineAnnotation)
+	case len(oldMachines) > 0:
+		progressing.Reason = v1beta1.RollingUpdateReason
+		progressing.Message = fmt.Sprintf("%d of %d machines are updated to revision %d", len(newMachines), replicas, status.Revision)
+	case controlPlane && marked < surplus:
+		// deleting a control plane machine would leave its etcd member behind
+		progressing.Status = metav1.ConditionFalse
+		progressing.Reason = v1beta1.WaitingForDeleteMachineAnnotationReason
+		progressing.Message = fmt.Sprintf("%d control plane machines above the desired replicas wait for the %s annotation, set once their etcd members are removed",
+			surplus-marked, v1beta1.DeleteMachineAnnotation)
+	case len(machines) != replicas || ready < replicas:
+		progressing.Reason = v1beta1.ScalingReason
+		progressing.Message = fmt.Sprintf("%d of %d machines are ready", ready, replicas)
+	}
+	setMachineDeploymentCondition(machineDeployment, progressing)
+
+	healthy := metav1.Condition{
+		Type:   v1beta1.MachineDeploymentMachinesHealthyCondition,
+		Status: metav1.ConditionTrue,
+		Reason: v1beta1.MachinesHealthyReason,
+	}
+	if len(unhealthy) > 0 {
+		healthy.Status = metav1.ConditionFalse
+		healthy.Reason = v1beta1.MachineErrorReason
+		healthy.Message = "Machines in error state: " + strings.Join(unhealthy, ", ")
+	}
+	setMachineDeploymentCondition(machineDeployment, healthy)
+}
+
+func setMachineDeploymentCondition(machineDeployment *v1beta1.MachineDeployment, condition metav1.Condition) {
+	condition.ObservedGeneration = machineDeployment.Generation
+	meta.SetStatusCondition(&machineDeployment.Status.Conditions, condition)
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ktcloud is a client for the KT Cloud open APIs used by the operator.
+// Read more at https://cloud.kt.com/docs/open-api-guide/d/guide/how-to-use
+package ktcloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/cloudapi"
+)
+
+// Client is a KT Cloud API client scoped to a zone and a subject token.
+// Controllers depend on this interface so they can be tested with the fake package.
+type Client interface {
+	Identity() IdentityService
+	Servers() ServerService
+	StaticNAT() StaticNATService
+	IPAddresses() IPAddressService
+	Firewall() FirewallService
+	PortForwarding() PortForwardingService
+	LoadBalancers() LoadBalancerService
+	Networks() NetworkService
+	SecurityGroups() SecurityGroupService
+}
+
+// Factory returns a Client for the given zone authenticating with the given subject token.
+// The token may be empty for calls that log in.
+type Factory func(zone, token string) Client
+
+// NewFactory returns a Factory creating clients for the API at config.ApiBaseURL.
+// All clients share one http.Client using config.RemoteBackendTimeout.
+func NewFactory(config cloudapi.Config) Factory {
+	httpClient := &http.Client{Timeout: config.RemoteBackendTimeout}
+	return func(zone, token string) Client {
+		return New(httpClient, config.ApiBaseURL, zone, token)
+	}
+}
+
+// New returns a Client for the API at baseURL.
+func New(httpClient *http.Client, baseURL, zone, token string) Client {
+	return &client{
+		httpClient: httpClient,
+		baseURL:    baseURL,
+		zone:       zone,
+		token:      token,
+	}
+}
+
+type client struct {
+	httpClient *http.Client
+	baseURL    string
+	zone       string
+	token      string
+}
+
+func (c *client) Identity() IdentityService             { return &identityService{c} }
+func (c *client) Servers() ServerService                { return &serverService{c} }
+func (c *client) StaticNAT() StaticNATService           { return &staticNATService{c} }
+func (c *client) IPAddresses() IPAddressService         { return &ipAddressService{c} }
+func (c *client) Firewall() FirewallService             { return &firewallService{c} }
+func (c *client) PortForwarding() PortForwardingService { return &portForwardingService{c} }
+func (c *client) LoadBalancers() LoadBalancerService    { return &loadBalancerService{c} }
+func (c *client) Networks() NetworkService              { return &networkService{c} }
+func (c *client) SecurityGroups() SecurityGroupService  { return &securityGroupService{c} }
+
+// do sends a request to path below the zone of the client. in is sent as JSON
+// when not nil, and a successful response body is decoded into out when not nil.
+func (c *client) do(ctx context.Context, method string, path []string, in, out any) (*http.Response, error) {
+	logger := log.FromContext(ctx, "LogFrom", "KTCloud")
+
+	apiURL, err := url.JoinPath(c.baseURL, append([]string{c.zone}, path...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build KT Cloud API url: %w", err)
+	}
+
+	var body io.Reader
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal KT Cloud API request: %w", err)
+		}
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create KT Cloud API request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("X-Auth-Token", c.token)
+	}
+
+	logger.V(1).Info("Sending KT Cloud API request", "Method", method, "URL", apiURL)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send KT Cloud API request %s %s: %w", method, apiURL, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read KT Cloud API response %s %s: %w", method, apiURL, err)
+	}
+	logger.V(1).Info("Got KT Cloud API response", "Method", method, "URL", apiURL, "Status", resp.Status)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &APIError{
+			Method:     method,
+			URL:        apiURL,
+			StatusCode: resp.StatusCode,
+			Body:       string(respBody),
+		}
+	}
+
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal KT Cloud API response %s %s: %w", method, apiURL, err)
+		}
+	}
+	return resp, nil
+}
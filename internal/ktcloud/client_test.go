@@ -0,0 +1,349 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ktcloud
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/cloudapi"
+)
+
+var _ = Describe("KT Cloud Client", func() {
+	var (
+		server   *httptest.Server
+		handler  http.HandlerFunc
+		requests []*http.Request
+		bodies   []string
+		factory  Factory
+	)
+
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		requests = nil
+		bodies = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			requests = append(requests, req)
+			bodies = append(bodies, string(body))
+			handler(w, req)
+		}))
+		factory = NewFactory(cloudapi.Config{ApiBaseURL: server.URL + "/", RemoteBackendTimeout: time.Second})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should log in and read the subject token from the response header", func() {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("X-Subject-Token", "subject-token")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(w, `{"token": {"expires_at": "2024-12-18T03:47:08.000000Z", "is_domain": false}}`)
+		}
+
+		token, err := factory("gd1", "").Identity().Login(ctx, cloudapi.Credentials{
+			Username:        "user",
+			Password:        "secret",
+			UserDomainId:    "default",
+			ProjectName:     "project",
+			ProjectDomainId: "default",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.SubjectToken).To(Equal("subject-token"))
+		Expect(token.ExpiresAt).To(Equal("2024-12-18T03:47:08.000000Z"))
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Method).To(Equal(http.MethodPost))
+		Expect(requests[0].URL.Path).To(Equal("/gd1/identity/auth/tokens"))
+		Expect(requests[0].Header.Get("X-Auth-Token")).To(BeEmpty())
+
+		var sent authRequest
+		Expect(json.Unmarshal([]byte(bodies[0]), &sent)).To(Succeed())
+		Expect(sent.Auth.Identity.Password.User.Name).To(Equal("user"))
+		Expect(sent.Auth.Scope.Project.Name).To(Equal("project"))
+	})
+
+	It("should send the token and decode created servers", func() {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = io.WriteString(w, `{"server": {"id": "server-1", "adminPass": "pass"}}`)
+		}
+
+		created, err := factory("gd1", "subject-token").Servers().Create(ctx, CreateServerOpts{Name: "machine"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(created.ID).To(Equal("server-1"))
+
+		Expect(requests[0].URL.Path).To(Equal("/gd1/server/servers"))
+		Expect(requests[0].Header.Get("X-Auth-Token")).To(Equal("subject-token"))
+		Expect(bodies[0]).To(ContainSubstring(`"name":"machine"`))
+	})
+
+	It("should list the availability zones of the server API", func() {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			_, _ = io.WriteString(w, `{"availabilityZoneInfo": [{"zoneName": "DX-M1", "zoneState": {"available": true}}, {"zoneName": "DX-M2", "zoneState": {"available": false}}]}`)
+		}
+
+		zones, err := factory("gd1", "subject-token").Servers().ListAvailabilityZones(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(zones).To(HaveLen(2))
+		Expect(zones[0].Name).To(Equal("DX-M1"))
+		Expect(zones[0].State.Available).To(BeTrue())
+		Expect(zones[1].State.Available).To(BeFalse())
+		Expect(requests[0].URL.Path).To(Equal("/gd1/server/os-availability-zone"))
+	})
+
+	It("should send server metadata and list servers with their metadata", func() {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodPost {
+				_, _ = io.WriteString(w, `{"server": {"id": "server-1"}}`)
+				return
+			}
+			_, _ = io.WriteString(w, `{"servers": [{"id": "server-1", "name": "machine", "status": "ACTIVE", "metadata": {"machine-uid": "uid-1"}}]}`)
+		}
+
+		cloud := factory("gd1", "subject-token")
+		_, err := cloud.Servers().Create(ctx, CreateServerOpts{Name: "machine", Metadata: map[string]string{"machine-uid": "uid-1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bodies[0]).To(ContainSubstring(`"metadata":{"machine-uid":"uid-1"}`))
+
+		servers, err := cloud.Servers().List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(servers).To(HaveLen(1))
+		Expect(servers[0].ID).To(Equal("server-1"))
+		Expect(servers[0].Metadata).To(HaveKeyWithValue("machine-uid", "uid-1"))
+		Expect(requests[1].Method).To(Equal(http.MethodGet))
+		Expect(requests[1].URL.Path).To(Equal("/gd1/server/servers/detail"))
+
+		Expect(cloud.Servers().SetMetadata(ctx, "server-1", map[string]string{"machine-uid": "uid-2"})).To(Succeed())
+		Expect(requests[2].Method).To(Equal(http.MethodPost))
+		Expect(requests[2].URL.Path).To(Equal("/gd1/server/servers/server-1/metadata"))
+		Expect(bodies[2]).To(MatchJSON(`{"metadata": {"machine-uid": "uid-2"}}`))
+	})
+
+	It("should return errors satisfying IsNotFound for missing servers", func() {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"itemNotFound": {"message": "Instance could not be found", "code": 404}}`)
+		}
+
+		_, err := factory("gd1", "subject-token").Servers().Get(ctx, "missing")
+		Expect(err).To(HaveOccurred())
+		Expect(IsNotFound(err)).To(BeTrue())
+		Expect(IsUnauthorized(err)).To(BeFalse())
+		Expect(requests[0].URL.Path).To(Equal("/gd1/server/servers/missing"))
+	})
+
+	It("should delete servers and disable static NAT by ID", func() {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/gd1/server/servers/server-1" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			_, _ = io.WriteString(w, `{"nc_disablestaticnatresponse": {"displaytext": "", "success": true}}`)
+		}
+
+		cloud := factory("gd1", "subject-token")
+		Expect(cloud.StaticNAT().Disable(ctx, "static-nat-1")).To(Succeed())
+		Expect(cloud.Servers().Delete(ctx, "server-1")).To(Succeed())
+
+		Expect(requests).To(HaveLen(2))
+		Expect(requests[0].Method).To(Equal(http.MethodDelete))
+		Expect(requests[0].URL.Path).To(Equal("/gd1/nc/StaticNat/static-nat-1"))
+		Expect(requests[1].Method).To(Equal(http.MethodDelete))
+		Expect(requests[1].URL.Path).To(Equal("/gd1/server/servers/server-1"))
+	})
+
+	It("should allocate and release public IPs", func() {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodPost {
+				_, _ = io.WriteString(w, `{"nc_associateentpublicipresponse": {"id": "ip-1", "displaytext": "", "success": true}}`)
+				return
+			}
+			_, _ = io.WriteString(w, `{"nc_disassociateentpublicipresponse": {"displaytext": "", "success": true}}`)
+		}
+
+		cloud := factory("gd1", "subject-token")
+		id, err := cloud.IPAddresses().Allocate(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("ip-1"))
+		Expect(cloud.IPAddresses().Release(ctx, id)).To(Succeed())
+
+		Expect(requests).To(HaveLen(2))
+		Expect(requests[0].Method).To(Equal(http.MethodPost))
+		Expect(requests[0].URL.Path).To(Equal("/gd1/nc/IpAddress"))
+		Expect(requests[1].Method).To(Equal(http.MethodDelete))
+		Expect(requests[1].URL.Path).To(Equal("/gd1/nc/IpAddress/ip-1"))
+	})
+
+	It("should create, list and delete port forwarding rules", func() {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			switch req.Method {
+			case http.MethodPost:
+				_, _ = io.WriteString(w, `{"nc_createportforwardingruleresponse": {"id": "pf-1", "displaytext": "", "success": true}}`)
+			case http.MethodGet:
+				_, _ = io.WriteString(w, `{"nc_listportforwardingrulesresponse": {"portforwardingrules": [{"id": "pf-1", "virtualipid": "vip-1", "publicport": "6444", "privateport": "6443"}]}}`)
+			default:
+				_, _ = io.WriteString(w, `{"nc_deleteportforwardingruleresponse": {"displaytext": "", "success": true}}`)
+			}
+		}
+
+		cloud := factory("gd1", "subject-token")
+		id, err := cloud.PortForwarding().Create(ctx, CreatePortForwardingRuleOpts{
+			EntPublicIPId: "ip-1",
+			PublicPort:    "6444",
+			PrivatePort:   "6443",
+			Protocol:      "TCP",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("pf-1"))
+		rules, err := cloud.PortForwarding().List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rules).To(ConsistOf(HaveField("VirtualIPId", "vip-1")))
+		Expect(cloud.PortForwarding().Delete(ctx, id)).To(Succeed())
+
+		Expect(requests).To(HaveLen(3))
+		Expect(requests[0].URL.Path).To(Equal("/gd1/nc/PortForwarding"))
+		Expect(bodies[0]).To(ContainSubstring(`"publicport":"6444"`))
+		Expect(requests[2].Method).To(Equal(http.MethodDelete))
+		Expect(requests[2].URL.Path).To(Equal("/gd1/nc/PortForwarding/pf-1"))
+	})
+
+	It("should create load balancers and register servers with them", func() {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			switch {
+			case req.Method == http.MethodPost && req.URL.Path == "/gd1/nc/LoadBalancer":
+				_, _ = io.WriteString(w, `{"nc_createloadbalancerresponse": {"id": "lb-1", "displaytext": "", "success": true}}`)
+			case req.Method == http.MethodPost:
+				_, _ = io.WriteString(w, `{"nc_addloadbalancerwebserverresponse": {"serviceid": "service-1", "displaytext": "", "success": true}}`)
+			case req.Method == http.MethodGet:
+				_, _ = io.WriteString(w, `{"nc_listloadbalancerwebserversresponse": {"loadbalancerwebservers": [{"serviceid": "service-1", "vmid": "server-1"}]}}`)
+			default:
+				_, _ = io.WriteString(w, `{"nc_removeloadbalancerwebserverresponse": {"displaytext": "", "success": true}}`)
+			}
+		}
+
+		cloud := factory("gd1", "subject-token")
+		id, err := cloud.LoadBalancers().Create(ctx, CreateLoadBalancerOpts{Name: "edge01-apiserver", ServicePort: "6443"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("lb-1"))
+		serviceID, err := cloud.LoadBalancers().AddServer(ctx, id, AddLoadBalancerServerOpts{VMID: "server-1", PublicPort: "6443"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(serviceID).To(Equal("service-1"))
+		servers, err := cloud.LoadBalancers().ListServers(ctx, id)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(servers).To(ConsistOf(HaveField("VMID", "server-1")))
+		Expect(cloud.LoadBalancers().RemoveServer(ctx, id, serviceID)).To(Succeed())
+
+		Expect(requests).To(HaveLen(4))
+		Expect(bodies[0]).To(ContainSubstring(`"serviceport":"6443"`))
+		Expect(requests[1].URL.Path).To(Equal("/gd1/nc/LoadBalancer/lb-1/WebServer"))
+		Expect(requests[3].Method).To(Equal(http.MethodDelete))
+		Expect(requests[3].URL.Path).To(Equal("/gd1/nc/LoadBalancer/lb-1/WebServer/service-1"))
+	})
+
+	It("should create, list and delete tier networks", func() {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			switch req.Method {
+			case http.MethodPost:
+				_, _ = io.WriteString(w, `{"nc_createnetworkresponse": {"id": "network-1", "displaytext": "", "success": true}}`)
+			case http.MethodGet:
+				_, _ = io.WriteString(w, `{"nc_listnetworksresponse": {"networks": [{"id": "network-1", "name": "edge01-tier-0", "cidr": "10.6.0.0/24", "type": "tier"}]}}`)
+			default:
+				_, _ = io.WriteString(w, `{"nc_deletenetworkresponse": {"displaytext": "", "success": true}}`)
+			}
+		}
+
+		cloud := factory("gd1", "subject-token")
+		id, err := cloud.Networks().Create(ctx, CreateNetworkOpts{Name: "edge01-tier-0", CIDR: "10.6.0.0/24", Type: "tier"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("network-1"))
+		networks, err := cloud.Networks().List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(networks).To(ConsistOf(HaveField("CIDR", "10.6.0.0/24")))
+		Expect(cloud.Networks().Delete(ctx, id)).To(Succeed())
+
+		Expect(requests).To(HaveLen(3))
+		Expect(requests[0].URL.Path).To(Equal("/gd1/nc/Network"))
+		Expect(bodies[0]).To(ContainSubstring(`"cidr":"10.6.0.0/24"`))
+		Expect(requests[2].URL.Path).To(Equal("/gd1/nc/Network/network-1"))
+	})
+
+	It("should manage security groups and their rules", func() {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			switch {
+			case req.Method == http.MethodPost && req.URL.Path == "/gd1/network/security-groups":
+				_, _ = io.WriteString(w, `{"security_group": {"id": "sg-1", "name": "edge01-controlplane"}}`)
+			case req.Method == http.MethodPost:
+				_, _ = io.WriteString(w, `{"security_group_rule": {"id": "rule-1", "security_group_id": "sg-1", "direction": "ingress", "protocol": "tcp", "port_range_min": 6443, "port_range_max": 6443}}`)
+			case req.Method == http.MethodGet:
+				_, _ = io.WriteString(w, `{"security_groups": [{"id": "sg-1", "name": "edge01-controlplane", "security_group_rules": [{"id": "rule-1", "direction": "ingress"}]}]}`)
+			default:
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}
+
+		cloud := factory("gd1", "subject-token")
+		group, err := cloud.SecurityGroups().Create(ctx, CreateSecurityGroupOpts{Name: "edge01-controlplane"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(group.ID).To(Equal("sg-1"))
+		rule, err := cloud.SecurityGroups().CreateRule(ctx, CreateSecurityGroupRuleOpts{
+			SecurityGroupID: group.ID, Direction: "ingress", Protocol: "tcp", PortRangeMin: 6443, PortRangeMax: 6443,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rule.PortRangeMin).To(Equal(6443))
+		groups, err := cloud.SecurityGroups().List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(groups).To(ConsistOf(HaveField("Rules", ConsistOf(HaveField("ID", "rule-1")))))
+		Expect(cloud.SecurityGroups().DeleteRule(ctx, rule.ID)).To(Succeed())
+		Expect(cloud.SecurityGroups().Delete(ctx, group.ID)).To(Succeed())
+
+		Expect(requests).To(HaveLen(5))
+		Expect(bodies[0]).To(ContainSubstring(`"security_group":{"name":"edge01-controlplane"}`))
+		Expect(bodies[1]).To(ContainSubstring(`"port_range_min":6443`))
+		Expect(requests[3].URL.Path).To(Equal("/gd1/network/security-group-rules/rule-1"))
+		Expect(requests[4].URL.Path).To(Equal("/gd1/network/security-groups/sg-1"))
+	})
+
+	It("should return an OperationError when a nc call is unsuccessful", func() {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			_, _ = io.WriteString(w, `{"nc_enablestaticnatresponse": {"displaytext": "ip in use", "success": false}}`)
+		}
+
+		err := factory("gd1", "subject-token").StaticNAT().Enable(ctx, EnableStaticNATOpts{EntPublicIPId: "ip-1"})
+		var operationErr *OperationError
+		Expect(err).To(BeAssignableToTypeOf(operationErr))
+		Expect(err.Error()).To(ContainSubstring("ip in use"))
+	})
+
+	It("should give up after the remote backend timeout", func() {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			time.Sleep(2 * time.Second)
+		}
+
+		_, err := factory("gd1", "subject-token").IPAddresses().List(ctx)
+		Expect(err).To(HaveOccurred())
+	})
+})
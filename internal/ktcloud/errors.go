@@ -0,0 +1,61 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ktcloud
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// APIError is returned when the KT Cloud API answers with a non 2xx status.
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("KT Cloud API request %s %s failed with status %d: %s", e.Method, e.URL, e.StatusCode, e.Body)
+}
+
+// OperationError is returned when a network (nc) API call is answered with
+// success=false, which KT Cloud does with a 2xx status.
+type OperationError struct {
+	Operation   string
+	DisplayText string
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("KT Cloud operation %s failed: %s", e.Operation, e.DisplayText)
+}
+
+// IsNotFound returns true if err is an APIError with status 404.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsUnauthorized returns true if err is an APIError with status 401, usually an expired token.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+func hasStatus(err error, statusCode int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == statusCode
+}
@@ -0,0 +1,759 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fake provides an in-memory ktcloud.Client for tests.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/cloudapi"
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/ktcloud"
+)
+
+// Cloud is the state shared by all clients of a fake Factory.
+// Tests seed and inspect the exported fields directly, but not while a reconcile is running.
+type Cloud struct {
+	mu sync.Mutex
+
+	// TokenLifetime is how long tokens issued by Login are valid
+	TokenLifetime time.Duration
+	// Logins counts the calls to Login
+	Logins int
+
+	Servers       map[string]*ktcloud.Server
+	PublicIPs     []ktcloud.PublicIP
+	FirewallRules map[string]*ktcloud.FirewallRule
+	// FirewallRuleCreates counts the calls to Firewall().Create
+	FirewallRuleCreates int
+	// FirewallRuleListDelay is how many calls to Firewall().List leave out a newly created rule,
+	// like KT Cloud listing rules a while after creating them
+	FirewallRuleListDelay int
+	// AvailabilityZones are listed by the server API
+	AvailabilityZones []ktcloud.AvailabilityZone
+	// PortForwardingRules are also listed as virtual IPs on their public IP
+	PortForwardingRules map[string]*ktcloud.PortForwardingRule
+
+	LoadBalancers map[string]*ktcloud.LoadBalancer
+	// LoadBalancerServers are the servers registered with each load balancer, by load balancer ID
+	LoadBalancerServers map[string][]ktcloud.LoadBalancerServer
+
+	Networks map[string]*ktcloud.Network
+	// SecurityGroups hold their rules, new groups start with the egress rules the API adds
+	SecurityGroups map[string]*ktcloud.SecurityGroup
+
+	nextID int
+	// unlistedFirewallRules are the remaining List calls leaving out each new rule
+	unlistedFirewallRules map[string]int
+}
+
+// New returns an empty fake cloud.
+func New() *Cloud {
+	return &Cloud{
+		TokenLifetime: time.Hour,
+		Servers:       map[string]*ktcloud.Server{},
+		FirewallRules: map[string]*ktcloud.FirewallRule{},
+
+		PortForwardingRules: map[string]*ktcloud.PortForwardingRule{},
+		LoadBalancers:       map[string]*ktcloud.LoadBalancer{},
+		LoadBalancerServers: map[string][]ktcloud.LoadBalancerServer{},
+		Networks:            map[string]*ktcloud.Network{},
+		SecurityGroups:      map[string]*ktcloud.SecurityGroup{},
+	}
+}
+
+// Factory returns a ktcloud.Factory whose clients all operate on this cloud.
+func (c *Cloud) Factory() ktcloud.Factory {
+	return func(zone, token string) ktcloud.Client {
+		return &client{cloud: c, zone: zone, token: token}
+	}
+}
+
+func (c *Cloud) newID(prefix string) string {
+	c.nextID++
+	return fmt.Sprintf("%s-%d", prefix, c.nextID)
+}
+
+type client struct {
+	cloud *Cloud
+	zone  string
+	token string
+}
+
+func (c *client) Identity() ktcloud.IdentityService             { return c }
+func (c *client) Servers() ktcloud.ServerService                { return &servers{c} }
+func (c *client) StaticNAT() ktcloud.StaticNATService           { return &staticNAT{c} }
+func (c *client) IPAddresses() ktcloud.IPAddressService         { return &ipAddresses{c} }
+func (c *client) Firewall() ktcloud.FirewallService             { return &firewall{c} }
+func (c *client) PortForwarding() ktcloud.PortForwardingService { return &portForwarding{c} }
+func (c *client) LoadBalancers() ktcloud.LoadBalancerService    { return &loadBalancers{c} }
+func (c *client) Networks() ktcloud.NetworkService              { return &networks{c} }
+func (c *client) SecurityGroups() ktcloud.SecurityGroupService  { return &securityGroups{c} }
+
+func (c *client) Login(_ context.Context, credentials cloudapi.Credentials) (*ktcloud.Token, error) {
+	c.cloud.mu.Lock()
+	defer c.cloud.mu.Unlock()
+
+	if credentials.Username == "" || credentials.Password == "" {
+		return nil, apiError(http.StatusUnauthorized, "login")
+	}
+	c.cloud.Logins++
+	return &ktcloud.Token{
+		SubjectToken: c.cloud.newID("token"),
+		ExpiresAt:    time.Now().Add(c.cloud.TokenLifetime).UTC().Format("2006-01-02T15:04:05.000000Z"),
+	}, nil
+}
+
+// authorize returns a 401 error for clients without a token like the real API
+func (c *client) authorize() error {
+	if c.token == "" {
+		return apiError(http.StatusUnauthorized, "token")
+	}
+	return nil
+}
+
+func apiError(statusCode int, what string) error {
+	return &ktcloud.APIError{Method: "FAKE", URL: what, StatusCode: statusCode}
+}
+
+type servers struct{ *client }
+
+func (s *servers) Create(_ context.Context, opts ktcloud.CreateServerOpts) (*ktcloud.Server, error) {
+	if err := s.authorize(); err != nil {
+		return nil, err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	server := &ktcloud.Server{
+		ID:               s.cloud.newID("server"),
+		Name:             opts.Name,
+		Status:           "BUILD",
+		KeyName:          opts.KeyName,
+		AvailabilityZone: opts.AvailabilityZone,
+		Addresses:        map[string][]ktcloud.ServerAddress{},
+		Metadata:         opts.Metadata,
+	}
+	for _, group := range opts.SecurityGroups {
+		server.SecurityGroups = append(server.SecurityGroups, ktcloud.SecurityGroup{Name: group.Name})
+	}
+	for i, network := range opts.Networks {
+		server.Addresses[network.UUID] = []ktcloud.ServerAddress{{
+			Addr:    fmt.Sprintf("172.25.%d.%d", i, s.cloud.nextID),
+			Version: 4,
+		}}
+	}
+	s.cloud.Servers[server.ID] = server
+	copied := *server
+	return &copied, nil
+}
+
+func (s *servers) Get(_ context.Context, id string) (*ktcloud.Server, error) {
+	if err := s.authorize(); err != nil {
+		return nil, err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	server, ok := s.cloud.Servers[id]
+	if !ok {
+		return nil, apiError(http.StatusNotFound, "server "+id)
+	}
+	copied := *server
+	return &copied, nil
+}
+
+func (s *servers) List(_ context.Context) ([]ktcloud.Server, error) {
+	if err := s.authorize(); err != nil {
+		return nil, err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	servers := make([]ktcloud.Server, 0, len(s.cloud.Servers))
+	for _, server := range s.cloud.Servers {
+		servers = append(servers, *server)
+	}
+	return servers, nil
+}
+
+func (s *servers) Delete(_ context.Context, id string) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	if _, ok := s.cloud.Servers[id]; !ok {
+		return apiError(http.StatusNotFound, "server "+id)
+	}
+	delete(s.cloud.Servers, id)
+	return nil
+}
+
+func (s *servers) SetMetadata(_ context.Context, id string, metadata map[string]string) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	server, ok := s.cloud.Servers[id]
+	if !ok {
+		return apiError(http.StatusNotFound, "server "+id)
+	}
+	merged := map[string]string{}
+	for key, value := range server.Metadata {
+		merged[key] = value
+	}
+	for key, value := range metadata {
+		merged[key] = value
+	}
+	server.Metadata = merged
+	return nil
+}
+
+func (s *servers) ListAvailabilityZones(_ context.Context) ([]ktcloud.AvailabilityZone, error) {
+	if err := s.authorize(); err != nil {
+		return nil, err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	return slices.Clone(s.cloud.AvailabilityZones), nil
+}
+
+type staticNAT struct{ *client }
+
+func (s *staticNAT) Enable(_ context.Context, opts ktcloud.EnableStaticNATOpts) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	for i := range s.cloud.PublicIPs {
+		publicIP := &s.cloud.PublicIPs[i]
+		if publicIP.Id != opts.EntPublicIPId {
+			continue
+		}
+		if !publicIP.IsAvailable() {
+			return &ktcloud.OperationError{Operation: "EnableStaticNat", DisplayText: "public ip is already in use"}
+		}
+		publicIP.VirtualIps = append(publicIP.VirtualIps, ktcloud.VirtualIP{
+			Id:          s.cloud.newID("virtualip"),
+			VMGuestIP:   opts.VMGuestIP,
+			NetworkId:   opts.VMNetworkId,
+			IPAddress:   publicIP.IP,
+			IPAddressId: publicIP.Id,
+		})
+		return nil
+	}
+	return &ktcloud.OperationError{Operation: "EnableStaticNat", DisplayText: "public ip not found"}
+}
+
+func (s *staticNAT) Disable(_ context.Context, id string) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	for i := range s.cloud.PublicIPs {
+		publicIP := &s.cloud.PublicIPs[i]
+		for j, virtualIP := range publicIP.VirtualIps {
+			if virtualIP.Id == id {
+				publicIP.VirtualIps = append(publicIP.VirtualIps[:j], publicIP.VirtualIps[j+1:]...)
+				return nil
+			}
+		}
+	}
+	return &ktcloud.OperationError{Operation: "DisableStaticNat", DisplayText: "static nat not found"}
+}
+
+type ipAddresses struct{ *client }
+
+func (s *ipAddresses) List(_ context.Context) ([]ktcloud.PublicIP, error) {
+	if err := s.authorize(); err != nil {
+		return nil, err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	return append([]ktcloud.PublicIP(nil), s.cloud.PublicIPs...), nil
+}
+
+func (s *ipAddresses) Allocate(_ context.Context) (string, error) {
+	if err := s.authorize(); err != nil {
+		return "", err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	id := s.cloud.newID("ip")
+	s.cloud.PublicIPs = append(s.cloud.PublicIPs, ktcloud.PublicIP{
+		Id:     id,
+		IP:     fmt.Sprintf("211.0.%d.%d", s.cloud.nextID/256, s.cloud.nextID%256),
+		Type:   "ASSOCIATE",
+		ZoneId: s.zone,
+	})
+	return id, nil
+}
+
+func (s *ipAddresses) Release(_ context.Context, id string) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	for i, publicIP := range s.cloud.PublicIPs {
+		if publicIP.Id != id {
+			continue
+		}
+		if len(publicIP.VirtualIps) > 0 {
+			return &ktcloud.OperationError{Operation: "DisassociateEntPublicIp", DisplayText: "public ip is in use"}
+		}
+		s.cloud.PublicIPs = append(s.cloud.PublicIPs[:i], s.cloud.PublicIPs[i+1:]...)
+		return nil
+	}
+	return apiError(http.StatusNotFound, "public ip "+id)
+}
+
+type firewall struct{ *client }
+
+func (s *firewall) Create(_ context.Context, opts ktcloud.CreateFirewallRuleOpts) (string, error) {
+	if err := s.authorize(); err != nil {
+		return "", err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	rule := &ktcloud.FirewallRule{
+		ID:           s.cloud.newID("firewall"),
+		StartPort:    opts.StartPort,
+		EndPort:      opts.EndPort,
+		Protocol:     opts.Protocol,
+		Action:       opts.Action,
+		VirtualIPID:  opts.VirtualIPID,
+		SrcNetworkID: opts.SrcNetworkID,
+		DstIP:        opts.DstIP,
+		DstNetworkID: opts.DstNetworkID,
+		State:        "Active",
+	}
+	s.cloud.FirewallRules[rule.ID] = rule
+	s.cloud.FirewallRuleCreates++
+	if s.cloud.FirewallRuleListDelay > 0 {
+		if s.cloud.unlistedFirewallRules == nil {
+			s.cloud.unlistedFirewallRules = map[string]int{}
+		}
+		s.cloud.unlistedFirewallRules[rule.ID] = s.cloud.FirewallRuleListDelay
+	}
+	return rule.ID, nil
+}
+
+func (s *firewall) List(_ context.Context) ([]ktcloud.FirewallRule, error) {
+	if err := s.authorize(); err != nil {
+		return nil, err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	rules := make([]ktcloud.FirewallRule, 0, len(s.cloud.FirewallRules))
+	for _, rule := range s.cloud.FirewallRules {
+		if s.cloud.unlistedFirewallRules[rule.ID] > 0 {
+			s.cloud.unlistedFirewallRules[rule.ID]--
+			continue
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, nil
+}
+
+func (s *firewall) Delete(_ context.Context, id string) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	if _, ok := s.cloud.FirewallRules[id]; !ok {
+		return apiError(http.StatusNotFound, "firewall rule "+id)
+	}
+	delete(s.cloud.FirewallRules, id)
+	return nil
+}
+
+type portForwarding struct{ *client }
+
+func (s *portForwarding) Create(_ context.Context, opts ktcloud.CreatePortForwardingRuleOpts) (string, error) {
+	if err := s.authorize(); err != nil {
+		return "", err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	for i := range s.cloud.PublicIPs {
+		publicIP := &s.cloud.PublicIPs[i]
+		if publicIP.Id != opts.EntPublicIPId {
+			continue
+		}
+		for _, virtualIP := range publicIP.VirtualIps {
+			rule := s.ruleOfVirtualIP(virtualIP.Id)
+			if rule == nil {
+				return "", &ktcloud.OperationError{Operation: "CreatePortForwardingRule", DisplayText: "public ip is used by static nat"}
+			}
+			if rule.PublicPort == opts.PublicPort && rule.Protocol == opts.Protocol {
+				return "", &ktcloud.OperationError{Operation: "CreatePortForwardingRule", DisplayText: "public port is already forwarded"}
+			}
+		}
+		rule := &ktcloud.PortForwardingRule{
+			ID:          s.cloud.newID("portforwarding"),
+			VirtualIPId: s.cloud.newID("virtualip"),
+			IPAddressId: publicIP.Id,
+			IPAddress:   publicIP.IP,
+			VMGuestIP:   opts.VMGuestIP,
+			VMNetworkId: opts.VMNetworkId,
+			PublicPort:  opts.PublicPort,
+			PrivatePort: opts.PrivatePort,
+			Protocol:    opts.Protocol,
+		}
+		publicIP.VirtualIps = append(publicIP.VirtualIps, ktcloud.VirtualIP{
+			Id:          rule.VirtualIPId,
+			VMGuestIP:   opts.VMGuestIP,
+			NetworkId:   opts.VMNetworkId,
+			IPAddress:   publicIP.IP,
+			IPAddressId: publicIP.Id,
+		})
+		s.cloud.PortForwardingRules[rule.ID] = rule
+		return rule.ID, nil
+	}
+	return "", &ktcloud.OperationError{Operation: "CreatePortForwardingRule", DisplayText: "public ip not found"}
+}
+
+func (s *portForwarding) List(_ context.Context) ([]ktcloud.PortForwardingRule, error) {
+	if err := s.authorize(); err != nil {
+		return nil, err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	rules := make([]ktcloud.PortForwardingRule, 0, len(s.cloud.PortForwardingRules))
+	for _, rule := range s.cloud.PortForwardingRules {
+		rules = append(rules, *rule)
+	}
+	return rules, nil
+}
+
+func (s *portForwarding) Delete(_ context.Context, id string) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	rule, ok := s.cloud.PortForwardingRules[id]
+	if !ok {
+		return apiError(http.StatusNotFound, "port forwarding rule "+id)
+	}
+	for i := range s.cloud.PublicIPs {
+		publicIP := &s.cloud.PublicIPs[i]
+		publicIP.VirtualIps = slices.DeleteFunc(publicIP.VirtualIps, func(virtualIP ktcloud.VirtualIP) bool {
+			return virtualIP.Id == rule.VirtualIPId
+		})
+	}
+	delete(s.cloud.PortForwardingRules, id)
+	return nil
+}
+
+// ruleOfVirtualIP returns the port forwarding rule listed as the virtual IP, nil for a static NAT
+func (s *portForwarding) ruleOfVirtualIP(id string) *ktcloud.PortForwardingRule {
+	for _, rule := range s.cloud.PortForwardingRules {
+		if rule.VirtualIPId == id {
+			return rule
+		}
+	}
+	return nil
+}
+
+type loadBalancers struct{ *client }
+
+func (s *loadBalancers) Create(_ context.Context, opts ktcloud.CreateLoadBalancerOpts) (string, error) {
+	if err := s.authorize(); err != nil {
+		return "", err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	id := s.cloud.newID("loadbalancer")
+	s.cloud.LoadBalancers[id] = &ktcloud.LoadBalancer{
+		ID:              id,
+		Name:            opts.Name,
+		NetworkID:       opts.NetworkID,
+		ServiceIP:       fmt.Sprintf("172.25.%d.%d", s.cloud.nextID/256, s.cloud.nextID%256),
+		ServicePort:     opts.ServicePort,
+		HealthCheckType: opts.HealthCheckType,
+		State:           "Active",
+	}
+	return id, nil
+}
+
+func (s *loadBalancers) List(_ context.Context) ([]ktcloud.LoadBalancer, error) {
+	if err := s.authorize(); err != nil {
+		return nil, err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	loadBalancers := make([]ktcloud.LoadBalancer, 0, len(s.cloud.LoadBalancers))
+	for _, loadBalancer := range s.cloud.LoadBalancers {
+		loadBalancers = append(loadBalancers, *loadBalancer)
+	}
+	return loadBalancers, nil
+}
+
+func (s *loadBalancers) Delete(_ context.Context, id string) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	if _, ok := s.cloud.LoadBalancers[id]; !ok {
+		return apiError(http.StatusNotFound, "load balancer "+id)
+	}
+	delete(s.cloud.LoadBalancers, id)
+	delete(s.cloud.LoadBalancerServers, id)
+	return nil
+}
+
+func (s *loadBalancers) AddServer(_ context.Context, loadBalancerID string, opts ktcloud.AddLoadBalancerServerOpts) (string, error) {
+	if err := s.authorize(); err != nil {
+		return "", err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	if _, ok := s.cloud.LoadBalancers[loadBalancerID]; !ok {
+		return "", apiError(http.StatusNotFound, "load balancer "+loadBalancerID)
+	}
+	server := ktcloud.LoadBalancerServer{
+		ID:         s.cloud.newID("loadbalancerserver"),
+		VMID:       opts.VMID,
+		IPAddress:  opts.IPAddress,
+		PublicPort: opts.PublicPort,
+		State:      "UP",
+	}
+	s.cloud.LoadBalancerServers[loadBalancerID] = append(s.cloud.LoadBalancerServers[loadBalancerID], server)
+	return server.ID, nil
+}
+
+func (s *loadBalancers) ListServers(_ context.Context, loadBalancerID string) ([]ktcloud.LoadBalancerServer, error) {
+	if err := s.authorize(); err != nil {
+		return nil, err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	if _, ok := s.cloud.LoadBalancers[loadBalancerID]; !ok {
+		return nil, apiError(http.StatusNotFound, "load balancer "+loadBalancerID)
+	}
+	return slices.Clone(s.cloud.LoadBalancerServers[loadBalancerID]), nil
+}
+
+func (s *loadBalancers) RemoveServer(_ context.Context, loadBalancerID, id string) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	servers := s.cloud.LoadBalancerServers[loadBalancerID]
+	i := slices.IndexFunc(servers, func(server ktcloud.LoadBalancerServer) bool { return server.ID == id })
+	if i < 0 {
+		return apiError(http.StatusNotFound, "load balancer server "+id)
+	}
+	s.cloud.LoadBalancerServers[loadBalancerID] = slices.Delete(servers, i, i+1)
+	return nil
+}
+
+type networks struct{ *client }
+
+func (s *networks) Create(_ context.Context, opts ktcloud.CreateNetworkOpts) (string, error) {
+	if err := s.authorize(); err != nil {
+		return "", err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	for _, network := range s.cloud.Networks {
+		if network.CIDR == opts.CIDR {
+			return "", apiError(http.StatusConflict, "network with cidr "+opts.CIDR)
+		}
+	}
+	id := s.cloud.newID("network")
+	s.cloud.Networks[id] = &ktcloud.Network{
+		ID:             id,
+		Name:           opts.Name,
+		CIDR:           opts.CIDR,
+		Type:           opts.Type,
+		DNSNameServers: opts.DNSNameServers,
+	}
+	return id, nil
+}
+
+func (s *networks) List(_ context.Context) ([]ktcloud.Network, error) {
+	if err := s.authorize(); err != nil {
+		return nil, err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	networks := make([]ktcloud.Network, 0, len(s.cloud.Networks))
+	for _, network := range s.cloud.Networks {
+		networks = append(networks, *network)
+	}
+	return networks, nil
+}
+
+func (s *networks) Delete(_ context.Context, id string) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	if _, ok := s.cloud.Networks[id]; !ok {
+		return apiError(http.StatusNotFound, "network "+id)
+	}
+	delete(s.cloud.Networks, id)
+	return nil
+}
+
+type securityGroups struct{ *client }
+
+func (s *securityGroups) Create(_ context.Context, opts ktcloud.CreateSecurityGroupOpts) (*ktcloud.SecurityGroup, error) {
+	if err := s.authorize(); err != nil {
+		return nil, err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	group := &ktcloud.SecurityGroup{
+		ID:          s.cloud.newID("securitygroup"),
+		Name:        opts.Name,
+		Description: opts.Description,
+	}
+	for _, etherType := range []string{"IPv4", "IPv6"} {
+		group.Rules = append(group.Rules, ktcloud.SecurityGroupRule{
+			ID:              s.cloud.newID("securitygrouprule"),
+			SecurityGroupID: group.ID,
+			Direction:       "egress",
+			EtherType:       etherType,
+		})
+	}
+	s.cloud.SecurityGroups[group.ID] = group
+	copied := *group
+	copied.Rules = slices.Clone(group.Rules)
+	return &copied, nil
+}
+
+func (s *securityGroups) List(_ context.Context) ([]ktcloud.SecurityGroup, error) {
+	if err := s.authorize(); err != nil {
+		return nil, err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	groups := make([]ktcloud.SecurityGroup, 0, len(s.cloud.SecurityGroups))
+	for _, group := range s.cloud.SecurityGroups {
+		copied := *group
+		copied.Rules = slices.Clone(group.Rules)
+		groups = append(groups, copied)
+	}
+	return groups, nil
+}
+
+func (s *securityGroups) Delete(_ context.Context, id string) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	group, ok := s.cloud.SecurityGroups[id]
+	if !ok {
+		return apiError(http.StatusNotFound, "security group "+id)
+	}
+	for _, server := range s.cloud.Servers {
+		for _, serverGroup := range server.SecurityGroups {
+			if serverGroup.Name == group.Name {
+				return apiError(http.StatusConflict, "security group "+id+" in use by server "+server.ID)
+			}
+		}
+	}
+	delete(s.cloud.SecurityGroups, id)
+	return nil
+}
+
+func (s *securityGroups) CreateRule(_ context.Context, opts ktcloud.CreateSecurityGroupRuleOpts) (*ktcloud.SecurityGroupRule, error) {
+	if err := s.authorize(); err != nil {
+		return nil, err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	group, ok := s.cloud.SecurityGroups[opts.SecurityGroupID]
+	if !ok {
+		return nil, apiError(http.StatusNotFound, "security group "+opts.SecurityGroupID)
+	}
+	rule := ktcloud.SecurityGroupRule{
+		ID:              s.cloud.newID("securitygrouprule"),
+		SecurityGroupID: opts.SecurityGroupID,
+		Description:     opts.Description,
+		Direction:       opts.Direction,
+		EtherType:       opts.EtherType,
+		Protocol:        opts.Protocol,
+		PortRangeMin:    opts.PortRangeMin,
+		PortRangeMax:    opts.PortRangeMax,
+		RemoteGroupID:   opts.RemoteGroupID,
+		RemoteIPPrefix:  opts.RemoteIPPrefix,
+	}
+	group.Rules = append(group.Rules, rule)
+	return &rule, nil
+}
+
+func (s *securityGroups) DeleteRule(_ context.Context, id string) error {
+	if err := s.authorize(); err != nil {
+		return err
+	}
+	s.cloud.mu.Lock()
+	defer s.cloud.mu.Unlock()
+
+	for _, group := range s.cloud.SecurityGroups {
+		i := slices.IndexFunc(group.Rules, func(rule ktcloud.SecurityGroupRule) bool { return rule.ID == id })
+		if i >= 0 {
+			group.Rules = slices.Delete(group.Rules, i, i+1)
+			return nil
+		}
+	}
+	return apiError(http.StatusNotFound, "security group rule "+id)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ktcloud
+
+import (
+	"context"
+	"net/http"
+)
+
+// FirewallService manages rules of the network (NC) firewall.
+type FirewallService interface {
+	// Create adds a rule and returns its ID.
+	Create(ctx context.Context, opts CreateFirewallRuleOpts) (string, error)
+	// List returns all rules in the zone.
+	List(ctx context.Context) ([]FirewallRule, error)
+	// Delete removes the rule with the given ID.
+	Delete(ctx context.Context, id string) error
+}
+
+type CreateFirewallRuleOpts struct {
+	StartPort    string `json:"startport"`
+	EndPort      string `json:"endport"`
+	Protocol     int    `json:"protocol"`
+	Action       int    `json:"action"`
+	VirtualIPID  string `json:"virtualipid,omitempty"`
+	SrcNetworkID string `json:"srcnetworkid"`
+	DstIP        string `json:"dstip,omitempty"`
+	DstNetworkID string `json:"dstnetworkid"`
+}
+
+type FirewallRule struct {
+	ID           string `json:"id"`
+	StartPort    string `json:"startport"`
+	EndPort      string `json:"endport"`
+	Protocol     int    `json:"protocol"`
+	Action       int    `json:"action"`
+	VirtualIPID  string `json:"virtualipid"`
+	SrcNetworkID string `json:"srcnetworkid"`
+	DstIP        string `json:"dstip"`
+	DstNetworkID string `json:"dstnetworkid"`
+	State        string `json:"state"`
+}
+
+type createFirewallRuleResponse struct {
+	NcCreateFirewallRuleResponse struct {
+		operationResponse
+		ID string `json:"id"`
+	} `json:"nc_createfirewallruleresponse"`
+}
+
+type listFirewallRulesResponse struct {
+	NcListFirewallRulesResponse struct {
+		FirewallRules []FirewallRule `json:"firewallrules"`
+	} `json:"nc_listfirewallrulesresponse"`
+}
+
+type deleteFirewallRuleResponse struct {
+	NcDeleteFirewallRuleResponse operationResponse `json:"nc_deletefirewallruleresponse"`
+}
+
+type firewallService struct {
+	client *client
+}
+
+func (s *firewallService) Create(ctx context.Context, opts CreateFirewallRuleOpts) (string, error) {
+	var response createFirewallRuleResponse
+	if _, err := s.client.do(ctx, http.MethodPost, []string{"nc", "Firewall"}, opts, &response); err != nil {
+		return "", err
+	}
+	if err := response.NcCreateFirewallRuleResponse.err("CreateFirewallRule"); err != nil {
+		return "", err
+	}
+	return response.NcCreateFirewallRuleResponse.ID, nil
+}
+
+func (s *firewallService) List(ctx context.Context) ([]FirewallRule, error) {
+	var response listFirewallRulesResponse
+	if _, err := s.client.do(ctx, http.MethodGet, []string{"nc", "Firewall"}, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.NcListFirewallRulesResponse.FirewallRules, nil
+}
+
+func (s *firewallService) Delete(ctx context.Context, id string) error {
+	var response deleteFirewallRuleResponse
+	if _, err := s.client.do(ctx, http.MethodDelete, []string{"nc", "Firewall", id}, nil, &response); err != nil {
+		return err
+	}
+	return response.NcDeleteFirewallRuleResponse.err("DeleteFirewallRule")
+}
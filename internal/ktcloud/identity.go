@@ -0,0 +1,130 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ktcloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"dcnlab.ssu.ac.kr/kt-cloud-operator/internal/cloudapi"
+)
+
+// IdentityService issues subject tokens.
+type IdentityService interface {
+	// Login authenticates with the given credentials and returns the issued token.
+	Login(ctx context.Context, credentials cloudapi.Credentials) (*Token, error)
+}
+
+// Token is a subject token issued by the identity API.
+type Token struct {
+	SubjectToken string
+	ExpiresAt    string
+	IsDomain     bool
+}
+
+// Structs for login
+type authRequest struct {
+	Auth auth `json:"auth"`
+}
+
+type auth struct {
+	Identity identity `json:"identity"`
+	Scope    scope    `json:"scope"`
+}
+
+type identity struct {
+	Methods  []string `json:"methods"`
+	Password password `json:"password"`
+}
+
+type password struct {
+	User user `json:"user"`
+}
+
+type user struct {
+	Domain   domain `json:"domain"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+type domain struct {
+	ID string `json:"id"`
+}
+
+type scope struct {
+	Project project `json:"project"`
+}
+
+type project struct {
+	Domain domain `json:"domain"`
+	Name   string `json:"name"`
+}
+
+type authResponse struct {
+	Token struct {
+		ExpiresAt string `json:"expires_at"`
+		IsDomain  bool   `json:"is_domain"`
+	} `json:"token"`
+}
+
+// end structs for login
+
+type identityService struct {
+	client *client
+}
+
+func (s *identityService) Login(ctx context.Context, credentials cloudapi.Credentials) (*Token, error) {
+	request := authRequest{
+		Auth: auth{
+			Identity: identity{
+				Methods: []string{"password"},
+				Password: password{
+					User: user{
+						Domain:   domain{ID: credentials.UserDomainId},
+						Name:     credentials.Username,
+						Password: credentials.Password,
+					},
+				},
+			},
+			Scope: scope{
+				Project: project{
+					Domain: domain{ID: credentials.ProjectDomainId},
+					Name:   credentials.ProjectName,
+				},
+			},
+		},
+	}
+
+	var response authResponse
+	resp, err := s.client.do(ctx, http.MethodPost, []string{"identity", "auth", "tokens"}, request, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	// the token itself is only returned in the response header
+	subjectToken := resp.Header.Get("X-Subject-Token")
+	if subjectToken == "" {
+		return nil, errors.New("KT Cloud identity response did not contain a X-Subject-Token header")
+	}
+
+	return &Token{
+		SubjectToken: subjectToken,
+		ExpiresAt:    response.Token.ExpiresAt,
+		IsDomain:     response.Token.IsDomain,
+	}, nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ktcloud
+
+import (
+	"context"
+	"net/http"
+)
+
+// IPAddressService manages enterprise public IP addresses.
+type IPAddressService interface {
+	// List returns all public IPs of the account in the zone.
+	List(ctx context.Context) ([]PublicIP, error)
+	// Allocate associates a new enterprise public IP with the account and returns its ID.
+	Allocate(ctx context.Context) (string, error)
+	// Release disassociates the public IP with the given ID from the account.
+	Release(ctx context.Context, id string) error
+}
+
+type PublicIP struct {
+	EntPublicCIDRId string      `json:"entpubliccidrid"`
+	VirtualIps      []VirtualIP `json:"virtualips"`
+	VPCId           string      `json:"vpcid"`
+	IP              string      `json:"ip"`
+	ZoneId          string      `json:"zoneid"`
+	Id              string      `json:"id"`
+	Type            string      `json:"type"`
+	Account         string      `json:"account"`
+}
+
+type VirtualIP struct {
+	VMGuestIP   string `json:"vmguestip"`
+	IPAddress   string `json:"ipaddress"`
+	VPCId       string `json:"vpcid"`
+	IPAddressId string `json:"ipaddressid"`
+	Name        string `json:"name"`
+	NetworkId   string `json:"networkid"`
+	Id          string `json:"id"`
+}
+
+// IsAvailable returns true if the IP is associated to the account but not
+// used by any static NAT or port forwarding yet.
+func (ip *PublicIP) IsAvailable() bool {
+	return len(ip.VirtualIps) == 0 && ip.Type == "ASSOCIATE"
+}
+
+type listPublicIPsResponse struct {
+	NcListentPublicIpsResponse struct {
+		PublicIps []PublicIP `json:"publicips"`
+	} `json:"nc_listentpublicipsresponse"`
+}
+
+type allocatePublicIPResponse struct {
+	NcAssociateEntPublicIpResponse struct {
+		operationResponse
+		ID string `json:"id"`
+	} `json:"nc_associateentpublicipresponse"`
+}
+
+type releasePublicIPResponse struct {
+	NcDisassociateEntPublicIpResponse operationResponse `json:"nc_disassociateentpublicipresponse"`
+}
+
+type ipAddressService struct {
+	client *client
+}
+
+func (s *ipAddressService) List(ctx context.Context) ([]PublicIP, error) {
+	var response listPublicIPsResponse
+	if _, err := s.client.do(ctx, http.MethodGet, []string{"nc", "IpAddress"}, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.NcListentPublicIpsResponse.PublicIps, nil
+}
+
+func (s *ipAddressService) Allocate(ctx context.Context) (string, error) {
+	var response allocatePublicIPResponse
+	if _, err := s.client.do(ctx, http.MethodPost, []string{"nc", "IpAddress"}, nil, &response); err != nil {
+		return "", err
+	}
+	if err := response.NcAssociateEntPublicIpResponse.err("AssociateEntPublicIp"); err != nil {
+		return "", err
+	}
+	return response.NcAssociateEntPublicIpResponse.ID, nil
+}
+
+func (s *ipAddressService) Release(ctx context.Context, id string) error {
+	var response releasePublicIPResponse
+	if _, err := s.client.do(ctx, http.MethodDelete, []string{"nc", "IpAddress", id}, nil, &response); err != nil {
+		return err
+	}
+	return response.NcDisassociateEntPublicIpResponse.err("DisassociateEntPublicIp")
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ktcloud
+
+import (
+	"context"
+	"net/http"
+)
+
+// LoadBalancerService manages load balancers and the servers they balance to.
+type LoadBalancerService interface {
+	// Create adds a load balancer and returns its ID.
+	Create(ctx context.Context, opts CreateLoadBalancerOpts) (string, error)
+	// List returns all load balancers in the zone.
+	List(ctx context.Context) ([]LoadBalancer, error)
+	// Delete removes the load balancer with the given ID.
+	Delete(ctx context.Context, id string) error
+	// AddServer registers a server with the load balancer and returns the ID of the registration.
+	AddServer(ctx context.Context, loadBalancerID string, opts AddLoadBalancerServerOpts) (string, error)
+	// ListServers returns the servers registered with the load balancer.
+	ListServers(ctx context.Context, loadBalancerID string) ([]LoadBalancerServer, error)
+	// RemoveServer deregisters the server registration with the given ID.
+	RemoveServer(ctx context.Context, loadBalancerID, id string) error
+}
+
+type CreateLoadBalancerOpts struct {
+	Name            string `json:"name"`
+	NetworkID       string `json:"networkid"`
+	ServicePort     string `json:"serviceport"`
+	ServiceType     string `json:"servicetype"`
+	Option          string `json:"loadbalanceroption"`
+	HealthCheckType string `json:"healthchecktype"`
+}
+
+type LoadBalancer struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	NetworkID       string `json:"networkid"`
+	ServiceIP       string `json:"serviceip"`
+	ServicePort     string `json:"serviceport"`
+	HealthCheckType string `json:"healthchecktype"`
+	State           string `json:"state"`
+}
+
+type AddLoadBalancerServerOpts struct {
+	VMID       string `json:"vmid"`
+	IPAddress  string `json:"ipaddress"`
+	PublicPort string `json:"publicport"`
+}
+
+type LoadBalancerServer struct {
+	ID         string `json:"serviceid"`
+	VMID       string `json:"vmid"`
+	IPAddress  string `json:"ipaddress"`
+	PublicPort string `json:"publicport"`
+	State      string `json:"state"`
+}
+
+type createLoadBalancerResponse struct {
+	NcCreateLoadBalancerResponse struct {
+		operationResponse
+		ID string `json:"id"`
+	} `json:"nc_createloadbalancerresponse"`
+}
+
+type listLoadBalancersResponse struct {
+	NcListLoadBalancersResponse struct {
+		LoadBalancers []LoadBalancer `json:"loadbalancers"`
+	} `json:"nc_listloadbalancersresponse"`
+}
+
+type deleteLoadBalancerResponse struct {
+	NcDeleteLoadBalancerResponse operationResponse `json:"nc_deleteloadbalancerresponse"`
+}
+
+type addLoadBalancerServerResponse struct {
+	NcAddLoadBalancerWebServerResponse struct {
+		operationResponse
+		ID string `json:"serviceid"`
+	} `json:"nc_addloadbalancerwebserverresponse"`
+}
+
+type listLoadBalancerServersResponse struct {
+	NcListLoadBalancerWebServersResponse struct {
+		Servers []LoadBalancerServer `json:"loadbalancerwebservers"`
+	} `json:"nc_listloadbalancerwebserversresponse"`
+}
+
+type removeLoadBalancerServerResponse struct {
+	NcRemoveLoadBalancerWebServerResponse operationResponse `json:"nc_removeloadbalancerwebserverresponse"`
+}
+
+type loadBalancerService struct {
+	client *client
+}
+
+func (s *loadBalancerService) Create(ctx context.Context, opts CreateLoadBalancerOpts) (string, error) {
+	var response createLoadBalancerResponse
+	if _, err := s.client.do(ctx, http.MethodPost, []string{"nc", "LoadBalancer"}, opts, &response); err != nil {
+		return "", err
+	}
+	if err := response.NcCreateLoadBalancerResponse.err("CreateLoadBalancer"); err != nil {
+		return "", err
+	}
+	return response.NcCreateLoadBalancerResponse.ID, nil
+}
+
+func (s *loadBalancerService) List(ctx context.Context) ([]LoadBalancer, error) {
+	var response listLoadBalancersResponse
+	if _, err := s.client.do(ctx, http.MethodGet, []string{"nc", "LoadBalancer"}, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.NcListLoadBalancersResponse.LoadBalancers, nil
+}
+
+func (s *loadBalancerService) Delete(ctx context.Context, id string) error {
+	var response deleteLoadBalancerResponse
+	if _, err := s.client.do(ctx, http.MethodDelete, []string{"nc", "LoadBalancer", id}, nil, &response); err != nil {
+		return err
+	}
+	return response.NcDeleteLoadBalancerResponse.err("DeleteLoadBalancer")
+}
+
+func (s *loadBalancerService) AddServer(ctx context.Context, loadBalancerID string, opts AddLoadBalancerServerOpts) (string, error) {
+	var response addLoadBalancerServerResponse
+	if _, err := s.client.do(ctx, http.MethodPost, []string{"nc", "LoadBalancer", loadBalancerID, "WebServer"}, opts, &response); err != nil {
+		return "", err
+	}
+	if err := response.NcAddLoadBalancerWebServerResponse.err("AddLoadBalancerWebServer"); err != nil {
+		return "", err
+	}
+	return response.NcAddLoadBalancerWebServerResponse.ID, nil
+}
+
+func (s *loadBalancerService) ListServers(ctx context.Context, loadBalancerID string) ([]LoadBalancerServer, error) {
+	var response listLoadBalancerServersResponse
+	if _, err := s.client.do(ctx, http.MethodGet, []string{"nc", "LoadBalancer", loadBalancerID, "WebServer"}, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.NcListLoadBalancerWebServersResponse.Servers, nil
+}
+
+func (s *loadBalancerService) RemoveServer(ctx context.Context, loadBalancerID, id string) error {
+	var response removeLoadBalancerServerResponse
+	if _, err := s.client.do(ctx, http.MethodDelete, []string{"nc", "LoadBalancer", loadBalancerID, "WebServer", id}, nil, &response); err != nil {
+		return err
+	}
+	return response.NcRemoveLoadBalancerWebServerResponse.err("RemoveLoadBalancerWebServer")
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ktcloud
+
+import (
+	"context"
+	"net/http"
+)
+
+// NetworkService manages the tier networks of the VPC.
+type NetworkService interface {
+	// Create adds a tier network and returns its ID.
+	Create(ctx context.Context, opts CreateNetworkOpts) (string, error)
+	// List returns all networks of the VPC in the zone.
+	List(ctx context.Context) ([]Network, error)
+	// Delete removes the network with the given ID.
+	Delete(ctx context.Context, id string) error
+}
+
+type CreateNetworkOpts struct {
+	Name           string   `json:"name"`
+	CIDR           string   `json:"cidr"`
+	Type           string   `json:"type"`
+	DNSNameServers []string `json:"dnsnameservers,omitempty"`
+}
+
+type Network struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	CIDR           string   `json:"cidr"`
+	Type           string   `json:"type"`
+	Gateway        string   `json:"gateway"`
+	DNSNameServers []string `json:"dnsnameservers"`
+}
+
+type createNetworkResponse struct {
+	NcCreateNetworkResponse struct {
+		operationResponse
+		ID string `json:"id"`
+	} `json:"nc_createnetworkresponse"`
+}
+
+type listNetworksResponse struct {
+	NcListNetworksResponse struct {
+		Networks []Network `json:"networks"`
+	} `json:"nc_listnetworksresponse"`
+}
+
+type deleteNetworkResponse struct {
+	NcDeleteNetworkResponse operationResponse `json:"nc_deletenetworkresponse"`
+}
+
+type networkService struct {
+	client *client
+}
+
+func (s *networkService) Create(ctx context.Context, opts CreateNetworkOpts) (string, error) {
+	var response createNetworkResponse
+	if _, err := s.client.do(ctx, http.MethodPost, []string{"nc", "Network"}, opts, &response); err != nil {
+		return "", err
+	}
+	if err := response.NcCreateNetworkResponse.err("CreateNetwork"); err != nil {
+		return "", err
+	}
+	return response.NcCreateNetworkResponse.ID, nil
+}
+
+func (s *networkService) List(ctx context.Context) ([]Network, error) {
+	var response listNetworksResponse
+	if _, err := s.client.do(ctx, http.MethodGet, []string{"nc", "Network"}, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.NcListNetworksResponse.Networks, nil
+}
+
+func (s *networkService) Delete(ctx context.Context, id string) error {
+	var response deleteNetworkResponse
+	if _, err := s.client.do(ctx, http.MethodDelete, []string{"nc", "Network", id}, nil, &response); err != nil {
+		return err
+	}
+	return response.NcDeleteNetworkResponse.err("DeleteNetwork")
+}
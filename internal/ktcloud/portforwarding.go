@@ -0,0 +1,102 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ktcloud
+
+import (
+	"context"
+	"net/http"
+)
+
+// PortForwardingService forwards ports of a public IP to servers, so several servers can share it.
+type PortForwardingService interface {
+	// Create adds a rule and returns its ID.
+	Create(ctx context.Context, opts CreatePortForwardingRuleOpts) (string, error)
+	// List returns all rules in the zone.
+	List(ctx context.Context) ([]PortForwardingRule, error)
+	// Delete removes the rule with the given ID.
+	Delete(ctx context.Context, id string) error
+}
+
+type CreatePortForwardingRuleOpts struct {
+	VMGuestIP     string `json:"vmguestip"`
+	VMNetworkId   string `json:"vmnetworkid"`
+	EntPublicIPId string `json:"entpublicipid"`
+	PublicPort    string `json:"publicport"`
+	PrivatePort   string `json:"privateport"`
+	Protocol      string `json:"protocol"`
+}
+
+// PortForwardingRule is listed on its public IP as a virtual IP with the ID VirtualIPId.
+type PortForwardingRule struct {
+	ID          string `json:"id"`
+	VirtualIPId string `json:"virtualipid"`
+	IPAddressId string `json:"ipaddressid"`
+	IPAddress   string `json:"ipaddress"`
+	VMGuestIP   string `json:"vmguestip"`
+	VMNetworkId string `json:"vmnetworkid"`
+	PublicPort  string `json:"publicport"`
+	PrivatePort string `json:"privateport"`
+	Protocol    string `json:"protocol"`
+}
+
+type createPortForwardingRuleResponse struct {
+	NcCreatePortForwardingRuleResponse struct {
+		operationResponse
+		ID string `json:"id"`
+	} `json:"nc_createportforwardingruleresponse"`
+}
+
+type listPortForwardingRulesResponse struct {
+	NcListPortForwardingRulesResponse struct {
+		PortForwardingRules []PortForwardingRule `json:"portforwardingrules"`
+	} `json:"nc_listportforwardingrulesresponse"`
+}
+
+type deletePortForwardingRuleResponse struct {
+	NcDeletePortForwardingRuleResponse operationResponse `json:"nc_deleteportforwardingruleresponse"`
+}
+
+type portForwardingService struct {
+	client *client
+}
+
+func (s *portForwardingService) Create(ctx context.Context, opts CreatePortForwardingRuleOpts) (string, error) {
+	var response createPortForwardingRuleResponse
+	if _, err := s.client.do(ctx, http.MethodPost, []string{"nc", "PortForwarding"}, opts, &response); err != nil {
+		return "", err
+	}
+	if err := response.NcCreatePortForwardingRuleResponse.err("CreatePortForwardingRule"); err != nil {
+		return "", err
+	}
+	return response.NcCreatePortForwardingRuleResponse.ID, nil
+}
+
+func (s *portForwardingService) List(ctx context.Context) ([]PortForwardingRule, error) {
+	var response listPortForwardingRulesResponse
+	if _, err := s.client.do(ctx, http.MethodGet, []string{"nc", "PortForwarding"}, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.NcListPortForwardingRulesResponse.PortForwardingRules, nil
+}
+
+func (s *portForwardingService) Delete(ctx context.Context, id string) error {
+	var response deletePortForwardingRuleResponse
+	if _, err := s.client.do(ctx, http.MethodDelete, []string{"nc", "PortForwarding", id}, nil, &response); err != nil {
+		return err
+	}
+	return response.NcDeletePortForwardingRuleResponse.err("DeletePortForwardingRule")
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ktcloud
+
+import (
+	"context"
+	"net/http"
+)
+
+// SecurityGroupService manages security groups and their rules.
+type SecurityGroupService interface {
+	// Create adds a security group without rules besides the egress rules the API adds itself.
+	Create(ctx context.Context, opts CreateSecurityGroupOpts) (*SecurityGroup, error)
+	// List returns all security groups of the project with their rules.
+	List(ctx context.Context) ([]SecurityGroup, error)
+	// Delete removes the security group with the given ID.
+	Delete(ctx context.Context, id string) error
+	// CreateRule adds a rule to a security group.
+	CreateRule(ctx context.Context, opts CreateSecurityGroupRuleOpts) (*SecurityGroupRule, error)
+	// DeleteRule removes the security group rule with the given ID.
+	DeleteRule(ctx context.Context, id string) error
+}
+
+type CreateSecurityGroupOpts struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// CreateSecurityGroupRuleOpts describes a rule, ports and remotes left empty match any.
+type CreateSecurityGroupRuleOpts struct {
+	SecurityGroupID string `json:"security_group_id"`
+	Description     string `json:"description,omitempty"`
+	Direction       string `json:"direction"`
+	EtherType       string `json:"ethertype,omitempty"`
+	Protocol        string `json:"protocol,omitempty"`
+	PortRangeMin    int    `json:"port_range_min,omitempty"`
+	PortRangeMax    int    `json:"port_range_max,omitempty"`
+	RemoteGroupID   string `json:"remote_group_id,omitempty"`
+	RemoteIPPrefix  string `json:"remote_ip_prefix,omitempty"`
+}
+
+type SecurityGroupRule struct {
+	ID              string `json:"id"`
+	SecurityGroupID string `json:"security_group_id"`
+	Description     string `json:"description,omitempty"`
+	Direction       string `json:"direction"`
+	EtherType       string `json:"ethertype,omitempty"`
+	Protocol        string `json:"protocol,omitempty"`
+	PortRangeMin    int    `json:"port_range_min,omitempty"`
+	PortRangeMax    int    `json:"port_range_max,omitempty"`
+	RemoteGroupID   string `json:"remote_group_id,omitempty"`
+	RemoteIPPrefix  string `json:"remote_ip_prefix,omitempty"`
+}
+
+type securityGroupRequest struct {
+	SecurityGroup CreateSecurityGroupOpts `json:"security_group"`
+}
+
+type securityGroupResponse struct {
+	SecurityGroup SecurityGroup `json:"security_group"`
+}
+
+type listSecurityGroupsResponse struct {
+	SecurityGroups []SecurityGroup `json:"security_groups"`
+}
+
+type securityGroupRuleRequest struct {
+	SecurityGroupRule CreateSecurityGroupRuleOpts `json:"security_group_rule"`
+}
+
+type securityGroupRuleResponse struct {
+	SecurityGroupRule SecurityGroupRule `json:"security_group_rule"`
+}
+
+type securityGroupService struct {
+	client *client
+}
+
+func (s *securityGroupService) Create(ctx context.Context, opts CreateSecurityGroupOpts) (*SecurityGroup, error) {
+	var response securityGroupResponse
+	if _, err := s.client.do(ctx, http.MethodPost, []string{"network", "security-groups"}, securityGroupRequest{SecurityGroup: opts}, &response); err != nil {
+		return nil, err
+	}
+	return &response.SecurityGroup, nil
+}
+
+func (s *securityGroupService) List(ctx context.Context) ([]SecurityGroup, error) {
+	var response listSecurityGroupsResponse
+	if _, err := s.client.do(ctx, http.MethodGet, []string{"network", "security-groups"}, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.SecurityGroups, nil
+}
+
+func (s *securityGroupService) Delete(ctx context.Context, id string) error {
+	_, err := s.client.do(ctx, http.MethodDelete, []string{"network", "security-groups", id}, nil, nil)
+	return err
+}
+
+func (s *securityGroupService) CreateRule(ctx context.Context, opts CreateSecurityGroupRuleOpts) (*SecurityGroupRule, error) {
+	var response securityGroupRuleResponse
+	if _, err := s.client.do(ctx, http.MethodPost, []string{"network", "security-group-rules"}, securityGroupRuleRequest{SecurityGroupRule: opts}, &response); err != nil {
+		return nil, err
+	}
+	return &response.SecurityGroupRule, nil
+}
+
+func (s *securityGroupService) DeleteRule(ctx context.Context, id string) error {
+	_, err := s.client.do(ctx, http.MethodDelete, []string{"network", "security-group-rules", id}, nil, nil)
+	return err
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ktcloud
+
+import (
+	"context"
+	"net/http"
+	"sort"
+)
+
+// ServerService manages virtual machines.
+type ServerService interface {
+	// Create requests a new server, the returned server is still building.
+	Create(ctx context.Context, opts CreateServerOpts) (*Server, error)
+	// Get returns the server with the given ID, or an error satisfying IsNotFound.
+	Get(ctx context.Context, id string) (*Server, error)
+	// List returns the servers of the project with their details.
+	List(ctx context.Context) ([]Server, error)
+	// Delete requests the deletion of the server, which is gone once Get returns an error satisfying IsNotFound.
+	Delete(ctx context.Context, id string) error
+	// SetMetadata adds the given key/value pairs to the metadata of the server, keeping its other metadata.
+	SetMetadata(ctx context.Context, id string, metadata map[string]string) error
+	// ListAvailabilityZones returns the availability zones servers can be created in.
+	ListAvailabilityZones(ctx context.Context) ([]AvailabilityZone, error)
+}
+
+// CreateServerOpts describes the server to create.
+type CreateServerOpts struct {
+	Name                 string                 `json:"name"`
+	KeyName              string                 `json:"key_name"`
+	FlavorRef            string                 `json:"flavorRef"`
+	AvailabilityZone     string                 `json:"availability_zone"`
+	Networks             []ServerNetwork        `json:"networks"`
+	BlockDeviceMappingV2 []BlockDeviceMappingV2 `json:"block_device_mapping_v2"`
+	// SecurityGroups are attached by name, the default group of the project is used without any
+	SecurityGroups []SecurityGroup `json:"security_groups,omitempty"`
+	// UserData is the base64 encoded cloud-init user data
+	UserData string `json:"user_data"`
+	// Metadata are key/value pairs stored with the server and returned by Get and List
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// ServerNetwork attaches a server to a tier network.
+type ServerNetwork struct {
+	UUID string `json:"uuid"`
+}
+
+type BlockDeviceMappingV2 struct {
+	DestinationType string `json:"destination_type"`
+	BootIndex       int    `json:"boot_index"`
+	SourceType      string `json:"source_type"`
+	VolumeSize      int    `json:"volume_size"`
+	UUID            string `json:"uuid"`
+}
+
+// Server is a virtual machine as returned by the server API.
+type Server struct {
+	ID                string                     `json:"id"`
+	Name              string                     `json:"name,omitempty"`
+	Status            string                     `json:"status,omitempty"`
+	AdminPass         string                     `json:"adminPass,omitempty"`
+	Links             []Link                     `json:"links,omitempty"`
+	SecurityGroups    []SecurityGroup            `json:"security_groups,omitempty"`
+	TenantID          string                     `json:"tenant_id,omitempty"`
+	UserID            string                     `json:"user_id,omitempty"`
+	Addresses         map[string][]ServerAddress `json:"addresses,omitempty"`
+	TaskState         *string                    `json:"OS-EXT-STS:task_state,omitempty"`
+	VMState           string                     `json:"OS-EXT-STS:vm_state,omitempty"`
+	PowerState        int                        `json:"OS-EXT-STS:power_state,omitempty"`
+	Description       *string                    `json:"description,omitempty"`
+	DiskConfig        string                     `json:"OS-DCF:diskConfig,omitempty"`
+	TrustedImageCerts *string                    `json:"trusted_image_certificates,omitempty"`
+	AvailabilityZone  string                     `json:"OS-EXT-AZ:availability_zone,omitempty"`
+	VolumesAttached   []VolumeAttached           `json:"os-extended-volumes:volumes_attached,omitempty"`
+	Locked            bool                       `json:"locked,omitempty"`
+	Image             string                     `json:"image,omitempty"`
+	AccessIPv4        string                     `json:"accessIPv4,omitempty"`
+	AccessIPv6        string                     `json:"accessIPv6,omitempty"`
+	Created           string                     `json:"created,omitempty"`
+	Updated           string                     `json:"updated,omitempty"`
+	HostID            string                     `json:"hostId,omitempty"`
+	Tags              []string                   `json:"tags,omitempty"`
+	Metadata          map[string]string          `json:"metadata,omitempty"`
+	Flavor            ServerFlavor               `json:"flavor,omitempty"`
+	KeyName           string                     `json:"key_name,omitempty"`
+	Progress          int                        `json:"progress,omitempty"`
+	LaunchedAt        string                     `json:"OS-SRV-USG:launched_at,omitempty"`
+	TerminatedAt      *string                    `json:"OS-SRV-USG:terminated_at,omitempty"`
+	ConfigDrive       string                     `json:"config_drive,omitempty"`
+}
+
+type Link struct {
+	Rel  string `json:"rel,omitempty"`
+	Href string `json:"href,omitempty"`
+}
+
+// SecurityGroup is a security group as returned by the security group API. Servers only
+// report the names of their security groups.
+type SecurityGroup struct {
+	ID          string              `json:"id,omitempty"`
+	Name        string              `json:"name,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Rules       []SecurityGroupRule `json:"security_group_rules,omitempty"`
+}
+
+type ServerAddress struct {
+	MACAddr string `json:"OS-EXT-IPS-MAC:mac_addr,omitempty"`
+	Type    string `json:"OS-EXT-IPS:type,omitempty"`
+	Addr    string `json:"addr,omitempty"`
+	Version int    `json:"version,omitempty"`
+}
+
+type VolumeAttached struct {
+	DeleteOnTermination bool   `json:"delete_on_termination,omitempty"`
+	ID                  string `json:"id,omitempty"`
+}
+
+type ServerFlavor struct {
+	Disk       int               `json:"disk,omitempty"`
+	Swap       int               `json:"swap,omitempty"`
+	Original   string            `json:"original_name,omitempty"`
+	ExtraSpecs map[string]string `json:"extra_specs,omitempty"`
+	Ephemeral  int               `json:"ephemeral,omitempty"`
+	VCPUs      int               `json:"vcpus,omitempty"`
+	RAM        int               `json:"ram,omitempty"`
+}
+
+// PrivateAddresses returns the addresses of the server on all of its networks,
+// ordered by network name so the first address is stable across calls.
+func (s *Server) PrivateAddresses() []string {
+	networks := make([]string, 0, len(s.Addresses))
+	for network := range s.Addresses {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+
+	var addresses []string
+	for _, network := range networks {
+		for _, address := range s.Addresses[network] {
+			addresses = append(addresses, address.Addr)
+		}
+	}
+	return addresses
+}
+
+// AvailabilityZone is an availability zone servers can be created in.
+type AvailabilityZone struct {
+	Name  string `json:"zoneName"`
+	State struct {
+		Available bool `json:"available"`
+	} `json:"zoneState"`
+}
+
+type serverRequest struct {
+	Server CreateServerOpts `json:"server"`
+}
+
+type serverResponse struct {
+	Server Server `json:"server"`
+}
+
+type listServersResponse struct {
+	Servers []Server `json:"servers"`
+}
+
+type serverMetadataRequest struct {
+	Metadata map[string]string `json:"metadata"`
+}
+
+type availabilityZonesResponse struct {
+	AvailabilityZones []AvailabilityZone `json:"availabilityZoneInfo"`
+}
+
+type serverService struct {
+	client *client
+}
+
+func (s *serverService) Create(ctx context.Context, opts CreateServerOpts) (*Server, error) {
+	var response serverResponse
+	if _, err := s.client.do(ctx, http.MethodPost, []string{"server", "servers"}, serverRequest{Server: opts}, &response); err != nil {
+		return nil, err
+	}
+	return &response.Server, nil
+}
+
+func (s *serverService) Get(ctx context.Context, id string) (*Server, error) {
+	var response serverResponse
+	if _, err := s.client.do(ctx, http.MethodGet, []string{"server", "servers", id}, nil, &response); err != nil {
+		return nil, err
+	}
+	return &response.Server, nil
+}
+
+func (s *serverService) List(ctx context.Context) ([]Server, error) {
+	var response listServersResponse
+	if _, err := s.client.do(ctx, http.MethodGet, []string{"server", "servers", "detail"}, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Servers, nil
+}
+
+func (s *serverService) Delete(ctx context.Context, id string) error {
+	_, err := s.client.do(ctx, http.MethodDelete, []string{"server", "servers", id}, nil, nil)
+	return err
+}
+
+func (s *serverService) SetMetadata(ctx context.Context, id string, metadata map[string]string) error {
+	_, err := s.client.do(ctx, http.MethodPost, []string{"server", "servers", id, "metadata"}, serverMetadataRequest{Metadata: metadata}, nil)
+	return err
+}
+
+func (s *serverService) ListAvailabilityZones(ctx context.Context) ([]AvailabilityZone, error) {
+	var response availabilityZonesResponse
+	if _, err := s.client.do(ctx, http.MethodGet, []string{"server", "os-availability-zone"}, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.AvailabilityZones, nil
+}
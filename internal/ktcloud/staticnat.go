@@ -0,0 +1,78 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ktcloud
+
+import (
+	"context"
+	"net/http"
+)
+
+// StaticNATService binds public IPs 1:1 to servers.
+type StaticNATService interface {
+	// Enable binds the public IP to the guest IP of a server.
+	Enable(ctx context.Context, opts EnableStaticNATOpts) error
+	// Disable removes the static NAT with the given ID, which is the ID of
+	// the virtual IP listed on the public IP.
+	Disable(ctx context.Context, id string) error
+}
+
+type EnableStaticNATOpts struct {
+	VMGuestIP     string `json:"vmguestip"`
+	VMNetworkId   string `json:"vmnetworkid"`
+	EntPublicIPId string `json:"entpublicipid"`
+}
+
+type enableStaticNATResponse struct {
+	NcEnableStaticNatResponse operationResponse `json:"nc_enablestaticnatresponse"`
+}
+
+type disableStaticNATResponse struct {
+	NcDisableStaticNatResponse operationResponse `json:"nc_disablestaticnatresponse"`
+}
+
+// operationResponse is the body nc APIs answer mutations with
+type operationResponse struct {
+	DisplayText string `json:"displaytext"`
+	Success     bool   `json:"success"`
+}
+
+func (r operationResponse) err(operation string) error {
+	if r.Success {
+		return nil
+	}
+	return &OperationError{Operation: operation, DisplayText: r.DisplayText}
+}
+
+type staticNATService struct {
+	client *client
+}
+
+func (s *staticNATService) Enable(ctx context.Context, opts EnableStaticNATOpts) error {
+	var response enableStaticNATResponse
+	if _, err := s.client.do(ctx, http.MethodPost, []string{"nc", "StaticNat"}, opts, &response); err != nil {
+		return err
+	}
+	return response.NcEnableStaticNatResponse.err("EnableStaticNat")
+}
+
+func (s *staticNATService) Disable(ctx context.Context, id string) error {
+	var response disableStaticNATResponse
+	if _, err := s.client.do(ctx, http.MethodDelete, []string{"nc", "StaticNat", id}, nil, &response); err != nil {
+		return err
+	}
+	return response.NcDisableStaticNatResponse.err("DisableStaticNat")
+}
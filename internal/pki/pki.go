@@ -0,0 +1,190 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package pki generates the certificate authorities, keys and bootstrap tokens of a workload
+// cluster so they never have to leave the control plane machines over the network.
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	// rsaKeySize is the size of all generated RSA keys
+	rsaKeySize = 2048
+
+	// caValidity is how long the generated certificate authorities are valid
+	caValidity = 10 * 365 * 24 * time.Hour
+
+	// clockSkew backdates certificates so they are valid on machines with a slightly late clock
+	clockSkew = 5 * time.Minute
+)
+
+// KeyPair is a PEM encoded certificate, or public key, and its private key.
+type KeyPair struct {
+	Cert []byte
+	Key  []byte
+}
+
+// NewCertificateAuthority returns a self-signed certificate authority.
+func NewCertificateAuthority(commonName string) (*KeyPair, error) {
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key for %s: %w", commonName, err)
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate for %s: %w", commonName, err)
+	}
+	return &KeyPair{Cert: encodeCertificate(der), Key: encodePrivateKey(key)}, nil
+}
+
+// NewServiceAccountKeyPair returns the key pair the API server signs service account tokens with.
+// Cert holds the PEM encoded public key.
+func NewServiceAccountKeyPair() (*KeyPair, error) {
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate service account key: %w", err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode service account public key: %w", err)
+	}
+	return &KeyPair{
+		Cert: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}),
+		Key:  encodePrivateKey(key),
+	}, nil
+}
+
+// NewClientCertificate returns a client certificate signed by the certificate authority.
+func (ca *KeyPair) NewClientCertificate(commonName string, organizations []string, validity time.Duration) (*KeyPair, error) {
+	caCert, caKey, err := ca.parse()
+	if err != nil {
+		return nil, err
+	}
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key for %s: %w", commonName, err)
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: organizations},
+		NotBefore:    now.Add(-clockSkew),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, key.Public(), caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate for %s: %w", commonName, err)
+	}
+	return &KeyPair{Cert: encodeCertificate(der), Key: encodePrivateKey(key)}, nil
+}
+
+// CertificateHash returns the hash of the public key of the certificate in the
+// sha256:<hex> format of kubeadm's discovery-token-ca-cert-hash.
+func CertificateHash(certPEM []byte) (string, error) {
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// CertificateNotAfter returns when the certificate expires.
+func CertificateNotAfter(certPEM []byte) (time.Time, error) {
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
+
+func (ca *KeyPair) parse() (*x509.Certificate, *rsa.PrivateKey, error) {
+	cert, err := parseCertificate(ca.Cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(ca.Key)
+	if block == nil {
+		return nil, nil, errors.New("private key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return cert, key, nil
+}
+
+func parseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, errors.New("certificate is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return cert, nil
+}
+
+func newSerialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+func encodeCertificate(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func encodePrivateKey(key *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PKI", func() {
+	parse := func(certPEM []byte) *x509.Certificate {
+		block, _ := pem.Decode(certPEM)
+		Expect(block).NotTo(BeNil())
+		cert, err := x509.ParseCertificate(block.Bytes)
+		Expect(err).NotTo(HaveOccurred())
+		return cert
+	}
+
+	It("should generate a certificate authority that signs client certificates", func() {
+		ca, err := NewCertificateAuthority("kubernetes")
+		Expect(err).NotTo(HaveOccurred())
+		caCert := parse(ca.Cert)
+		Expect(caCert.IsCA).To(BeTrue())
+		Expect(caCert.Subject.CommonName).To(Equal("kubernetes"))
+
+		client, err := ca.NewClientCertificate("kubernetes-admin", []string{"system:masters"}, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		clientCert := parse(client.Cert)
+		Expect(clientCert.Subject.Organization).To(ConsistOf("system:masters"))
+		Expect(clientCert.CheckSignatureFrom(caCert)).To(Succeed())
+		Expect(clientCert.NotAfter).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+	})
+
+	It("should hash the public key of a certificate like kubeadm", func() {
+		ca, err := NewCertificateAuthority("kubernetes")
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := CertificateHash(ca.Cert)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).To(MatchRegexp(`^sha256:[0-9a-f]{64}$`))
+
+		_, err = CertificateHash([]byte("not a certificate"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should generate a service account key pair", func() {
+		sa, err := NewServiceAccountKeyPair()
+		Expect(err).NotTo(HaveOccurred())
+		block, _ := pem.Decode(sa.Cert)
+		Expect(block.Type).To(Equal("PUBLIC KEY"))
+		_, err = x509.ParsePKIXPublicKey(block.Bytes)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should generate bootstrap tokens that expire", func() {
+		token, err := NewBootstrapToken()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.String()).To(MatchRegexp(`^[a-z0-9]{6}\.[a-z0-9]{16}$`))
+
+		expiration := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		secret := BootstrapTokenSecret(token, expiration)
+		Expect(secret.Name).To(Equal("bootstrap-token-" + token.ID))
+		Expect(secret.Namespace).To(Equal("kube-system"))
+		Expect(secret.Type).To(Equal(BootstrapTokenSecretType))
+		Expect(secret.StringData).To(HaveKeyWithValue("token-secret", token.Secret))
+		Expect(secret.StringData).To(HaveKeyWithValue("expiration", "2024-05-01T12:00:00Z"))
+	})
+})
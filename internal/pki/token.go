@@ -0,0 +1,93 @@
+/*
+Copyright 2024 DCN
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// tokenCharset is the character set of bootstrap token IDs and secrets
+	tokenCharset = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+	// BootstrapTokenSecretType is the type of the secrets bootstrap tokens are stored in.
+	BootstrapTokenSecretType corev1.SecretType = "bootstrap.kubernetes.io/token"
+
+	// bootstrapTokenGroup allows kubeadm join to use the token
+	bootstrapTokenGroup = "system:bootstrappers:kubeadm:default-node-token"
+)
+
+// BootstrapToken is a kubeadm bootstrap token in the <id>.<secret> format.
+type BootstrapToken struct {
+	ID     string
+	Secret string
+}
+
+// NewBootstrapToken returns a random bootstrap token.
+func NewBootstrapToken() (BootstrapToken, error) {
+	id, err := randomString(6)
+	if err != nil {
+		return BootstrapToken{}, err
+	}
+	secret, err := randomString(16)
+	if err != nil {
+		return BootstrapToken{}, err
+	}
+	return BootstrapToken{ID: id, Secret: secret}, nil
+}
+
+func (t BootstrapToken) String() string {
+	return t.ID + "." + t.Secret
+}
+
+// BootstrapTokenSecret returns the kube-system secret that makes the token valid in the workload
+// cluster until it expires.
+func BootstrapTokenSecret(t BootstrapToken, expiration time.Time) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "bootstrap-token-" + t.ID,
+			Namespace: metav1.NamespaceSystem,
+		},
+		Type: BootstrapTokenSecretType,
+		StringData: map[string]string{
+			"token-id":                       t.ID,
+			"token-secret":                   t.Secret,
+			"expiration":                     expiration.UTC().Format(time.RFC3339),
+			"usage-bootstrap-authentication": "true",
+			"usage-bootstrap-signing":        "true",
+			"auth-extra-groups":              bootstrapTokenGroup,
+		},
+	}
+}
+
+func randomString(length int) (string, error) {
+	out := make([]byte, length)
+	for i := range out {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(tokenCharset))))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate bootstrap token: %w", err)
+		}
+		out[i] = tokenCharset[n.Int64()]
+	}
+	return string(out), nil
+}